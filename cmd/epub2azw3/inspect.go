@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/yuanying/epub2azw3/internal/mobi"
+)
+
+// inspectReport is the structure of an AZW3/MOBI file printed by the inspect command.
+type inspectReport struct {
+	File     string          `json:"file"`
+	Size     int             `json:"size"`
+	PDB      pdbReport       `json:"pdb"`
+	Records  []recordReport  `json:"records"`
+	Sections []sectionReport `json:"sections"`
+}
+
+type pdbReport struct {
+	Name               string    `json:"name"`
+	Attributes         uint16    `json:"attributes"`
+	Version            uint16    `json:"version"`
+	CreationDate       time.Time `json:"creationDate"`
+	ModificationDate   time.Time `json:"modificationDate"`
+	BackupDate         uint32    `json:"backupDate"`
+	ModificationNumber uint32    `json:"modificationNumber"`
+	Type               string    `json:"type"`
+	Creator            string    `json:"creator"`
+	UniqueSeed         uint32    `json:"uniqueSeed"`
+	NumRecords         uint16    `json:"numRecords"`
+}
+
+type recordReport struct {
+	Index  int    `json:"index"`
+	Offset uint32 `json:"offset"`
+	Size   int    `json:"size"`
+	Type   string `json:"type"`
+}
+
+type sectionReport struct {
+	Kind       string           `json:"kind"`
+	Record0    int              `json:"record0"`
+	FullName   string           `json:"fullName"`
+	MOBIHeader mobiHeaderReport `json:"mobiHeader"`
+	EXTH       []exthReport     `json:"exth"`
+	FDST       []flowReport     `json:"fdst,omitempty"`
+	NCX        []ncxReport      `json:"ncx,omitempty"`
+	RESC       *rescReport      `json:"resc,omitempty"`
+	Errors     []string         `json:"errors,omitempty"`
+}
+
+type mobiHeaderReport struct {
+	MOBIType             uint32 `json:"mobiType"`
+	FileVersion          uint32 `json:"fileVersion"`
+	Compression          uint16 `json:"compression"`
+	Encryption           uint16 `json:"encryption"`
+	Encoding             uint32 `json:"encoding"`
+	TextLength           uint32 `json:"textLength"`
+	TextRecordCount      uint16 `json:"textRecordCount"`
+	UniqueID             uint32 `json:"uniqueID"`
+	LanguageCode         uint32 `json:"languageCode"`
+	FirstContentRecord   uint16 `json:"firstContentRecord"`
+	LastContentRecord    uint16 `json:"lastContentRecord"`
+	FirstImageIndex      uint32 `json:"firstImageIndex"`
+	FCISRecordNumber     uint32 `json:"fcisRecordNumber"`
+	FLISRecordNumber     uint32 `json:"flisRecordNumber"`
+	ExtraRecordDataFlags uint32 `json:"extraRecordDataFlags"`
+	NCXIndex             uint32 `json:"ncxIndex"`
+	FragmentIndex        uint32 `json:"fragmentIndex"`
+	SkeletonIndex        uint32 `json:"skeletonIndex"`
+	GuideIndex           uint32 `json:"guideIndex"`
+	RESCIndex            uint32 `json:"rescIndex"`
+	FDSTFlowCount        uint32 `json:"fdstFlowCount"`
+	FDSTOffset           uint32 `json:"fdstOffset"`
+}
+
+type exthReport struct {
+	Type  uint32 `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type flowReport struct {
+	Index int    `json:"index"`
+	Start uint32 `json:"start"`
+	End   uint32 `json:"end"`
+}
+
+type rescReport struct {
+	PageProgressionDirection string           `json:"pageProgressionDirection,omitempty"`
+	Spine                    []rescItemReport `json:"spine"`
+}
+
+type rescItemReport struct {
+	IDRef      string   `json:"idref"`
+	SkeletonID int      `json:"skeletonID"`
+	Linear     bool     `json:"linear"`
+	Properties []string `json:"properties,omitempty"`
+}
+
+type ncxReport struct {
+	Label    string      `json:"label"`
+	FilePos  uint32      `json:"filePos"`
+	Children []ncxReport `json:"children,omitempty"`
+}
+
+func newInspectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect <file.azw3>",
+		Short: "Dump the internal structure of an AZW3/MOBI file",
+		Long: `inspect prints the PDB header, the record table, the MOBI header,
+the EXTH records, the FDST flow table, the NCX tree and the RESC spine of an
+AZW3/MOBI file.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			jsonOutput, _ := cmd.Flags().GetBool("json")
+
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+			r, err := mobi.NewReader(data)
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", args[0], err)
+			}
+
+			report := buildInspectReport(args[0], len(data), r)
+			if jsonOutput {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				return enc.Encode(report)
+			}
+			return writeInspectText(cmd.OutOrStdout(), report)
+		},
+	}
+	cmd.Flags().Bool("json", false, "Print the structure as JSON")
+	return cmd
+}
+
+// buildInspectReport collects the structure of a parsed file. Errors in the
+// optional structures (FDST, NCX, RESC) are recorded in the report instead of
+// aborting, so that broken files can still be inspected.
+func buildInspectReport(path string, size int, r *mobi.Reader) inspectReport {
+	h := r.PDB.Header
+	report := inspectReport{
+		File: path,
+		Size: size,
+		PDB: pdbReport{
+			Name:               h.Title(),
+			Attributes:         h.Attributes,
+			Version:            h.Version,
+			CreationDate:       mobi.PalmEpochTime(h.CreationDate),
+			ModificationDate:   mobi.PalmEpochTime(h.ModificationDate),
+			BackupDate:         h.BackupDate,
+			ModificationNumber: h.ModificationNumber,
+			Type:               string(h.Type[:]),
+			Creator:            string(h.Creator[:]),
+			UniqueSeed:         h.UniqueSeed,
+			NumRecords:         h.NumRecords,
+		},
+	}
+
+	for i, entry := range r.PDB.Records {
+		rec, _ := r.Record(i)
+		report.Records = append(report.Records, recordReport{
+			Index:  i,
+			Offset: entry.Offset,
+			Size:   len(rec),
+			Type:   r.RecordType(i),
+		})
+	}
+
+	for _, s := range r.Sections {
+		report.Sections = append(report.Sections, buildSectionReport(r, s))
+	}
+	return report
+}
+
+func buildSectionReport(r *mobi.Reader, s *mobi.Section) sectionReport {
+	h := s.Header
+	sr := sectionReport{
+		Kind:     "MOBI7",
+		Record0:  s.Record0,
+		FullName: s.FullName,
+		MOBIHeader: mobiHeaderReport{
+			MOBIType:             h.MOBIType,
+			FileVersion:          h.FileVersion,
+			Compression:          h.Compression,
+			Encryption:           s.Encryption,
+			Encoding:             s.Encoding,
+			TextLength:           h.TextLength,
+			TextRecordCount:      h.TextRecordCount,
+			UniqueID:             h.UniqueID,
+			LanguageCode:         h.LanguageCode,
+			FirstContentRecord:   h.FirstContentRecord,
+			LastContentRecord:    h.LastContentRecord,
+			FirstImageIndex:      h.FirstImageIndex,
+			FCISRecordNumber:     h.FCISRecordNumber,
+			FLISRecordNumber:     h.FLISRecordNumber,
+			ExtraRecordDataFlags: h.ExtraRecordDataFlags,
+			NCXIndex:             h.NCXIndex,
+			FragmentIndex:        h.FragmentIndex,
+			SkeletonIndex:        h.SkeletonIndex,
+			GuideIndex:           h.GuideIndex,
+			RESCIndex:            h.RESCIndex,
+			FDSTFlowCount:        h.FDSTFlowCount,
+			FDSTOffset:           h.FDSTOffset,
+		},
+	}
+	if s.IsKF8() {
+		sr.Kind = "KF8"
+	}
+
+	if s.EXTH != nil {
+		for _, rec := range s.EXTH.Records {
+			sr.EXTH = append(sr.EXTH, exthReport{
+				Type:  rec.Type,
+				Name:  mobi.EXTHTypeName(rec.Type),
+				Value: mobi.FormatEXTHValue(rec),
+			})
+		}
+	}
+
+	fdst, err := r.FDST(s)
+	if err != nil {
+		sr.Errors = append(sr.Errors, fmt.Sprintf("FDST: %v", err))
+	} else if fdst != nil {
+		for i, e := range fdst.Entries {
+			sr.FDST = append(sr.FDST, flowReport{Index: i, Start: e[0], End: e[1]})
+		}
+	}
+
+	ncx, err := r.NCX(s)
+	if err != nil {
+		sr.Errors = append(sr.Errors, fmt.Sprintf("NCX: %v", err))
+	} else {
+		sr.NCX = buildNCXReport(ncx)
+	}
+
+	resc, err := r.RESC(s)
+	if err != nil {
+		sr.Errors = append(sr.Errors, fmt.Sprintf("RESC: %v", err))
+	} else if resc != nil {
+		sr.RESC = &rescReport{PageProgressionDirection: resc.PageProgressionDirection}
+		for _, item := range resc.Spine {
+			sr.RESC.Spine = append(sr.RESC.Spine, rescItemReport(item))
+		}
+	}
+	return sr
+}
+
+func buildNCXReport(entries []mobi.NCXEntry) []ncxReport {
+	var out []ncxReport
+	for _, e := range entries {
+		out = append(out, ncxReport{
+			Label:    e.Label,
+			FilePos:  e.FilePos,
+			Children: buildNCXReport(e.Children),
+		})
+	}
+	return out
+}
+
+// writeInspectText prints the report as aligned, human-readable text.
+func writeInspectText(out io.Writer, report inspectReport) error {
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	p := func(format string, args ...any) {
+		fmt.Fprintf(tw, format+"\n", args...)
+	}
+
+	p("File: %s (%d bytes)", report.File, report.Size)
+	p("")
+	p("PDB Header")
+	p("  Name:\t%s", report.PDB.Name)
+	p("  Attributes:\t0x%04X", report.PDB.Attributes)
+	p("  Version:\t%d", report.PDB.Version)
+	p("  Created:\t%s", report.PDB.CreationDate.Format(time.RFC3339))
+	p("  Modified:\t%s", report.PDB.ModificationDate.Format(time.RFC3339))
+	p("  Backup date:\t%d", report.PDB.BackupDate)
+	p("  Modification number:\t%d", report.PDB.ModificationNumber)
+	p("  Type/Creator:\t%s/%s", report.PDB.Type, report.PDB.Creator)
+	p("  Unique seed:\t%d", report.PDB.UniqueSeed)
+	p("  Records:\t%d", report.PDB.NumRecords)
+	p("")
+	p("Records")
+	p("  Index\tOffset\tSize\tType")
+	for _, rec := range report.Records {
+		p("  %d\t%d\t%d\t%s", rec.Index, rec.Offset, rec.Size, rec.Type)
+	}
+
+	for _, s := range report.Sections {
+		h := s.MOBIHeader
+		p("")
+		p("%s section (Record 0 = %d)", s.Kind, s.Record0)
+		p("  Full name:\t%s", s.FullName)
+		p("  MOBI type:\t%d", h.MOBIType)
+		p("  File version:\t%d", h.FileVersion)
+		p("  Compression:\t%d (%s)", h.Compression, compressionName(h.Compression))
+		p("  Encryption:\t%d", h.Encryption)
+		p("  Encoding:\t%d", h.Encoding)
+		p("  Text length:\t%d", h.TextLength)
+		p("  Text record count:\t%d", h.TextRecordCount)
+		p("  Unique ID:\t0x%08X", h.UniqueID)
+		p("  Language code:\t0x%04X", h.LanguageCode)
+		p("  First/last content record:\t%d/%d", h.FirstContentRecord, h.LastContentRecord)
+		p("  First image index:\t%s", formatIndex(h.FirstImageIndex))
+		p("  FCIS record:\t%s", formatIndex(h.FCISRecordNumber))
+		p("  FLIS record:\t%s", formatIndex(h.FLISRecordNumber))
+		p("  Extra record data flags:\t0x%X", h.ExtraRecordDataFlags)
+		p("  NCX index:\t%s", formatIndex(h.NCXIndex))
+		p("  FRAG index:\t%s", formatIndex(h.FragmentIndex))
+		p("  SKEL index:\t%s", formatIndex(h.SkeletonIndex))
+		p("  Guide index:\t%s", formatIndex(h.GuideIndex))
+		p("  RESC index:\t%s", formatIndex(h.RESCIndex))
+		p("  FDST flow count:\t%d", h.FDSTFlowCount)
+		p("  FDST offset:\t%s", formatIndex(h.FDSTOffset))
+
+		p("  EXTH (%d records)", len(s.EXTH))
+		for _, e := range s.EXTH {
+			p("    %d\t%s:\t%s", e.Type, e.Name, e.Value)
+		}
+
+		if len(s.FDST) > 0 {
+			p("  FDST (%d flows)", len(s.FDST))
+			for _, f := range s.FDST {
+				p("    flow %d\t[%d, %d)\t%d bytes", f.Index, f.Start, f.End, f.End-f.Start)
+			}
+		}
+
+		if len(s.NCX) > 0 {
+			p("  NCX")
+			writeNCXText(p, s.NCX, 2)
+		}
+
+		if s.RESC != nil {
+			p("  RESC (page-progression-direction %q)", s.RESC.PageProgressionDirection)
+			for _, item := range s.RESC.Spine {
+				p("    %s\tskeleton %d\tlinear=%t\t%s", item.IDRef, item.SkeletonID, item.Linear, strings.Join(item.Properties, " "))
+			}
+		}
+
+		for _, e := range s.Errors {
+			p("  Error:\t%s", e)
+		}
+	}
+	return tw.Flush()
+}
+
+func writeNCXText(p func(string, ...any), entries []ncxReport, depth int) {
+	for _, e := range entries {
+		p("%s%s (filepos %d)", strings.Repeat("  ", depth), e.Label, e.FilePos)
+		writeNCXText(p, e.Children, depth+1)
+	}
+}
+
+func compressionName(compression uint16) string {
+	switch compression {
+	case mobi.CompressionNone:
+		return "none"
+	case mobi.CompressionPalmDoc:
+		return "PalmDoc"
+	case 17480:
+		return "HUFF/CDIC"
+	default:
+		return "unknown"
+	}
+}
+
+// formatIndex formats a record number, showing NullIndex as "none".
+func formatIndex(index uint32) string {
+	if index == mobi.NullIndex {
+		return "none"
+	}
+	return fmt.Sprintf("%d", index)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuanying/epub2azw3/internal/epub"
+	"github.com/yuanying/epub2azw3/internal/mobi"
+)
+
+func writeInspectTestFile(t *testing.T) string {
+	t.Helper()
+	w, err := mobi.NewAZW3Writer(mobi.AZW3WriterConfig{
+		Title:       "Inspect Test",
+		HTML:        []byte(`<html><body><div id="c1"><p>one</p></div><div id="c2"><p>two</p></div></body></html>`),
+		Metadata:    &epub.Metadata{Title: "Inspect Test", Language: "ja", Creators: []epub.Creator{{Name: "Author"}}},
+		Compression: mobi.CompressionPalmDoc,
+		ChapterIDs:  []string{"c1", "c2"},
+		NCXEntries: []mobi.NCXEntry{
+			{Label: "Chapter 1", FilePos: 0, Children: []mobi.NCXEntry{{Label: "Section 1.1", FilePos: 10}}},
+			{Label: "Chapter 2", FilePos: 30},
+		},
+		Flows: [][]byte{[]byte("p { margin: 0; }")},
+		RESC: &mobi.RESC{
+			PageProgressionDirection: "rtl",
+			Spine:                    []mobi.RESCSpineItem{{IDRef: "c1", SkeletonID: 0, Linear: true, Properties: []string{"page-spread-right"}}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "book.azw3")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runInspect(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(append([]string{"inspect"}, args...))
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestInspect_Text(t *testing.T) {
+	path := writeInspectTestFile(t)
+	out, err := runInspect(t, path)
+	if err != nil {
+		t.Fatalf("inspect error = %v\n%s", err, out)
+	}
+
+	for _, want := range []string{
+		"PDB Header",
+		"Inspect Test",
+		"BOOK/MOBI",
+		"KF8 Record 0",
+		"KF8 section (Record 0 = 0)",
+		"Compression:",
+		"PalmDoc",
+		"100  Author:",
+		"524  Language:",
+		"FDST (2 flows)",
+		"Chapter 1 (filepos 0)",
+		"      Section 1.1 (filepos 10)",
+		"Chapter 2 (filepos 30)",
+		`RESC (page-progression-direction "rtl")`,
+		"page-spread-right",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestInspect_JSON(t *testing.T) {
+	path := writeInspectTestFile(t)
+	out, err := runInspect(t, "--json", path)
+	if err != nil {
+		t.Fatalf("inspect --json error = %v\n%s", err, out)
+	}
+
+	var report inspectReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("invalid JSON output: %v\n%s", err, out)
+	}
+	if report.PDB.Name != "Inspect Test" {
+		t.Errorf("pdb.name = %q, want %q", report.PDB.Name, "Inspect Test")
+	}
+	if len(report.Records) != int(report.PDB.NumRecords) {
+		t.Errorf("records = %d, want %d", len(report.Records), report.PDB.NumRecords)
+	}
+	if len(report.Sections) != 1 || report.Sections[0].Kind != "KF8" {
+		t.Fatalf("sections = %+v, want one KF8 section", report.Sections)
+	}
+	s := report.Sections[0]
+	if s.MOBIHeader.Compression != mobi.CompressionPalmDoc {
+		t.Errorf("compression = %d, want %d", s.MOBIHeader.Compression, mobi.CompressionPalmDoc)
+	}
+	if len(s.FDST) != 2 {
+		t.Errorf("fdst flows = %d, want 2", len(s.FDST))
+	}
+	if len(s.NCX) != 2 || len(s.NCX[0].Children) != 1 || s.NCX[0].Children[0].Label != "Section 1.1" {
+		t.Errorf("ncx = %+v", s.NCX)
+	}
+	if s.RESC == nil || s.RESC.PageProgressionDirection != "rtl" || len(s.RESC.Spine) != 1 || s.RESC.Spine[0].IDRef != "c1" {
+		t.Errorf("resc = %+v", s.RESC)
+	}
+	var foundAuthor bool
+	for _, e := range s.EXTH {
+		if e.Type == 100 && e.Name == "Author" && e.Value == "Author" {
+			foundAuthor = true
+		}
+	}
+	if !foundAuthor {
+		t.Errorf("EXTH 100 not found in %+v", s.EXTH)
+	}
+	if len(s.Errors) != 0 {
+		t.Errorf("errors = %v", s.Errors)
+	}
+}
+
+func TestInspect_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.azw3")
+	if err := os.WriteFile(path, []byte("not a mobi file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runInspect(t, path); err == nil {
+		t.Error("inspect error = nil for an invalid file")
+	}
+	if _, err := runInspect(t, filepath.Join(t.TempDir(), "missing.azw3")); err == nil {
+		t.Error("inspect error = nil for a missing file")
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime/debug"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
@@ -34,12 +36,24 @@ const (
 	defaultMaxImageWidth = 600
 )
 
+// asinRe matches the characters allowed in an ASIN, which also names the
+// thumbnail sidecar.
+var asinRe = regexp.MustCompile(`^[A-Za-z0-9]+$`)
+
 type CLIOptions struct {
 	OutputPath    string
+	Format        string
 	JPEGQuality   int
 	MaxImageSize  int
 	MaxImageWidth int
 	NoImages      bool
+	WritingMode   string
+	PanelView     bool
+	Comic         bool
+	APNX          string
+	ASIN          string
+	CDEType       string
+	ThumbnailDir  string
 	LogLevel      string
 	LogFormat     string
 	Strict        bool
@@ -72,6 +86,28 @@ func validateCLIOptions(opts CLIOptions) error {
 		return fmt.Errorf("invalid --max-image-width %d (expected > 0)", opts.MaxImageWidth)
 	}
 
+	switch strings.ToLower(strings.TrimSpace(opts.Format)) {
+	case converter.FormatAZW3, converter.FormatMOBI7KF8:
+	default:
+		return fmt.Errorf("invalid --format %q (expected %s/%s)", opts.Format, converter.FormatAZW3, converter.FormatMOBI7KF8)
+	}
+
+	if mode := strings.ToLower(strings.TrimSpace(opts.WritingMode)); mode != "" && !slices.Contains(converter.WritingModes, mode) {
+		return fmt.Errorf("invalid --writing-mode %q (expected %s)", opts.WritingMode, strings.Join(converter.WritingModes, "/"))
+	}
+
+	if mode := strings.ToLower(strings.TrimSpace(opts.APNX)); mode != "" && !slices.Contains(converter.APNXModes, mode) {
+		return fmt.Errorf("invalid --apnx %q (expected %s)", opts.APNX, strings.Join(converter.APNXModes, "/"))
+	}
+
+	if asin := strings.TrimSpace(opts.ASIN); asin != "" && !asinRe.MatchString(asin) {
+		return fmt.Errorf("invalid --asin %q (expected letters and digits)", opts.ASIN)
+	}
+
+	if cdeType := strings.ToUpper(strings.TrimSpace(opts.CDEType)); !slices.Contains(converter.CDETypes, cdeType) {
+		return fmt.Errorf("invalid --cdetype %q (expected %s)", opts.CDEType, strings.Join(converter.CDETypes, "/"))
+	}
+
 	switch strings.ToLower(strings.TrimSpace(opts.LogLevel)) {
 	case "error", "warn", "info", "debug":
 	default:
@@ -125,46 +161,77 @@ func buildLogger(writer io.Writer, levelStr string, format string) *slog.Logger
 func readCLIOptions(cmd *cobra.Command, args []string) (converter.ConvertOptions, error) {
 	inputPath := args[0]
 
-	outputPath, _ := cmd.Flags().GetString("output")
+	cliOpts := readConversionFlags(cmd)
+	cliOpts.OutputPath, _ = cmd.Flags().GetString("output")
+	cliOpts.ASIN, _ = cmd.Flags().GetString("asin")
+	cliOpts.ThumbnailDir, _ = cmd.Flags().GetString("thumbnail-dir")
+
+	if cliOpts.OutputPath == "" {
+		cliOpts.OutputPath = defaultOutputPath(inputPath)
+	}
+
+	if err := validateCLIOptions(cliOpts); err != nil {
+		return converter.ConvertOptions{}, err
+	}
+
+	return cliOpts.convertOptions(inputPath), nil
+}
+
+// readConversionFlags reads the flags added by addConversionFlags.
+func readConversionFlags(cmd *cobra.Command) CLIOptions {
+	format, _ := cmd.Flags().GetString("format")
 	quality, _ := cmd.Flags().GetInt("quality")
 	maxImageSize, _ := cmd.Flags().GetInt("max-image-size")
 	maxImageWidth, _ := cmd.Flags().GetInt("max-image-width")
 	noImages, _ := cmd.Flags().GetBool("no-images")
+	writingMode, _ := cmd.Flags().GetString("writing-mode")
+	panelView, _ := cmd.Flags().GetBool("panel-view")
+	comic, _ := cmd.Flags().GetBool("comic")
+	apnx, _ := cmd.Flags().GetString("apnx")
+	cdeType, _ := cmd.Flags().GetString("cdetype")
 	logLevel, _ := cmd.Flags().GetString("log-level")
 	logFormat, _ := cmd.Flags().GetString("log-format")
 	strict, _ := cmd.Flags().GetBool("strict")
 	verbose, _ := cmd.Flags().GetBool("verbose")
 
-	cliOpts := CLIOptions{
-		OutputPath:    outputPath,
+	return CLIOptions{
+		Format:        format,
 		JPEGQuality:   quality,
 		MaxImageSize:  maxImageSize,
 		MaxImageWidth: maxImageWidth,
 		NoImages:      noImages,
+		WritingMode:   writingMode,
+		PanelView:     panelView,
+		Comic:         comic,
+		APNX:          apnx,
+		CDEType:       cdeType,
 		LogLevel:      normalizeLogLevel(logLevel, verbose),
 		LogFormat:     logFormat,
 		Strict:        strict,
 		Verbose:       verbose,
 	}
+}
 
-	if cliOpts.OutputPath == "" {
-		cliOpts.OutputPath = defaultOutputPath(inputPath)
-	}
-
-	if err := validateCLIOptions(cliOpts); err != nil {
-		return converter.ConvertOptions{}, err
-	}
-
+// convertOptions returns the conversion options of the book at inputPath.
+func (cliOpts CLIOptions) convertOptions(inputPath string) converter.ConvertOptions {
 	return converter.ConvertOptions{
 		InputPath:         inputPath,
 		OutputPath:        cliOpts.OutputPath,
+		Format:            strings.ToLower(strings.TrimSpace(cliOpts.Format)),
 		MaxImageWidth:     cliOpts.MaxImageWidth,
 		JPEGQuality:       cliOpts.JPEGQuality,
 		MaxImageSizeBytes: cliOpts.MaxImageSize * 1024,
 		NoImages:          cliOpts.NoImages,
+		WritingMode:       strings.ToLower(strings.TrimSpace(cliOpts.WritingMode)),
+		PanelView:         cliOpts.PanelView,
+		Comic:             cliOpts.Comic,
+		APNX:              strings.ToLower(strings.TrimSpace(cliOpts.APNX)),
+		ASIN:              strings.TrimSpace(cliOpts.ASIN),
+		CDEType:           strings.ToUpper(strings.TrimSpace(cliOpts.CDEType)),
+		ThumbnailDir:      cliOpts.ThumbnailDir,
 		Strict:            cliOpts.Strict,
 		Logger:            buildLogger(os.Stderr, cliOpts.LogLevel, cliOpts.LogFormat),
-	}, nil
+	}
 }
 
 func newRootCmd() *cobra.Command {
@@ -173,7 +240,8 @@ func newRootCmd() *cobra.Command {
 		Version: version,
 		Short:   "Convert EPUB files to AZW3 (Kindle) format",
 		Long: `epub2azw3 is a command-line tool that converts EPUB ebooks to
-Amazon Kindle compatible AZW3 (KF8) format.
+Amazon Kindle compatible AZW3 (KF8) format. CBZ comic archives (.cbz)
+are converted to fixed-layout comics.
 
 It is a standalone implementation in Go without external dependencies
 like Calibre.`,
@@ -195,15 +263,33 @@ like Calibre.`,
 	cmd.SetVersionTemplate(fmt.Sprintf("epub2azw3 %s (commit: %s, built: %s)\n", version, commit, date))
 	cmd.SetErr(os.Stderr)
 	cmd.Flags().StringP("output", "o", "", "Output file path (default: input with .azw3 extension)")
+	cmd.Flags().String("asin", "", "ASIN written to the book (default: derived from the book identifier)")
+	cmd.Flags().String("thumbnail-dir", "", "Write the cover thumbnail sidecar for the Kindle library to this directory")
+	addConversionFlags(cmd)
+	cmd.AddCommand(newInspectCmd())
+	cmd.AddCommand(newVerifyCmd())
+	cmd.AddCommand(newUnpackCmd())
+	cmd.AddCommand(newSyncCmd())
+	return cmd
+}
+
+// addConversionFlags adds the flags that control how a book is converted,
+// shared by the root command and sync.
+func addConversionFlags(cmd *cobra.Command) {
+	cmd.Flags().String("format", converter.FormatAZW3, "Output format (azw3/mobi7+kf8)")
 	cmd.Flags().IntP("quality", "q", defaultJPEGQuality, "JPEG quality (60-100)")
 	cmd.Flags().Int("max-image-size", defaultMaxImageSize, "Max image size in KB")
 	cmd.Flags().Int("max-image-width", defaultMaxImageWidth, "Max image width in pixels")
 	cmd.Flags().Bool("no-images", false, "Remove all images from output")
+	cmd.Flags().String("writing-mode", "", "Primary writing mode (horizontal-lr/horizontal-rl/vertical-rl/vertical-lr, default: detect)")
+	cmd.Flags().Bool("panel-view", false, "Add Panel View region magnification to fixed-layout comics")
+	cmd.Flags().Bool("comic", false, "Crop margins, split double-page spreads and adjust contrast of comic pages")
+	cmd.Flags().String("apnx", converter.APNXAuto, "Page number sidecar (none/auto/pagelist/fast)")
+	cmd.Flags().String("cdetype", converter.CDETypeEBOK, "Content type of the book (EBOK/PDOC)")
 	cmd.Flags().StringP("log-level", "l", "info", "Log level (error/warn/info/debug)")
 	cmd.Flags().String("log-format", "text", "Log output format (text/json)")
 	cmd.Flags().Bool("strict", false, "Treat recoverable warnings as errors")
 	cmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
-	return cmd
 }
 
 func main() {
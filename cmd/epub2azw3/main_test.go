@@ -37,6 +37,15 @@ func TestReadCLIOptions_Defaults(t *testing.T) {
 	if opts.MaxImageSizeBytes != defaultMaxImageSize*1024 {
 		t.Fatalf("MaxImageSizeBytes = %d, want %d", opts.MaxImageSizeBytes, defaultMaxImageSize*1024)
 	}
+	if opts.Format != "azw3" {
+		t.Fatalf("Format = %q, want %q", opts.Format, "azw3")
+	}
+	if opts.APNX != "auto" {
+		t.Fatalf("APNX = %q, want %q", opts.APNX, "auto")
+	}
+	if opts.ASIN != "" || opts.CDEType != "EBOK" || opts.ThumbnailDir != "" {
+		t.Fatalf("ASIN, CDEType, ThumbnailDir = %q, %q, %q, want derived, EBOK and none", opts.ASIN, opts.CDEType, opts.ThumbnailDir)
+	}
 	if opts.Logger == nil {
 		t.Fatal("Logger is nil, want non-nil")
 	}
@@ -115,6 +124,126 @@ func TestReadCLIOptions_InvalidMaxImageWidth(t *testing.T) {
 	}
 }
 
+func TestReadCLIOptions_Format(t *testing.T) {
+	cmd := newRootCmd()
+	if err := cmd.ParseFlags([]string{"--format", "MOBI7+KF8"}); err != nil {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+
+	opts, err := readCLIOptions(cmd, []string{"./input/book.epub"})
+	if err != nil {
+		t.Fatalf("readCLIOptions() error = %v", err)
+	}
+	if opts.Format != "mobi7+kf8" {
+		t.Fatalf("Format = %q, want %q", opts.Format, "mobi7+kf8")
+	}
+}
+
+func TestReadCLIOptions_InvalidFormat(t *testing.T) {
+	err := readConvertOptionsForTest(t, "--format", "epub")
+	if err == nil || !strings.Contains(err.Error(), "--format") {
+		t.Fatalf("expected format validation error, got %v", err)
+	}
+}
+
+func TestReadCLIOptions_WritingMode(t *testing.T) {
+	cmd := newRootCmd()
+	if err := cmd.ParseFlags([]string{"--writing-mode", "Vertical-RL"}); err != nil {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+
+	opts, err := readCLIOptions(cmd, []string{"./input/book.epub"})
+	if err != nil {
+		t.Fatalf("readCLIOptions() error = %v", err)
+	}
+	if opts.WritingMode != "vertical-rl" {
+		t.Fatalf("WritingMode = %q, want %q", opts.WritingMode, "vertical-rl")
+	}
+}
+
+func TestReadCLIOptions_PanelView(t *testing.T) {
+	cmd := newRootCmd()
+	if err := cmd.ParseFlags([]string{"--panel-view"}); err != nil {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+
+	opts, err := readCLIOptions(cmd, []string{"./input/book.epub"})
+	if err != nil {
+		t.Fatalf("readCLIOptions() error = %v", err)
+	}
+	if !opts.PanelView {
+		t.Fatal("PanelView = false, want true")
+	}
+}
+
+func TestReadCLIOptions_Comic(t *testing.T) {
+	cmd := newRootCmd()
+	if err := cmd.ParseFlags([]string{"--comic"}); err != nil {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+
+	opts, err := readCLIOptions(cmd, []string{"./input/book.epub"})
+	if err != nil {
+		t.Fatalf("readCLIOptions() error = %v", err)
+	}
+	if !opts.Comic {
+		t.Fatal("Comic = false, want true")
+	}
+}
+
+func TestReadCLIOptions_APNX(t *testing.T) {
+	cmd := newRootCmd()
+	if err := cmd.ParseFlags([]string{"--apnx", "PageList"}); err != nil {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+
+	opts, err := readCLIOptions(cmd, []string{"./input/book.epub"})
+	if err != nil {
+		t.Fatalf("readCLIOptions() error = %v", err)
+	}
+	if opts.APNX != "pagelist" {
+		t.Fatalf("APNX = %q, want %q", opts.APNX, "pagelist")
+	}
+}
+
+func TestReadCLIOptions_InvalidAPNX(t *testing.T) {
+	err := readConvertOptionsForTest(t, "--apnx", "accurate")
+	if err == nil || !strings.Contains(err.Error(), "--apnx") {
+		t.Fatalf("expected apnx validation error, got %v", err)
+	}
+}
+
+func TestReadCLIOptions_Sideload(t *testing.T) {
+	cmd := newRootCmd()
+	if err := cmd.ParseFlags([]string{"--asin", "B0ABCDEF12", "--cdetype", "pdoc", "--thumbnail-dir", "/mnt/kindle/system/thumbnails"}); err != nil {
+		t.Fatalf("ParseFlags() error = %v", err)
+	}
+
+	opts, err := readCLIOptions(cmd, []string{"./input/book.epub"})
+	if err != nil {
+		t.Fatalf("readCLIOptions() error = %v", err)
+	}
+	if opts.ASIN != "B0ABCDEF12" || opts.CDEType != "PDOC" || opts.ThumbnailDir != "/mnt/kindle/system/thumbnails" {
+		t.Fatalf("ASIN, CDEType, ThumbnailDir = %q, %q, %q", opts.ASIN, opts.CDEType, opts.ThumbnailDir)
+	}
+}
+
+func TestReadCLIOptions_InvalidSideload(t *testing.T) {
+	if err := readConvertOptionsForTest(t, "--cdetype", "BOOK"); err == nil || !strings.Contains(err.Error(), "--cdetype") {
+		t.Fatalf("expected cdetype validation error, got %v", err)
+	}
+	if err := readConvertOptionsForTest(t, "--asin", "B0/../x"); err == nil || !strings.Contains(err.Error(), "--asin") {
+		t.Fatalf("expected asin validation error, got %v", err)
+	}
+}
+
+func TestReadCLIOptions_InvalidWritingMode(t *testing.T) {
+	err := readConvertOptionsForTest(t, "--writing-mode", "vertical")
+	if err == nil || !strings.Contains(err.Error(), "--writing-mode") {
+		t.Fatalf("expected writing-mode validation error, got %v", err)
+	}
+}
+
 func TestReadCLIOptions_InvalidLogLevel(t *testing.T) {
 	err := readConvertOptionsForTest(t, "--log-level", "trace")
 	if err == nil || !strings.Contains(err.Error(), "--log-level") {
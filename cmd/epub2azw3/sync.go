@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/yuanying/epub2azw3/internal/converter"
+)
+
+func newSyncCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sync <kindle-mount> <source>...",
+		Short: "Convert books onto a mounted Kindle",
+		Long: `sync converts the EPUB and CBZ files among the sources (files, or directories
+that are searched for them) into the documents directory of a Kindle mounted
+over USB, with the APNX next to each book and the cover thumbnail in
+system/thumbnails. Books whose source is unchanged since the last sync are
+skipped; --prune removes the books whose source is no longer given.`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cliOpts := readConversionFlags(cmd)
+			if err := validateCLIOptions(cliOpts); err != nil {
+				return err
+			}
+			prune, _ := cmd.Flags().GetBool("prune")
+
+			convertOpts := cliOpts.convertOptions("")
+			result, err := converter.Sync(converter.SyncOptions{
+				DevicePath: args[0],
+				Sources:    args[1:],
+				Convert:    convertOpts,
+				Prune:      prune,
+				Logger:     convertOpts.Logger,
+			})
+			if result != nil {
+				fmt.Fprintf(cmd.OutOrStdout(), "synced: %d converted, %d skipped, %d removed, %d failed\n",
+					len(result.Converted), len(result.Skipped), len(result.Removed), len(result.Failed))
+			}
+			if err != nil {
+				return fmt.Errorf("sync failed: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Bool("prune", false, "Remove books synced before whose source is no longer given")
+	addConversionFlags(cmd)
+	return cmd
+}
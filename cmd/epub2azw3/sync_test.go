@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSync_Command(t *testing.T) {
+	device := t.TempDir()
+	if err := os.Mkdir(filepath.Join(device, "documents"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join("..", "..", "testdata", "test.epub")
+
+	for _, want := range []string{
+		"synced: 1 converted, 0 skipped, 0 removed, 0 failed",
+		"synced: 0 converted, 1 skipped, 0 removed, 0 failed",
+	} {
+		cmd := newRootCmd()
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetErr(&out)
+		cmd.SetArgs([]string{"sync", "--log-level", "error", device, source})
+		if err := cmd.Execute(); err != nil {
+			t.Fatalf("sync error = %v\n%s", err, out.String())
+		}
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output = %q, want %q", out.String(), want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(device, "documents", "test.azw3")); err != nil {
+		t.Errorf("book not on the device: %v", err)
+	}
+}
+
+func TestSync_CommandErrors(t *testing.T) {
+	source := filepath.Join("..", "..", "testdata", "test.epub")
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "not a Kindle", args: []string{"sync", t.TempDir(), source}},
+		{name: "no sources", args: []string{"sync", t.TempDir()}},
+		{name: "invalid option", args: []string{"sync", "--quality", "10", t.TempDir(), source}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := newRootCmd()
+			cmd.SetOut(&bytes.Buffer{})
+			cmd.SetErr(&bytes.Buffer{})
+			cmd.SetArgs(tt.args)
+			if err := cmd.Execute(); err == nil {
+				t.Error("sync error = nil")
+			}
+		})
+	}
+}
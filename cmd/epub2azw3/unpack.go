@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/yuanying/epub2azw3/internal/converter"
+)
+
+func newUnpackCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "unpack <file.azw3>",
+		Short: "Convert an AZW3/MOBI file back to EPUB",
+		Long: `unpack reads an AZW3/MOBI file and writes an EPUB: the text is split back
+into XHTML files, kindle:embed images are extracted, and the OPF and the
+navigation documents are rebuilt from the EXTH metadata and the NCX index.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			outputPath, _ := cmd.Flags().GetString("output")
+			logLevel, _ := cmd.Flags().GetString("log-level")
+			logFormat, _ := cmd.Flags().GetString("log-format")
+			if outputPath == "" {
+				outputPath = strings.TrimSuffix(args[0], filepath.Ext(args[0])) + ".epub"
+			}
+
+			opts := converter.UnpackOptions{
+				InputPath:  args[0],
+				OutputPath: outputPath,
+				Logger:     buildLogger(os.Stderr, normalizeLogLevel(logLevel, false), logFormat),
+			}
+			if err := converter.Unpack(opts); err != nil {
+				return fmt.Errorf("unpack failed: %w", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringP("output", "o", "", "Output file path (default: input with .epub extension)")
+	cmd.Flags().StringP("log-level", "l", "info", "Log level (error/warn/info/debug)")
+	cmd.Flags().String("log-format", "text", "Log output format (text/json)")
+	return cmd
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuanying/epub2azw3/internal/epub"
+)
+
+func TestUnpack_DefaultOutputPath(t *testing.T) {
+	path := writeInspectTestFile(t)
+
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs([]string{"unpack", "--log-level", "error", path})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("unpack error = %v\n%s", err, out.String())
+	}
+
+	epubPath := strings.TrimSuffix(path, ".azw3") + ".epub"
+	r, err := epub.Open(epubPath)
+	if err != nil {
+		t.Fatalf("epub.Open() error = %v", err)
+	}
+	defer r.Close()
+	if _, err := r.ReadFile(r.OPFPath()); err != nil {
+		t.Errorf("OPF not found: %v", err)
+	}
+}
+
+func TestUnpack_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.azw3")
+	if err := os.WriteFile(path, []byte("not a mobi file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := newRootCmd()
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetErr(&bytes.Buffer{})
+	cmd.SetArgs([]string{"unpack", path})
+	if err := cmd.Execute(); err == nil {
+		t.Error("unpack error = nil for an invalid file")
+	}
+}
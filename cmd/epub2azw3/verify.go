@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/yuanying/epub2azw3/internal/mobi"
+)
+
+func newVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify <file.azw3>",
+		Short: "Check the structural invariants of an AZW3/MOBI file",
+		Long: `verify re-reads an AZW3/MOBI file and checks its structural invariants:
+record offsets, text record counts, the first image index, FDST flow ranges,
+the EXTH record count, kindle:embed references and NCX offsets.
+
+Each violation is printed as "check: location: message".`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+
+			issues := mobi.Verify(data)
+			out := cmd.OutOrStdout()
+			for _, issue := range issues {
+				fmt.Fprintln(out, issue)
+			}
+			if len(issues) > 0 {
+				cmd.SilenceUsage = true
+				return fmt.Errorf("verification failed: %d issues", len(issues))
+			}
+			fmt.Fprintf(out, "%s: OK\n", args[0])
+			return nil
+		},
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuanying/epub2azw3/internal/mobi"
+)
+
+func runVerify(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	cmd := newRootCmd()
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	cmd.SetArgs(append([]string{"verify"}, args...))
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestVerify_Valid(t *testing.T) {
+	path := writeInspectTestFile(t)
+	out, err := runVerify(t, path)
+	if err != nil {
+		t.Fatalf("verify error = %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "OK") {
+		t.Errorf("output = %q, want OK", out)
+	}
+}
+
+func TestVerify_Broken(t *testing.T) {
+	path := writeInspectTestFile(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Last content record of the KF8 Record 0
+	rec0 := binary.BigEndian.Uint32(data[78:])
+	binary.BigEndian.PutUint16(data[rec0+16+162:], 9)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runVerify(t, path)
+	if err == nil || !strings.Contains(err.Error(), "verification failed") {
+		t.Fatalf("verify error = %v, want verification failure", err)
+	}
+	if !strings.Contains(out, mobi.CheckTextRecords+": KF8 section (Record 0 = 0): last content record 9") {
+		t.Errorf("output does not report the text record issue:\n%s", out)
+	}
+}
+
+func TestVerify_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.azw3")
+	if err := os.WriteFile(path, []byte("not a mobi file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out, err := runVerify(t, path)
+	if err == nil {
+		t.Error("verify error = nil for an invalid file")
+	}
+	if !strings.Contains(out, mobi.CheckParse+": file:") {
+		t.Errorf("output does not report a parse issue:\n%s", out)
+	}
+}
@@ -0,0 +1,167 @@
+package converter
+
+import (
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/yuanying/epub2azw3/internal/epub"
+	"github.com/yuanying/epub2azw3/internal/mobi"
+)
+
+// APNX modes accepted by ConvertOptions.APNX.
+const (
+	// APNXNone writes no page number sidecar.
+	APNXNone = "none"
+	// APNXAuto uses the page list of the EPUB when it has one, and the
+	// length of the text otherwise.
+	APNXAuto = "auto"
+	// APNXPageList uses the page list of the EPUB only.
+	APNXPageList = "pagelist"
+	// APNXFast splits the text into pages of apnxCharsPerPage characters.
+	APNXFast = "fast"
+)
+
+// APNXModes lists the modes accepted by ConvertOptions.APNX.
+var APNXModes = []string{APNXNone, APNXAuto, APNXPageList, APNXFast}
+
+// apnxCharsPerPage is the number of characters of a page in the fast mode,
+// about a page of a printed paperback. CJK characters count apnxWideCharWeight
+// times, since a page holds far fewer of them.
+const (
+	apnxCharsPerPage   = 1800
+	apnxWideCharWeight = 3
+)
+
+// APNXPath returns the path of the page number sidecar of an output file:
+// the output path with the .apnx extension.
+func APNXPath(outputPath string) string {
+	return strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".apnx"
+}
+
+// writeAPNX writes the page number sidecar next to the output file. Pages come
+// from the page list of the EPUB, or else from the text length; the pages of a
+// fixed-layout book are its own pages. Problems are recorded as recoverable
+// errors, since the book itself has already been written.
+func (p *Pipeline) writeAPNX(ncx *epub.NCX, chapterIDs map[string]string, layout *mobi.KF8Layout, fixedLayout bool, metadata *epub.Metadata) {
+	mode := p.Options.APNX
+	if mode == "" {
+		mode = APNXAuto
+	}
+	if mode == APNXNone {
+		return
+	}
+
+	hasPageList := ncx != nil && len(ncx.PageList) > 0
+	apnx := &mobi.APNX{
+		ContentGUID: fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(metadata.Identifier))),
+		ASIN:        BookASIN(p.Options.ASIN, metadata.Identifier),
+		CDEType:     p.cdeType(),
+		Title:       metadata.Title,
+	}
+	if apnx.Title == "" {
+		apnx.Title = "Untitled"
+	}
+	var source string
+	switch {
+	case mode == APNXPageList && !hasPageList:
+		p.recoverable("apnx", "EPUB has no page list, APNX not written", nil)
+		return
+	case mode == APNXPageList || mode == APNXAuto && hasPageList:
+		gen := NewTOCGenerator(ncx, chapterIDs)
+		var labels []string
+		var dropped int
+		apnx.Pages, labels, dropped = apnxPageListPages(ncx.PageList, gen, layout.Text)
+		if dropped > 0 {
+			p.recoverable("apnx", fmt.Sprintf("%d of %d page list targets not found or out of order, skipping them", dropped, len(ncx.PageList)), nil)
+		}
+		if len(apnx.Pages) == 0 {
+			return
+		}
+		apnx.PageMap = mobi.APNXPageMap(labels)
+		source = "page list"
+	case fixedLayout:
+		for _, skel := range layout.Skeletons {
+			apnx.Pages = append(apnx.Pages, skel.StartPos)
+		}
+		source = "fixed-layout pages"
+	default:
+		apnx.Pages = apnxTextPages(layout.Text)
+		source = "text length"
+	}
+
+	data, err := apnx.Bytes()
+	if err != nil {
+		p.recoverable("apnx", "failed to build APNX", err)
+		return
+	}
+	path := APNXPath(p.Options.OutputPath)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		p.recoverable("apnx", "failed to write APNX", err)
+		return
+	}
+	p.logger.Info(fmt.Sprintf("apnx: %d pages from %s written to %s", len(apnx.Pages), source, path), "stage", "apnx")
+}
+
+// apnxPageListPages resolves the page list targets to offsets in the text
+// flow and returns them with their labels. Targets that are not found, or
+// that start before the previous page, are dropped and counted.
+func apnxPageListPages(targets []epub.PageTarget, gen *TOCGenerator, text []byte) ([]uint32, []string, int) {
+	var pages []uint32
+	var labels []string
+	dropped := 0
+	for _, target := range targets {
+		pos, _ := gen.calculateFilePos(text, target.ContentPath, target.Fragment)
+		if pos == 0 || len(pages) > 0 && pos < pages[len(pages)-1] {
+			dropped++
+			continue
+		}
+		pages = append(pages, pos)
+		labels = append(labels, target.Label)
+	}
+	return pages, labels, dropped
+}
+
+// apnxTextPages splits the text flow into pages of apnxCharsPerPage
+// characters, counting the non-space characters outside of tags and heads.
+// It returns the offset where each page starts.
+func apnxTextPages(text []byte) []uint32 {
+	pages := []uint32{0}
+	count := 0
+	inHead := false
+	for i := 0; i < len(text); {
+		if text[i] == '<' {
+			end := i + 1
+			for end < len(text) && text[end] != '>' {
+				end++
+			}
+			switch tag := strings.ToLower(string(text[i+1 : end])); {
+			case tag == "head" || strings.HasPrefix(tag, "head "):
+				inHead = true
+			case tag == "/head":
+				inHead = false
+			}
+			i = end + 1
+			continue
+		}
+
+		r, size := utf8.DecodeRune(text[i:])
+		if !inHead && !unicode.IsSpace(r) {
+			if count >= apnxCharsPerPage {
+				pages = append(pages, uint32(i))
+				count = 0
+			}
+			if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+				count += apnxWideCharWeight
+			} else {
+				count++
+			}
+		}
+		i += size
+	}
+	return pages
+}
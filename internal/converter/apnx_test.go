@@ -0,0 +1,67 @@
+package converter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yuanying/epub2azw3/internal/epub"
+)
+
+func TestAPNXPath(t *testing.T) {
+	tests := map[string]string{
+		"out/book.azw3": "out/book.apnx",
+		"book.mobi":     "book.apnx",
+		"book":          "book.apnx",
+	}
+	for output, want := range tests {
+		if got := APNXPath(output); got != want {
+			t.Errorf("APNXPath(%q) = %q, want %q", output, got, want)
+		}
+	}
+}
+
+func TestAPNXTextPages(t *testing.T) {
+	head := `<html><head><title>` + strings.Repeat("t", 5000) + `</title></head><body>`
+	body := strings.Repeat("a ", apnxCharsPerPage) + `<p class="x">` + strings.Repeat("b", apnxCharsPerPage) + "</p>"
+	text := []byte(head + body + `</body></html>`)
+
+	pages := apnxTextPages(text)
+	if len(pages) != 2 {
+		t.Fatalf("pages = %v, want 2 pages", pages)
+	}
+	if pages[0] != 0 {
+		t.Errorf("first page starts at %d, want 0", pages[0])
+	}
+	if want := strings.Index(string(text), "bbb"); pages[1] != uint32(want) {
+		t.Errorf("second page starts at %d, want %d", pages[1], want)
+	}
+}
+
+func TestAPNXTextPages_WideCharacters(t *testing.T) {
+	text := []byte(`<body>` + strings.Repeat("あ", apnxCharsPerPage) + `</body>`)
+	if got, want := len(apnxTextPages(text)), apnxWideCharWeight; got != want {
+		t.Errorf("pages = %d, want %d", got, want)
+	}
+}
+
+func TestAPNXPageListPages(t *testing.T) {
+	text := []byte(`<body><div id="ch01"><p id="ch01-p1">one</p><p id="ch01-p2">two</p></div><div id="ch02"><p id="ch02-p3">three</p></div>`)
+	gen := NewTOCGenerator(&epub.NCX{}, map[string]string{"ch1.xhtml": "ch01", "ch2.xhtml": "ch02"})
+	targets := []epub.PageTarget{
+		{Label: "i", ContentPath: "ch1.xhtml"},
+		{Label: "1", ContentPath: "ch1.xhtml", Fragment: "p2"},
+		{Label: "2", ContentPath: "ch1.xhtml", Fragment: "missing"},
+		{Label: "3", ContentPath: "ch1.xhtml", Fragment: "p1"}, // before page 1
+		{Label: "4", ContentPath: "ch2.xhtml", Fragment: "p3"},
+	}
+
+	pages, labels, dropped := apnxPageListPages(targets, gen, text)
+	wantPages := []uint32{6, uint32(strings.Index(string(text), `<p id="ch01-p2"`)), uint32(strings.Index(string(text), `<p id="ch02-p3"`))}
+	if !reflect.DeepEqual(pages, wantPages) {
+		t.Errorf("pages = %v, want %v", pages, wantPages)
+	}
+	if !reflect.DeepEqual(labels, []string{"i", "1", "4"}) || dropped != 2 {
+		t.Errorf("labels = %q, dropped = %d", labels, dropped)
+	}
+}
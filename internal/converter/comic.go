@@ -0,0 +1,305 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/png"
+	"math"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/disintegration/imaging"
+	"github.com/yuanying/epub2azw3/internal/epub"
+)
+
+const (
+	// defaultComicGamma darkens the midtones of comic pages, which look washed
+	// out on e-ink screens.
+	defaultComicGamma = 1.8
+	// comicLevelsClip is the fraction of the darkest and of the brightest
+	// pixels ignored when stretching the levels, so that specks do not count.
+	comicLevelsClip = 0.005
+	// comicMinContrast is the smallest range of grey levels that is stretched.
+	// Flatter pages (blank or nearly blank) are left as is.
+	comicMinContrast = 16
+	// comicCropPadding is the margin kept around the content when cropping,
+	// relative to the longer side of the page.
+	comicCropPadding = 0.01
+	// comicMinCrop is the smallest fraction of the width or height that
+	// cropping may keep. A page with less content (e.g. a lone caption) is
+	// not cropped.
+	comicMinCrop = 0.5
+)
+
+// ComicPages applies the comic profile to a scanned page: the uniform borders
+// are cropped, the levels are stretched and the gamma of e-ink screens is
+// applied. A landscape image is a double-page spread and is split into its
+// two pages, returned in reading order: the right page first when rtl is set.
+func (o *ImageOptimizer) ComicPages(img image.Image, rtl bool) []image.Image {
+	page := autoLevels(cropBorders(img), o.ComicGamma)
+	b := page.Bounds()
+	if b.Dx() <= b.Dy() {
+		return []image.Image{page}
+	}
+	mid := b.Min.X + b.Dx()/2
+	left := imaging.Crop(page, image.Rect(b.Min.X, b.Min.Y, mid, b.Max.Y))
+	right := imaging.Crop(page, image.Rect(mid, b.Min.Y, b.Max.X, b.Max.Y))
+	if rtl {
+		return []image.Image{right, left}
+	}
+	return []image.Image{left, right}
+}
+
+// cropBorders crops the borders of the gutter colour (see newInkMap) around
+// the content of a page, keeping a small margin.
+func cropBorders(img image.Image) image.Image {
+	b := img.Bounds()
+	m := newInkMap(img)
+	content := m.trim(image.Rect(0, 0, m.width, m.height))
+	if content.Empty() {
+		return img
+	}
+	pad := int(comicCropPadding * float64(max(b.Dx(), b.Dy())))
+	r := m.imageRect(content, b).Inset(-pad).Intersect(b)
+	if r == b || float64(r.Dx()) < comicMinCrop*float64(b.Dx()) || float64(r.Dy()) < comicMinCrop*float64(b.Dy()) {
+		return img
+	}
+	return imaging.Crop(img, r)
+}
+
+// autoLevels stretches the grey levels of img to the full range and applies
+// gamma to the result. The same curve is applied to each colour channel.
+func autoLevels(img image.Image, gamma float64) image.Image {
+	nrgba := imaging.Clone(img)
+	var histogram [256]int
+	for i := 0; i < len(nrgba.Pix); i += 4 {
+		histogram[luminance(nrgba.Pix[i], nrgba.Pix[i+1], nrgba.Pix[i+2])]++
+	}
+
+	clip := int(comicLevelsClip * float64(len(nrgba.Pix)/4))
+	lo, hi := 0, 255
+	for n := histogram[lo]; n <= clip && lo < 255; n += histogram[lo] {
+		lo++
+	}
+	for n := histogram[hi]; n <= clip && hi > 0; n += histogram[hi] {
+		hi--
+	}
+	if hi-lo < comicMinContrast {
+		return img
+	}
+
+	var curve [256]uint8
+	for v := range curve {
+		t := min(1, max(0, float64(v-lo)/float64(hi-lo)))
+		curve[v] = uint8(math.Round(255 * math.Pow(t, gamma)))
+	}
+	for i := 0; i < len(nrgba.Pix); i += 4 {
+		nrgba.Pix[i] = curve[nrgba.Pix[i]]
+		nrgba.Pix[i+1] = curve[nrgba.Pix[i+1]]
+		nrgba.Pix[i+2] = curve[nrgba.Pix[i+2]]
+	}
+	return nrgba
+}
+
+// luminance returns the Rec. 601 luma of a colour.
+func luminance(r, g, b uint8) uint8 {
+	return uint8((299*int(r) + 587*int(g) + 114*int(b) + 500) / 1000)
+}
+
+// prepareComicPages applies the comic profile (ImageOptimizer.ComicPages) to
+// the images of the image-only pages of the spine, except the cover. The
+// processed images are added to reader as PNG, their manifest items are
+// renamed to a .png href, and their pages are regenerated to show them; a
+// fixed-layout page gets the viewport of its new image. The second page of a
+// split spread is added to the manifest and to the spine after the first one,
+// and both get page-spread properties.
+func (p *Pipeline) prepareComicPages(reader *epub.EPUBReader, opf *epub.OPF, cover *CoverInfo) {
+	optimizer := NewImageOptimizer(p.Options)
+	rtl := opf.PageProgressionDirection == "rtl"
+	fixedLayout := opf.FixedLayout()
+	firstSpread, secondSpread := "page-spread-left", "page-spread-right"
+	if rtl {
+		firstSpread, secondSpread = secondSpread, firstSpread
+	}
+
+	idUsed := func(id string) bool { _, ok := opf.Manifest[id]; return ok }
+	hrefUsed := func(href string) bool { _, ok := findManifestByHref(opf, href); return ok }
+
+	spine := make([]epub.SpineItem, 0, len(opf.Spine))
+	pages, spreads := 0, 0
+	for _, spineItem := range opf.Spine {
+		spine = append(spine, spineItem)
+		pageItem, ok := opf.Manifest[spineItem.IDRef]
+		if !ok || !isXHTML(pageItem.MediaType) {
+			continue
+		}
+		content, imageItem, ok := comicPage(reader, opf, pageItem)
+		if !ok || (cover != nil && cover.Href == imageItem.Href) {
+			continue
+		}
+
+		data, err := reader.ReadFile(imageItem.Href)
+		if err != nil {
+			p.recoverable("comic", fmt.Sprintf("failed to read image %q; page left as is", imageItem.Href), err)
+			continue
+		}
+		img, err := decodeComicImage(data, optimizer.MaxPixels)
+		if err != nil {
+			p.recoverable("comic", fmt.Sprintf("failed to decode image %q; page left as is", imageItem.Href), err)
+			continue
+		}
+
+		images := optimizer.ComicPages(img, rtl)
+		encoded := make([][]byte, len(images))
+		for i, page := range images {
+			var buf bytes.Buffer
+			if err := (&png.Encoder{CompressionLevel: png.BestSpeed}).Encode(&buf, page); err != nil {
+				p.recoverable("comic", fmt.Sprintf("failed to encode image %q; page left as is", imageItem.Href), err)
+				encoded = nil
+				break
+			}
+			encoded[i] = buf.Bytes()
+		}
+		if encoded == nil {
+			continue
+		}
+		imageItem.MediaType = "image/png"
+		if !strings.EqualFold(path.Ext(imageItem.Href), ".png") {
+			imageItem.Href = unusedName(strings.TrimSuffix(imageItem.Href, path.Ext(imageItem.Href))+".png", hrefUsed)
+		}
+		opf.Manifest[imageItem.ID] = imageItem
+		hrefs := []string{imageItem.Href}
+		if len(images) == 2 {
+			second := epub.ManifestItem{
+				ID:        unusedName(imageItem.ID+"-2", idUsed),
+				Href:      unusedName(strings.TrimSuffix(imageItem.Href, path.Ext(imageItem.Href))+"-2.png", hrefUsed),
+				MediaType: "image/png",
+			}
+			addManifestItem(opf, second, imageItem.ID)
+			hrefs = append(hrefs, second.Href)
+		}
+
+		title := strings.TrimSpace(content.Document.Find("title").First().Text())
+		for i, page := range images {
+			pageHref := pageItem.Href
+			if i > 0 {
+				secondPage := epub.ManifestItem{
+					ID:        unusedName(pageItem.ID+"-2", idUsed),
+					Href:      unusedName(strings.TrimSuffix(pageItem.Href, path.Ext(pageItem.Href))+"-2.xhtml", hrefUsed),
+					MediaType: "application/xhtml+xml",
+				}
+				addManifestItem(opf, secondPage, pageItem.ID)
+				pageHref = secondPage.Href
+				spine[len(spine)-1].Properties = withPageSpread(spineItem.Properties, firstSpread)
+				spine = append(spine, epub.SpineItem{
+					IDRef:      secondPage.ID,
+					Linear:     spineItem.Linear,
+					Properties: withPageSpread(spineItem.Properties, secondSpread),
+				})
+				spreads++
+			}
+			reader.AddFile(hrefs[i], encoded[i])
+			src := relativeTo(path.Dir(pageHref), hrefs[i])
+			reader.AddFile(pageHref, comicPageXHTML(title, src, page.Bounds().Size(), content.BodyAttrs, fixedLayout))
+		}
+		pages++
+	}
+	opf.Spine = spine
+	p.logger.Info(fmt.Sprintf("comic: %d pages processed, %d spreads split", pages, spreads), "stage", "comic")
+}
+
+// comicPage loads a spine page and returns it with the manifest item of its
+// image when it is an image-only page (see isImagePage) with a single image.
+func comicPage(reader *epub.EPUBReader, opf *epub.OPF, pageItem epub.ManifestItem) (*epub.Content, epub.ManifestItem, bool) {
+	data, err := reader.ReadFile(pageItem.Href)
+	if err != nil {
+		return nil, epub.ManifestItem{}, false
+	}
+	content, err := epub.LoadContent(pageItem.ID, pageItem.Href, data)
+	if err != nil || !isImagePage(content.Document) {
+		return nil, epub.ManifestItem{}, false
+	}
+	imgs := content.Document.Find("body img[src]")
+	if imgs.Length() != 1 {
+		return nil, epub.ManifestItem{}, false
+	}
+	src, _ := imgs.Attr("src")
+	imageItem, ok := findManifestByHref(opf, path.Join(path.Dir(pageItem.Href), src))
+	if !ok || !isImage(imageItem.MediaType) || normalizeMediaType(imageItem.MediaType) == "image/gif" {
+		return nil, epub.ManifestItem{}, false
+	}
+	return content, imageItem, true
+}
+
+// decodeComicImage decodes an image, refusing images of more than maxPixels
+// pixels.
+func decodeComicImage(data []byte, maxPixels int) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if pixels := uint64(cfg.Width) * uint64(cfg.Height); maxPixels > 0 && pixels > uint64(maxPixels) {
+		return nil, fmt.Errorf("image too large to decode: %dx%d (%d pixels)", cfg.Width, cfg.Height, pixels)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// comicPageXHTML returns a page showing a single image. The lang and dir
+// attributes of the original page are kept. A fixed-layout page has the size
+// of the image and the image fills it.
+func comicPageXHTML(title, src string, size image.Point, attrs map[string]string, fixedLayout bool) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<html xmlns="http://www.w3.org/1999/xhtml"`)
+	for _, attr := range []string{"lang", "xml:lang", "dir"} {
+		if val, ok := attrs[attr]; ok {
+			fmt.Fprintf(&b, ` %s="%s"`, attr, html.EscapeString(val))
+		}
+	}
+	fmt.Fprintf(&b, ">\n<head><title>%s</title>", html.EscapeString(title))
+	if fixedLayout {
+		fmt.Fprintf(&b, `<meta name="viewport" content="width=%d, height=%d"/>`, size.X, size.Y)
+	}
+	b.WriteString("</head>\n<body>")
+	if fixedLayout {
+		fmt.Fprintf(&b, `<div style="position:absolute;left:0;top:0;width:100%%;height:100%%;"><img src="%s" alt="" style="width:100%%;height:100%%;"/></div>`, html.EscapeString(src))
+	} else {
+		fmt.Fprintf(&b, `<div><img src="%s" alt=""/></div>`, html.EscapeString(src))
+	}
+	b.WriteString("</body>\n</html>\n")
+	return []byte(b.String())
+}
+
+// addManifestItem adds item to the manifest, after the item with the id after.
+func addManifestItem(opf *epub.OPF, item epub.ManifestItem, after string) {
+	opf.Manifest[item.ID] = item
+	i := slices.Index(opf.ManifestOrder, after)
+	opf.ManifestOrder = slices.Insert(opf.ManifestOrder, i+1, item.ID)
+}
+
+// withPageSpread returns properties with its page-spread property replaced
+// by spread.
+func withPageSpread(properties []string, spread string) []string {
+	var out []string
+	for _, prop := range properties {
+		if !strings.Contains(prop, "page-spread-") {
+			out = append(out, prop)
+		}
+	}
+	return append(out, spread)
+}
+
+// unusedName returns name, or name with a numeric suffix before its
+// extension when used reports that name is taken.
+func unusedName(name string, used func(string) bool) string {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 2; used(name); i++ {
+		name = fmt.Sprintf("%s-%d%s", stem, i, ext)
+	}
+	return name
+}
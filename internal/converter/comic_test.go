@@ -0,0 +1,168 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// scannedPage draws grey boxes on a white page.
+func scannedPage(width, height int, boxes map[image.Rectangle]uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for r, grey := range boxes {
+		draw.Draw(img, r, image.NewUniform(color.Gray{Y: grey}), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+// meanGrey returns the average luminance of img.
+func meanGrey(img image.Image) int {
+	b := img.Bounds()
+	sum := 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			sum += int(color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y)
+		}
+	}
+	return sum / (b.Dx() * b.Dy())
+}
+
+func TestImageOptimizer_ComicPagesCropsBorders(t *testing.T) {
+	o := NewImageOptimizer(ConvertOptions{})
+	page := scannedPage(600, 800, map[image.Rectangle]uint8{image.Rect(100, 100, 500, 700): 100})
+
+	pages := o.ComicPages(page, false)
+	if len(pages) != 1 {
+		t.Fatalf("ComicPages() returned %d pages, want 1", len(pages))
+	}
+	// 8px margin: 1% of the longer side.
+	if got, want := pages[0].Bounds().Size(), image.Pt(416, 616); got != want {
+		t.Errorf("cropped size = %v, want %v", got, want)
+	}
+}
+
+func TestImageOptimizer_ComicPagesKeepsSparsePage(t *testing.T) {
+	o := NewImageOptimizer(ConvertOptions{})
+	page := scannedPage(600, 800, map[image.Rectangle]uint8{image.Rect(250, 380, 350, 420): 0})
+
+	pages := o.ComicPages(page, false)
+	if got := pages[0].Bounds().Size(); got != image.Pt(600, 800) {
+		t.Errorf("size = %v, want the page not to be cropped", got)
+	}
+}
+
+func TestImageOptimizer_ComicPagesSplitsSpread(t *testing.T) {
+	o := NewImageOptimizer(ConvertOptions{})
+	spread := scannedPage(1600, 1000, map[image.Rectangle]uint8{
+		image.Rect(50, 50, 780, 950):     40,  // left page
+		image.Rect(820, 50, 1550, 950):   180, // right page
+		image.Rect(780, 50, 820, 950):    120, // binding shadow
+		image.Rect(1500, 900, 1550, 950): 0,
+	})
+
+	for _, rtl := range []bool{false, true} {
+		pages := o.ComicPages(spread, rtl)
+		if len(pages) != 2 {
+			t.Fatalf("rtl=%v: ComicPages() returned %d pages, want 2", rtl, len(pages))
+		}
+		for i, page := range pages {
+			if size := page.Bounds().Size(); size.X >= size.Y {
+				t.Errorf("rtl=%v: page %d is not portrait: %v", rtl, i, size)
+			}
+		}
+		first, second := meanGrey(pages[0]), meanGrey(pages[1])
+		if rightFirst := first > second; rightFirst != rtl {
+			t.Errorf("rtl=%v: page greys = %d, %d, want the right (lighter) page first only for rtl", rtl, first, second)
+		}
+	}
+}
+
+func TestAutoLevels(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 101, 1))
+	for x := 0; x <= 100; x++ {
+		img.Pix[x] = uint8(50 + x) // 50..150
+	}
+
+	got := autoLevels(img, 1)
+	at := func(x int) uint8 { return color.GrayModel.Convert(got.At(x, 0)).(color.Gray).Y }
+	if at(0) != 0 || at(100) != 255 {
+		t.Errorf("levels = %d..%d, want 0..255", at(0), at(100))
+	}
+	if v := at(50); v < 120 || v > 135 {
+		t.Errorf("midtone = %d, want about 128", v)
+	}
+
+	darker := autoLevels(img, defaultComicGamma)
+	if v := color.GrayModel.Convert(darker.At(50, 0)).(color.Gray).Y; v >= at(50) {
+		t.Errorf("midtone with gamma %v = %d, want darker than %d", defaultComicGamma, v, at(50))
+	}
+}
+
+func TestAutoLevels_FlatImage(t *testing.T) {
+	img := scannedPage(10, 10, nil)
+	if got := autoLevels(img, defaultComicGamma); got != image.Image(img) {
+		t.Error("flat image was modified")
+	}
+}
+
+func TestWithPageSpread(t *testing.T) {
+	got := withPageSpread([]string{"rendition:page-spread-center", "rendition:layout-pre-paginated"}, "page-spread-right")
+	want := []string{"rendition:layout-pre-paginated", "page-spread-right"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("withPageSpread() = %v, want %v", got, want)
+	}
+}
+
+func TestUnusedName(t *testing.T) {
+	used := map[string]bool{"img/p1-2.png": true, "img/p1-2-2.png": true}
+	if got := unusedName("img/p1-2.png", func(name string) bool { return used[name] }); got != "img/p1-2-3.png" {
+		t.Errorf("unusedName() = %q, want %q", got, "img/p1-2-3.png")
+	}
+}
+
+func TestPrepareComicPages_PNGHrefs(t *testing.T) {
+	p := NewPipeline(ConvertOptions{
+		InputPath:         createComicSpreadTestEPUB(t, t.TempDir()),
+		MaxImageSizeBytes: 2 * 1024 * 1024,
+		Comic:             true,
+	})
+	reader, opf, err := p.parseEPUB()
+	if err != nil {
+		t.Fatalf("parseEPUB() error = %v", err)
+	}
+	defer reader.Close()
+	p.prepareComicPages(reader, opf, DetectCoverInfo(opf, reader))
+
+	for id, want := range map[string]string{"i1": "OEBPS/images/p1.png", "i1-2": "OEBPS/images/p1-2.png"} {
+		item := opf.Manifest[id]
+		if item.Href != want || item.MediaType != "image/png" {
+			t.Errorf("manifest %s = %s (%s), want %s (image/png)", id, item.Href, item.MediaType, want)
+			continue
+		}
+		data, err := reader.ReadFile(item.Href)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", item.Href, err)
+		}
+		if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s is not a PNG: %v", item.Href, err)
+		}
+	}
+	if cover := opf.Manifest["cover"]; cover.Href != "OEBPS/images/cover.jpg" {
+		t.Errorf("cover href = %s, want it unchanged", cover.Href)
+	}
+	for id, want := range map[string]string{"p1": `src="../images/p1.png"`, "p1-2": `src="../images/p1-2.png"`} {
+		data, err := reader.ReadFile(opf.Manifest[id].Href)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", opf.Manifest[id].Href, err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Errorf("page %s does not show %s:\n%s", id, want, data)
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package converter
 
 import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
 	"path/filepath"
 	"strings"
 
+	"github.com/disintegration/imaging"
 	"github.com/yuanying/epub2azw3/internal/epub"
 	"github.com/yuanying/epub2azw3/internal/mobi"
 )
@@ -54,6 +59,34 @@ func ComputeCoverOffset(cover *CoverInfo, mapper *mobi.ImageMapper) (uint32, boo
 	return uint32(idx), true
 }
 
+// thumbnailHeight is the height in pixels of the cover thumbnail (EXTH 202)
+// that Kindle shows in the library.
+const thumbnailHeight = 330
+
+// thumbnailPath is the ImageMapper path of the cover thumbnail. It is not an
+// EPUB path, so no img element refers to it.
+const thumbnailPath = "epub2azw3:cover-thumbnail"
+
+// CoverThumbnail scales a cover image to thumbnailHeight pixels high and
+// encodes it as JPEG. Smaller covers are not enlarged, and transparent areas
+// become white.
+func CoverThumbnail(data []byte) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover image: %w", err)
+	}
+	if src.Bounds().Dy() > thumbnailHeight {
+		src = imaging.Resize(src, 0, thumbnailHeight, imaging.Lanczos)
+	}
+	bounds := src.Bounds()
+	thumbnail := imaging.Overlay(imaging.New(bounds.Dx(), bounds.Dy(), color.White), src, image.Pt(0, 0), 1)
+	data, err = encodeJPEG(thumbnail, defaultJPEGQuality)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode cover thumbnail: %w", err)
+	}
+	return data, nil
+}
+
 func detectCoverByProperty(opf *epub.OPF) *CoverInfo {
 	for _, item := range orderedManifestItems(opf) {
 		if !isImage(item.MediaType) {
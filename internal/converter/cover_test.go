@@ -1,6 +1,9 @@
 package converter
 
 import (
+	"bytes"
+	"image"
+	"image/jpeg"
 	"testing"
 
 	"github.com/yuanying/epub2azw3/internal/epub"
@@ -184,3 +187,36 @@ func TestComputeCoverOffset_NotFound(t *testing.T) {
 		t.Fatal("ComputeCoverOffset() ok = true, want false")
 	}
 }
+
+func TestCoverThumbnail(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		wantSize image.Point
+	}{
+		{"large cover", createJPEGImage(t, 1200, 1800), image.Pt(220, 330)},
+		{"png cover", createPNGImage(t, 600, 900), image.Pt(220, 330)},
+		{"small cover", createJPEGImage(t, 100, 150), image.Pt(100, 150)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := CoverThumbnail(tt.data)
+			if err != nil {
+				t.Fatalf("CoverThumbnail() error = %v", err)
+			}
+			cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("thumbnail is not a JPEG: %v", err)
+			}
+			if got := image.Pt(cfg.Width, cfg.Height); got != tt.wantSize {
+				t.Errorf("thumbnail size = %v, want %v", got, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestCoverThumbnail_InvalidImage(t *testing.T) {
+	if _, err := CoverThumbnail([]byte("not an image")); err == nil {
+		t.Fatal("CoverThumbnail() should fail for invalid image data")
+	}
+}
@@ -2,9 +2,13 @@ package converter
 
 import (
 	"fmt"
+	"net/url"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
+
+	"github.com/yuanying/epub2azw3/internal/mobi"
 )
 
 // pxValueRe matches px values for conversion to em.
@@ -19,6 +23,25 @@ var declarationRe = regexp.MustCompile(`(?i)^\s*([\w-]+)\s*:\s*(.*?)\s*;?\s*$`)
 // negativeMarginRe matches negative numeric values in margin declarations.
 var negativeMarginRe = regexp.MustCompile(`-\d`)
 
+// resolveCSSURLs rewrites relative url(...) values in a stylesheet located in
+// cssDir to absolute EPUB paths, so that they match manifest Href paths.
+// Absolute URLs, data URIs and fragment-only references are left unchanged.
+func resolveCSSURLs(css, cssDir string) string {
+	return mobi.CSSURLRe.ReplaceAllStringFunc(css, func(match string) string {
+		submatch := mobi.CSSURLRe.FindStringSubmatch(match)
+		raw := submatch[1] + submatch[2] + submatch[3]
+		u, err := url.Parse(raw)
+		if err != nil || u.IsAbs() || u.Path == "" || strings.HasPrefix(u.Path, "/") {
+			return match
+		}
+		resolved := path.Clean(path.Join(cssDir, u.Path))
+		if u.Fragment != "" {
+			resolved += "#" + u.Fragment
+		}
+		return `url("` + resolved + `")`
+	})
+}
+
 // TransformCSS removes forbidden CSS properties and converts units.
 // It processes the CSS declaration by declaration, preserving structure.
 // CSS comments and string literals are passed through without transformation.
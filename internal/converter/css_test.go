@@ -303,3 +303,25 @@ func TestTransformCSS_MultipleDeclarations(t *testing.T) {
 		t.Fatal("color should be preserved")
 	}
 }
+
+func TestResolveCSSURLs(t *testing.T) {
+	tests := []struct {
+		name, css, dir, want string
+	}{
+		{"quoted relative", `src: url("../fonts/a.ttf")`, "OEBPS/styles", `src: url("OEBPS/fonts/a.ttf")`},
+		{"single quoted", `src: url('a.otf')`, "OEBPS", `src: url("OEBPS/a.otf")`},
+		{"unquoted", `background: url( img/bg.png )`, "OEBPS", `background: url("OEBPS/img/bg.png")`},
+		{"root directory", `src: url(a.ttf)`, ".", `src: url("a.ttf")`},
+		{"fragment kept", `src: url(../fonts/a.svg#f)`, "OEBPS/styles", `src: url("OEBPS/fonts/a.svg#f")`},
+		{"absolute URL", `src: url(https://example.com/a.ttf)`, "OEBPS", `src: url(https://example.com/a.ttf)`},
+		{"data URI", `src: url(data:font/ttf;base64,AAAA)`, "OEBPS", `src: url(data:font/ttf;base64,AAAA)`},
+		{"fragment only", `fill: url(#grad)`, "OEBPS", `fill: url(#grad)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveCSSURLs(tt.css, tt.dir); got != tt.want {
+				t.Errorf("resolveCSSURLs(%q, %q) = %q, want %q", tt.css, tt.dir, got, tt.want)
+			}
+		})
+	}
+}
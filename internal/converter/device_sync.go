@@ -0,0 +1,382 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Directories of a Kindle that Sync writes to, relative to its mount point.
+const (
+	deviceDocumentsDir  = "documents"
+	deviceThumbnailsDir = "system/thumbnails"
+)
+
+// syncManifestName is the name of the manifest of the synced books, kept in
+// the documents directory of the device.
+const syncManifestName = ".epub2azw3-sync.json"
+
+// SyncOptions holds the options for syncing books to a Kindle.
+type SyncOptions struct {
+	// DevicePath is the mount point of the Kindle. It must have a documents
+	// directory.
+	DevicePath string
+	// Sources are the EPUB and CBZ files to sync, and directories that are
+	// searched for them.
+	Sources []string
+	// Convert holds the conversion options of every book. InputPath and
+	// OutputPath are set for each book, the ASIN is derived from each book's
+	// identifier, and the thumbnail is written to the thumbnail directory of
+	// the device.
+	Convert ConvertOptions
+	// Prune removes the books synced before whose sources are no longer among
+	// Sources.
+	Prune  bool
+	Logger *slog.Logger
+}
+
+// SyncResult lists the source paths of the books by what Sync did with them.
+type SyncResult struct {
+	Converted []string
+	Skipped   []string // unchanged since they were synced
+	Removed   []string // pruned
+	Failed    []string
+}
+
+// syncManifest records the books synced to a device, keyed by the absolute
+// path of their source.
+type syncManifest struct {
+	Books map[string]syncEntry `json:"books"`
+}
+
+// syncEntry is a synced book: the SHA-256 of its source, the conversion
+// options it was converted with (see syncOptionsKey) and the files written
+// for it, relative to the mount point with forward slashes.
+type syncEntry struct {
+	Hash    string   `json:"hash"`
+	Options string   `json:"options"`
+	Files   []string `json:"files"`
+}
+
+// Sync converts books and copies them to a mounted Kindle: the book and its
+// APNX go to documents/, the cover thumbnail to system/thumbnails/. Books
+// whose source and conversion options have not changed since they were
+// synced, and whose files are still on the device, are skipped. A book that
+// fails to convert does not stop the others; Sync returns an error naming the
+// failed count after saving the manifest.
+func Sync(opts SyncOptions) (*SyncResult, error) {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(discardHandler{})
+	}
+
+	documents := filepath.Join(opts.DevicePath, deviceDocumentsDir)
+	if info, err := os.Stat(documents); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("not a Kindle: %s has no documents directory", opts.DevicePath)
+	}
+	sources, err := findSyncSources(opts.Sources)
+	if err != nil {
+		return nil, err
+	}
+	manifestPath := filepath.Join(documents, syncManifestName)
+	manifest, err := loadSyncManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp("", "epub2azw3-sync-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+	options := syncOptionsKey(opts.Convert)
+
+	result := &SyncResult{}
+	owners := make(map[string]string) // book file -> source
+	for source, entry := range manifest.Books {
+		if len(entry.Files) > 0 {
+			owners[entry.Files[0]] = source
+		}
+	}
+	for i, source := range sources {
+		logger.Info(fmt.Sprintf("book %d/%d: %s", i+1, len(sources), source), "stage", "sync")
+		hash, err := fileSHA256(source)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to read %s: %v", source, err), "stage", "sync")
+			result.Failed = append(result.Failed, source)
+			continue
+		}
+		old, synced := manifest.Books[source]
+		if synced && old.Hash == hash && old.Options == options && deviceFilesExist(opts.DevicePath, old.Files) {
+			result.Skipped = append(result.Skipped, source)
+			continue
+		}
+
+		bookFile := path.Join(deviceDocumentsDir, strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))+".azw3")
+		if owner, ok := owners[bookFile]; ok && owner != source {
+			logger.Error(fmt.Sprintf("%s would overwrite %s of %s, skipping", source, bookFile, owner), "stage", "sync")
+			result.Failed = append(result.Failed, source)
+			continue
+		}
+		files, err := syncBook(opts, source, bookFile, staging, i, old.Files)
+		if err != nil {
+			logger.Error(fmt.Sprintf("failed to sync %s: %v", source, err), "stage", "sync")
+			result.Failed = append(result.Failed, source)
+			continue
+		}
+		for _, file := range old.Files {
+			if !slices.Contains(files, file) {
+				removeDeviceFile(opts.DevicePath, file, logger)
+			}
+		}
+		manifest.Books[source] = syncEntry{Hash: hash, Options: options, Files: files}
+		owners[bookFile] = source
+		result.Converted = append(result.Converted, source)
+	}
+
+	if opts.Prune {
+		for source, entry := range manifest.Books {
+			if slices.Contains(sources, source) {
+				continue
+			}
+			for _, file := range entry.Files {
+				removeDeviceFile(opts.DevicePath, file, logger)
+			}
+			delete(manifest.Books, source)
+			result.Removed = append(result.Removed, source)
+		}
+		slices.Sort(result.Removed)
+	}
+
+	if err := saveSyncManifest(manifestPath, manifest); err != nil {
+		return result, err
+	}
+	if len(result.Failed) > 0 {
+		return result, fmt.Errorf("%d of %d books failed to sync", len(result.Failed), len(sources))
+	}
+	return result, nil
+}
+
+// syncBook converts a book into its own staging directory, writing its
+// thumbnail straight to the device, and copies the book and its APNX to the
+// device. It returns the written files, the book first. oldFiles are the
+// files of the book's previous sync; a thumbnail that is not among them is
+// removed again when the book fails to sync.
+func syncBook(opts SyncOptions, source, bookFile, staging string, n int, oldFiles []string) (files []string, err error) {
+	dir := filepath.Join(staging, fmt.Sprintf("%04d", n))
+	convert := opts.Convert
+	convert.InputPath = source
+	convert.OutputPath = filepath.Join(dir, path.Base(bookFile))
+	convert.ASIN = ""
+	convert.ThumbnailDir = filepath.Join(opts.DevicePath, filepath.FromSlash(deviceThumbnailsDir))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	p := NewPipeline(convert)
+	var thumbnail string
+	defer func() {
+		if err != nil && thumbnail != "" && !slices.Contains(oldFiles, thumbnail) {
+			removeDeviceFile(opts.DevicePath, thumbnail, p.logger)
+		}
+	}()
+	err = p.Convert()
+	if p.thumbnailPath != "" {
+		thumbnail = path.Join(deviceThumbnailsDir, filepath.Base(p.thumbnailPath))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	staged := [][2]string{{convert.OutputPath, bookFile}}
+	if apnx := APNXPath(convert.OutputPath); fileExists(apnx) {
+		staged = append(staged, [2]string{apnx, path.Join(deviceDocumentsDir, filepath.Base(apnx))})
+	}
+	for _, file := range staged {
+		if err := copyFile(file[0], filepath.Join(opts.DevicePath, filepath.FromSlash(file[1]))); err != nil {
+			return nil, err
+		}
+		files = append(files, file[1])
+	}
+	if thumbnail != "" {
+		files = append(files, thumbnail)
+	}
+	return files, nil
+}
+
+// findSyncSources returns the absolute paths of the EPUB and CBZ files among
+// paths and in the directories among them, sorted and without duplicates.
+func findSyncSources(paths []string) ([]string, error) {
+	var sources []string
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read source: %w", err)
+		}
+		if !info.IsDir() {
+			sources = append(sources, p)
+			continue
+		}
+		err = filepath.WalkDir(p, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(name)) {
+			case ".epub", ".cbz":
+				if !d.IsDir() {
+					sources = append(sources, name)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search %s: %w", p, err)
+		}
+	}
+	for i, source := range sources {
+		abs, err := filepath.Abs(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", source, err)
+		}
+		sources[i] = abs
+	}
+	slices.Sort(sources)
+	return slices.Compact(sources), nil
+}
+
+// loadSyncManifest reads the manifest of a device; a missing manifest is an
+// empty one.
+func loadSyncManifest(path string) (*syncManifest, error) {
+	manifest := &syncManifest{Books: make(map[string]syncEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return manifest, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync manifest: %w", err)
+	}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse sync manifest %s: %w", path, err)
+	}
+	if manifest.Books == nil {
+		manifest.Books = make(map[string]syncEntry)
+	}
+	return manifest, nil
+}
+
+// saveSyncManifest writes the manifest of a device.
+func saveSyncManifest(path string, manifest *syncManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode sync manifest: %w", err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write sync manifest: %w", err)
+	}
+	return nil
+}
+
+// syncOptionsKey encodes the conversion options that change the synced
+// files. The ASIN and the thumbnail directory are set by Sync itself, and
+// the logging and strict options do not change the output.
+func syncOptionsKey(opts ConvertOptions) string {
+	key, _ := json.Marshal(struct {
+		Format            string `json:"format"`
+		MaxImageWidth     int    `json:"maxImageWidth"`
+		JPEGQuality       int    `json:"jpegQuality"`
+		MaxImageSizeBytes int    `json:"maxImageSizeBytes"`
+		NoImages          bool   `json:"noImages"`
+		WritingMode       string `json:"writingMode"`
+		PanelView         bool   `json:"panelView"`
+		Comic             bool   `json:"comic"`
+		APNX              string `json:"apnx"`
+		CDEType           string `json:"cdeType"`
+	}{
+		Format:            opts.Format,
+		MaxImageWidth:     opts.MaxImageWidth,
+		JPEGQuality:       opts.JPEGQuality,
+		MaxImageSizeBytes: opts.MaxImageSizeBytes,
+		NoImages:          opts.NoImages,
+		WritingMode:       opts.WritingMode,
+		PanelView:         opts.PanelView,
+		Comic:             opts.Comic,
+		APNX:              opts.APNX,
+		CDEType:           opts.CDEType,
+	})
+	return string(key)
+}
+
+// fileSHA256 returns the hexadecimal SHA-256 of a file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// deviceFilesExist reports whether all of files are on the device.
+func deviceFilesExist(devicePath string, files []string) bool {
+	for _, file := range files {
+		if !fileExists(filepath.Join(devicePath, filepath.FromSlash(file))) {
+			return false
+		}
+	}
+	return len(files) > 0
+}
+
+// removeDeviceFile removes a synced file from the device. Files that are
+// already gone are ignored.
+func removeDeviceFile(devicePath, file string, logger *slog.Logger) {
+	err := os.Remove(filepath.Join(devicePath, filepath.FromSlash(file)))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Warn(fmt.Sprintf("failed to remove %s: %v", file, err), "stage", "sync")
+	}
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// copyFile copies src to dst, creating the directory of dst.
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", src, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := writeFileAtomic(dst, data); err != nil {
+		return fmt.Errorf("failed to copy to %s: %w", dst, err)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it, so that an interrupted copy does not leave a truncated file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
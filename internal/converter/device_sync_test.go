@@ -0,0 +1,133 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSync(t *testing.T) {
+	sourceDir := t.TempDir()
+	covered := createOptimizedImageTestEPUB(t, sourceDir)
+	paged := createPageListTestEPUB(t, sourceDir)
+	device := t.TempDir()
+	if err := os.Mkdir(filepath.Join(device, "documents"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	thumbnail := filepath.Join(device, "system", "thumbnails", ThumbnailSidecarName(BookASIN("", "urn:uuid:img-opt-test"), CDETypeEBOK))
+
+	sync := func(prune bool, sources ...string) *SyncResult {
+		t.Helper()
+		result, err := Sync(SyncOptions{DevicePath: device, Sources: sources, Prune: prune})
+		if err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		return result
+	}
+
+	result := sync(false, sourceDir)
+	if want := []string{covered, paged}; !reflect.DeepEqual(result.Converted, want) {
+		t.Fatalf("Converted = %q, want %q", result.Converted, want)
+	}
+	for _, file := range []string{
+		"documents/opt-images.azw3",
+		"documents/opt-images.apnx",
+		"documents/paged.azw3",
+		"documents/paged.apnx",
+		"documents/" + syncManifestName,
+	} {
+		if !fileExists(filepath.Join(device, file)) {
+			t.Errorf("%s not on the device", file)
+		}
+	}
+	if !fileExists(thumbnail) {
+		t.Errorf("thumbnail %s not on the device", thumbnail)
+	}
+
+	// Unchanged books are skipped, unless their files are gone from the device
+	if result := sync(false, sourceDir); len(result.Converted) != 0 || len(result.Skipped) != 2 {
+		t.Errorf("second sync converted %q and skipped %q, want all skipped", result.Converted, result.Skipped)
+	}
+	if err := os.Remove(thumbnail); err != nil {
+		t.Fatal(err)
+	}
+	if result := sync(false, sourceDir); !reflect.DeepEqual(result.Converted, []string{covered}) {
+		t.Errorf("sync after removing the thumbnail converted %q, want %q", result.Converted, covered)
+	}
+
+	// Without --prune, books missing from the sources stay on the device
+	if result := sync(false, paged); len(result.Removed) != 0 || !fileExists(filepath.Join(device, "documents/opt-images.azw3")) {
+		t.Errorf("sync without prune removed %q", result.Removed)
+	}
+	result = sync(true, paged)
+	if !reflect.DeepEqual(result.Removed, []string{covered}) {
+		t.Errorf("Removed = %q, want %q", result.Removed, covered)
+	}
+	for _, file := range []string{"documents/opt-images.azw3", "documents/opt-images.apnx"} {
+		if fileExists(filepath.Join(device, file)) {
+			t.Errorf("%s not removed", file)
+		}
+	}
+	if fileExists(thumbnail) {
+		t.Error("thumbnail of the removed book not removed")
+	}
+	manifest, err := loadSyncManifest(filepath.Join(device, "documents", syncManifestName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := manifest.Books[covered]; ok || len(manifest.Books) != 1 {
+		t.Errorf("manifest books = %v, want only %s", manifest.Books, paged)
+	}
+}
+
+func TestSync_OptionsChanged(t *testing.T) {
+	device := t.TempDir()
+	if err := os.Mkdir(filepath.Join(device, "documents"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	source := createPageListTestEPUB(t, t.TempDir())
+	sync := func(convert ConvertOptions) *SyncResult {
+		t.Helper()
+		result, err := Sync(SyncOptions{DevicePath: device, Sources: []string{source}, Convert: convert})
+		if err != nil {
+			t.Fatalf("Sync() error = %v", err)
+		}
+		return result
+	}
+
+	sync(ConvertOptions{})
+	if result := sync(ConvertOptions{APNX: APNXNone}); len(result.Converted) != 1 {
+		t.Errorf("sync with other options skipped %q, want it converted", result.Skipped)
+	}
+	if fileExists(filepath.Join(device, "documents", "paged.apnx")) {
+		t.Error("APNX of the previous conversion not removed")
+	}
+	if result := sync(ConvertOptions{APNX: APNXNone}); len(result.Skipped) != 1 {
+		t.Errorf("sync with the same options converted %q, want it skipped", result.Converted)
+	}
+}
+
+func TestSync_NameCollision(t *testing.T) {
+	device := t.TempDir()
+	if err := os.Mkdir(filepath.Join(device, "documents"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	first := createPageListTestEPUB(t, t.TempDir())
+	second := createPageListTestEPUB(t, t.TempDir())
+
+	result, err := Sync(SyncOptions{DevicePath: device, Sources: []string{first, second}})
+	if err == nil {
+		t.Fatal("Sync() should fail when two books have the same name")
+	}
+	if len(result.Converted) != 1 || len(result.Failed) != 1 {
+		t.Errorf("Converted = %q, Failed = %q, want one each", result.Converted, result.Failed)
+	}
+}
+
+func TestSync_NotAKindle(t *testing.T) {
+	source := createPageListTestEPUB(t, t.TempDir())
+	if _, err := Sync(SyncOptions{DevicePath: t.TempDir(), Sources: []string{source}}); err == nil {
+		t.Fatal("Sync() should fail without a documents directory")
+	}
+}
@@ -0,0 +1,131 @@
+package converter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/yuanying/epub2azw3/internal/epub"
+	"github.com/yuanying/epub2azw3/internal/mobi"
+)
+
+// Kindle book types of fixed-layout books (EXTH 123).
+const (
+	BookTypeComic    = "comic"
+	BookTypeChildren = "children"
+)
+
+// Viewport is the page size of a fixed-layout page in CSS pixels.
+type Viewport struct {
+	Width  int
+	Height int
+}
+
+// String returns the viewport as "<width>x<height>", the format of the
+// Kindle original-resolution.
+func (v Viewport) String() string {
+	return fmt.Sprintf("%dx%d", v.Width, v.Height)
+}
+
+// ParseViewport parses the content of a viewport meta element, e.g.
+// "width=1072, height=1448". Both the width and the height are required.
+func ParseViewport(content string) (Viewport, bool) {
+	var v Viewport
+	for _, field := range strings.FieldsFunc(content, func(r rune) bool { return r == ',' || r == ';' }) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || n <= 0 {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "width":
+			v.Width = n
+		case "height":
+			v.Height = n
+		}
+	}
+	return v, v.Width > 0 && v.Height > 0
+}
+
+// pageViewport returns the viewport declared in the head of a page.
+func pageViewport(doc *goquery.Document) (Viewport, bool) {
+	content, ok := doc.Find(`head meta[name="viewport"]`).First().Attr("content")
+	if !ok {
+		return Viewport{}, false
+	}
+	return ParseViewport(content)
+}
+
+// isImagePage reports whether the body of a page holds images and no text,
+// as the pages of a comic do.
+func isImagePage(doc *goquery.Document) bool {
+	body := doc.Find("body")
+	return body.Find("img").Length() > 0 && strings.TrimSpace(body.Text()) == ""
+}
+
+// FullPageImages returns the src paths of the images of the image-only pages
+// (see isImagePage). On a fixed-layout page they fill the viewport and must
+// not be downsized to the reflowable image width.
+func FullPageImages(chapters []*ChapterContent) map[string]bool {
+	images := make(map[string]bool)
+	for _, chapter := range chapters {
+		if !isImagePage(chapter.Document) {
+			continue
+		}
+		chapter.Document.Find("body img[src]").Each(func(_ int, s *goquery.Selection) {
+			src, _ := s.Attr("src")
+			images[src] = true
+		})
+	}
+	return images
+}
+
+// buildFixedLayout returns the Kindle fixed-layout description of a
+// pre-paginated book and the viewport meta elements of its pages, keyed by
+// chapter id. The original resolution is the Kindle original-resolution meta,
+// or else the most common page viewport. The book type is the Kindle
+// book-type meta, or else comic when every page is an image page and
+// children otherwise.
+func buildFixedLayout(opf *epub.OPF, chapters []*ChapterContent) (*mobi.FixedLayout, map[string][]byte) {
+	heads := make(map[string][]byte)
+	counts := make(map[Viewport]int)
+	var common Viewport
+	allImages := len(chapters) > 0
+	for _, chapter := range chapters {
+		allImages = allImages && isImagePage(chapter.Document)
+		v, ok := pageViewport(chapter.Document)
+		if !ok {
+			continue
+		}
+		heads[chapter.ID] = fmt.Appendf(nil, `<meta name="viewport" content="width=%d, height=%d"/>`, v.Width, v.Height)
+		counts[v]++
+		if counts[v] > counts[common] {
+			common = v
+		}
+	}
+
+	fl := &mobi.FixedLayout{
+		OriginalResolution: opf.Rendition.OriginalResolution,
+		BookType:           opf.Rendition.BookType,
+	}
+	if fl.OriginalResolution == "" && counts[common] > 0 {
+		fl.OriginalResolution = common.String()
+	}
+	if fl.BookType == "" {
+		fl.BookType = BookTypeChildren
+		if allImages {
+			fl.BookType = BookTypeComic
+		}
+	}
+	switch opf.Rendition.Orientation {
+	case "portrait", "landscape":
+		fl.OrientationLock = opf.Rendition.Orientation
+	case "auto":
+		fl.OrientationLock = "none"
+	}
+	return fl, heads
+}
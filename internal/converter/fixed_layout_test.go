@@ -0,0 +1,79 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/yuanying/epub2azw3/internal/epub"
+)
+
+func TestParseViewport(t *testing.T) {
+	tests := []struct {
+		content string
+		want    Viewport
+		ok      bool
+	}{
+		{"width=1072, height=1448", Viewport{1072, 1448}, true},
+		{"height=800;width=600", Viewport{600, 800}, true},
+		{"width=device-width, initial-scale=1", Viewport{}, false},
+		{"width=600", Viewport{Width: 600}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseViewport(tt.content)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseViewport(%q) = %+v, %v, want %+v, %v", tt.content, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBuildFixedLayout(t *testing.T) {
+	chapter := func(id, viewport, body string) *ChapterContent {
+		html := `<html><head>`
+		if viewport != "" {
+			html += `<meta name="viewport" content="` + viewport + `"/>`
+		}
+		html += `</head><body>` + body + `</body></html>`
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &ChapterContent{ID: id, Document: doc}
+	}
+
+	chapters := []*ChapterContent{
+		chapter("ch01", "width=600, height=800", `<img src="a.jpg"/>`),
+		chapter("ch02", "width=1200, height=1600", `<img src="b.jpg"/>`),
+		chapter("ch03", "width=1200, height=1600", `<div><img src="c.jpg"/></div>`),
+		chapter("ch04", "", `<img src="d.jpg"/>`),
+	}
+	fl, heads := buildFixedLayout(&epub.OPF{Rendition: epub.Rendition{Orientation: "auto"}}, chapters)
+	if fl.OriginalResolution != "1200x1600" {
+		t.Errorf("OriginalResolution = %q, want the most common viewport 1200x1600", fl.OriginalResolution)
+	}
+	if fl.BookType != BookTypeComic {
+		t.Errorf("BookType = %q, want %q", fl.BookType, BookTypeComic)
+	}
+	if fl.OrientationLock != "none" {
+		t.Errorf("OrientationLock = %q, want none", fl.OrientationLock)
+	}
+	if got := string(heads["ch01"]); got != `<meta name="viewport" content="width=600, height=800"/>` {
+		t.Errorf("heads[ch01] = %q", got)
+	}
+	if _, ok := heads["ch04"]; ok {
+		t.Error("head markup for a page without viewport")
+	}
+	if images := FullPageImages(chapters); len(images) != 4 || !images["c.jpg"] {
+		t.Errorf("FullPageImages() = %v", images)
+	}
+
+	chapters = append(chapters, chapter("ch05", "width=1200, height=1600", `<p>Once upon a time</p><img src="e.jpg"/>`))
+	opf := &epub.OPF{Rendition: epub.Rendition{OriginalResolution: "1072x1448"}}
+	fl, _ = buildFixedLayout(opf, chapters)
+	if fl.BookType != BookTypeChildren || fl.OriginalResolution != "1072x1448" || fl.OrientationLock != "" {
+		t.Errorf("FixedLayout = %+v, want children book with the meta resolution", fl)
+	}
+	if images := FullPageImages(chapters); images["e.jpg"] {
+		t.Error("image of a text page reported as a full-page image")
+	}
+}
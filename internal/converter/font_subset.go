@@ -0,0 +1,1103 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// sfnt versions (the first four bytes of a font file).
+const (
+	sfntVersionTrueType   = 0x00010000
+	sfntVersionApple      = 0x74727565 // "true"
+	sfntVersionCFF        = 0x4F54544F // "OTTO"
+	sfntVersionCollection = 0x74746366 // "ttcf"
+)
+
+// cffEndchar is a Type 2 charstring that draws nothing.
+var cffEndchar = []byte{0x0E}
+
+// droppedFontTables are removed from subset fonts: the digital signature is
+// invalidated by subsetting, and embedded bitmaps are not needed when the
+// outlines are present.
+var droppedFontTables = []string{"DSIG", "EBDT", "EBLC", "EBSC"}
+
+// CollectCodePoints returns every code point used in the text of an HTML
+// document, including ruby text. The upper and lower case forms of letters
+// are added for text-transform, and the space characters are always included.
+func CollectCodePoints(html string) (map[rune]bool, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	runes := map[rune]bool{' ': true, ' ': true, '　': true}
+	for _, r := range doc.Text() {
+		if unicode.IsControl(r) {
+			continue
+		}
+		runes[r] = true
+		if unicode.IsLetter(r) {
+			runes[unicode.ToUpper(r)] = true
+			runes[unicode.ToLower(r)] = true
+		}
+	}
+	return runes, nil
+}
+
+// SubsetFont removes the outlines of the glyphs of a TrueType (glyf/loca) or
+// OpenType (CFF) font that are not needed to render runes. The glyphs that are
+// kept are those mapped from runes by the cmap table, the glyphs they can be
+// substituted with by GSUB (e.g. vertical forms and ligatures) and the
+// components of composite glyphs.
+//
+// Glyph IDs are preserved: unused glyphs become empty rather than being
+// removed, so GSUB and GPOS remain valid without rewriting. The cmap table is
+// rebuilt to map only runes, and the hmtx and vmtx metrics of the unused
+// glyphs are zeroed.
+func SubsetFont(font []byte, runes map[rune]bool) ([]byte, error) {
+	version, tables, err := parseSFNT(font)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range []string{"head", "maxp", "cmap"} {
+		if _, ok := tables[tag]; !ok {
+			return nil, fmt.Errorf("%s table not found", tag)
+		}
+	}
+	if len(tables["maxp"]) < 6 || len(tables["head"]) < 54 {
+		return nil, fmt.Errorf("head or maxp table is truncated")
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(tables["maxp"][4:6]))
+
+	keep := map[int]bool{0: true} // .notdef
+	mapped := make(map[rune]int)
+	if err := cmapGlyphs(tables["cmap"], runes, numGlyphs, keep, mapped); err != nil {
+		return nil, fmt.Errorf("failed to parse cmap table: %w", err)
+	}
+	if gsub, ok := tables["GSUB"]; ok {
+		if err := gsubClosure(gsub, numGlyphs, keep); err != nil {
+			return nil, fmt.Errorf("failed to parse GSUB table: %w", err)
+		}
+	}
+
+	switch {
+	case tables["glyf"] != nil && tables["loca"] != nil:
+		if err := subsetGlyf(tables, numGlyphs, keep); err != nil {
+			return nil, err
+		}
+	case tables["CFF "] != nil:
+		cff, err := subsetCFF(tables["CFF "], keep)
+		if err != nil {
+			return nil, fmt.Errorf("failed to subset CFF table: %w", err)
+		}
+		tables["CFF "] = cff
+	default:
+		return nil, fmt.Errorf("font has neither glyf nor CFF outlines")
+	}
+
+	if cmap := subsetCmap(tables["cmap"], mapped); cmap != nil {
+		tables["cmap"] = cmap
+	}
+	for _, tags := range [][2]string{{"hhea", "hmtx"}, {"vhea", "vmtx"}} {
+		if tables[tags[0]] == nil || tables[tags[1]] == nil {
+			continue
+		}
+		hea, mtx, err := subsetMetrics(tables[tags[0]], tables[tags[1]], numGlyphs, keep)
+		if err != nil {
+			return nil, fmt.Errorf("failed to subset %s table: %w", tags[1], err)
+		}
+		tables[tags[0]], tables[tags[1]] = hea, mtx
+	}
+
+	for _, tag := range droppedFontTables {
+		delete(tables, tag)
+	}
+	return writeSFNT(version, tables), nil
+}
+
+// fontBuf reads big-endian values from font data. Out-of-range reads return
+// zero and record an error, so that parsers can check for it once.
+type fontBuf struct {
+	b   []byte
+	err error
+}
+
+func (f *fontBuf) ok(off, n int) bool {
+	if f.err != nil {
+		return false
+	}
+	if off < 0 || n < 0 || off+n > len(f.b) {
+		f.err = fmt.Errorf("read of %d bytes at offset %d is beyond the data (%d bytes)", n, off, len(f.b))
+		return false
+	}
+	return true
+}
+
+func (f *fontBuf) u8(off int) int {
+	if !f.ok(off, 1) {
+		return 0
+	}
+	return int(f.b[off])
+}
+
+func (f *fontBuf) u16(off int) int {
+	if !f.ok(off, 2) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(f.b[off:]))
+}
+
+func (f *fontBuf) u24(off int) int {
+	if !f.ok(off, 3) {
+		return 0
+	}
+	return int(f.b[off])<<16 | int(f.b[off+1])<<8 | int(f.b[off+2])
+}
+
+func (f *fontBuf) u32(off int) int {
+	if !f.ok(off, 4) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(f.b[off:]))
+}
+
+// uN reads an n-byte unsigned integer (1 <= n <= 4).
+func (f *fontBuf) uN(off, n int) int {
+	if !f.ok(off, n) {
+		return 0
+	}
+	v := 0
+	for _, b := range f.b[off : off+n] {
+		v = v<<8 | int(b)
+	}
+	return v
+}
+
+func (f *fontBuf) bytes(off, n int) []byte {
+	if !f.ok(off, n) {
+		return nil
+	}
+	return f.b[off : off+n]
+}
+
+// parseSFNT splits a font file into its tables.
+func parseSFNT(font []byte) (uint32, map[string][]byte, error) {
+	f := &fontBuf{b: font}
+	version := uint32(f.u32(0))
+	switch version {
+	case sfntVersionTrueType, sfntVersionApple, sfntVersionCFF:
+	case sfntVersionCollection:
+		return 0, nil, fmt.Errorf("font collections are not supported")
+	default:
+		return 0, nil, fmt.Errorf("unsupported font format %#08x", version)
+	}
+
+	n := f.u16(4)
+	tables := make(map[string][]byte, n)
+	for i := range n {
+		rec := 12 + 16*i
+		tag := string(f.bytes(rec, 4))
+		tables[tag] = f.bytes(f.u32(rec+8), f.u32(rec+12))
+	}
+	if f.err != nil {
+		return 0, nil, fmt.Errorf("failed to read table directory: %w", f.err)
+	}
+	return version, tables, nil
+}
+
+// writeSFNT assembles a font file from its tables, computing the table
+// checksums and the head checksum adjustment.
+func writeSFNT(version uint32, tables map[string][]byte) []byte {
+	tags := slices.Sorted(maps.Keys(tables))
+	if head, ok := tables["head"]; ok {
+		head = bytes.Clone(head)
+		binary.BigEndian.PutUint32(head[8:12], 0)
+		tables["head"] = head
+	}
+
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= len(tags) {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	out := make([]byte, 12+16*len(tags))
+	binary.BigEndian.PutUint32(out[0:4], version)
+	binary.BigEndian.PutUint16(out[4:6], uint16(len(tags)))
+	binary.BigEndian.PutUint16(out[6:8], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:10], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:12], uint16(len(tags)*16-searchRange))
+
+	headOffset := -1
+	for i, tag := range tags {
+		data := tables[tag]
+		rec := out[12+16*i:]
+		copy(rec[0:4], tag)
+		binary.BigEndian.PutUint32(rec[4:8], fontChecksum(data))
+		binary.BigEndian.PutUint32(rec[8:12], uint32(len(out)))
+		binary.BigEndian.PutUint32(rec[12:16], uint32(len(data)))
+		if tag == "head" {
+			headOffset = len(out)
+		}
+		out = append(out, data...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-fontChecksum(out))
+	}
+	return out
+}
+
+// fontChecksum returns the sum of data as big-endian uint32 values, padded
+// with zeros to a multiple of four bytes.
+func fontChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// cmapGlyphs adds the glyphs mapped from runes by every supported cmap
+// subtable (formats 0, 4, 6, 12 and the non-default variation sequences of
+// format 14) to keep. The glyphs of runes in the Unicode subtables are
+// recorded in mapped, the first subtable that maps a rune taking precedence.
+func cmapGlyphs(cmap []byte, runes map[rune]bool, numGlyphs int, keep map[int]bool, mapped map[rune]int) error {
+	f := &fontBuf{b: cmap}
+	sorted := slices.Sorted(maps.Keys(runes))
+	unicode := false
+	add := func(g int) {
+		if g > 0 && g < numGlyphs {
+			keep[g] = true
+		}
+	}
+	addRune := func(r rune, g int) {
+		if g <= 0 || g >= numGlyphs {
+			return
+		}
+		keep[g] = true
+		if _, ok := mapped[r]; unicode && !ok {
+			mapped[r] = g
+		}
+	}
+
+	n := f.u16(2)
+	for i := range n {
+		unicode = isUnicodeCmap(f.u16(4+8*i), f.u16(4+8*i+2))
+		st := f.u32(4 + 8*i + 4)
+		switch f.u16(st) {
+		case 0:
+			for _, r := range sorted {
+				if r < 256 {
+					addRune(r, f.u8(st+6+int(r)))
+				}
+			}
+		case 4:
+			segCount := f.u16(st+6) / 2
+			endCodes := st + 14
+			startCodes := endCodes + 2*segCount + 2
+			deltas := startCodes + 2*segCount
+			rangeOffsets := deltas + 2*segCount
+			for _, r := range sorted {
+				if r > 0xFFFF {
+					break
+				}
+				// Find the first segment whose end code is >= c.
+				c := int(r)
+				lo, hi := 0, segCount
+				for lo < hi {
+					mid := (lo + hi) / 2
+					if f.u16(endCodes+2*mid) < c {
+						lo = mid + 1
+					} else {
+						hi = mid
+					}
+				}
+				seg := lo
+				if seg >= segCount || f.u16(startCodes+2*seg) > c {
+					continue
+				}
+				delta := f.u16(deltas + 2*seg)
+				rangeOffset := f.u16(rangeOffsets + 2*seg)
+				if rangeOffset == 0 {
+					addRune(r, (c+delta)&0xFFFF)
+					continue
+				}
+				g := f.u16(rangeOffsets + 2*seg + rangeOffset + 2*(c-f.u16(startCodes+2*seg)))
+				if g != 0 {
+					addRune(r, (g+delta)&0xFFFF)
+				}
+			}
+		case 6:
+			first, count := f.u16(st+6), f.u16(st+8)
+			for _, r := range sorted {
+				if c := int(r); c >= first && c < first+count {
+					addRune(r, f.u16(st+10+2*(c-first)))
+				}
+			}
+		case 12:
+			groups := f.u32(st + 12)
+			for _, r := range sorted {
+				c := int(r)
+				lo, hi := 0, groups
+				for lo < hi {
+					mid := (lo + hi) / 2
+					if f.u32(st+16+12*mid+4) < c {
+						lo = mid + 1
+					} else {
+						hi = mid
+					}
+				}
+				if lo < groups {
+					group := st + 16 + 12*lo
+					if start := f.u32(group); start <= c {
+						addRune(r, f.u32(group+8)+c-start)
+					}
+				}
+			}
+		case 14:
+			records := f.u32(st + 6)
+			for j := range records {
+				rec := st + 10 + 11*j
+				if !runes[rune(f.u24(rec))] {
+					continue
+				}
+				nonDefault := f.u32(rec + 7)
+				if nonDefault == 0 {
+					continue
+				}
+				mappings := f.u32(st + nonDefault)
+				for k := range mappings {
+					m := st + nonDefault + 4 + 5*k
+					if runes[rune(f.u24(m))] {
+						add(f.u16(m + 3))
+					}
+				}
+			}
+		}
+		if f.err != nil {
+			return f.err
+		}
+	}
+	return f.err
+}
+
+// isUnicodeCmap reports whether a cmap subtable maps Unicode code points:
+// the Unicode platform, or the Windows platform with the BMP or full
+// repertoire encodings.
+func isUnicodeCmap(platformID, encodingID int) bool {
+	return platformID == 0 || (platformID == 3 && (encodingID == 1 || encodingID == 10))
+}
+
+// subsetCmap builds a cmap table that maps only the runes of mapped: a format
+// 4 subtable for the BMP and, when mapped has supplementary-plane runes, a
+// format 12 subtable, for both the Unicode and Windows platforms. A format 14
+// subtable (Unicode variation sequences) is kept as is, since glyph IDs are
+// preserved. It returns nil when the original cmap has no Unicode subtable
+// or a format 4 subtable cannot hold the mappings, in which case the original
+// cmap should be kept.
+func subsetCmap(cmap []byte, mapped map[rune]int) []byte {
+	var format14 []byte
+	hasUnicode := false
+	f := &fontBuf{b: cmap}
+	for i := range f.u16(2) {
+		hasUnicode = hasUnicode || isUnicodeCmap(f.u16(4+8*i), f.u16(4+8*i+2))
+		if st := f.u32(4 + 8*i + 4); f.u16(st) == 14 && format14 == nil {
+			format14 = f.bytes(st, f.u32(st+2))
+		}
+	}
+	if f.err != nil || !hasUnicode {
+		return nil
+	}
+	runes := slices.Sorted(maps.Keys(mapped))
+
+	// Runs of consecutive runes mapped to consecutive glyphs
+	type run struct{ start, end rune }
+	var bmp, all []run
+	for _, r := range runes {
+		if n := len(all); n > 0 && all[n-1].end+1 == r && mapped[all[n-1].end]+1 == mapped[r] && (r <= 0xFFFF) == (all[n-1].end <= 0xFFFF) {
+			all[n-1].end = r
+		} else {
+			all = append(all, run{r, r})
+		}
+	}
+	for _, rn := range all {
+		if rn.end < 0xFFFF {
+			bmp = append(bmp, rn)
+		}
+	}
+
+	// Format 4, with the required final 0xFFFF segment
+	segCount := len(bmp) + 1
+	length := 16 + 8*segCount
+	if length > 0xFFFF {
+		return nil
+	}
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= segCount {
+		entrySelector++
+	}
+	searchRange := 2 << entrySelector
+	format4 := make([]byte, length)
+	put16 := func(b []byte, off, v int) { binary.BigEndian.PutUint16(b[off:], uint16(v)) }
+	put16(format4, 0, 4)
+	put16(format4, 2, length)
+	put16(format4, 6, 2*segCount)
+	put16(format4, 8, searchRange)
+	put16(format4, 10, entrySelector)
+	put16(format4, 12, 2*segCount-searchRange)
+	endCodes, startCodes, deltas := 14, 16+2*segCount, 16+4*segCount
+	for i, rn := range bmp {
+		put16(format4, endCodes+2*i, int(rn.end))
+		put16(format4, startCodes+2*i, int(rn.start))
+		put16(format4, deltas+2*i, (mapped[rn.start]-int(rn.start))&0xFFFF)
+	}
+	put16(format4, endCodes+2*len(bmp), 0xFFFF)
+	put16(format4, startCodes+2*len(bmp), 0xFFFF)
+	put16(format4, deltas+2*len(bmp), 1)
+
+	var format12 []byte
+	if len(runes) > 0 && runes[len(runes)-1] > 0xFFFF {
+		format12 = make([]byte, 16+12*len(all))
+		put16(format12, 0, 12)
+		binary.BigEndian.PutUint32(format12[4:], uint32(len(format12)))
+		binary.BigEndian.PutUint32(format12[12:], uint32(len(all)))
+		for i, rn := range all {
+			group := format12[16+12*i:]
+			binary.BigEndian.PutUint32(group[0:], uint32(rn.start))
+			binary.BigEndian.PutUint32(group[4:], uint32(rn.end))
+			binary.BigEndian.PutUint32(group[8:], uint32(mapped[rn.start]))
+		}
+	}
+
+	// Encoding records, sorted by platform and encoding, followed by the
+	// subtables they share
+	type record struct{ platformID, encodingID, subtable int }
+	subtables := [][]byte{format4}
+	records := []record{{0, 3, 0}}
+	if format12 != nil {
+		subtables = append(subtables, format12)
+		records = append(records, record{0, 4, len(subtables) - 1})
+	}
+	if format14 != nil {
+		subtables = append(subtables, format14)
+		records = append(records, record{0, 5, len(subtables) - 1})
+	}
+	records = append(records, record{3, 1, 0})
+	if format12 != nil {
+		records = append(records, record{3, 10, 1})
+	}
+
+	out := make([]byte, 4+8*len(records))
+	put16(out, 2, len(records))
+	offsets := make([]int, len(subtables))
+	for i, subtable := range subtables {
+		offsets[i] = len(out)
+		out = append(out, subtable...)
+	}
+	for i, rec := range records {
+		put16(out, 4+8*i, rec.platformID)
+		put16(out, 4+8*i+2, rec.encodingID)
+		binary.BigEndian.PutUint32(out[4+8*i+4:], uint32(offsets[rec.subtable]))
+	}
+	return out
+}
+
+// subsetMetrics zeroes the advances and side bearings of the glyphs that are
+// not kept in an hmtx or vmtx table, and drops the trailing metrics that
+// repeat the last advance. hea is the matching hhea or vhea table, whose
+// metric count (at offset 34) is updated.
+func subsetMetrics(hea, mtx []byte, numGlyphs int, keep map[int]bool) ([]byte, []byte, error) {
+	f := &fontBuf{b: mtx}
+	h := &fontBuf{b: hea}
+	numMetrics := h.u16(34)
+	if h.err != nil {
+		return nil, nil, h.err
+	}
+	if numMetrics == 0 || numMetrics > numGlyphs {
+		return nil, nil, fmt.Errorf("invalid metric count %d for %d glyphs", numMetrics, numGlyphs)
+	}
+
+	advances := make([]int, numGlyphs)
+	bearings := make([]int, numGlyphs)
+	for g := range numGlyphs {
+		if g < numMetrics {
+			advances[g], bearings[g] = f.u16(4*g), f.u16(4*g+2)
+		} else {
+			advances[g], bearings[g] = advances[numMetrics-1], f.u16(4*numMetrics+2*(g-numMetrics))
+		}
+		if !keep[g] {
+			advances[g], bearings[g] = 0, 0
+		}
+	}
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+
+	n := numGlyphs
+	for n > 1 && advances[n-2] == advances[n-1] {
+		n--
+	}
+	out := make([]byte, 4*n+2*(numGlyphs-n))
+	for g := range numGlyphs {
+		if g < n {
+			binary.BigEndian.PutUint16(out[4*g:], uint16(advances[g]))
+			binary.BigEndian.PutUint16(out[4*g+2:], uint16(bearings[g]))
+		} else {
+			binary.BigEndian.PutUint16(out[4*n+2*(g-n):], uint16(bearings[g]))
+		}
+	}
+	hea = bytes.Clone(hea)
+	binary.BigEndian.PutUint16(hea[34:], uint16(n))
+	return hea, out, nil
+}
+
+// gsubClosure adds to keep every glyph that GSUB single, multiple, alternate
+// and ligature substitutions can produce from the kept glyphs, until no more
+// glyphs are added. All lookups are considered regardless of feature.
+func gsubClosure(gsub []byte, numGlyphs int, keep map[int]bool) error {
+	f := &fontBuf{b: gsub}
+	type subtable struct{ lookupType, offset int }
+	var subtables []subtable
+
+	lookupList := f.u16(8)
+	for i := range f.u16(lookupList) {
+		lookup := lookupList + f.u16(lookupList+2+2*i)
+		lookupType := f.u16(lookup)
+		for j := range f.u16(lookup + 4) {
+			st := lookup + f.u16(lookup+6+2*j)
+			t := lookupType
+			if t == 7 { // extension
+				t = f.u16(st + 2)
+				st += f.u32(st + 4)
+			}
+			subtables = append(subtables, subtable{t, st})
+		}
+		if f.err != nil {
+			return f.err
+		}
+	}
+
+	add := func(g int) bool {
+		if g >= numGlyphs || keep[g] {
+			return false
+		}
+		keep[g] = true
+		return true
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, st := range subtables {
+			cov := coverageGlyphs(f, st.offset+f.u16(st.offset+2))
+			switch st.lookupType {
+			case 1:
+				format := f.u16(st.offset)
+				for i, g := range cov {
+					if !keep[g] {
+						continue
+					}
+					if format == 1 {
+						changed = add((g+f.u16(st.offset+4))&0xFFFF) || changed
+					} else {
+						changed = add(f.u16(st.offset+6+2*i)) || changed
+					}
+				}
+			case 2, 3:
+				for i, g := range cov {
+					if !keep[g] {
+						continue
+					}
+					seq := st.offset + f.u16(st.offset+6+2*i)
+					for k := range f.u16(seq) {
+						changed = add(f.u16(seq+2+2*k)) || changed
+					}
+				}
+			case 4:
+				for i, g := range cov {
+					if !keep[g] {
+						continue
+					}
+					set := st.offset + f.u16(st.offset+6+2*i)
+					for k := range f.u16(set) {
+						lig := set + f.u16(set+2+2*k)
+						all := true
+						for m := range f.u16(lig+2) - 1 {
+							if !keep[f.u16(lig+4+2*m)] {
+								all = false
+								break
+							}
+						}
+						if all {
+							changed = add(f.u16(lig)) || changed
+						}
+					}
+				}
+			}
+			if f.err != nil {
+				return f.err
+			}
+		}
+	}
+	return nil
+}
+
+// coverageGlyphs returns the glyphs of a coverage table in coverage index order.
+func coverageGlyphs(f *fontBuf, off int) []int {
+	var glyphs []int
+	switch f.u16(off) {
+	case 1:
+		for i := range f.u16(off + 2) {
+			glyphs = append(glyphs, f.u16(off+4+2*i))
+		}
+	case 2:
+		for i := range f.u16(off + 2) {
+			r := off + 4 + 6*i
+			for g := f.u16(r); g <= f.u16(r+2) && f.err == nil; g++ {
+				glyphs = append(glyphs, g)
+			}
+		}
+	}
+	return glyphs
+}
+
+// subsetGlyf rewrites the glyf and loca tables so that only the kept glyphs
+// and the components of kept composite glyphs have outlines.
+func subsetGlyf(tables map[string][]byte, numGlyphs int, keep map[int]bool) error {
+	head := bytes.Clone(tables["head"])
+	longLoca := binary.BigEndian.Uint16(head[50:52]) == 1
+	loca := &fontBuf{b: tables["loca"]}
+	glyf := tables["glyf"]
+
+	offsets := make([]int, numGlyphs+1)
+	for i := range offsets {
+		if longLoca {
+			offsets[i] = loca.u32(4 * i)
+		} else {
+			offsets[i] = 2 * loca.u16(2*i)
+		}
+	}
+	if loca.err != nil {
+		return fmt.Errorf("failed to read loca table: %w", loca.err)
+	}
+	glyph := func(g int) ([]byte, error) {
+		start, end := offsets[g], offsets[g+1]
+		if start > end || end > len(glyf) {
+			return nil, fmt.Errorf("glyph %d [%d, %d) is outside the glyf table (%d bytes)", g, start, end, len(glyf))
+		}
+		return glyf[start:end], nil
+	}
+
+	// Composite glyphs reference their components by glyph ID.
+	queue := slices.Sorted(maps.Keys(keep))
+	for len(queue) > 0 {
+		g := queue[0]
+		queue = queue[1:]
+		if g >= numGlyphs {
+			continue
+		}
+		data, err := glyph(g)
+		if err != nil {
+			return err
+		}
+		if len(data) < 10 || int16(binary.BigEndian.Uint16(data)) >= 0 {
+			continue
+		}
+		f := &fontBuf{b: data}
+		for off, more := 10, true; more && f.err == nil; {
+			flags := f.u16(off)
+			component := f.u16(off + 2)
+			if component < numGlyphs && !keep[component] {
+				keep[component] = true
+				queue = append(queue, component)
+			}
+			off += 4
+			if flags&0x0001 != 0 { // ARG_1_AND_2_ARE_WORDS
+				off += 4
+			} else {
+				off += 2
+			}
+			switch {
+			case flags&0x0008 != 0: // WE_HAVE_A_SCALE
+				off += 2
+			case flags&0x0040 != 0: // WE_HAVE_AN_X_AND_Y_SCALE
+				off += 4
+			case flags&0x0080 != 0: // WE_HAVE_A_TWO_BY_TWO
+				off += 8
+			}
+			more = flags&0x0020 != 0 // MORE_COMPONENTS
+		}
+		if f.err != nil {
+			return fmt.Errorf("failed to read composite glyph %d: %w", g, f.err)
+		}
+	}
+
+	var newGlyf []byte
+	newOffsets := make([]int, numGlyphs+1)
+	for g := range numGlyphs {
+		newOffsets[g] = len(newGlyf)
+		if !keep[g] {
+			continue
+		}
+		data, err := glyph(g)
+		if err != nil {
+			return err
+		}
+		newGlyf = append(newGlyf, data...)
+		for len(newGlyf)%4 != 0 {
+			newGlyf = append(newGlyf, 0)
+		}
+	}
+	newOffsets[numGlyphs] = len(newGlyf)
+
+	var newLoca []byte
+	if len(newGlyf) <= 2*0xFFFF {
+		newLoca = make([]byte, 2*len(newOffsets))
+		for i, off := range newOffsets {
+			binary.BigEndian.PutUint16(newLoca[2*i:], uint16(off/2))
+		}
+		binary.BigEndian.PutUint16(head[50:52], 0)
+	} else {
+		newLoca = make([]byte, 4*len(newOffsets))
+		for i, off := range newOffsets {
+			binary.BigEndian.PutUint32(newLoca[4*i:], uint32(off))
+		}
+		binary.BigEndian.PutUint16(head[50:52], 1)
+	}
+
+	tables["glyf"], tables["loca"], tables["head"] = newGlyf, newLoca, head
+	return nil
+}
+
+// CFF DICT operators that hold offsets.
+const (
+	cffOpCharset     = 15
+	cffOpEncoding    = 16
+	cffOpCharStrings = 17
+	cffOpPrivate     = 18
+	cffOpFDArray     = 0x0C24
+	cffOpFDSelect    = 0x0C25
+)
+
+// cffOperand is a DICT operand with its encoded bytes.
+type cffOperand struct {
+	raw   []byte
+	value int // integer value; 0 for reals
+}
+
+// cffDictEntry is a DICT operator with its operands.
+type cffDictEntry struct {
+	op       int // one-byte operators, or 0x0C00 | second byte for escaped operators
+	operands []cffOperand
+}
+
+// subsetCFF replaces the charstrings of the glyphs that are not kept with an
+// empty charstring. The CharStrings INDEX shrinks, so the data following the
+// INDEXes at the start of the table is laid out again and the offsets in the
+// Top DICT and the Font DICTs of CID-keyed fonts are updated.
+func subsetCFF(cff []byte, keep map[int]bool) ([]byte, error) {
+	f := &fontBuf{b: cff}
+	hdrSize := f.u8(2)
+	_, topStart := readCFFIndex(f, hdrSize)
+	topDicts, stringStart := readCFFIndex(f, topStart)
+	_, gsubrsStart := readCFFIndex(f, stringStart)
+	_, prefixEnd := readCFFIndex(f, gsubrsStart)
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(topDicts) != 1 {
+		return nil, fmt.Errorf("CFF with %d fonts is not supported", len(topDicts))
+	}
+	top, err := parseCFFDict(topDicts[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Top DICT: %w", err)
+	}
+
+	// Data blocks referenced by absolute offsets. Each block extends to the
+	// next one; a Private DICT block includes its local subroutines.
+	starts := make(map[int]bool)
+	offsetOf := func(entries []cffDictEntry, op, operand int) (int, bool) {
+		for _, e := range entries {
+			if e.op == op && len(e.operands) > operand {
+				return e.operands[operand].value, true
+			}
+		}
+		return 0, false
+	}
+	if off, ok := offsetOf(top, cffOpCharset, 0); ok && off > 2 {
+		starts[off] = true
+	}
+	if off, ok := offsetOf(top, cffOpEncoding, 0); ok && off > 1 {
+		starts[off] = true
+	}
+	charStringsOff, ok := offsetOf(top, cffOpCharStrings, 0)
+	if !ok {
+		return nil, fmt.Errorf("CharStrings offset not found")
+	}
+	starts[charStringsOff] = true
+	if size, ok := offsetOf(top, cffOpPrivate, 0); ok && size > 0 {
+		off, _ := offsetOf(top, cffOpPrivate, 1)
+		starts[off] = true
+	}
+	if off, ok := offsetOf(top, cffOpFDSelect, 0); ok {
+		starts[off] = true
+	}
+	fdArrayOff, hasFDArray := offsetOf(top, cffOpFDArray, 0)
+	var fontDicts [][]cffDictEntry
+	if hasFDArray {
+		starts[fdArrayOff] = true
+		items, _ := readCFFIndex(f, fdArrayOff)
+		for i, item := range items {
+			fd, err := parseCFFDict(item)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse Font DICT %d: %w", i, err)
+			}
+			if size, ok := offsetOf(fd, cffOpPrivate, 0); ok && size > 0 {
+				off, _ := offsetOf(fd, cffOpPrivate, 1)
+				starts[off] = true
+			}
+			fontDicts = append(fontDicts, fd)
+		}
+	}
+
+	charStrings, _ := readCFFIndex(f, charStringsOff)
+	if f.err != nil {
+		return nil, f.err
+	}
+	for g := range charStrings {
+		if !keep[g] {
+			charStrings[g] = cffEndchar
+		}
+	}
+	newCharStrings := encodeCFFIndex(charStrings)
+
+	blocks := slices.Sorted(maps.Keys(starts))
+	for _, off := range blocks {
+		if off < prefixEnd || off >= len(cff) {
+			return nil, fmt.Errorf("offset %d is outside the CFF data area [%d, %d)", off, prefixEnd, len(cff))
+		}
+	}
+
+	// Offsets are written as 5-byte integers, so the DICT sizes do not depend
+	// on their values and the layout can be computed before encoding them.
+	// Predefined charsets and encodings are not offsets and are kept as is.
+	moved := make(map[int]int)
+	remap := func(entries []cffDictEntry) []cffDictEntry {
+		out := make([]cffDictEntry, len(entries))
+		for i, e := range entries {
+			out[i] = e
+			switch e.op {
+			case cffOpCharset, cffOpEncoding, cffOpCharStrings, cffOpFDArray, cffOpFDSelect:
+				if len(e.operands) == 1 && starts[e.operands[0].value] {
+					out[i].operands = []cffOperand{fixedCFFOperand(moved[e.operands[0].value])}
+				}
+			case cffOpPrivate:
+				if len(e.operands) == 2 {
+					out[i].operands = []cffOperand{fixedCFFOperand(e.operands[0].value), fixedCFFOperand(moved[e.operands[1].value])}
+				}
+			}
+		}
+		return out
+	}
+	encodeFDArray := func() []byte {
+		items := make([][]byte, len(fontDicts))
+		for i, fd := range fontDicts {
+			items[i] = encodeCFFDict(remap(fd))
+		}
+		return encodeCFFIndex(items)
+	}
+	encodeTop := func() []byte {
+		return encodeCFFIndex([][]byte{encodeCFFDict(remap(top))})
+	}
+
+	pos := hdrSize + (topStart - hdrSize) + len(encodeTop()) + (prefixEnd - stringStart)
+	blockData := make([][]byte, len(blocks))
+	for i, off := range blocks {
+		moved[off] = pos
+		switch {
+		case off == charStringsOff:
+			blockData[i] = newCharStrings
+		case hasFDArray && off == fdArrayOff:
+			blockData[i] = encodeFDArray()
+		default:
+			end := len(cff)
+			if i+1 < len(blocks) {
+				end = blocks[i+1]
+			}
+			blockData[i] = cff[off:end]
+		}
+		pos += len(blockData[i])
+	}
+	if hasFDArray {
+		blockData[slices.Index(blocks, fdArrayOff)] = encodeFDArray()
+	}
+
+	out := make([]byte, 0, pos)
+	out = append(out, cff[:topStart]...)
+	out = append(out, encodeTop()...)
+	out = append(out, cff[stringStart:prefixEnd]...)
+	for _, data := range blockData {
+		out = append(out, data...)
+	}
+	return out, nil
+}
+
+// readCFFIndex reads the items of the CFF INDEX at off and returns them with
+// the offset following the INDEX.
+func readCFFIndex(f *fontBuf, off int) ([][]byte, int) {
+	count := f.u16(off)
+	if count == 0 {
+		return nil, off + 2
+	}
+	offSize := f.u8(off + 2)
+	if offSize < 1 || offSize > 4 {
+		if f.err == nil {
+			f.err = fmt.Errorf("invalid INDEX offset size %d at %d", offSize, off)
+		}
+		return nil, off
+	}
+	offsets := off + 3
+	dataStart := offsets + (count+1)*offSize - 1
+	items := make([][]byte, count)
+	for i := range count {
+		start, end := f.uN(offsets+i*offSize, offSize), f.uN(offsets+(i+1)*offSize, offSize)
+		if end < start {
+			if f.err == nil {
+				f.err = fmt.Errorf("INDEX item %d at %d has a negative length", i, off)
+			}
+			return nil, off
+		}
+		items[i] = f.bytes(dataStart+start, end-start)
+	}
+	return items, dataStart + f.uN(offsets+count*offSize, offSize)
+}
+
+// encodeCFFIndex encodes items as a CFF INDEX with the smallest offset size.
+func encodeCFFIndex(items [][]byte) []byte {
+	if len(items) == 0 {
+		return []byte{0, 0}
+	}
+	total := 1
+	for _, item := range items {
+		total += len(item)
+	}
+	offSize := 1
+	for offSize < 4 && total > 1<<(8*offSize)-1 {
+		offSize++
+	}
+
+	out := make([]byte, 3, 3+(len(items)+1)*offSize+total-1)
+	binary.BigEndian.PutUint16(out, uint16(len(items)))
+	out[2] = byte(offSize)
+	writeOffset := func(v int) {
+		for i := offSize - 1; i >= 0; i-- {
+			out = append(out, byte(v>>(8*i)))
+		}
+	}
+	off := 1
+	writeOffset(off)
+	for _, item := range items {
+		off += len(item)
+		writeOffset(off)
+	}
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// parseCFFDict decodes the operators and operands of a CFF DICT.
+func parseCFFDict(b []byte) ([]cffDictEntry, error) {
+	var entries []cffDictEntry
+	var operands []cffOperand
+	for i := 0; i < len(b); {
+		b0 := int(b[i])
+		size, value := 0, 0
+		switch {
+		case b0 <= 21:
+			op := b0
+			i++
+			if b0 == 12 {
+				if i >= len(b) {
+					return nil, fmt.Errorf("truncated escaped operator")
+				}
+				op = 0x0C00 | int(b[i])
+				i++
+			}
+			entries = append(entries, cffDictEntry{op: op, operands: operands})
+			operands = nil
+			continue
+		case b0 == 28:
+			size = 3
+			if i+size <= len(b) {
+				value = int(int16(binary.BigEndian.Uint16(b[i+1:])))
+			}
+		case b0 == 29:
+			size = 5
+			if i+size <= len(b) {
+				value = int(int32(binary.BigEndian.Uint32(b[i+1:])))
+			}
+		case b0 == 30:
+			size = 1
+			for i+size < len(b) && b[i+size]&0x0F != 0x0F && b[i+size]&0xF0 != 0xF0 {
+				size++
+			}
+			size++
+		case b0 >= 32 && b0 <= 246:
+			size, value = 1, b0-139
+		case b0 >= 247 && b0 <= 250:
+			size = 2
+			if i+size <= len(b) {
+				value = (b0-247)*256 + int(b[i+1]) + 108
+			}
+		case b0 >= 251 && b0 <= 254:
+			size = 2
+			if i+size <= len(b) {
+				value = -(b0-251)*256 - int(b[i+1]) - 108
+			}
+		default:
+			return nil, fmt.Errorf("reserved DICT byte %d at %d", b0, i)
+		}
+		if i+size > len(b) {
+			return nil, fmt.Errorf("truncated operand at %d", i)
+		}
+		operands = append(operands, cffOperand{raw: b[i : i+size], value: value})
+		i += size
+	}
+	return entries, nil
+}
+
+// encodeCFFDict encodes DICT entries, writing the operands as they were read.
+func encodeCFFDict(entries []cffDictEntry) []byte {
+	var out []byte
+	for _, e := range entries {
+		for _, operand := range e.operands {
+			out = append(out, operand.raw...)
+		}
+		if e.op >= 0x0C00 {
+			out = append(out, 12, byte(e.op&0xFF))
+		} else {
+			out = append(out, byte(e.op))
+		}
+	}
+	return out
+}
+
+// fixedCFFOperand encodes v as a 5-byte integer operand.
+func fixedCFFOperand(v int) cffOperand {
+	raw := make([]byte, 5)
+	raw[0] = 29
+	binary.BigEndian.PutUint32(raw[1:], uint32(int32(v)))
+	return cffOperand{raw: raw, value: v}
+}
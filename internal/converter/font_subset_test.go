@@ -0,0 +1,281 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"maps"
+	"os"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// glyphSegments returns the number of outline segments of the glyph for r.
+func glyphSegments(t *testing.T, f *sfnt.Font, r rune) int {
+	t.Helper()
+	var b sfnt.Buffer
+	x, err := f.GlyphIndex(&b, r)
+	if err != nil || x == 0 {
+		t.Fatalf("GlyphIndex(%q) = %d, %v", r, x, err)
+	}
+	segments, err := f.LoadGlyph(&b, x, fixed.I(16), nil)
+	if err != nil {
+		t.Fatalf("LoadGlyph(%q) error = %v", r, err)
+	}
+	return len(segments)
+}
+
+// checkUnusedGlyph checks that r is unmapped in the subset font and that the
+// glyph it has in the original font is empty and has no advance.
+func checkUnusedGlyph(t *testing.T, orig, subset *sfnt.Font, r rune) {
+	t.Helper()
+	var b sfnt.Buffer
+	if x, err := subset.GlyphIndex(&b, r); err != nil || x != 0 {
+		t.Errorf("subset GlyphIndex(%q) = %d, %v, want 0", r, x, err)
+	}
+	x, err := orig.GlyphIndex(&b, r)
+	if err != nil || x == 0 {
+		t.Fatalf("GlyphIndex(%q) = %d, %v", r, x, err)
+	}
+	segments, err := subset.LoadGlyph(&b, x, fixed.I(16), nil)
+	if err != nil {
+		t.Fatalf("LoadGlyph(%q) error = %v", r, err)
+	}
+	if len(segments) != 0 {
+		t.Errorf("unused glyph %q has %d segments, want 0", r, len(segments))
+	}
+	advance, err := subset.GlyphAdvance(&b, x, fixed.I(16), 0)
+	if err != nil {
+		t.Fatalf("GlyphAdvance(%q) error = %v", r, err)
+	}
+	if advance != 0 {
+		t.Errorf("unused glyph %q has advance %v, want 0", r, advance)
+	}
+}
+
+func TestCollectCodePoints(t *testing.T) {
+	html := `<html><head><title>T</title></head><body><p>ab<ruby>漢<rt>かん</rt></ruby></p></body></html>`
+	runes, err := CollectCodePoints(html)
+	if err != nil {
+		t.Fatalf("CollectCodePoints() error = %v", err)
+	}
+	for _, r := range "abAB漢かん " {
+		if !runes[r] {
+			t.Errorf("code point %q not collected", r)
+		}
+	}
+	for _, r := range "<>p" {
+		if runes[r] {
+			t.Errorf("markup code point %q collected", r)
+		}
+	}
+}
+
+func TestSubsetFont_TrueType(t *testing.T) {
+	subset, err := SubsetFont(goregular.TTF, map[rune]bool{'A': true, 'é': true})
+	if err != nil {
+		t.Fatalf("SubsetFont() error = %v", err)
+	}
+	if len(subset) >= len(goregular.TTF)/2 {
+		t.Errorf("subset size = %d, want well below %d", len(subset), len(goregular.TTF))
+	}
+
+	var sum uint32
+	for i := 0; i < len(subset); i += 4 {
+		sum += binary.BigEndian.Uint32(subset[i:])
+	}
+	if sum != 0xB1B0AFBA {
+		t.Errorf("font checksum = %#x, want 0xB1B0AFBA", sum)
+	}
+
+	orig, err := sfnt.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := sfnt.Parse(subset)
+	if err != nil {
+		t.Fatalf("sfnt.Parse(subset) error = %v", err)
+	}
+	if f.NumGlyphs() != orig.NumGlyphs() {
+		t.Errorf("NumGlyphs() = %d, want %d (glyph IDs are preserved)", f.NumGlyphs(), orig.NumGlyphs())
+	}
+	for _, r := range "Aé" {
+		if got, want := glyphSegments(t, f, r), glyphSegments(t, orig, r); got != want {
+			t.Errorf("glyph %q has %d segments, want %d", r, got, want)
+		}
+	}
+	for _, r := range "Aé" {
+		var b sfnt.Buffer
+		x, _ := orig.GlyphIndex(&b, r)
+		got, err := f.GlyphAdvance(&b, x, fixed.I(16), 0)
+		if err != nil {
+			t.Fatalf("GlyphAdvance(%q) error = %v", r, err)
+		}
+		if want, _ := orig.GlyphAdvance(&b, x, fixed.I(16), 0); got != want {
+			t.Errorf("glyph %q advance = %v, want %v", r, got, want)
+		}
+	}
+	checkUnusedGlyph(t, orig, f, 'Z')
+}
+
+func TestSubsetFont_CFF(t *testing.T) {
+	font, err := os.ReadFile("../../testdata/fonts/CFFTest.otf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subset, err := SubsetFont(font, map[rune]bool{'0': true, '中': true})
+	if err != nil {
+		t.Fatalf("SubsetFont() error = %v", err)
+	}
+
+	orig, err := sfnt.Parse(font)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := sfnt.Parse(subset)
+	if err != nil {
+		t.Fatalf("sfnt.Parse(subset) error = %v", err)
+	}
+	for _, r := range "0中" {
+		if got, want := glyphSegments(t, f, r), glyphSegments(t, orig, r); got != want {
+			t.Errorf("glyph %q has %d segments, want %d", r, got, want)
+		}
+	}
+	for _, r := range "1Q" {
+		checkUnusedGlyph(t, orig, f, r)
+	}
+}
+
+func TestSubsetFont_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		font []byte
+	}{
+		{"not a font", []byte("<html></html>")},
+		{"font collection", []byte("ttcf\x00\x01\x00\x00\x00\x00\x00\x00")},
+		{"truncated", goregular.TTF[:100]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := SubsetFont(tt.font, map[rune]bool{'A': true}); err == nil {
+				t.Error("SubsetFont() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestSubsetGlyf_CompositeComponents(t *testing.T) {
+	simple := []byte{0, 1, 0, 0, 0, 0, 0, 10, 0, 10, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0}
+	composite := []byte{
+		0xFF, 0xFF, 0, 0, 0, 0, 0, 10, 0, 10, // numberOfContours = -1, bbox
+		0x00, 0x02, 0x00, 0x01, 0, 0, // ARGS_ARE_XY_VALUES, glyph 1, byte args
+	}
+	tables := map[string][]byte{
+		"head": make([]byte, 54),
+		"glyf": append(append([]byte{}, simple...), composite...),
+		// Glyph 0 and 2 are empty, glyph 1 is simple and glyph 3 is composite.
+		"loca": {0, 0, 0, 0, 0, 10, 0, 10, 0, 18},
+	}
+
+	keep := map[int]bool{0: true, 3: true}
+	if err := subsetGlyf(tables, 4, keep); err != nil {
+		t.Fatalf("subsetGlyf() error = %v", err)
+	}
+	if !keep[1] {
+		t.Error("component glyph 1 of composite glyph 3 was not kept")
+	}
+	if got, want := len(tables["glyf"]), len(simple)+len(composite); got != want {
+		t.Errorf("glyf size = %d, want %d", got, want)
+	}
+}
+
+func TestGSUBClosure(t *testing.T) {
+	gsub := []byte{
+		0, 1, 0, 0, 0, 0, 0, 0, 0, 10, // header; lookup list at 10
+		0, 1, 0, 4, // one lookup at 14
+		0, 1, 0, 0, 0, 1, 0, 8, // single substitution with one subtable at 22
+		0, 2, 0, 8, 0, 1, 0, 5, // format 2: coverage at 30, glyph 3 -> 5
+		0, 1, 0, 1, 0, 3, // coverage format 1: glyph 3
+	}
+	keep := map[int]bool{0: true, 3: true}
+	if err := gsubClosure(gsub, 10, keep); err != nil {
+		t.Fatalf("gsubClosure() error = %v", err)
+	}
+	if !keep[5] {
+		t.Errorf("substitute glyph 5 was not kept: %v", keep)
+	}
+}
+
+func TestSubsetCmap(t *testing.T) {
+	_, tables, err := parseSFNT(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		mapped map[rune]int
+	}{
+		{"BMP", map[rune]int{'A': 10, 'B': 11, 'D': 12, 'é': 5}},
+		{"supplementary", map[rune]int{'A': 10, 0x1F600: 20, 0x1F601: 21}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmap := subsetCmap(tables["cmap"], tt.mapped)
+			if cmap == nil {
+				t.Fatal("subsetCmap() = nil")
+			}
+			font := maps.Clone(tables)
+			font["cmap"] = cmap
+			f, err := sfnt.Parse(writeSFNT(0x00010000, font))
+			if err != nil {
+				t.Fatalf("sfnt.Parse() error = %v", err)
+			}
+			var b sfnt.Buffer
+			for r, want := range tt.mapped {
+				if x, err := f.GlyphIndex(&b, r); err != nil || int(x) != want {
+					t.Errorf("GlyphIndex(%q) = %d, %v, want %d", r, x, err, want)
+				}
+			}
+			if x, err := f.GlyphIndex(&b, 'C'); err != nil || x != 0 {
+				t.Errorf("GlyphIndex('C') = %d, %v, want 0", x, err)
+			}
+		})
+	}
+
+	// A cmap with only a Macintosh Roman subtable is kept as is.
+	mac := []byte{
+		0, 0, 0, 1, // version, one encoding record
+		0, 1, 0, 0, 0, 0, 0, 12, // platform 1, encoding 0 at 12
+		0, 0, 0, 6, 0, 0, // format 0 header; glyph IDs omitted
+	}
+	if cmap := subsetCmap(mac, map[rune]int{}); cmap != nil {
+		t.Errorf("subsetCmap() = %v, want nil without a Unicode subtable", cmap)
+	}
+}
+
+func TestSubsetMetrics(t *testing.T) {
+	hea := make([]byte, 36)
+	hea[35] = 3 // three long metrics
+	mtx := []byte{
+		0, 100, 0, 1, 0, 200, 0, 2, 1, 44, 0, 3, // advances and bearings of glyphs 0-2
+		0, 4, 0, 5, // bearings of glyphs 3 and 4
+	}
+	hea, mtx, err := subsetMetrics(hea, mtx, 5, map[int]bool{0: true, 2: true})
+	if err != nil {
+		t.Fatalf("subsetMetrics() error = %v", err)
+	}
+	// Glyphs 1, 3 and 4 are zeroed, and glyph 4 repeats the advance of glyph 3.
+	wantMtx := []byte{0, 100, 0, 1, 0, 0, 0, 0, 1, 44, 0, 3, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(mtx, wantMtx) {
+		t.Errorf("mtx = %v, want %v", mtx, wantMtx)
+	}
+	if n := binary.BigEndian.Uint16(hea[34:]); n != 4 {
+		t.Errorf("metric count = %d, want 4", n)
+	}
+
+	if _, _, err := subsetMetrics(make([]byte, 36), mtx, 5, nil); err == nil {
+		t.Error("subsetMetrics() with no long metrics error = nil, want error")
+	}
+}
@@ -0,0 +1,116 @@
+package converter
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+
+	"github.com/yuanying/epub2azw3/internal/epub"
+	"github.com/yuanying/epub2azw3/internal/mobi"
+)
+
+// landmarkGuideTypes maps EPUB 3 landmark types (epub:type) to the OPF 2
+// guide types that Kindle reads from the guide.
+var landmarkGuideTypes = map[string]string{
+	"cover":           "cover",
+	"titlepage":       "title-page",
+	"toc":             "toc",
+	"bodymatter":      "text",
+	"copyright-page":  "copyright-page",
+	"acknowledgments": "acknowledgements",
+	"bibliography":    "bibliography",
+	"colophon":        "colophon",
+	"dedication":      "dedication",
+	"epigraph":        "epigraph",
+	"foreword":        "foreword",
+	"glossary":        "glossary",
+	"index":           "index",
+	"loi":             "loi",
+	"lot":             "lot",
+	"preface":         "preface",
+}
+
+// buildGuideReferences creates guide references for the guide index: the
+// inline TOC div ("toc"), then the EPUB 3 landmarks, then the OPF guide. Only
+// the first reference of each type is kept. References to a missing fragment
+// point at the start of its chapter; references to content that is not in the
+// text are skipped.
+func buildGuideReferences(finalHTML []byte, gen *TOCGenerator, landmarks []epub.Landmark, guide []epub.GuideReference) []mobi.GuideReference {
+	var refs []mobi.GuideReference
+	seen := make(map[string]bool)
+	add := func(guideType, title string, pos uint32) {
+		if seen[guideType] {
+			return
+		}
+		seen[guideType] = true
+		if title == "" {
+			title = guideType
+		}
+		refs = append(refs, mobi.GuideReference{Type: guideType, Title: title, FilePos: pos})
+	}
+
+	// Find the inline TOC position
+	tocPattern := []byte(`id="toc"`)
+	if idx := bytes.Index(finalHTML, tocPattern); idx >= 0 {
+		// Walk backwards to find the '<' that opens this tag
+		tagStart := idx
+		for tagStart > 0 && finalHTML[tagStart] != '<' {
+			tagStart--
+		}
+		add("toc", "Table of Contents", uint32(tagStart))
+	}
+
+	for _, lm := range landmarks {
+		guideType := ""
+		for _, token := range strings.Fields(lm.Type) {
+			if t, ok := landmarkGuideTypes[token]; ok {
+				guideType = t
+				break
+			}
+		}
+		if guideType == "" || seen[guideType] {
+			continue
+		}
+		if pos, ok := guideFilePos(finalHTML, gen, lm.ContentPath, lm.Fragment); ok {
+			add(guideType, lm.Label, pos)
+		}
+	}
+
+	for _, ref := range guide {
+		guideType := strings.ToLower(strings.TrimSpace(ref.Type))
+		if guideType == "" || strings.HasPrefix(guideType, "other.") || seen[guideType] {
+			continue
+		}
+		path, fragment, _ := strings.Cut(ref.Href, "#")
+		if decoded, err := url.PathUnescape(fragment); err == nil {
+			fragment = decoded
+		}
+		if pos, ok := guideFilePos(finalHTML, gen, path, fragment); ok {
+			add(guideType, ref.Title, pos)
+		}
+	}
+
+	return refs
+}
+
+// guideFilePos resolves the target of a guide reference, falling back to the
+// start of its chapter when the fragment is not found.
+func guideFilePos(finalHTML []byte, gen *TOCGenerator, contentPath, fragment string) (uint32, bool) {
+	pos, _ := gen.calculateFilePos(finalHTML, contentPath, fragment)
+	if pos == 0 && fragment != "" {
+		pos, _ = gen.calculateFilePos(finalHTML, contentPath, "")
+	}
+	return pos, pos > 0
+}
+
+// startReadingOffset returns the position of the "text" guide reference,
+// where Kindle opens the book (EXTH 116).
+func startReadingOffset(refs []mobi.GuideReference) *uint32 {
+	for _, ref := range refs {
+		if ref.Type == "text" {
+			pos := ref.FilePos
+			return &pos
+		}
+	}
+	return nil
+}
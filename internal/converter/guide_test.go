@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yuanying/epub2azw3/internal/epub"
+	"github.com/yuanying/epub2azw3/internal/mobi"
+)
+
+func TestBuildGuideReferences(t *testing.T) {
+	html := []byte(`<html><body>` +
+		`<div id="toc"><p>Contents</p></div>` +
+		`<div id="ch01"><p>Title</p></div>` +
+		`<div id="ch02"><p id="ch02-start">Text</p></div>` +
+		`<div id="ch03"><p>Colophon</p></div>` +
+		`</body></html>`)
+	gen := NewTOCGenerator(nil, map[string]string{
+		"text/title.xhtml":    "ch01",
+		"text/chapter1.xhtml": "ch02",
+		"text/colophon.xhtml": "ch03",
+	})
+	landmarks := []epub.Landmark{
+		{Type: "bodymatter", Label: "Start", ContentPath: "text/chapter1.xhtml", Fragment: "start"},
+		{Type: "colophon", Label: "Colophon", ContentPath: "text/colophon.xhtml", Fragment: "missing"},
+		{Type: "loi", Label: "Illustrations", ContentPath: "text/missing.xhtml"},
+	}
+	guide := []epub.GuideReference{
+		{Type: "text", Title: "Beginning", Href: "text/title.xhtml"},
+		{Type: "Title-Page", Href: "text/title.xhtml"},
+		{Type: "other.ms-coverimage-standard", Href: "text/title.xhtml"},
+		{Type: "toc", Title: "Contents", Href: "text/title.xhtml"},
+	}
+
+	refs := buildGuideReferences(html, gen, landmarks, guide)
+
+	pos := func(marker string) uint32 {
+		return uint32(bytes.Index(html, []byte(marker)))
+	}
+	want := []mobi.GuideReference{
+		{Type: "toc", Title: "Table of Contents", FilePos: pos(`<div id="toc"`)},
+		{Type: "text", Title: "Start", FilePos: pos(`<p id="ch02-start"`)},
+		{Type: "colophon", Title: "Colophon", FilePos: pos(`<div id="ch03"`)},
+		{Type: "title-page", Title: "title-page", FilePos: pos(`<div id="ch01"`)},
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("got %d references %+v, want %d", len(refs), refs, len(want))
+	}
+	for i := range want {
+		if refs[i] != want[i] {
+			t.Errorf("refs[%d] = %+v, want %+v", i, refs[i], want[i])
+		}
+	}
+
+	start := startReadingOffset(refs)
+	if start == nil || *start != pos(`<p id="ch02-start"`) {
+		t.Errorf("startReadingOffset() = %v, want %d", start, pos(`<p id="ch02-start"`))
+	}
+}
+
+func TestBuildGuideReferences_EncodedFragment(t *testing.T) {
+	html := []byte(`<html><body><div id="ch01"><p id="ch01-%E7%AB%A0+1">Text</p></div></body></html>`)
+	gen := NewTOCGenerator(nil, map[string]string{"text/chapter1.xhtml": "ch01"})
+	guide := []epub.GuideReference{{Type: "text", Href: "text/chapter1.xhtml#%E7%AB%A0%201"}}
+
+	refs := buildGuideReferences(html, gen, nil, guide)
+	want := uint32(bytes.Index(html, []byte(`<p id=`)))
+	if len(refs) != 1 || refs[0].FilePos != want {
+		t.Errorf("refs = %+v, want text at %d", refs, want)
+	}
+}
+
+func TestStartReadingOffset_NoText(t *testing.T) {
+	refs := []mobi.GuideReference{{Type: "toc", Title: "Table of Contents", FilePos: 10}}
+	if start := startReadingOffset(refs); start != nil {
+		t.Errorf("startReadingOffset() = %d, want nil", *start)
+	}
+}
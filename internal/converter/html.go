@@ -21,6 +21,8 @@ type HTMLBuilder struct {
 	chapters   []*ChapterContent
 	cssContent []string
 	chapterIDs map[string]string // file path -> chapter ID (e.g., "text/ch01.xhtml" -> "ch01")
+	cssHref    string            // stylesheet link target; empty means inline <style>
+	keepCSS    bool              // add CSS without TransformCSS (fixed-layout pages)
 }
 
 // ChapterContent represents the content of a single chapter
@@ -65,20 +67,47 @@ func (h *HTMLBuilder) AddChapter(content *epub.Content) error {
 	return nil
 }
 
+// KeepCSSLayout makes AddCSS and AddChapterCSS keep pixel units and
+// positioning instead of applying TransformCSS. Fixed-layout pages are laid
+// out in the pixels of their viewport and rely on them.
+func (h *HTMLBuilder) KeepCSSLayout() {
+	h.keepCSS = true
+}
+
+// transformCSS applies TransformCSS unless KeepCSSLayout was called.
+func (h *HTMLBuilder) transformCSS(css string) string {
+	if h.keepCSS {
+		return css
+	}
+	return TransformCSS(css)
+}
+
 // AddCSS adds global CSS content to the builder (no namespacing)
 func (h *HTMLBuilder) AddCSS(css string) {
-	h.cssContent = append(h.cssContent, TransformCSS(css))
+	h.cssContent = append(h.cssContent, h.transformCSS(css))
 }
 
 // AddChapterCSS adds chapter-specific CSS with ID selector namespacing
 // ID selectors like #cover are transformed to #chapterID-cover
 // Only selectors outside {} blocks are transformed (not color codes inside property values)
 func (h *HTMLBuilder) AddChapterCSS(chapterID, css string) {
-	transformed := TransformCSS(css)
+	transformed := h.transformCSS(css)
 	namespaced := namespaceIDSelectors(chapterID, transformed)
 	h.cssContent = append(h.cssContent, namespaced)
 }
 
+// UseStylesheetLink makes Build reference the merged CSS through a <link> element
+// pointing at href (e.g. a kindle:flow reference) instead of an inline <style>.
+// The merged CSS itself is available from CSS.
+func (h *HTMLBuilder) UseStylesheetLink(href string) {
+	h.cssHref = href
+}
+
+// CSS returns the merged CSS of all added stylesheets.
+func (h *HTMLBuilder) CSS() string {
+	return strings.Join(h.cssContent, "\n")
+}
+
 // namespaceIDSelectors replaces ID selectors outside CSS {} blocks
 func namespaceIDSelectors(chapterID, css string) string {
 	var result strings.Builder
@@ -209,6 +238,15 @@ func (h *HTMLBuilder) GetChapterIDs() map[string]string {
 	return result
 }
 
+// ChapterOrder returns the chapter IDs in the order the chapters were added.
+func (h *HTMLBuilder) ChapterOrder() []string {
+	ids := make([]string, len(h.chapters))
+	for i, chapter := range h.chapters {
+		ids[i] = chapter.ID
+	}
+	return ids
+}
+
 // RemoveImages removes all img elements from all chapters.
 func (h *HTMLBuilder) RemoveImages() {
 	for _, chapter := range h.chapters {
@@ -228,13 +266,16 @@ func (h *HTMLBuilder) Build() (string, error) {
 	head := doc.Find("head")
 	body := doc.Find("body")
 
-	// Add CSS to head
-	if len(h.cssContent) > 0 {
-		cssText := strings.Join(h.cssContent, "\n")
-		// Escape any </style> tags in CSS to prevent breaking the HTML structure
-		// Use <\/style> which is safe in CSS context
-		cssText = strings.ReplaceAll(cssText, "</style>", "<\\/style>")
-		head.AppendHtml(fmt.Sprintf("<style>%s</style>", cssText))
+	// Add CSS to head, either inline or as a link to the stylesheet flow
+	if cssText := h.CSS(); cssText != "" {
+		if h.cssHref != "" {
+			head.AppendHtml(fmt.Sprintf(`<link rel="stylesheet" type="text/css" href="%s"/>`, h.cssHref))
+		} else {
+			// Escape any </style> tags in CSS to prevent breaking the HTML structure
+			// Use <\/style> which is safe in CSS context
+			cssText = strings.ReplaceAll(cssText, "</style>", "<\\/style>")
+			head.AppendHtml(fmt.Sprintf("<style>%s</style>", cssText))
+		}
 	}
 
 	// Process each chapter
@@ -544,6 +544,47 @@ func TestHTMLBuilder_IntegrateCSS(t *testing.T) {
 	}
 }
 
+// TestHTMLBuilder_UseStylesheetLink tests that CSS is referenced through a link element
+func TestHTMLBuilder_UseStylesheetLink(t *testing.T) {
+	builder := NewHTMLBuilder()
+	builder.AddCSS("body { margin: 0; }")
+	builder.UseStylesheetLink("kindle:flow:0001?mime=text/css")
+
+	chapterHTML := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>Test</title></head>
+<body><h1>Test</h1></body>
+</html>`
+	content, err := epub.LoadContent("ch1", "text/chapter01.xhtml", []byte(chapterHTML))
+	if err != nil {
+		t.Fatalf("Failed to load content: %v", err)
+	}
+	if err := builder.AddChapter(content); err != nil {
+		t.Fatalf("Failed to add chapter: %v", err)
+	}
+
+	result, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Failed to build HTML: %v", err)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(result))
+	if err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+
+	if n := doc.Find("head style").Length(); n != 0 {
+		t.Errorf("Expected no style tag in head, got %d", n)
+	}
+	href, _ := doc.Find(`head link[rel="stylesheet"]`).Attr("href")
+	if href != "kindle:flow:0001?mime=text/css" {
+		t.Errorf("Expected stylesheet link to kindle:flow:0001, got %q", href)
+	}
+	if css := builder.CSS(); !strings.Contains(css, "margin: 0") {
+		t.Errorf("CSS() should return the merged stylesheet, got %q", css)
+	}
+}
+
 // TestHTMLBuilder_AddChapterCSS tests CSS ID selector namespacing
 func TestHTMLBuilder_AddChapterCSS(t *testing.T) {
 	tests := []struct {
@@ -693,4 +734,11 @@ func TestHTMLBuilder_ChapterIDMapping(t *testing.T) {
 			t.Errorf("Expected chapter ID for '%s' to be '%s', got '%s'", path, expectedID, actualID)
 		}
 	}
+
+	// Check the chapter order
+	order := builder.ChapterOrder()
+	expectedOrder := []string{"ch01", "ch02", "ch03"}
+	if strings.Join(order, ",") != strings.Join(expectedOrder, ",") {
+		t.Errorf("Expected chapter order %v, got %v", expectedOrder, order)
+	}
 }
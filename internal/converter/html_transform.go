@@ -27,6 +27,12 @@ var forbiddenAttrs = map[string]bool{
 	"translate":       true,
 }
 
+// kindleDataAttrs lists data-* attributes that Kindle interprets and that
+// are kept: the region magnification (Panel View) targets.
+var kindleDataAttrs = map[string]bool{
+	"data-app-amzn-magnify": true,
+}
+
 // TransformHTML transforms HTML5 tags to Kindle-compatible equivalents
 // and removes forbidden attributes.
 func TransformHTML(doc *goquery.Document) {
@@ -44,12 +50,12 @@ func TransformHTML(doc *goquery.Document) {
 		})
 	}
 
-	// Remove forbidden attributes and data-* attributes from all elements
+	// Remove forbidden attributes and data-* attributes (except Kindle's own) from all elements
 	doc.Find("*").Each(func(i int, s *goquery.Selection) {
 		node := s.Get(0)
 		var toRemove []string
 		for _, attr := range node.Attr {
-			if forbiddenAttrs[attr.Key] || strings.HasPrefix(attr.Key, "data-") {
+			if forbiddenAttrs[attr.Key] || (strings.HasPrefix(attr.Key, "data-") && !kindleDataAttrs[attr.Key]) {
 				toRemove = append(toRemove, attr.Key)
 			}
 		}
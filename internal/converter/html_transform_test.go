@@ -93,6 +93,14 @@ func TestTransformHTML_DataAttributeRemoval(t *testing.T) {
 	}
 }
 
+func TestTransformHTML_KeepsKindleMagnifyAttribute(t *testing.T) {
+	doc := parseTestHTML(`<html><body><a id="test" class="app-amzn-magnify" data-app-amzn-magnify='{"targetId":"t1","ordinal":1}'></a></body></html>`)
+	TransformHTML(doc)
+	if v, _ := doc.Find("#test").Attr("data-app-amzn-magnify"); v != `{"targetId":"t1","ordinal":1}` {
+		t.Fatalf("data-app-amzn-magnify = %q, want it preserved", v)
+	}
+}
+
 func TestTransformHTML_ForbiddenAttributeRemoval(t *testing.T) {
 	doc := parseTestHTML(`<html><body><div contenteditable="true" draggable="true" hidden="" spellcheck="false" translate="no" id="test">content</div></body></html>`)
 	TransformHTML(doc)
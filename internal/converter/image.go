@@ -29,6 +29,15 @@ type ImageOptimizer struct {
 	MinJPEGQuality   int
 	CoverJPEGQuality int
 	MaxPixels        int // Total pixel count limit for decode (width * height)
+	// FullPageImages holds the paths of the full-page images of a fixed-layout
+	// book. Like the cover, they are not resized to MaxWidth.
+	FullPageImages map[string]bool
+	// PanelView enables panel detection on the full-page images (see
+	// DetectPanels), in right-to-left order when RightToLeft is set.
+	PanelView   bool
+	RightToLeft bool
+	// ComicGamma is the gamma applied to comic pages by ComicPages.
+	ComicGamma float64
 }
 
 // OptimizedImage holds optimized image data and metadata.
@@ -42,6 +51,7 @@ type OptimizedImage struct {
 	Format       string
 	OriginalPath string
 	Warning      string
+	Panels       []image.Rectangle // detected panels of a full-page image, in reading order
 }
 
 // NewImageOptimizer creates an image optimizer with defaults.
@@ -71,6 +81,7 @@ func NewImageOptimizer(opts ConvertOptions) *ImageOptimizer {
 		MinJPEGQuality:   minJPEGQuality,
 		CoverJPEGQuality: defaultCoverJPEGQuality,
 		MaxPixels:        defaultMaxPixels,
+		ComicGamma:       defaultComicGamma,
 	}
 }
 
@@ -116,9 +127,12 @@ func (o *ImageOptimizer) Optimize(path, mediaType string, input []byte, isCover
 	}
 
 	processed := src
-	if !isCover && o.MaxWidth > 0 && src.Bounds().Dx() > o.MaxWidth {
+	if !isCover && !o.FullPageImages[path] && o.MaxWidth > 0 && src.Bounds().Dx() > o.MaxWidth {
 		processed = imaging.Resize(src, o.MaxWidth, 0, imaging.Lanczos)
 	}
+	if o.PanelView && o.FullPageImages[path] {
+		out.Panels = DetectPanels(processed, o.RightToLeft)
+	}
 
 	targetFormat := chooseTargetFormat(mediaType, out.Format, processed)
 	var data []byte
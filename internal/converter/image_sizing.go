@@ -0,0 +1,172 @@
+package converter
+
+import (
+	"image"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FullPageImageClass marks the images of the image-only pages of a
+// reflowable book, which are scaled to fill the screen.
+const FullPageImageClass = "fullpage-image"
+
+// inlineImageMaxHeight is the largest height in pixels of an image that is
+// sized in em like text (e.g. gaiji and icons); larger images are sized in
+// percentages of the screen width.
+const inlineImageMaxHeight = 32
+
+// screenAspect is the height to width ratio of a Kindle screen. Full-page
+// images that are taller than the screen are fitted to its height instead of
+// its width.
+const screenAspect = 4.0 / 3.0
+
+// pxLengthRe matches a length in pixels, with or without the px unit.
+var pxLengthRe = regexp.MustCompile(`(?i)^\s*(\d+(?:\.\d+)?)\s*(?:px)?\s*$`)
+
+// fitImageSizes rewrites the sizing of the images of a reflowable book to
+// match the images as they were optimized. sizes holds the pixel size of each
+// image record by src; images without a size are left alone. Stale width and
+// height attributes and pixel sizes of the style attribute are replaced with
+// sizes relative to the screen: em for images no taller than a line or two,
+// and percentages of viewportWidth (the width images are resized to)
+// otherwise. The images of image-only pages get FullPageImageClass and fill
+// the screen. It returns the number of images that were changed.
+func fitImageSizes(chapters []*ChapterContent, sizes map[string]image.Point, viewportWidth int) int {
+	count := 0
+	for _, chapter := range chapters {
+		imgs := chapter.Document.Find("body img[src]")
+		fullPage := isImagePage(chapter.Document) && imgs.Length() == 1
+		imgs.Each(func(_ int, s *goquery.Selection) {
+			src, _ := s.Attr("src")
+			size, ok := sizes[src]
+			if !ok || size.X <= 0 || size.Y <= 0 {
+				return
+			}
+			if fullPage {
+				fitFullPageImage(s, size)
+				count++
+				return
+			}
+			if fitImage(s, size, viewportWidth) {
+				count++
+			}
+		})
+	}
+	return count
+}
+
+// fitFullPageImage makes an image fill the screen: its width, or its height
+// when the image is taller than the screen.
+func fitFullPageImage(s *goquery.Selection, size image.Point) {
+	s.RemoveAttr("width")
+	s.RemoveAttr("height")
+	if class, _ := s.Attr("class"); class != "" {
+		s.SetAttr("class", class+" "+FullPageImageClass)
+	} else {
+		s.SetAttr("class", FullPageImageClass)
+	}
+	sizing := []string{"width: 100%", "height: auto"}
+	if float64(size.Y)/float64(size.X) > screenAspect {
+		sizing = []string{"width: auto", "height: 100%"}
+	}
+	setImageSizing(s, sizing)
+}
+
+// fitImage replaces the pixel sizing of an image, from its style or its
+// width and height attributes, with a relative size. A missing width or
+// height follows from the aspect ratio of the image; a relative width (e.g. a
+// percentage) is kept. It reports whether the image was changed.
+func fitImage(s *goquery.Selection, size image.Point, viewportWidth int) bool {
+	widthValue := imageLength(s, "width")
+	heightValue := imageLength(s, "height")
+	width, hasWidth := pixelLength(widthValue)
+	height, hasHeight := pixelLength(heightValue)
+	if !hasWidth && !hasHeight {
+		return false
+	}
+	s.RemoveAttr("width")
+	s.RemoveAttr("height")
+
+	if relative := strings.TrimSpace(widthValue); relative != "" && !hasWidth && !strings.EqualFold(relative, "auto") {
+		setImageSizing(s, []string{"width: " + relative, "height: auto"})
+		return true
+	}
+	switch {
+	case !hasWidth:
+		width = height * float64(size.X) / float64(size.Y)
+	case !hasHeight:
+		height = width * float64(size.Y) / float64(size.X)
+	}
+	if height <= inlineImageMaxHeight {
+		setImageSizing(s, []string{"width: auto", "height: " + formatEm(round2(height/16))})
+		return true
+	}
+	percent := 100.0
+	if viewportWidth > 0 {
+		percent = min(100, width*100/float64(viewportWidth))
+	}
+	setImageSizing(s, []string{"width: " + strconv.FormatFloat(round2(percent), 'f', -1, 64) + "%", "height: auto"})
+	return true
+}
+
+// imageLength returns the width or height of an image from its style, or
+// else from its attribute.
+func imageLength(s *goquery.Selection, property string) string {
+	style, _ := s.Attr("style")
+	if value := styleValue(style, property); value != "" {
+		return value
+	}
+	value, _ := s.Attr(property)
+	return value
+}
+
+// setImageSizing replaces the width and height declarations of the style
+// attribute with sizing, keeping the other declarations.
+func setImageSizing(s *goquery.Selection, sizing []string) {
+	style, _ := s.Attr("style")
+	var decls []string
+	for _, decl := range strings.Split(style, ";") {
+		m := declarationRe.FindStringSubmatch(decl)
+		if m == nil {
+			continue
+		}
+		switch strings.ToLower(m[1]) {
+		case "width", "height":
+			continue
+		}
+		decls = append(decls, strings.TrimSpace(decl))
+	}
+	s.SetAttr("style", strings.Join(append(decls, sizing...), "; "))
+}
+
+// styleValue returns the value of a property in a style attribute, or "".
+func styleValue(style, property string) string {
+	value := ""
+	for _, decl := range strings.Split(style, ";") {
+		if m := declarationRe.FindStringSubmatch(decl); m != nil && strings.EqualFold(m[1], property) {
+			value = m[2]
+		}
+	}
+	return value
+}
+
+// pixelLength parses a length in pixels ("120" or "120px").
+func pixelLength(value string) (float64, bool) {
+	m := pxLengthRe.FindStringSubmatch(value)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+// round2 rounds to two decimal places.
+func round2(v float64) float64 {
+	return float64(int(v*100+0.5)) / 100
+}
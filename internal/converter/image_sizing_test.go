@@ -0,0 +1,118 @@
+package converter
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func newSizingChapter(t *testing.T, id, body string) *ChapterContent {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><body>" + body + "</body></html>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &ChapterContent{ID: id, Document: doc}
+}
+
+func TestFitImageSizes(t *testing.T) {
+	sizes := map[string]image.Point{
+		"images/photo.jpg": image.Pt(600, 400),  // resized from 1200x800
+		"images/gaiji.png": image.Pt(24, 24),    // not resized
+		"images/page.jpg":  image.Pt(600, 1000), // taller than the screen
+		"images/wide.jpg":  image.Pt(600, 300),
+	}
+	tests := []struct {
+		name      string
+		img       string
+		wantStyle string
+	}{
+		{
+			name:      "stale attributes wider than the screen",
+			img:       `<img src="images/photo.jpg" width="1200" height="800"/>`,
+			wantStyle: "width: 100%; height: auto",
+		},
+		{
+			name:      "width attribute only",
+			img:       `<img src="images/photo.jpg" width="300px"/>`,
+			wantStyle: "width: 50%; height: auto",
+		},
+		{
+			name:      "height from style, width from aspect ratio",
+			img:       `<img src="images/photo.jpg" style="height: 200px; border: 0"/>`,
+			wantStyle: "border: 0; width: 50%; height: auto",
+		},
+		{
+			name:      "small image sized in em",
+			img:       `<img src="images/gaiji.png" width="24" height="24"/>`,
+			wantStyle: "width: auto; height: 1.5em",
+		},
+		{
+			name:      "relative width kept",
+			img:       `<img src="images/photo.jpg" width="50%" height="800"/>`,
+			wantStyle: "width: 50%; height: auto",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chapter := newSizingChapter(t, "ch01", "<p>Text "+tt.img+"</p>")
+			if n := fitImageSizes([]*ChapterContent{chapter}, sizes, 600); n != 1 {
+				t.Errorf("fitImageSizes() = %d, want 1", n)
+			}
+			img := chapter.Document.Find("img")
+			if style, _ := img.Attr("style"); style != tt.wantStyle {
+				t.Errorf("style = %q, want %q", style, tt.wantStyle)
+			}
+			for _, attr := range []string{"width", "height"} {
+				if v, ok := img.Attr(attr); ok {
+					t.Errorf("%s attribute %q not removed", attr, v)
+				}
+			}
+		})
+	}
+}
+
+func TestFitImageSizes_Unchanged(t *testing.T) {
+	sizes := map[string]image.Point{"images/photo.jpg": image.Pt(600, 400)}
+	chapter := newSizingChapter(t, "ch01", `<p>Text <img src="images/photo.jpg" class="photo"/>`+
+		`<img src="images/photo.jpg" width="80%"/><img src="images/unknown.jpg" width="1200"/></p>`)
+
+	if n := fitImageSizes([]*ChapterContent{chapter}, sizes, 600); n != 0 {
+		t.Errorf("fitImageSizes() = %d, want 0", n)
+	}
+	html, _ := chapter.Document.Find("p").Html()
+	if want := `Text <img src="images/photo.jpg" class="photo"/><img src="images/photo.jpg" width="80%"/><img src="images/unknown.jpg" width="1200"/>`; html != want {
+		t.Errorf("html = %s, want %s", html, want)
+	}
+}
+
+func TestFitImageSizes_FullPage(t *testing.T) {
+	sizes := map[string]image.Point{
+		"images/page.jpg": image.Pt(600, 1000),
+		"images/wide.jpg": image.Pt(600, 300),
+	}
+	chapters := []*ChapterContent{
+		newSizingChapter(t, "ch01", `<div><img src="images/page.jpg" width="600" height="1000" class="pic"/></div>`),
+		newSizingChapter(t, "ch02", `<div><img src="images/wide.jpg" style="width: 600px"/></div>`),
+	}
+	if n := fitImageSizes(chapters, sizes, 600); n != 2 {
+		t.Errorf("fitImageSizes() = %d, want 2", n)
+	}
+
+	tall := chapters[0].Document.Find("img")
+	if style, _ := tall.Attr("style"); style != "width: auto; height: 100%" {
+		t.Errorf("tall page style = %q", style)
+	}
+	if class, _ := tall.Attr("class"); class != "pic "+FullPageImageClass {
+		t.Errorf("tall page class = %q", class)
+	}
+	if _, ok := tall.Attr("width"); ok {
+		t.Error("width attribute of the full-page image not removed")
+	}
+	wide := chapters[1].Document.Find("img")
+	if style, _ := wide.Attr("style"); style != "width: 100%; height: auto" {
+		t.Errorf("wide page style = %q", style)
+	}
+}
@@ -190,6 +190,29 @@ func TestImageOptimizer_CoverSkipsMaxWidthResize(t *testing.T) {
 	}
 }
 
+func TestImageOptimizer_FullPageImageSkipsMaxWidthResize(t *testing.T) {
+	src := makeSolidNRGBA(1200, 1600, color.NRGBA{R: 20, G: 50, B: 200, A: 255})
+	data := mustEncodeJPEG(t, src, 90)
+	opt := NewImageOptimizer(ConvertOptions{MaxImageWidth: 600})
+	opt.FullPageImages = map[string]bool{"OEBPS/p1.jpg": true}
+
+	out, err := opt.Optimize("OEBPS/p1.jpg", "image/jpeg", data, false)
+	if err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+	if out.Width != 1200 || out.Height != 1600 {
+		t.Fatalf("full-page image size got %dx%d, want 1200x1600", out.Width, out.Height)
+	}
+
+	out, err = opt.Optimize("OEBPS/inline.jpg", "image/jpeg", data, false)
+	if err != nil {
+		t.Fatalf("Optimize() error = %v", err)
+	}
+	if out.Width != 600 {
+		t.Fatalf("inline image width got %d, want 600", out.Width)
+	}
+}
+
 func TestImageOptimizer_DecodeFailurePassthrough(t *testing.T) {
 	raw := []byte("not-an-image")
 	opt := NewImageOptimizer(ConvertOptions{})
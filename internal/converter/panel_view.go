@@ -0,0 +1,290 @@
+package converter
+
+import (
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"strings"
+)
+
+const (
+	// panelAnalysisSize is the longer side, in pixels, of the ink map that
+	// panels are detected on. Larger images are sampled down to it.
+	panelAnalysisSize = 1024
+	// panelInkThreshold is the grey level difference from the gutter colour
+	// above which a pixel counts as ink.
+	panelInkThreshold = 48
+	// panelGutterInk is the largest fraction of ink pixels on a gutter line.
+	panelGutterInk = 0.01
+	// panelMinGutter is the smallest gutter thickness, relative to the page.
+	panelMinGutter = 0.006
+	// panelMinSize is the smallest panel width or height, relative to the page.
+	// Smaller regions (page numbers, stray marks) are dropped.
+	panelMinSize = 0.08
+)
+
+// inkMap is a greyscale-thresholded, sampled copy of a page image.
+type inkMap struct {
+	width, height int
+	scale         float64 // image pixels per ink map pixel
+	ink           []bool
+}
+
+// newInkMap thresholds img against the gutter colour, which is taken as the
+// average grey level of the image border. This handles both white and black
+// gutters.
+func newInkMap(img image.Image) *inkMap {
+	b := img.Bounds()
+	scale := 1.0
+	if longer := max(b.Dx(), b.Dy()); longer > panelAnalysisSize {
+		scale = float64(longer) / panelAnalysisSize
+	}
+	m := &inkMap{
+		width:  max(1, int(float64(b.Dx())/scale)),
+		height: max(1, int(float64(b.Dy())/scale)),
+		scale:  scale,
+	}
+
+	grey := make([]uint8, m.width*m.height)
+	for y := 0; y < m.height; y++ {
+		sy := b.Min.Y + min(b.Dy()-1, int(float64(y)*scale))
+		for x := 0; x < m.width; x++ {
+			sx := b.Min.X + min(b.Dx()-1, int(float64(x)*scale))
+			grey[y*m.width+x] = color.GrayModel.Convert(img.At(sx, sy)).(color.Gray).Y
+		}
+	}
+
+	var sum, n int
+	for x := 0; x < m.width; x++ {
+		sum += int(grey[x]) + int(grey[(m.height-1)*m.width+x])
+		n += 2
+	}
+	for y := 0; y < m.height; y++ {
+		sum += int(grey[y*m.width]) + int(grey[y*m.width+m.width-1])
+		n += 2
+	}
+	background := sum / n
+
+	m.ink = make([]bool, len(grey))
+	for i, g := range grey {
+		d := int(g) - background
+		m.ink[i] = d > panelInkThreshold || d < -panelInkThreshold
+	}
+	return m
+}
+
+// imageRect maps a rectangle of the ink map to the image with bounds b.
+func (m *inkMap) imageRect(r, b image.Rectangle) image.Rectangle {
+	return image.Rect(
+		int(float64(r.Min.X)*m.scale), int(float64(r.Min.Y)*m.scale),
+		int(float64(r.Max.X)*m.scale), int(float64(r.Max.Y)*m.scale),
+	).Add(b.Min).Intersect(b)
+}
+
+// profile returns the ink count of each row (horizontal) or column of r.
+func (m *inkMap) profile(r image.Rectangle, horizontal bool) []int {
+	var counts []int
+	if horizontal {
+		counts = make([]int, r.Dy())
+	} else {
+		counts = make([]int, r.Dx())
+	}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := m.ink[y*m.width : (y+1)*m.width]
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if !row[x] {
+				continue
+			}
+			if horizontal {
+				counts[y-r.Min.Y]++
+			} else {
+				counts[x-r.Min.X]++
+			}
+		}
+	}
+	return counts
+}
+
+// isGutter reports whether a line with count ink pixels of length is blank.
+func isGutter(count, length int) bool {
+	return float64(count) <= panelGutterInk*float64(length)
+}
+
+// trim shrinks r to the smallest rectangle without blank border lines.
+func (m *inkMap) trim(r image.Rectangle) image.Rectangle {
+	rows := m.profile(r, true)
+	top, bottom := 0, len(rows)
+	for top < bottom && isGutter(rows[top], r.Dx()) {
+		top++
+	}
+	for bottom > top && isGutter(rows[bottom-1], r.Dx()) {
+		bottom--
+	}
+	if top == bottom {
+		return image.Rectangle{}
+	}
+	r.Min.Y, r.Max.Y = r.Min.Y+top, r.Min.Y+bottom
+
+	cols := m.profile(r, false)
+	left, right := 0, len(cols)
+	for left < right && isGutter(cols[left], r.Dy()) {
+		left++
+	}
+	for right > left && isGutter(cols[right-1], r.Dy()) {
+		right--
+	}
+	r.Min.X, r.Max.X = r.Min.X+left, r.Min.X+right
+	return r
+}
+
+// split cuts r at its horizontal (or vertical) gutters and returns the
+// trimmed parts that are large enough to be panels, in top-to-bottom (or
+// left-to-right) order.
+func (m *inkMap) split(r image.Rectangle, horizontal bool) []image.Rectangle {
+	counts := m.profile(r, horizontal)
+	length, extent := r.Dx(), m.height
+	if !horizontal {
+		length, extent = r.Dy(), m.width
+	}
+	minGutter := max(2, int(panelMinGutter*float64(extent)))
+
+	var parts []image.Rectangle
+	start, blank := 0, 0
+	flush := func(end int) {
+		part := r
+		if horizontal {
+			part.Min.Y, part.Max.Y = r.Min.Y+start, r.Min.Y+end
+		} else {
+			part.Min.X, part.Max.X = r.Min.X+start, r.Min.X+end
+		}
+		part = m.trim(part)
+		if float64(part.Dx()) >= panelMinSize*float64(m.width) && float64(part.Dy()) >= panelMinSize*float64(m.height) {
+			parts = append(parts, part)
+		}
+	}
+	for i, c := range counts {
+		if isGutter(c, length) {
+			blank++
+			continue
+		}
+		if blank >= minGutter && i-blank > start {
+			flush(i - blank)
+			start = i
+		}
+		blank = 0
+	}
+	flush(len(counts))
+	return parts
+}
+
+// cut splits r recursively into panels, first into rows and then into
+// columns (recursive XY-cut), appending them to panels in reading order.
+func (m *inkMap) cut(r image.Rectangle, rtl bool, panels *[]image.Rectangle) {
+	if rows := m.split(r, true); len(rows) > 1 {
+		for _, row := range rows {
+			m.cut(row, rtl, panels)
+		}
+		return
+	}
+	if cols := m.split(r, false); len(cols) > 1 {
+		if rtl {
+			for i, j := 0, len(cols)-1; i < j; i, j = i+1, j-1 {
+				cols[i], cols[j] = cols[j], cols[i]
+			}
+		}
+		for _, col := range cols {
+			m.cut(col, rtl, panels)
+		}
+		return
+	}
+	*panels = append(*panels, r)
+}
+
+// DetectPanels finds the comic panels of a page image by gutter detection:
+// the image is thresholded against the gutter colour and cut recursively
+// along the blank rows and columns of its projection profiles. Panels are
+// returned in reading order, rows from top to bottom and the panels of a row
+// from left to right, or from right to left when rtl is set. It returns nil
+// when the page does not divide into at least two panels.
+func DetectPanels(img image.Image, rtl bool) []image.Rectangle {
+	m := newInkMap(img)
+	page := m.trim(image.Rect(0, 0, m.width, m.height))
+	if page.Empty() {
+		return nil
+	}
+
+	var panels []image.Rectangle
+	m.cut(page, rtl, &panels)
+	if len(panels) < 2 {
+		return nil
+	}
+
+	for i, p := range panels {
+		panels[i] = m.imageRect(p, img.Bounds())
+	}
+	return panels
+}
+
+// panelViewMarkup returns the Kindle region magnification markup of a page
+// showing src with the given panels: for each panel, a tap region holding an
+// app-amzn-magnify link, and the magnification target, which shows the image
+// enlarged around the panel. Positions are percentages of the page size.
+// HTMLBuilder prefixes ids with the chapter id, so targetIds refer to the
+// prefixed ids.
+func panelViewMarkup(chapterID, src string, size image.Point, panels []image.Rectangle) string {
+	pct := func(v, total int) float64 { return 100 * float64(v) / float64(total) }
+
+	var b strings.Builder
+	b.WriteString(`<div class="panel-view" style="position:absolute;left:0;top:0;width:100%;height:100%;">`)
+	for i, p := range panels {
+		ordinal := i + 1
+		targetID := fmt.Sprintf("pv-%d-magTarget", ordinal)
+		data := fmt.Sprintf(`{"targetId":"%s-%s","ordinal":%d}`, chapterID, targetID, ordinal)
+		fmt.Fprintf(&b, `<div id="pv-%d" style="position:absolute;left:%.2f%%;top:%.2f%%;width:%.2f%%;height:%.2f%%;">`,
+			ordinal, pct(p.Min.X, size.X), pct(p.Min.Y, size.Y), pct(p.Dx(), size.X), pct(p.Dy(), size.Y))
+		fmt.Fprintf(&b, `<a class="app-amzn-magnify" data-app-amzn-magnify="%s" style="display:block;width:100%%;height:100%%;"></a></div>`, html.EscapeString(data))
+
+		// Enlarge the panel to fit the page, and center it.
+		zoom := min(float64(size.X)/float64(p.Dx()), float64(size.Y)/float64(p.Dy()))
+		cx := float64(p.Min.X+p.Max.X) / 2 / float64(size.X)
+		cy := float64(p.Min.Y+p.Max.Y) / 2 / float64(size.Y)
+		fmt.Fprintf(&b, `<div id="%s" class="target-mag" style="position:absolute;left:0;top:0;width:100%%;height:100%%;overflow:hidden;display:none;">`, targetID)
+		fmt.Fprintf(&b, `<img src="%s" alt="" style="position:absolute;left:%.2f%%;top:%.2f%%;width:%.2f%%;height:%.2f%%;"/></div>`,
+			html.EscapeString(src), 50-zoom*cx*100, 50-zoom*cy*100, zoom*100, zoom*100)
+	}
+	b.WriteString(`</div>`)
+	return b.String()
+}
+
+// PagePanels is the size of a full-page image and its panels, in reading order.
+type PagePanels struct {
+	Size   image.Point
+	Panels []image.Rectangle
+}
+
+// addPanelView appends the region magnification markup to the image pages
+// whose image has panels, keyed by image src. Only pages with a single image
+// are considered, since the regions are positioned relative to the page. It
+// returns the number of pages that got the markup.
+func addPanelView(chapters []*ChapterContent, pages map[string]PagePanels) int {
+	count := 0
+	for _, chapter := range chapters {
+		if !isImagePage(chapter.Document) {
+			continue
+		}
+		body := chapter.Document.Find("body")
+		imgs := body.Find("img[src]")
+		if imgs.Length() != 1 {
+			continue
+		}
+		src, _ := imgs.Attr("src")
+		page, ok := pages[src]
+		if !ok {
+			continue
+		}
+		body.AppendHtml(panelViewMarkup(chapter.ID, src, page.Size, page.Panels))
+		count++
+	}
+	return count
+}
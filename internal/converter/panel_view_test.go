@@ -0,0 +1,155 @@
+package converter
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// panelPage draws the given panels as framed, shaded boxes on a page of the
+// gutter colour.
+func panelPage(width, height int, gutter color.Color, panels []image.Rectangle) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(gutter), image.Point{}, draw.Src)
+	for _, p := range panels {
+		draw.Draw(img, p, image.NewUniform(color.Gray{Y: 40}), image.Point{}, draw.Src)
+		draw.Draw(img, p.Inset(4), image.NewUniform(color.Gray{Y: 160}), image.Point{}, draw.Src)
+	}
+	return img
+}
+
+// gridPanels returns the panels of a 2x2 grid page of 600x800 pixels, in
+// left-to-right order.
+func gridPanels() []image.Rectangle {
+	return []image.Rectangle{
+		image.Rect(30, 30, 290, 380),
+		image.Rect(310, 30, 570, 380),
+		image.Rect(30, 420, 290, 770),
+		image.Rect(310, 420, 570, 770),
+	}
+}
+
+func TestDetectPanels(t *testing.T) {
+	grid := gridPanels()
+	// On a black page, the dark panel frames are part of the gutter.
+	var framed []image.Rectangle
+	for _, p := range grid {
+		framed = append(framed, p.Inset(4))
+	}
+	tests := []struct {
+		name   string
+		gutter color.Color
+		rtl    bool
+		want   []image.Rectangle
+	}{
+		{"white gutters, left to right", color.White, false, grid},
+		{"white gutters, right to left", color.White, true, []image.Rectangle{grid[1], grid[0], grid[3], grid[2]}},
+		{"black gutters", color.Black, false, framed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DetectPanels(panelPage(600, 800, tt.gutter, grid), tt.rtl)
+			if len(got) != len(tt.want) {
+				t.Fatalf("DetectPanels() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !nearRect(got[i], tt.want[i], 2) {
+					t.Errorf("panel %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDetectPanels_Downsampled(t *testing.T) {
+	panels := []image.Rectangle{
+		image.Rect(50, 50, 1950, 1450),
+		image.Rect(50, 1550, 950, 2950),
+		image.Rect(1050, 1550, 1950, 2950),
+	}
+	got := DetectPanels(panelPage(2000, 3000, color.White, panels), true)
+	want := []image.Rectangle{panels[0], panels[2], panels[1]}
+	if len(got) != len(want) {
+		t.Fatalf("DetectPanels() = %v, want %v", got, want)
+	}
+	for i := range got {
+		if !nearRect(got[i], want[i], 6) {
+			t.Errorf("panel %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDetectPanels_NoPanels(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"blank page", panelPage(600, 800, color.White, nil)},
+		{"single panel", panelPage(600, 800, color.White, []image.Rectangle{image.Rect(30, 30, 570, 770)})},
+		{"small marks", panelPage(600, 800, color.White, []image.Rectangle{image.Rect(30, 30, 570, 770), image.Rect(290, 780, 310, 795)})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectPanels(tt.img, false); got != nil {
+				t.Errorf("DetectPanels() = %v, want nil", got)
+			}
+		})
+	}
+}
+
+func TestAddPanelView(t *testing.T) {
+	page := func(body string) *ChapterContent {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><body>` + body + `</body></html>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &ChapterContent{Document: doc}
+	}
+	chapters := []*ChapterContent{
+		page(`<img src="p1.jpg"/>`),
+		page(`<img src="p2.jpg"/>`),
+		page(`<p>text</p><img src="p1.jpg"/>`),
+	}
+	for i, chapter := range chapters {
+		chapter.ID = []string{"ch01", "ch02", "ch03"}[i]
+	}
+	pages := map[string]PagePanels{
+		"p1.jpg": {Size: image.Pt(600, 800), Panels: gridPanels()[:2]},
+	}
+
+	if n := addPanelView(chapters, pages); n != 1 {
+		t.Fatalf("addPanelView() = %d, want 1", n)
+	}
+
+	body := chapters[0].Document.Find("body")
+	links := body.Find("a.app-amzn-magnify")
+	if links.Length() != 2 {
+		t.Fatalf("magnify links = %d, want 2", links.Length())
+	}
+	data, _ := links.Eq(1).Attr("data-app-amzn-magnify")
+	if want := `{"targetId":"ch01-pv-2-magTarget","ordinal":2}`; data != want {
+		t.Errorf("data-app-amzn-magnify = %q, want %q", data, want)
+	}
+	region, _ := body.Find("#pv-1").Attr("style")
+	if want := "left:5.00%;top:3.75%;width:43.33%;height:43.75%;"; !strings.Contains(region, want) {
+		t.Errorf("region style = %q, want it to contain %q", region, want)
+	}
+	if n := body.Find("#pv-2-magTarget img[src='p1.jpg']").Length(); n != 1 {
+		t.Errorf("magnification target images = %d, want 1", n)
+	}
+
+	for _, chapter := range chapters[1:] {
+		if chapter.Document.Find(".app-amzn-magnify").Length() != 0 {
+			t.Errorf("%s: unexpected panel view markup", chapter.ID)
+		}
+	}
+}
+
+func nearRect(a, b image.Rectangle, tolerance int) bool {
+	near := func(x, y int) bool { return x-y <= tolerance && y-x <= tolerance }
+	return near(a.Min.X, b.Min.X) && near(a.Min.Y, b.Min.Y) && near(a.Max.X, b.Max.X) && near(a.Max.Y, b.Max.Y)
+}
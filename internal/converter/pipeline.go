@@ -1,11 +1,12 @@
 package converter
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"image"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -14,14 +15,30 @@ import (
 	"github.com/yuanying/epub2azw3/internal/mobi"
 )
 
+// Output formats supported by the pipeline.
+const (
+	// FormatAZW3 writes a KF8-only AZW3 file.
+	FormatAZW3 = "azw3"
+	// FormatMOBI7KF8 writes a joint file with a MOBI7 section followed by the KF8 section.
+	FormatMOBI7KF8 = "mobi7+kf8"
+)
+
 // ConvertOptions holds options for the conversion pipeline.
 type ConvertOptions struct {
 	InputPath         string
 	OutputPath        string
+	Format            string // FormatAZW3 (default) or FormatMOBI7KF8
 	MaxImageWidth     int
 	JPEGQuality       int
 	MaxImageSizeBytes int
 	NoImages          bool
+	WritingMode       string // one of WritingModes; empty means detect it from the EPUB
+	PanelView         bool   // add region magnification to the pages of fixed-layout comics
+	Comic             bool   // crop, split and tone the image pages of scanned comics
+	APNX              string // one of APNXModes; empty means APNXAuto
+	ASIN              string // empty means derive it from the book identifier (see BookASIN)
+	CDEType           string // one of CDETypes; empty means CDETypeEBOK
+	ThumbnailDir      string // directory for the device thumbnail sidecar; empty means none
 	Strict            bool
 	Logger            *slog.Logger
 }
@@ -52,9 +69,10 @@ func (h discardHandler) WithGroup(string) slog.Handler           { return h }
 
 // Pipeline orchestrates the EPUB to AZW3 conversion.
 type Pipeline struct {
-	Options ConvertOptions
-	errors  []ConvertError
-	logger  *slog.Logger
+	Options       ConvertOptions
+	errors        []ConvertError
+	logger        *slog.Logger
+	thumbnailPath string // thumbnail sidecar written by Convert, if any
 }
 
 // NewPipeline creates a new conversion pipeline.
@@ -78,6 +96,9 @@ func (p *Pipeline) Convert() error {
 		return p.fatal("parse", "failed to parse EPUB", err)
 	}
 	defer reader.Close()
+	if encrypted := reader.EncryptedFiles(); len(encrypted) > 0 {
+		return p.fatal("parse", "EPUB is DRM-protected and cannot be converted", fmt.Errorf("%w: %s", epub.ErrEncrypted, strings.Join(encrypted, ", ")))
+	}
 	p.stageDone("parse", "parse EPUB")
 
 	if err := p.validateRequiredMetadata(&opf.Metadata); err != nil {
@@ -89,6 +110,12 @@ func (p *Pipeline) Convert() error {
 		p.acceptable("cover", "cover image not found", nil)
 	}
 
+	if p.Options.Comic && !p.Options.NoImages {
+		p.stageStart("comic", "prepare comic pages")
+		p.prepareComicPages(reader, opf, cover)
+		p.stageDone("comic", "prepare comic pages")
+	}
+
 	p.stageStart("build", "build integrated HTML")
 	html, imageMapper, builder, err := p.buildHTML(reader, opf, cover)
 	if err != nil {
@@ -96,6 +123,19 @@ func (p *Pipeline) Convert() error {
 	}
 	p.stageDone("build", "build integrated HTML")
 
+	writingMode, ppd := p.writingMode(opf, builder)
+	if p.Options.PanelView && !opf.FixedLayout() {
+		p.acceptable("build", "--panel-view only applies to fixed-layout books and is ignored", nil)
+	}
+
+	var fixedLayout *mobi.FixedLayout
+	var chapterHeads map[string][]byte
+	if opf.FixedLayout() {
+		fixedLayout, chapterHeads = buildFixedLayout(opf, builder.chapters)
+		fixedLayout.RegionMagnification = p.Options.PanelView && !p.Options.NoImages
+		p.logger.Info(fmt.Sprintf("fixed layout: %s, original resolution %q", fixedLayout.BookType, fixedLayout.OriginalResolution), "stage", "build")
+	}
+
 	var coverOffset *uint32
 	if cover != nil && !p.Options.NoImages {
 		if offset, ok := ComputeCoverOffset(cover, imageMapper); ok {
@@ -115,45 +155,107 @@ func (p *Pipeline) Convert() error {
 		p.recoverable("toc", "failed to load NCX", err)
 	}
 
-	// Generate inline TOC and insert into HTML (before image reference transformation)
+	// Generate inline TOC and insert into HTML (before image reference transformation).
+	// Fixed-layout books only consist of their own pages and get no inline TOC.
 	var tocGen *TOCGenerator
 	if ncx != nil && len(ncx.NavPoints) > 0 {
 		tocGen = NewTOCGenerator(ncx, builder.GetChapterIDs())
-		html = tocGen.InsertInlineTOC(html)
+		if fixedLayout == nil {
+			html = tocGen.InsertInlineTOC(html)
+		}
+	}
+
+	// Fonts follow the images so that image indexes (e.g. the cover offset)
+	// are not affected by them. They are subset to the final text, which
+	// includes the inline TOC.
+	p.collectFonts(reader, opf, imageMapper, html)
+	var thumbnailOffset *uint32
+	if coverOffset != nil {
+		thumbnailOffset = p.addCoverThumbnail(imageMapper, *coverOffset)
 	}
 
 	// Transform image references to kindle:embed format
 	html = mobi.TransformImageReferences(html, imageMapper)
 
-	// Build NCX record
-	var ncxRecord []byte
+	// Offsets in the NCX refer to the KF8 text flow, where each chapter
+	// becomes its own skeleton followed by its fragments.
+	chapterIDs := builder.ChapterOrder()
+	layout, err := mobi.BuildKF8LayoutWithHeads([]byte(html), chapterIDs, chapterHeads)
+	if err != nil {
+		return p.fatal("toc", "failed to build KF8 layout", err)
+	}
+
+	// Build NCX index entries and guide references
+	finalHTML := layout.Text
+	var ncxEntries []mobi.NCXEntry
 	if tocGen != nil {
-		finalHTML := []byte(html)
 		entries, buildErr := tocGen.BuildTOCEntries(finalHTML)
 		if buildErr != nil {
 			p.recoverable("toc", "failed to build TOC entries", buildErr)
 		} else if len(entries) > 0 {
-			ncxEntries := convertTOCEntries(entries)
-			ncxRecord = mobi.GenerateNCXRecord(mobi.NCXRecordConfig{
-				Title:   opf.Metadata.Title,
-				Entries: ncxEntries,
-				Guide:   buildGuideReferences(finalHTML),
-			})
+			ncxEntries = convertTOCEntries(entries)
 		}
 	}
+	var landmarks []epub.Landmark
+	if ncx != nil {
+		landmarks = ncx.Landmarks
+	}
+	guide := buildGuideReferences(finalHTML, NewTOCGenerator(ncx, builder.GetChapterIDs()), landmarks, opf.Guide)
+	startReading := startReadingOffset(guide)
+	if len(guide) > 0 {
+		types := make([]string, len(guide))
+		for i, ref := range guide {
+			types[i] = ref.Type
+		}
+		p.logger.Info("guide: "+strings.Join(types, ", "), "stage", "toc")
+	}
 	p.stageDone("toc", "load NCX and generate TOC")
 
 	p.stageStart("write", "write AZW3")
-	if err := p.writeAZW3(html, &opf.Metadata, imageMapper, ncxRecord, coverOffset); err != nil {
+	var flows [][]byte
+	if css := builder.CSS(); css != "" {
+		flows = append(flows, []byte(mobi.TransformCSSReferences(css, imageMapper)))
+	}
+	out := kf8Output{
+		html:            html,
+		chapterIDs:      chapterIDs,
+		chapterHeads:    chapterHeads,
+		flows:           flows,
+		metadata:        &opf.Metadata,
+		images:          imageMapper,
+		ncxEntries:      ncxEntries,
+		guide:           guide,
+		resc:            buildRESC(opf, builder, layout, ppd),
+		writingMode:     writingMode,
+		ppd:             ppd,
+		fixedLayout:     fixedLayout,
+		coverOffset:     coverOffset,
+		thumbnailOffset: thumbnailOffset,
+		startReading:    startReading,
+	}
+	if err := p.writeAZW3(out); err != nil {
 		return p.fatal("write", "failed to write AZW3", err)
 	}
 	p.stageDone("write", "write AZW3")
 
+	p.stageStart("apnx", "write APNX page numbers")
+	p.writeAPNX(ncx, builder.GetChapterIDs(), layout, fixedLayout != nil, &opf.Metadata)
+	p.stageDone("apnx", "write APNX page numbers")
+
+	if p.Options.ThumbnailDir != "" {
+		p.stageStart("thumbnail", "write thumbnail sidecar")
+		p.writeThumbnailSidecar(imageMapper, thumbnailOffset, BookASIN(p.Options.ASIN, opf.Metadata.Identifier))
+		p.stageDone("thumbnail", "write thumbnail sidecar")
+	}
+
 	if stat, err := os.Stat(p.Options.OutputPath); err == nil {
 		p.logger.Info(fmt.Sprintf("output size: %d bytes", stat.Size()), "stage", "result")
 	}
 
 	if p.Options.Strict {
+		if err := p.verifyOutput(); err != nil {
+			return err
+		}
 		if err := p.strictFailureIfNeeded(); err != nil {
 			return err
 		}
@@ -185,11 +287,21 @@ func (p *Pipeline) strictFailureIfNeeded() error {
 	return fmt.Errorf("strict mode failed: %d recoverable errors", len(recoverables))
 }
 
-// parseEPUB opens the EPUB file and parses the OPF.
+// parseEPUB opens the EPUB file and parses the OPF. A .cbz input is opened
+// as a fixed-layout comic with a synthesized OPF (see epub.OpenCBZ).
 func (p *Pipeline) parseEPUB() (*epub.EPUBReader, *epub.OPF, error) {
-	reader, err := epub.Open(p.Options.InputPath)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open EPUB: %w", err)
+	var reader *epub.EPUBReader
+	var err error
+	if strings.EqualFold(filepath.Ext(p.Options.InputPath), ".cbz") {
+		reader, err = epub.OpenCBZ(p.Options.InputPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open CBZ: %w", err)
+		}
+	} else {
+		reader, err = epub.Open(p.Options.InputPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open EPUB: %w", err)
+		}
 	}
 
 	opfData, err := reader.ReadFile(reader.OPFPath())
@@ -226,9 +338,12 @@ func (p *Pipeline) validateRequiredMetadata(metadata *epub.Metadata) error {
 }
 
 // buildHTML loads spine items and builds the integrated HTML.
-// It also collects images referenced in the content.
+// It also collects the images and fonts of the manifest.
 func (p *Pipeline) buildHTML(reader *epub.EPUBReader, opf *epub.OPF, cover *CoverInfo) (string, *mobi.ImageMapper, *HTMLBuilder, error) {
 	builder := NewHTMLBuilder()
+	if opf.FixedLayout() {
+		builder.KeepCSSLayout()
+	}
 	cssCache := make(map[string]string)
 	validChapters := 0
 	totalChapters := 0
@@ -312,12 +427,16 @@ func (p *Pipeline) buildHTML(reader *epub.EPUBReader, opf *epub.OPF, cover *Cove
 				p.recoverable("css", fmt.Sprintf("failed to read CSS %q, skipping", ref.path), err)
 				continue
 			}
-			cssText = string(cssData)
+			cssText = resolveCSSURLs(string(cssData), path.Dir(ref.path))
 			cssCache[ref.path] = cssText
 		}
 		builder.AddChapterCSS(ref.chapterID, cssText)
 	}
 
+	// The merged stylesheet is stored as KF8 flow 1 instead of inline in the head,
+	// which would otherwise be repeated in every skeleton.
+	builder.UseStylesheetLink(mobi.KindleFlowRef(1, "text/css"))
+
 	imageMapper := mobi.NewImageMapper()
 	if p.Options.NoImages {
 		p.logger.Info("--no-images enabled; removing all img tags", "stage", "images")
@@ -331,6 +450,13 @@ func (p *Pipeline) buildHTML(reader *epub.EPUBReader, opf *epub.OPF, cover *Cove
 
 	// Collect images from manifest in document order
 	optimizer := NewImageOptimizer(p.Options)
+	if opf.FixedLayout() {
+		optimizer.FullPageImages = FullPageImages(builder.chapters)
+		optimizer.PanelView = p.Options.PanelView
+		optimizer.RightToLeft = opf.PageProgressionDirection == "rtl"
+	}
+	pagePanels := make(map[string]PagePanels)
+	imageSizes := make(map[string]image.Point)
 	totalImages := 0
 	for _, id := range opf.ManifestOrder {
 		item, ok := opf.Manifest[id]
@@ -383,6 +509,26 @@ func (p *Pipeline) buildHTML(reader *epub.EPUBReader, opf *epub.OPF, cover *Cove
 			}
 		}
 		imageMapper.AddImage(item.Href, optimized.Data, mediaType)
+		if optimized.Width > 0 && optimized.Height > 0 {
+			imageSizes[item.Href] = image.Pt(optimized.Width, optimized.Height)
+		}
+		if len(optimized.Panels) > 0 {
+			pagePanels[item.Href] = PagePanels{
+				Size:   image.Pt(optimized.Width, optimized.Height),
+				Panels: optimized.Panels,
+			}
+		}
+	}
+
+	if optimizer.PanelView {
+		pages := addPanelView(builder.chapters, pagePanels)
+		p.logger.Info(fmt.Sprintf("panel view: %d/%d pages have panels", pages, len(optimizer.FullPageImages)), "stage", "images")
+	}
+	if !opf.FixedLayout() {
+		// Fixed-layout pages are laid out in the pixels of their viewport and
+		// keep their sizing.
+		fitted := fitImageSizes(builder.chapters, imageSizes, optimizer.MaxWidth)
+		p.logger.Info(fmt.Sprintf("image sizing: %d images sized to the screen", fitted), "stage", "images")
 	}
 
 	html, err := builder.Build()
@@ -393,24 +539,131 @@ func (p *Pipeline) buildHTML(reader *epub.EPUBReader, opf *epub.OPF, cover *Cove
 	return html, imageMapper, builder, nil
 }
 
+// addCoverThumbnail adds a thumbnail of the cover image record to the mapper
+// and returns its index, or nil when no thumbnail could be made. It is the
+// last resource, so that the indexes of the images and fonts are not affected
+// by it.
+func (p *Pipeline) addCoverThumbnail(mapper *mobi.ImageMapper, coverOffset uint32) *uint32 {
+	thumbnail, err := CoverThumbnail(mapper.Images[coverOffset].Data)
+	if err != nil {
+		p.recoverable("cover", "failed to generate cover thumbnail", err)
+		return nil
+	}
+	offset := uint32(len(mapper.Images))
+	mapper.AddImage(thumbnailPath, thumbnail, "image/jpeg")
+	p.logger.Info(fmt.Sprintf("cover thumbnail: %d bytes", len(thumbnail)), "stage", "cover")
+	return &offset
+}
+
+// collectFonts adds the TrueType/OpenType fonts of the manifest to the mapper
+// as FONT records, subset to the code points used in html. Other font formats
+// are not supported by Kindle and skipped.
+func (p *Pipeline) collectFonts(reader *epub.EPUBReader, opf *epub.OPF, mapper *mobi.ImageMapper, html string) {
+	var runes map[rune]bool
+	for _, id := range opf.ManifestOrder {
+		item, ok := opf.Manifest[id]
+		if !ok {
+			continue
+		}
+		if !isFont(item.MediaType, item.Href) {
+			if isUnsupportedFont(item.MediaType, item.Href) {
+				p.acceptable("fonts", fmt.Sprintf("font %q is not supported and will be skipped", item.Href), nil)
+			}
+			continue
+		}
+
+		fontData, err := reader.ReadFile(item.Href)
+		if err != nil {
+			p.recoverable("fonts", fmt.Sprintf("failed to read font %q, skipping", item.Href), err)
+			continue
+		}
+
+		if runes == nil {
+			if runes, err = CollectCodePoints(html); err != nil {
+				p.acceptable("fonts", "failed to collect code points; fonts will not be subset", err)
+				runes = map[rune]bool{}
+			}
+		}
+		embedded := fontData
+		if len(runes) > 0 {
+			subset, err := SubsetFont(fontData, runes)
+			if err != nil {
+				p.acceptable("fonts", fmt.Sprintf("failed to subset font %q; embedding the full font", item.Href), err)
+			} else if len(subset) < len(fontData) {
+				embedded = subset
+			}
+		}
+
+		if err := mapper.AddFont(item.Href, embedded, normalizeMediaType(item.MediaType)); err != nil {
+			p.recoverable("fonts", fmt.Sprintf("failed to embed font %q, skipping", item.Href), err)
+			continue
+		}
+		saved := 100 * float64(len(fontData)-len(embedded)) / float64(len(fontData))
+		p.logger.Info(fmt.Sprintf("font: %s (%d -> %d bytes, %.1f%% saved)", item.Href, len(fontData), len(embedded), saved), "stage", "fonts")
+	}
+}
+
+// kf8Output holds the converted book that writeAZW3 writes.
+type kf8Output struct {
+	html         string // integrated HTML with kindle:embed references
+	chapterIDs   []string
+	chapterHeads map[string][]byte // fixed-layout viewport markup per chapter
+	flows        [][]byte          // additional KF8 flows, e.g. the stylesheet
+	metadata     *epub.Metadata
+	images       *mobi.ImageMapper // nil when the book has no images
+	ncxEntries   []mobi.NCXEntry
+	guide        []mobi.GuideReference
+	resc         *mobi.RESC
+
+	writingMode string // EXTH 525
+	ppd         string // page progression direction, EXTH 527
+	fixedLayout *mobi.FixedLayout
+
+	// Image record indexes and the text offset written to EXTH; nil omits them.
+	coverOffset     *uint32
+	thumbnailOffset *uint32
+	startReading    *uint32
+}
+
 // writeAZW3 creates the AZW3 file from the integrated HTML and metadata.
-func (p *Pipeline) writeAZW3(html string, metadata *epub.Metadata, imageMapper *mobi.ImageMapper, ncxRecord []byte, coverOffset *uint32) error {
-	title := metadata.Title
+func (p *Pipeline) writeAZW3(out kf8Output) error {
+	title := out.metadata.Title
 	if title == "" {
 		title = "Untitled"
 	}
 
 	cfg := mobi.AZW3WriterConfig{
-		Title:       title,
-		HTML:        []byte(html),
-		Metadata:    metadata,
-		NCXRecord:   ncxRecord,
-		Compression: mobi.CompressionPalmDoc,
-		CoverOffset: coverOffset,
-	}
-
-	if imageMapper != nil {
-		cfg.ImageRecords = imageMapper.ImageRecordData()
+		Title:           title,
+		HTML:            []byte(out.html),
+		ChapterIDs:      out.chapterIDs,
+		Flows:           out.flows,
+		Metadata:        out.metadata,
+		NCXEntries:      out.ncxEntries,
+		Guide:           out.guide,
+		RESC:            out.resc,
+		Compression:     mobi.CompressionPalmDoc,
+		CoverOffset:     out.coverOffset,
+		ThumbnailOffset: out.thumbnailOffset,
+		StartReading:    out.startReading,
+		ASIN:            BookASIN(p.Options.ASIN, out.metadata.Identifier),
+		CDEType:         p.cdeType(),
+
+		WritingMode:              out.writingMode,
+		PageProgressionDirection: out.ppd,
+		FixedLayout:              out.fixedLayout,
+		ChapterHeads:             out.chapterHeads,
+	}
+
+	if out.images != nil {
+		cfg.ImageRecords = out.images.ImageRecordData()
+	}
+
+	if p.Options.Format == FormatMOBI7KF8 {
+		mobi7HTML, err := mobi.BuildMOBI7HTML([]byte(out.html))
+		if err != nil {
+			return fmt.Errorf("failed to build MOBI7 HTML: %w", err)
+		}
+		cfg.MOBI7HTML = mobi7HTML
 	}
 
 	writer, err := mobi.NewAZW3Writer(cfg)
@@ -431,6 +684,21 @@ func (p *Pipeline) writeAZW3(html string, metadata *epub.Metadata, imageMapper *
 	return nil
 }
 
+// verifyOutput re-reads the written file and records every violated
+// structural invariant as a recoverable error.
+func (p *Pipeline) verifyOutput() error {
+	p.stageStart("verify", "verify output structure")
+	data, err := os.ReadFile(p.Options.OutputPath)
+	if err != nil {
+		return p.fatal("verify", "failed to read output file", err)
+	}
+	for _, issue := range mobi.Verify(data) {
+		p.recoverable("verify", issue.String(), nil)
+	}
+	p.stageDone("verify", "verify output structure")
+	return nil
+}
+
 func (p *Pipeline) stageStart(stage, message string) {
 	p.logger.Info("start: "+message, "stage", stage)
 }
@@ -482,6 +750,69 @@ func (p *Pipeline) acceptable(stage, message string, cause error) {
 	p.logger.Info(message, "stage", stage)
 }
 
+// writingMode returns the primary writing mode and the page progression
+// direction of the book. The writing mode is taken from the WritingMode
+// option or detected from the spine, the CSS and the body attributes. The
+// page progression direction is the spine's, or is implied by the writing mode.
+// Fixed-layout books get a horizontal writing mode in the page progression
+// direction; the text direction within their pages is set by their own CSS.
+func (p *Pipeline) writingMode(opf *epub.OPF, builder *HTMLBuilder) (string, string) {
+	mode := p.Options.WritingMode
+	source := "option"
+	switch {
+	case mode != "":
+	case opf.FixedLayout():
+		mode = WritingModeHorizontalLR
+		if opf.PageProgressionDirection == "rtl" {
+			mode = WritingModeHorizontalRL
+		}
+		source = "fixed layout"
+	default:
+		mode = DetectWritingMode(opf.PageProgressionDirection, builder.CSS(), builder.chapters, opf.Metadata.Language)
+		source = "detected"
+	}
+
+	ppd := opf.PageProgressionDirection
+	if ppd != "rtl" && ppd != "ltr" {
+		ppd = PageProgressionForWritingMode(mode)
+	}
+	p.logger.Info(fmt.Sprintf("writing mode: %s (%s), page progression: %s", mode, source, ppd), "stage", "build")
+	return mode, ppd
+}
+
+// buildRESC builds the RESC record spine from the OPF spine. Each spine item
+// refers to the KF8 skeleton of its chapter in layout, and ppd is the page
+// progression direction resolved by writingMode. It returns nil when the book
+// pages left to right without the spine saying so and the spine has no
+// itemref properties or non-linear items, since the RESC record would then
+// only repeat the text order.
+func buildRESC(opf *epub.OPF, builder *HTMLBuilder, layout *mobi.KF8Layout, ppd string) *mobi.RESC {
+	needed := ppd == "rtl" || opf.PageProgressionDirection != ""
+	for _, item := range opf.Spine {
+		needed = needed || !item.Linear || len(item.Properties) > 0
+	}
+	if !needed {
+		return nil
+	}
+
+	resc := &mobi.RESC{PageProgressionDirection: ppd}
+	for _, item := range opf.Spine {
+		skelID := -1
+		if manifestItem, ok := opf.Manifest[item.IDRef]; ok {
+			if id, ok := layout.ChapterSkeleton(builder.GetChapterID(manifestItem.Href)); ok {
+				skelID = id
+			}
+		}
+		resc.Spine = append(resc.Spine, mobi.RESCSpineItem{
+			IDRef:      item.IDRef,
+			SkeletonID: skelID,
+			Linear:     item.Linear,
+			Properties: item.Properties,
+		})
+	}
+	return resc
+}
+
 // convertTOCEntries converts converter.TOCEntry slice to mobi.NCXEntry slice.
 func convertTOCEntries(entries []TOCEntry) []mobi.NCXEntry {
 	result := make([]mobi.NCXEntry, len(entries))
@@ -495,29 +826,6 @@ func convertTOCEntries(entries []TOCEntry) []mobi.NCXEntry {
 	return result
 }
 
-// buildGuideReferences creates guide references for the NCX record.
-// It includes a "toc" reference if an inline TOC div exists in the HTML.
-func buildGuideReferences(finalHTML []byte) []mobi.GuideReference {
-	var refs []mobi.GuideReference
-
-	// Find the inline TOC position
-	tocPattern := []byte(`id="toc"`)
-	if idx := bytes.Index(finalHTML, tocPattern); idx >= 0 {
-		// Walk backwards to find the '<' that opens this tag
-		tagStart := idx
-		for tagStart > 0 && finalHTML[tagStart] != '<' {
-			tagStart--
-		}
-		refs = append(refs, mobi.GuideReference{
-			Type:    "toc",
-			Title:   "Table of Contents",
-			FilePos: uint32(tagStart),
-		})
-	}
-
-	return refs
-}
-
 // isXHTML checks if a media type indicates an XHTML content file.
 func isXHTML(mediaType string) bool {
 	return strings.Contains(mediaType, "html") || strings.Contains(mediaType, "xhtml")
@@ -530,6 +838,50 @@ func normalizeMediaType(mt string) string {
 	return strings.TrimSpace(base)
 }
 
+// fontMediaTypes lists the media types used for TrueType/OpenType fonts.
+var fontMediaTypes = map[string]bool{
+	"font/ttf":                    true,
+	"font/otf":                    true,
+	"font/sfnt":                   true,
+	"application/font-sfnt":       true,
+	"application/x-font-ttf":      true,
+	"application/x-font-truetype": true,
+	"application/x-font-otf":      true,
+	"application/x-font-opentype": true,
+	"application/vnd.ms-opentype": true,
+	"application/x-truetype-font": true,
+	"application/x-opentype-font": true,
+	"application/font-ttf":        true,
+	"application/font-otf":        true,
+}
+
+// isFont checks if a manifest item is a TrueType/OpenType font. Fonts declared
+// with a generic media type are recognized by their extension.
+func isFont(mediaType, href string) bool {
+	if fontMediaTypes[normalizeMediaType(mediaType)] {
+		return true
+	}
+	switch strings.ToLower(path.Ext(href)) {
+	case ".ttf", ".otf":
+		return true
+	}
+	return false
+}
+
+// isUnsupportedFont checks if a manifest item is a font in a format that
+// Kindle does not support (WOFF, WOFF2).
+func isUnsupportedFont(mediaType, href string) bool {
+	switch normalizeMediaType(mediaType) {
+	case "font/woff", "font/woff2", "application/font-woff", "application/font-woff2", "application/x-font-woff":
+		return true
+	}
+	switch strings.ToLower(path.Ext(href)) {
+	case ".woff", ".woff2":
+		return true
+	}
+	return false
+}
+
 // isSVG checks if a media type indicates an SVG image.
 func isSVG(mediaType string) bool {
 	return normalizeMediaType(mediaType) == "image/svg+xml"
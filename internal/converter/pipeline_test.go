@@ -5,18 +5,25 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"image"
 	"image/color"
 	"image/jpeg"
 	"image/png"
 	"log/slog"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"testing"
 
+	"github.com/yuanying/epub2azw3/internal/epub"
 	"github.com/yuanying/epub2azw3/internal/mobi"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
 )
 
 // recordCollector is a test slog.Handler that collects log records.
@@ -544,6 +551,58 @@ func TestPipeline_Convert_MOBIHeader(t *testing.T) {
 	}
 }
 
+func TestPipeline_Convert_MOBI7KF8Format(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := createMinimalTestEPUB(t, dir)
+	outputPath := filepath.Join(dir, "output.azw3")
+
+	p := NewPipeline(ConvertOptions{
+		InputPath:  epubPath,
+		OutputPath: outputPath,
+		Format:     FormatMOBI7KF8,
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+
+	rec0 := extractRecord(data, 0)
+	if version := readUint32BE(rec0, 16+20); version != 6 {
+		t.Errorf("MOBI7 file version = %d, want 6", version)
+	}
+
+	kf8Index, ok := findEXTHUint32(rec0, 121)
+	if !ok {
+		t.Fatal("EXTH 121 not found in MOBI7 Record 0")
+	}
+	if boundary := extractRecord(data, int(kf8Index)-1); string(boundary) != "BOUNDARY" {
+		t.Errorf("record before KF8 Record 0 = %q, want BOUNDARY", boundary)
+	}
+	kf8Rec0 := extractRecord(data, int(kf8Index))
+	if version := readUint32BE(kf8Rec0, 16+20); version != 8 {
+		t.Errorf("KF8 file version = %d, want 8", version)
+	}
+
+	mobi7Record, err := mobi.StripTrailingEntries(extractRecord(data, 1), mobi.ExtraDataMultibyte)
+	if err != nil {
+		t.Fatalf("failed to strip MOBI7 text trailing entries: %v", err)
+	}
+	mobi7Text, err := mobi.PalmDocDecompress(mobi7Record)
+	if err != nil {
+		t.Fatalf("failed to decompress MOBI7 text: %v", err)
+	}
+	if !strings.Contains(string(mobi7Text), "<body") {
+		t.Errorf("MOBI7 text should contain the book HTML, got %q", mobi7Text)
+	}
+	if strings.Contains(string(mobi7Text), "kindle:flow") {
+		t.Error("MOBI7 text should not reference KF8 flows")
+	}
+}
+
 func TestPipeline_Convert_XHTMLReadError_Skips(t *testing.T) {
 	dir := t.TempDir()
 	epubPath := createBrokenXHTMLTestEPUB(t, dir)
@@ -606,6 +665,90 @@ func TestPipeline_Convert_StrictModeFailsOnRecoverable(t *testing.T) {
 	}
 }
 
+func TestPipeline_Convert_DRMEncryptedFails(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := filepath.Join(dir, "drm.epub")
+	f, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := epub.NewWriter(f, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"OEBPS/content.opf": `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>DRM Book</dc:title>
+    <dc:language>en</dc:language>
+    <dc:identifier id="uid">urn:uuid:drm-test</dc:identifier>
+  </metadata>
+  <manifest><item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/></manifest>
+  <spine><itemref idref="ch1"/></spine>
+</package>`,
+		"OEBPS/ch1.xhtml": "\x8f\x12encrypted",
+		"META-INF/encryption.xml": `<encryption xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:enc="http://www.w3.org/2001/04/xmlenc#">
+  <enc:EncryptedData>
+    <enc:EncryptionMethod Algorithm="http://www.w3.org/2001/04/xmlenc#aes128-cbc"/>
+    <enc:CipherData><enc:CipherReference URI="OEBPS/ch1.xhtml"/></enc:CipherData>
+  </enc:EncryptedData>
+</encryption>`,
+	} {
+		if err := w.AddFile(name, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	p := NewPipeline(ConvertOptions{
+		InputPath:  epubPath,
+		OutputPath: filepath.Join(dir, "drm.azw3"),
+	})
+	err = p.Convert()
+	if !errors.Is(err, epub.ErrEncrypted) {
+		t.Fatalf("Convert() error = %v, want ErrEncrypted", err)
+	}
+	if !strings.Contains(err.Error(), "DRM-protected") || !strings.Contains(err.Error(), "OEBPS/ch1.xhtml") {
+		t.Errorf("error = %v, want a DRM message naming the encrypted file", err)
+	}
+	if len(p.errors) == 0 || p.errors[len(p.errors)-1].Level != ErrorLevelFatal {
+		t.Errorf("errors = %+v, want a fatal error", p.errors)
+	}
+}
+
+func TestPipeline_Convert_StrictModeVerifiesOutput(t *testing.T) {
+	epubPath := filepath.Join("..", "..", "testdata", "test.epub")
+	if _, err := os.Stat(epubPath); os.IsNotExist(err) {
+		t.Skip("testdata/test.epub not found, skipping E2E test")
+	}
+
+	for _, format := range []string{FormatAZW3, FormatMOBI7KF8} {
+		t.Run(format, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "verified.azw3")
+
+			p := NewPipeline(ConvertOptions{
+				InputPath:  epubPath,
+				OutputPath: outputPath,
+				Format:     format,
+				Strict:     true,
+			})
+
+			if err := p.Convert(); err != nil {
+				t.Fatalf("Convert() failed: %v", err)
+			}
+			for _, ce := range p.errors {
+				if ce.Context == "verify" {
+					t.Errorf("unexpected verify error: %s", ce.Message)
+				}
+			}
+		})
+	}
+}
+
 func TestPipeline_Convert_NoImagesRemovesImageRecordsAndTags(t *testing.T) {
 	dir := t.TempDir()
 	epubPath := createImageTestEPUB(t, dir)
@@ -643,6 +786,10 @@ func TestPipeline_Convert_NoImagesRemovesImageRecordsAndTags(t *testing.T) {
 		if len(rec) == 0 {
 			continue
 		}
+		rec, stripErr := mobi.StripTrailingEntries(rec, mobi.ExtraDataMultibyte)
+		if stripErr != nil {
+			t.Fatalf("failed to strip trailing entries of text record %d: %v", i, stripErr)
+		}
 		dec, decErr := mobi.PalmDocDecompress(rec)
 		if decErr != nil {
 			t.Fatalf("failed to decompress text record %d: %v", i, decErr)
@@ -816,7 +963,7 @@ func createOptimizedImageTestEPUB(t *testing.T, dir string) string {
 <body>
 <h1>Images</h1>
 <img src="../images/cover.jpg" alt="Cover"/>
-<img src="../images/photo.png" alt="Photo"/>
+<img src="../images/photo.png" alt="Photo" width="1000" height="500"/>
 </body>
 </html>`))
 
@@ -1009,6 +1156,130 @@ func TestPipeline_Convert_ImageOptimizationApplied(t *testing.T) {
 	if coverOffset != 0 {
 		t.Fatalf("cover offset = %d, want 0", coverOffset)
 	}
+
+	// The stale size of the resized photo is replaced with a relative one
+	r, err := mobi.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("mobi.ReadFile() error = %v", err)
+	}
+	flows, err := r.Flows(r.KF8())
+	if err != nil {
+		t.Fatalf("Flows() error = %v", err)
+	}
+	if text := flows[0]; bytes.Contains(text, []byte(`width="1000"`)) || !bytes.Contains(text, []byte(`style="width: 100%; height: auto"`)) {
+		t.Errorf("photo sizing not fitted to the screen: %s", text)
+	}
+}
+
+func TestPipeline_Convert_CoverThumbnail(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := createOptimizedImageTestEPUB(t, dir)
+	outputPath := filepath.Join(dir, "output.azw3")
+
+	p := NewPipeline(ConvertOptions{
+		InputPath:  epubPath,
+		OutputPath: outputPath,
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+
+	r, err := mobi.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("mobi.ReadFile() error = %v", err)
+	}
+	kf8 := r.KF8()
+	for _, typ := range []uint32{131, 201} {
+		if v, ok := kf8.EXTH.Uint32Value(typ); !ok || v != 0 {
+			t.Errorf("EXTH %d = %d, %v; want 0", typ, v, ok)
+		}
+	}
+	if v, ok := kf8.EXTH.StringValue(129); !ok || v != "kindle:embed:0001" {
+		t.Errorf("EXTH 129 = %q, %v; want kindle:embed:0001", v, ok)
+	}
+	thumbnail, ok := kf8.EXTH.Uint32Value(202)
+	if !ok {
+		t.Fatal("EXTH 202 (thumbnail offset) not written")
+	}
+	// Cover and photo come first; the thumbnail follows them
+	if thumbnail != 2 {
+		t.Errorf("thumbnail offset = %d, want 2", thumbnail)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	firstImageIndex := readUint32BE(extractRecord(data, 0), 96)
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(extractRecord(data, int(firstImageIndex+thumbnail))))
+	if err != nil {
+		t.Fatalf("failed to decode thumbnail record: %v", err)
+	}
+	if format != "jpeg" || cfg.Width != 495 || cfg.Height != 330 {
+		t.Errorf("thumbnail = %s %dx%d, want jpeg 495x330", format, cfg.Width, cfg.Height)
+	}
+}
+
+func TestPipeline_Convert_ThumbnailSidecar(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := createOptimizedImageTestEPUB(t, dir)
+	outputPath := filepath.Join(dir, "output.azw3")
+	thumbnailDir := filepath.Join(dir, "thumbnails")
+
+	p := NewPipeline(ConvertOptions{
+		InputPath:    epubPath,
+		OutputPath:   outputPath,
+		CDEType:      "pdoc",
+		ThumbnailDir: thumbnailDir,
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+
+	asin := BookASIN("", "urn:uuid:img-opt-test")
+	r, err := mobi.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("mobi.ReadFile() error = %v", err)
+	}
+	exth := r.KF8().EXTH
+	for typ, want := range map[uint32]string{113: asin, 504: asin, 501: CDETypePDOC} {
+		if v, _ := exth.StringValue(typ); v != want {
+			t.Errorf("EXTH %d = %q, want %q", typ, v, want)
+		}
+	}
+
+	sidecar, err := os.ReadFile(filepath.Join(thumbnailDir, ThumbnailSidecarName(asin, CDETypePDOC)))
+	if err != nil {
+		t.Fatalf("thumbnail sidecar not written: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	thumbnail, _ := exth.Uint32Value(202)
+	firstImageIndex := readUint32BE(extractRecord(data, 0), 96)
+	if !bytes.Equal(sidecar, extractRecord(data, int(firstImageIndex+thumbnail))) {
+		t.Error("thumbnail sidecar differs from the thumbnail record")
+	}
+}
+
+func TestPipeline_Convert_ThumbnailSidecarWithoutCover(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := createMinimalTestEPUB(t, dir)
+	thumbnailDir := filepath.Join(dir, "thumbnails")
+
+	p := NewPipeline(ConvertOptions{
+		InputPath:    epubPath,
+		OutputPath:   filepath.Join(dir, "output.azw3"),
+		ThumbnailDir: thumbnailDir,
+		Strict:       true,
+	})
+	if err := p.Convert(); err == nil {
+		t.Fatal("Convert() should fail in strict mode without a cover thumbnail")
+	}
+	if entries, _ := os.ReadDir(thumbnailDir); len(entries) != 0 {
+		t.Errorf("thumbnail sidecar written without a cover: %v", entries)
+	}
 }
 
 func createJPEGImage(t *testing.T, w, h int) []byte {
@@ -1051,6 +1322,906 @@ func createPNGImage(t *testing.T, w, h int) []byte {
 	return buf.Bytes()
 }
 
+// createFontData returns size bytes of incompressible data starting with the
+// TrueType signature.
+func createFontData(size int) []byte {
+	data := make([]byte, size)
+	rand.NewChaCha8([32]byte{2}).Read(data)
+	copy(data, []byte{0x00, 0x01, 0x00, 0x00})
+	return data
+}
+
+func TestPipeline_Convert_EmbeddedFonts(t *testing.T) {
+	dir := t.TempDir()
+	outputPath := filepath.Join(dir, "output.azw3")
+	collector := newRecordCollector(slog.LevelInfo)
+
+	p := NewPipeline(ConvertOptions{
+		InputPath:  createUnpackTestEPUB(t, dir),
+		OutputPath: outputPath,
+		Strict:     true,
+		Logger:     slog.New(collector),
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+
+	r, err := mobi.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("mobi.ReadFile() error = %v", err)
+	}
+	s := r.KF8()
+	// The cover is resource 1, the font resource 2.
+	fontRecord := s.Record0 + int(s.Header.FirstImageIndex) + 1
+	if typ := r.RecordType(fontRecord); typ != "FONT" {
+		t.Fatalf("record %d type = %q, want FONT", fontRecord, typ)
+	}
+	rec, err := r.Record(fontRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := mobi.DecodeFontRecord(rec)
+	if err != nil {
+		t.Fatalf("DecodeFontRecord() error = %v", err)
+	}
+	if !bytes.Equal(font, createFontData(4096)) {
+		t.Error("FONT record does not hold the original font")
+	}
+
+	flows, err := r.Flows(s)
+	if err != nil {
+		t.Fatalf("Flows() error = %v", err)
+	}
+	if len(flows) < 2 || !strings.Contains(string(flows[1]), `src: url(kindle:embed:0002?mime=application/x-font-truetype)`) {
+		t.Errorf("@font-face src not rewritten in the stylesheet flow: %q", flows[1:])
+	}
+
+	if !collector.hasRecord(slog.LevelInfo, `font "OEBPS/fonts/gaiji.woff" is not supported`) {
+		t.Error("expected the WOFF font to be reported as skipped")
+	}
+}
+
+func TestPipeline_Convert_SubsetsFonts(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := filepath.Join(dir, "fonts.epub")
+	f, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := epub.NewWriter(f, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"OEBPS/content.opf": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Fonts</dc:title>
+    <dc:language>en</dc:language>
+    <dc:identifier id="uid">urn:uuid:12345</dc:identifier>
+  </metadata>
+  <manifest>
+    <item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="css" href="style.css" media-type="text/css"/>
+    <item id="font" href="go.ttf" media-type="font/ttf"/>
+  </manifest>
+  <spine><itemref idref="ch1"/></spine>
+</package>`),
+		"OEBPS/style.css": []byte(`@font-face { font-family: "Go"; src: url(go.ttf); } body { font-family: "Go"; }`),
+		"OEBPS/chapter1.xhtml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>Chapter 1</title><link rel="stylesheet" type="text/css" href="style.css"/></head>
+<body><p>hello</p></body>
+</html>`),
+		"OEBPS/go.ttf": goregular.TTF,
+	}
+	for name, data := range files {
+		if err := w.AddFile(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	outputPath := filepath.Join(dir, "output.azw3")
+	collector := newRecordCollector(slog.LevelInfo)
+	p := NewPipeline(ConvertOptions{
+		InputPath:  epubPath,
+		OutputPath: outputPath,
+		Strict:     true,
+		Logger:     slog.New(collector),
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+
+	r, err := mobi.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("mobi.ReadFile() error = %v", err)
+	}
+	s := r.KF8()
+	rec, err := r.Record(s.Record0 + int(s.Header.FirstImageIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := mobi.DecodeFontRecord(rec)
+	if err != nil {
+		t.Fatalf("DecodeFontRecord() error = %v", err)
+	}
+	if len(font) >= len(goregular.TTF) {
+		t.Errorf("embedded font = %d bytes, want less than %d", len(font), len(goregular.TTF))
+	}
+	sf, err := sfnt.Parse(font)
+	if err != nil {
+		t.Fatalf("sfnt.Parse() error = %v", err)
+	}
+	if glyphSegments(t, sf, 'h') == 0 || glyphSegments(t, sf, 'H') == 0 {
+		t.Error("glyphs used in the text are missing from the subset font")
+	}
+	orig, err := sfnt.Parse(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkUnusedGlyph(t, orig, sf, 'z')
+
+	want := fmt.Sprintf("font: OEBPS/go.ttf (%d -> %d bytes", len(goregular.TTF), len(font))
+	if !collector.hasAttr(want, "stage", "fonts") {
+		t.Errorf("expected a %q log record", want)
+	}
+}
+
+func TestPipeline_Convert_WritingModeEXTH(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := filepath.Join(dir, "vertical.epub")
+	f, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := epub.NewWriter(f, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"OEBPS/content.opf": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>縦書き</dc:title>
+    <dc:language>ja</dc:language>
+    <dc:identifier id="uid">urn:uuid:12345</dc:identifier>
+  </metadata>
+  <manifest>
+    <item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="css" href="vertical.css" media-type="text/css"/>
+  </manifest>
+  <spine page-progression-direction="rtl"><itemref idref="ch1"/></spine>
+</package>`),
+		"OEBPS/vertical.css": []byte(`.vrtl { -epub-writing-mode: vertical-rl; -webkit-writing-mode: vertical-rl; }`),
+		"OEBPS/chapter1.xhtml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xml:lang="ja" class="vrtl">
+<head><title>一</title><link rel="stylesheet" type="text/css" href="vertical.css"/></head>
+<body><p>本文</p></body>
+</html>`),
+	}
+	for name, data := range files {
+		if err := w.AddFile(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	tests := []struct {
+		name        string
+		input       string
+		writingMode string
+		wantMode    string
+		wantPPD     string
+		wantRESC    bool
+	}{
+		{"detected", epubPath, "", WritingModeVerticalRL, "rtl", true},
+		{"default", createMinimalTestEPUB(t, t.TempDir()), "", WritingModeHorizontalLR, "ltr", false},
+		// The minimal EPUB has no page-progression-direction in its spine.
+		{"override", createMinimalTestEPUB(t, t.TempDir()), WritingModeVerticalRL, WritingModeVerticalRL, "rtl", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "output.azw3")
+			p := NewPipeline(ConvertOptions{
+				InputPath:   tt.input,
+				OutputPath:  outputPath,
+				WritingMode: tt.writingMode,
+			})
+			if err := p.Convert(); err != nil {
+				t.Fatalf("Convert() failed: %v", err)
+			}
+
+			r, err := mobi.ReadFile(outputPath)
+			if err != nil {
+				t.Fatalf("mobi.ReadFile() error = %v", err)
+			}
+			exth := r.KF8().EXTH
+			if got, _ := exth.StringValue(525); got != tt.wantMode {
+				t.Errorf("EXTH 525 = %q, want %q", got, tt.wantMode)
+			}
+			if got, _ := exth.StringValue(527); got != tt.wantPPD {
+				t.Errorf("EXTH 527 = %q, want %q", got, tt.wantPPD)
+			}
+
+			resc, err := r.RESC(r.KF8())
+			if err != nil {
+				t.Fatalf("RESC() error = %v", err)
+			}
+			switch {
+			case !tt.wantRESC && resc != nil:
+				t.Errorf("RESC = %+v, want none", resc)
+			case tt.wantRESC && (resc == nil || resc.PageProgressionDirection != tt.wantPPD):
+				t.Errorf("RESC = %+v, want page-progression-direction %q", resc, tt.wantPPD)
+			}
+		})
+	}
+}
+
+func TestPipeline_Convert_FixedLayout(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := filepath.Join(dir, "comic.epub")
+	f, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := epub.NewWriter(f, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := func(n int) []byte {
+		return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>%d</title><meta name="viewport" content="width=1200, height=1600"/><link rel="stylesheet" type="text/css" href="fxl.css"/></head>
+<body><div class="page"><img src="p%d.jpg" alt=""/></div></body>
+</html>`, n, n))
+	}
+	files := map[string][]byte{
+		"OEBPS/content.opf": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Comic</dc:title>
+    <dc:language>ja</dc:language>
+    <dc:identifier id="uid">urn:uuid:12345</dc:identifier>
+    <meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:orientation">portrait</meta>
+  </metadata>
+  <manifest>
+    <item id="p1" href="p1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="p2" href="p2.xhtml" media-type="application/xhtml+xml"/>
+    <item id="css" href="fxl.css" media-type="text/css"/>
+    <item id="i1" href="p1.jpg" media-type="image/jpeg"/>
+    <item id="i2" href="p2.jpg" media-type="image/jpeg"/>
+  </manifest>
+  <spine page-progression-direction="rtl">
+    <itemref idref="p1" properties="page-spread-left"/>
+    <itemref idref="p2" properties="page-spread-right"/>
+  </spine>
+</package>`),
+		"OEBPS/fxl.css":  []byte(`.page { position: absolute; width: 1200px; height: 1600px; }`),
+		"OEBPS/p1.xhtml": page(1),
+		"OEBPS/p2.xhtml": page(2),
+		"OEBPS/p1.jpg":   createJPEGImage(t, 1200, 1600),
+		"OEBPS/p2.jpg":   createJPEGImage(t, 1200, 1600),
+	}
+	for name, data := range files {
+		if err := w.AddFile(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	outputPath := filepath.Join(dir, "output.azw3")
+	p := NewPipeline(ConvertOptions{
+		InputPath:         epubPath,
+		OutputPath:        outputPath,
+		MaxImageWidth:     600,
+		MaxImageSizeBytes: 2 * 1024 * 1024,
+		Strict:            true,
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+
+	r, err := mobi.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("mobi.ReadFile() error = %v", err)
+	}
+	s := r.KF8()
+	want := map[uint32]string{
+		122: "true",
+		123: BookTypeComic,
+		124: "portrait",
+		126: "1200x1600",
+		525: WritingModeHorizontalRL,
+		527: "rtl",
+	}
+	for recType, value := range want {
+		if got, _ := s.EXTH.StringValue(recType); got != value {
+			t.Errorf("EXTH %d = %q, want %q", recType, got, value)
+		}
+	}
+
+	rec, err := r.Record(s.Record0 + int(s.Header.FirstImageIndex))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(rec))
+	if err != nil {
+		t.Fatalf("DecodeConfig() error = %v", err)
+	}
+	if cfg.Width != 1200 || cfg.Height != 1600 {
+		t.Errorf("page image = %dx%d, want 1200x1600 (not downsized)", cfg.Width, cfg.Height)
+	}
+
+	text, err := r.Text(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(text, []byte(`<meta name="viewport" content="width=1200, height=1600"/>`)); n != 2 {
+		t.Errorf("viewport meta count = %d, want 2", n)
+	}
+	if bytes.Contains(text, []byte(`id="toc"`)) {
+		t.Error("inline TOC inserted into a fixed-layout book")
+	}
+	flows, err := r.Flows(s)
+	if err != nil || len(flows) < 2 {
+		t.Fatalf("Flows() = %d flows, %v", len(flows), err)
+	}
+	if !bytes.Contains(flows[1], []byte("position: absolute; width: 1200px")) {
+		t.Errorf("fixed-layout CSS was transformed: %s", flows[1])
+	}
+
+	epubOut := filepath.Join(dir, "unpacked.epub")
+	if err := Unpack(UnpackOptions{InputPath: outputPath, OutputPath: epubOut}); err != nil {
+		t.Fatalf("Unpack() error = %v", err)
+	}
+	er, err := epub.Open(epubOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer er.Close()
+	opfData, err := er.ReadFile(er.OPFPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opf, err := epub.ParseOPF(opfData, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRendition := epub.Rendition{Layout: "pre-paginated", Orientation: "portrait", OriginalResolution: "1200x1600", BookType: BookTypeComic}
+	if opf.Rendition != wantRendition {
+		t.Errorf("unpacked Rendition = %+v, want %+v", opf.Rendition, wantRendition)
+	}
+}
+
+func TestPipeline_Convert_PanelView(t *testing.T) {
+	var pageJPEG bytes.Buffer
+	if err := jpeg.Encode(&pageJPEG, panelPage(600, 800, color.White, gridPanels()), &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	epubPath := filepath.Join(dir, "comic.epub")
+	f, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := epub.NewWriter(f, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"OEBPS/content.opf": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Comic</dc:title>
+    <dc:language>ja</dc:language>
+    <dc:identifier id="uid">urn:uuid:12345</dc:identifier>
+    <meta property="rendition:layout">pre-paginated</meta>
+  </metadata>
+  <manifest>
+    <item id="p1" href="p1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="i1" href="p1.jpg" media-type="image/jpeg"/>
+  </manifest>
+  <spine page-progression-direction="rtl">
+    <itemref idref="p1"/>
+  </spine>
+</package>`),
+		"OEBPS/p1.xhtml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>1</title><meta name="viewport" content="width=600, height=800"/></head>
+<body><img src="p1.jpg" alt=""/></body>
+</html>`),
+		"OEBPS/p1.jpg": pageJPEG.Bytes(),
+	}
+	for name, data := range files {
+		if err := w.AddFile(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	outputPath := filepath.Join(dir, "output.azw3")
+	p := NewPipeline(ConvertOptions{
+		InputPath:  epubPath,
+		OutputPath: outputPath,
+		PanelView:  true,
+		Strict:     true,
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+
+	r, err := mobi.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("mobi.ReadFile() error = %v", err)
+	}
+	s := r.KF8()
+	if got, _ := s.EXTH.StringValue(132); got != "true" {
+		t.Errorf("EXTH 132 = %q, want %q", got, "true")
+	}
+
+	text, err := r.Text(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(text, []byte(`class="app-amzn-magnify"`)); n != 4 {
+		t.Fatalf("magnify links = %d, want 4", n)
+	}
+	// Right-to-left: the first panel is the top right one.
+	first := bytes.Index(text, []byte(`data-app-amzn-magnify="{&#34;targetId&#34;:&#34;ch01-pv-1-magTarget&#34;,&#34;ordinal&#34;:1}"`))
+	if first < 0 {
+		t.Fatalf("first magnify link not found in %s", text)
+	}
+	if !bytes.Contains(text, []byte(`id="ch01-pv-1" style="position:absolute;left:51.`)) {
+		t.Errorf("first region is not the top right panel: %s", text)
+	}
+	for i := 1; i <= 4; i++ {
+		if !bytes.Contains(text, fmt.Appendf(nil, `id="ch01-pv-%d-magTarget"`, i)) {
+			t.Errorf("magnification target %d not found", i)
+		}
+	}
+}
+
+func TestPipeline_Convert_PanelViewIgnoredForReflowable(t *testing.T) {
+	dir := t.TempDir()
+	p := NewPipeline(ConvertOptions{
+		InputPath:  createMinimalTestEPUB(t, dir),
+		OutputPath: filepath.Join(dir, "output.azw3"),
+		PanelView:  true,
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+	found := false
+	for _, e := range p.errors {
+		found = found || (e.Level == ErrorLevelAcceptable && strings.Contains(e.Message, "--panel-view"))
+	}
+	if !found {
+		t.Errorf("no warning that --panel-view is ignored: %+v", p.errors)
+	}
+}
+
+// createComicSpreadTestEPUB writes "comic.epub": a fixed-layout rtl comic
+// with a cover and one page showing a scanned JPEG double-page spread, whose
+// left half is darker than its right half.
+func createComicSpreadTestEPUB(t *testing.T, dir string) string {
+	t.Helper()
+	encode := func(img image.Image) []byte {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	page := func(img string) []byte {
+		return []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>page</title><meta name="viewport" content="width=1600, height=1000"/></head>
+<body><div class="page"><img src="../images/%s" alt=""/></div></body>
+</html>`, img))
+	}
+
+	epubPath := filepath.Join(dir, "comic.epub")
+	f, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := epub.NewWriter(f, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"OEBPS/content.opf": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Comic</dc:title>
+    <dc:language>ja</dc:language>
+    <dc:identifier id="uid">urn:uuid:12345</dc:identifier>
+    <meta property="rendition:layout">pre-paginated</meta>
+  </metadata>
+  <manifest>
+    <item id="cover" href="images/cover.jpg" media-type="image/jpeg" properties="cover-image"/>
+    <item id="p1" href="text/p1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="i1" href="images/p1.jpg" media-type="image/jpeg"/>
+  </manifest>
+  <spine page-progression-direction="rtl">
+    <itemref idref="p1" properties="rendition:page-spread-center"/>
+  </spine>
+</package>`),
+		"OEBPS/text/p1.xhtml":    page("p1.jpg"),
+		"OEBPS/images/cover.jpg": createJPEGImage(t, 600, 800),
+		"OEBPS/images/p1.jpg": encode(scannedPage(1600, 1000, map[image.Rectangle]uint8{
+			image.Rect(50, 50, 780, 950):   40,
+			image.Rect(820, 50, 1550, 950): 180,
+		})),
+	}
+	for name, data := range files {
+		if err := w.AddFile(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	return epubPath
+}
+
+func TestPipeline_Convert_ComicSplitsSpread(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := createComicSpreadTestEPUB(t, dir)
+
+	outputPath := filepath.Join(dir, "output.azw3")
+	p := NewPipeline(ConvertOptions{
+		InputPath:         epubPath,
+		OutputPath:        outputPath,
+		MaxImageSizeBytes: 2 * 1024 * 1024,
+		Comic:             true,
+		Strict:            true,
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+
+	r, err := mobi.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("mobi.ReadFile() error = %v", err)
+	}
+	s := r.KF8()
+	resc, err := r.RESC(s)
+	if err != nil || resc == nil {
+		t.Fatalf("RESC() = %v, %v", resc, err)
+	}
+	var spine []string
+	for _, item := range resc.Spine {
+		spine = append(spine, item.IDRef+" "+strings.Join(item.Properties, " "))
+	}
+	if want := []string{"p1 page-spread-right", "p1-2 page-spread-left"}; !slices.Equal(spine, want) {
+		t.Errorf("RESC spine = %q, want %q", spine, want)
+	}
+
+	// Image records: the cover, then the two halves in reading order.
+	var greys []int
+	for i := 0; i < 3; i++ {
+		rec, err := r.Record(s.Record0 + int(s.Header.FirstImageIndex) + i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, _, err := image.Decode(bytes.NewReader(rec))
+		if err != nil {
+			t.Fatalf("image record %d: %v", i, err)
+		}
+		if i > 0 {
+			if size := img.Bounds().Size(); size.X >= size.Y {
+				t.Errorf("page %d is not portrait: %v", i, size)
+			}
+			greys = append(greys, meanGrey(img))
+		}
+	}
+	if greys[0] <= greys[1] {
+		t.Errorf("page greys = %v, want the right (lighter) page first", greys)
+	}
+
+	text, err := r.Text(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(text, []byte(`<meta name="viewport"`)); n != 2 {
+		t.Errorf("viewport meta count = %d, want 2", n)
+	}
+}
+
+func TestPipeline_Convert_CBZ(t *testing.T) {
+	dir := t.TempDir()
+	cbzPath := filepath.Join(dir, "comic.cbz")
+	f, err := os.Create(cbzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"ComicInfo.xml", []byte(`<ComicInfo><Series>Comic</Series><Number>1</Number><Writer>Alice</Writer><LanguageISO>ja</LanguageISO><Manga>YesAndRightToLeft</Manga></ComicInfo>`)},
+		{"10.jpg", createJPEGImage(t, 600, 800)},
+		{"2.jpg", createJPEGImage(t, 600, 800)},
+		{"1.jpg", createJPEGImage(t, 600, 800)},
+	}
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(file.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	outputPath := filepath.Join(dir, "comic.azw3")
+	p := NewPipeline(ConvertOptions{
+		InputPath:         cbzPath,
+		OutputPath:        outputPath,
+		MaxImageSizeBytes: 2 * 1024 * 1024,
+		Strict:            true,
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+
+	r, err := mobi.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("mobi.ReadFile() error = %v", err)
+	}
+	s := r.KF8()
+	want := map[uint32]string{
+		100: "Alice",
+		122: "true",
+		123: BookTypeComic,
+		126: "600x800",
+		503: "Comic 1",
+		524: "ja",
+		527: "rtl",
+	}
+	for recType, value := range want {
+		if got, _ := s.EXTH.StringValue(recType); got != value {
+			t.Errorf("EXTH %d = %q, want %q", recType, got, value)
+		}
+	}
+	if _, ok := s.EXTH.Uint32Value(131); !ok {
+		t.Error("EXTH 131 (cover offset) is missing")
+	}
+
+	text, err := r.Text(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(text, []byte(`<meta name="viewport" content="width=600, height=800"/>`)); n != 3 {
+		t.Errorf("viewport meta count = %d, want 3", n)
+	}
+}
+
+// createPageListTestEPUB creates an EPUB of two chapters whose NAV document
+// has a page-list nav marking three print pages.
+func createPageListTestEPUB(t *testing.T, dir string) string {
+	t.Helper()
+	epubPath := filepath.Join(dir, "paged.epub")
+	f, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := epub.NewWriter(f, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"OEBPS/content.opf": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Paged Book</dc:title>
+    <dc:language>en</dc:language>
+    <dc:identifier id="uid">urn:uuid:12345</dc:identifier>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ch1" href="text/chapter1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ch2" href="text/chapter2.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="ch1"/>
+    <itemref idref="ch2"/>
+  </spine>
+</package>`),
+		"OEBPS/nav.xhtml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>Contents</title></head>
+<body>
+<nav epub:type="toc"><ol>
+  <li><a href="text/chapter1.xhtml">Chapter 1</a></li>
+  <li><a href="text/chapter2.xhtml">Chapter 2</a></li>
+</ol></nav>
+<nav epub:type="page-list"><ol>
+  <li><a href="text/chapter1.xhtml">1</a></li>
+  <li><a href="text/chapter1.xhtml#page2">2</a></li>
+  <li><a href="text/chapter2.xhtml#page%203">3</a></li>
+</ol></nav>
+<nav epub:type="landmarks"><ol>
+  <li><a epub:type="bodymatter" href="text/chapter2.xhtml">Start of Content</a></li>
+</ol></nav>
+</body>
+</html>`),
+		"OEBPS/text/chapter1.xhtml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>Chapter 1</title></head>
+<body><h1>Chapter 1</h1><p>First page.</p><p id="page2">Second page.</p></body>
+</html>`),
+		"OEBPS/text/chapter2.xhtml": []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>Chapter 2</title></head>
+<body><h1>Chapter 2</h1><p id="page 3">Third page.</p></body>
+</html>`),
+	}
+	for name, data := range files {
+		if err := w.AddFile(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	return epubPath
+}
+
+func TestPipeline_Convert_APNXFromPageList(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := createPageListTestEPUB(t, dir)
+	outputPath := filepath.Join(dir, "paged.azw3")
+
+	p := NewPipeline(ConvertOptions{
+		InputPath:  epubPath,
+		OutputPath: outputPath,
+		Strict:     true,
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+
+	apnx, err := os.ReadFile(filepath.Join(dir, "paged.apnx"))
+	if err != nil {
+		t.Fatalf("APNX not written: %v", err)
+	}
+	pageHeader := readUint32BE(apnx, 4)
+	headerLen := uint32(readUint16BE(apnx, int(pageHeader)+2))
+	if n := readUint16BE(apnx, int(pageHeader)+4); n != 3 {
+		t.Fatalf("page count = %d, want 3", n)
+	}
+
+	r, err := mobi.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("mobi.ReadFile() error = %v", err)
+	}
+	flows, err := r.Flows(r.KF8())
+	if err != nil {
+		t.Fatalf("Flows() error = %v", err)
+	}
+	text := flows[0]
+	offsets := pageHeader + 8 + headerLen
+	for i, want := range []string{`<div id="ch01"`, `<p id="ch01-page2"`, `<p id="ch02-page+3"`} {
+		pos := readUint32BE(apnx, int(offsets)+i*4)
+		if !bytes.HasPrefix(text[pos:], []byte(want)) {
+			t.Errorf("page %d starts at %q, want %q", i+1, text[pos:min(int(pos)+20, len(text))], want)
+		}
+	}
+}
+
+func TestPipeline_Convert_APNXModes(t *testing.T) {
+	tests := []struct {
+		mode      string
+		wantPages int // 0: no APNX
+	}{
+		{APNXNone, 0},
+		{APNXFast, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			dir := t.TempDir()
+			epubPath := createPageListTestEPUB(t, dir)
+			p := NewPipeline(ConvertOptions{
+				InputPath:  epubPath,
+				OutputPath: filepath.Join(dir, "paged.azw3"),
+				APNX:       tt.mode,
+			})
+			if err := p.Convert(); err != nil {
+				t.Fatalf("Convert() failed: %v", err)
+			}
+
+			apnx, err := os.ReadFile(filepath.Join(dir, "paged.apnx"))
+			if tt.wantPages == 0 {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("APNX written for mode %q", tt.mode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("APNX not written: %v", err)
+			}
+			if n := readUint16BE(apnx, int(readUint32BE(apnx, 4))+4); int(n) != tt.wantPages {
+				t.Errorf("page count = %d, want %d", n, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestPipeline_Convert_APNXPageListMissing(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := createMinimalTestEPUB(t, dir)
+	p := NewPipeline(ConvertOptions{
+		InputPath:  epubPath,
+		OutputPath: filepath.Join(dir, "output.azw3"),
+		APNX:       APNXPageList,
+		Strict:     true,
+	})
+	if err := p.Convert(); err == nil {
+		t.Fatal("Convert() should fail in strict mode without a page list")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "output.apnx")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("APNX written without a page list")
+	}
+}
+
+func TestPipeline_Convert_GuideStartReading(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := createPageListTestEPUB(t, dir)
+	outputPath := filepath.Join(dir, "paged.azw3")
+
+	p := NewPipeline(ConvertOptions{
+		InputPath:  epubPath,
+		OutputPath: outputPath,
+		Strict:     true,
+	})
+	if err := p.Convert(); err != nil {
+		t.Fatalf("Convert() failed: %v", err)
+	}
+
+	r, err := mobi.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("mobi.ReadFile() error = %v", err)
+	}
+	kf8 := r.KF8()
+	start, ok := kf8.EXTH.Uint32Value(116)
+	if !ok {
+		t.Fatal("EXTH 116 (start reading) not written")
+	}
+	flows, err := r.Flows(kf8)
+	if err != nil {
+		t.Fatalf("Flows() error = %v", err)
+	}
+	if text := flows[0]; !bytes.HasPrefix(text[start:], []byte(`<div id="ch02"`)) {
+		t.Errorf("start reading offset points at %q, want chapter 2", text[start:min(int(start)+20, len(text))])
+	}
+}
+
 func TestPipeline_Convert_WithTestdataEPUB(t *testing.T) {
 	// Use the project's testdata/test.epub for an E2E test
 	epubPath := filepath.Join("..", "..", "testdata", "test.epub")
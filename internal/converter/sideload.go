@@ -0,0 +1,87 @@
+package converter
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuanying/epub2azw3/internal/mobi"
+)
+
+// CDE types accepted by ConvertOptions.CDEType.
+const (
+	// CDETypeEBOK files the book under the books of the library.
+	CDETypeEBOK = "EBOK"
+	// CDETypePDOC files the book under the personal documents of the library.
+	CDETypePDOC = "PDOC"
+)
+
+// CDETypes lists the CDE types accepted by ConvertOptions.CDEType.
+var CDETypes = []string{CDETypeEBOK, CDETypePDOC}
+
+// derivedASINDigits is the number of base-36 digits of a derived ASIN after
+// its "B" prefix, which makes it as long as a real ASIN.
+const derivedASINDigits = 9
+
+// BookASIN returns asin, or else an ASIN-like identifier derived from the
+// book identifier: "B" followed by base-36 digits of its SHA-1, so that
+// converting the same book again gives the same ASIN. It returns "" when both
+// are empty.
+func BookASIN(asin, identifier string) string {
+	if asin = strings.TrimSpace(asin); asin != "" {
+		return asin
+	}
+	if identifier = strings.TrimSpace(identifier); identifier == "" {
+		return ""
+	}
+	sum := sha1.Sum([]byte(identifier))
+	digits := strings.Repeat("0", derivedASINDigits) + strings.ToUpper(new(big.Int).SetBytes(sum[:]).Text(36))
+	return "B" + digits[len(digits)-derivedASINDigits:]
+}
+
+// ThumbnailSidecarName returns the file name under which Kindle looks up the
+// library thumbnail of a sideloaded book.
+func ThumbnailSidecarName(asin, cdeType string) string {
+	return fmt.Sprintf("thumbnail_%s_%s_portrait.jpg", asin, cdeType)
+}
+
+// cdeType returns the CDE type of the output, CDETypeEBOK by default.
+func (p *Pipeline) cdeType() string {
+	if t := strings.ToUpper(strings.TrimSpace(p.Options.CDEType)); t != "" {
+		return t
+	}
+	return CDETypeEBOK
+}
+
+// writeThumbnailSidecar writes the cover thumbnail to the thumbnail directory,
+// named after the ASIN and CDE type of the book. Problems are recorded as
+// recoverable errors, since the book itself has already been written.
+func (p *Pipeline) writeThumbnailSidecar(mapper *mobi.ImageMapper, thumbnailOffset *uint32, asin string) {
+	dir := p.Options.ThumbnailDir
+	if dir == "" {
+		return
+	}
+	if thumbnailOffset == nil {
+		p.recoverable("thumbnail", "no cover thumbnail, thumbnail sidecar not written", nil)
+		return
+	}
+	if asin == "" {
+		p.recoverable("thumbnail", "book has no ASIN or identifier, thumbnail sidecar not written", nil)
+		return
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		p.recoverable("thumbnail", "failed to create thumbnail directory", err)
+		return
+	}
+	path := filepath.Join(dir, ThumbnailSidecarName(asin, p.cdeType()))
+	if err := os.WriteFile(path, mapper.Images[*thumbnailOffset].Data, 0o644); err != nil {
+		p.recoverable("thumbnail", "failed to write thumbnail sidecar", err)
+		return
+	}
+	p.thumbnailPath = path
+	p.logger.Info("thumbnail: written to "+path, "stage", "thumbnail")
+}
@@ -0,0 +1,32 @@
+package converter
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestBookASIN(t *testing.T) {
+	if got := BookASIN(" B00EXPLICIT ", "urn:uuid:12345"); got != "B00EXPLICIT" {
+		t.Errorf("BookASIN() with an ASIN = %q, want B00EXPLICIT", got)
+	}
+	if got := BookASIN("", ""); got != "" {
+		t.Errorf("BookASIN() without identifier = %q, want empty", got)
+	}
+
+	derived := BookASIN("", "urn:uuid:12345")
+	if !regexp.MustCompile(`^B[0-9A-Z]{9}$`).MatchString(derived) {
+		t.Errorf("derived ASIN = %q, want B and 9 digits or letters", derived)
+	}
+	if again := BookASIN("", "urn:uuid:12345"); again != derived {
+		t.Errorf("derived ASIN is not stable: %q, then %q", derived, again)
+	}
+	if other := BookASIN("", "urn:uuid:67890"); other == derived {
+		t.Errorf("different identifiers derive the same ASIN %q", other)
+	}
+}
+
+func TestThumbnailSidecarName(t *testing.T) {
+	if got := ThumbnailSidecarName("B012345678", CDETypePDOC); got != "thumbnail_B012345678_PDOC_portrait.jpg" {
+		t.Errorf("ThumbnailSidecarName() = %q", got)
+	}
+}
@@ -7,11 +7,16 @@ import (
 	"log"
 	"net/url"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/yuanying/epub2azw3/internal/epub"
 )
 
+// chapterDivIDRe matches the id attribute of a chapter div. The IDs of the
+// elements within chapters are namespaced as "<chapter ID>-<ID>".
+var chapterDivIDRe = regexp.MustCompile(`id="ch[0-9]+"`)
+
 // TOCEntry represents a resolved TOC entry with a byte offset in the final HTML.
 type TOCEntry struct {
 	Label    string
@@ -86,6 +91,10 @@ func (g *TOCGenerator) resolveHref(contentPath, fragment string) string {
 	if fragment == "" {
 		return "#" + chapterID
 	}
+	// kobo.* IDs are not namespaced (AozoraEpub3 compatibility)
+	if strings.HasPrefix(fragment, "kobo.") {
+		return "#" + fragment
+	}
 	sanitized := sanitizeFragmentForHTMLID(fragment)
 	return "#" + chapterID + "-" + sanitized
 }
@@ -159,12 +168,28 @@ func (g *TOCGenerator) calculateFilePos(finalHTML []byte, contentPath, fragment
 		return 0, nil
 	}
 
+	// kobo.* IDs are not namespaced and repeat across chapters, so they are
+	// only searched for within their chapter.
+	start, end := 0, len(finalHTML)
+	if strings.HasPrefix(fragment, "kobo.") {
+		chapterPos, _ := g.calculateFilePos(finalHTML, contentPath, "")
+		if chapterPos == 0 {
+			return 0, nil
+		}
+		chapterAttr := []byte(`id="` + g.resolveTargetID(contentPath, "") + `"`)
+		start = int(chapterPos) + bytes.Index(finalHTML[chapterPos:], chapterAttr) + len(chapterAttr)
+		if loc := chapterDivIDRe.FindIndex(finalHTML[start:]); loc != nil {
+			end = start + loc[0]
+		}
+	}
+
 	// Search for id="targetID" in the HTML bytes
 	searchPattern := []byte(`id="` + targetID + `"`)
-	idx := bytes.Index(finalHTML, searchPattern)
+	idx := bytes.Index(finalHTML[start:end], searchPattern)
 	if idx < 0 {
 		return 0, nil
 	}
+	idx += start
 
 	// Walk backwards to find the '<' that opens this tag
 	tagStart := idx
@@ -184,6 +209,9 @@ func (g *TOCGenerator) resolveTargetID(contentPath, fragment string) string {
 	if fragment == "" {
 		return chapterID
 	}
+	if strings.HasPrefix(fragment, "kobo.") {
+		return fragment
+	}
 	sanitized := url.QueryEscape(fragment)
 	return chapterID + "-" + sanitized
 }
@@ -70,6 +70,21 @@ func TestGenerateInlineTOC_WithFragment(t *testing.T) {
 	}
 }
 
+func TestGenerateInlineTOC_KoboFragment(t *testing.T) {
+	ncx := &epub.NCX{
+		NavPoints: []epub.NavPoint{
+			{Label: "Section 1", ContentPath: "text/ch01.xhtml", Fragment: "kobo.2.1"},
+		},
+	}
+	gen := NewTOCGenerator(ncx, map[string]string{"text/ch01.xhtml": "ch01"})
+	html := gen.GenerateInlineTOC()
+
+	// kobo.* fragments are kept as-is, like the IDs they refer to
+	if !strings.Contains(html, `href="#kobo.2.1"`) {
+		t.Errorf("expected link to #kobo.2.1, got: %s", html)
+	}
+}
+
 func TestGenerateInlineTOC_Nested(t *testing.T) {
 	ncx := &epub.NCX{
 		DocTitle: "Book",
@@ -437,6 +452,19 @@ func TestResolveTargetID_FragmentSanitized(t *testing.T) {
 	}
 }
 
+func TestResolveTargetID_KoboFragment(t *testing.T) {
+	chapterIDs := map[string]string{
+		"text/ch01.xhtml": "ch01",
+	}
+	gen := NewTOCGenerator(nil, chapterIDs)
+
+	// kobo.* IDs are not namespaced by HTMLBuilder
+	id := gen.resolveTargetID("text/ch01.xhtml", "kobo.2.1")
+	if id != "kobo.2.1" {
+		t.Errorf("expected 'kobo.2.1', got %q", id)
+	}
+}
+
 func TestResolveTargetID_UnmappedPath(t *testing.T) {
 	chapterIDs := map[string]string{
 		"text/ch01.xhtml": "ch01",
@@ -493,3 +521,61 @@ func TestCalculateFilePos_FragmentID(t *testing.T) {
 		t.Errorf("expected filepos %d, got %d", expected, pos)
 	}
 }
+
+func TestCalculateFilePos_KoboFragmentWithinChapter(t *testing.T) {
+	chapterIDs := map[string]string{
+		"text/ch01.xhtml": "ch01",
+		"text/ch02.xhtml": "ch02",
+		"text/ch03.xhtml": "ch03",
+	}
+	gen := NewTOCGenerator(nil, chapterIDs)
+
+	html := []byte(`<html><body>` +
+		`<div id="ch01"><p id="kobo.1.1">one</p></div>` +
+		`<div id="ch02"><p id="ch02-x">two</p></div>` +
+		`<div id="ch03"><p id="kobo.1.1">three</p></div>` +
+		`</body></html>`)
+
+	pos, _ := gen.calculateFilePos(html, "text/ch03.xhtml", "kobo.1.1")
+	if expected := strings.Index(string(html), `<p id="kobo.1.1">three`); pos != uint32(expected) {
+		t.Errorf("expected filepos %d, got %d", expected, pos)
+	}
+	// The kobo.1.1 of other chapters is not used for ch02
+	if pos, _ := gen.calculateFilePos(html, "text/ch02.xhtml", "kobo.1.1"); pos != 0 {
+		t.Errorf("expected 0 for a kobo ID missing from the chapter, got %d", pos)
+	}
+}
+
+func TestCalculateFilePos_BuiltHTML(t *testing.T) {
+	chapterHTML := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>Chapter</title></head>
+<body>
+<p>Text<span epub:type="pagebreak" id="page_12" title="12"/> more text.</p>
+<h2 id="章 1">Section</h2>
+<p id="kobo.3.1">Kobo span</p>
+</body>
+</html>`
+	content, err := epub.LoadContent("ch1", "text/chapter01.xhtml", []byte(chapterHTML))
+	if err != nil {
+		t.Fatalf("LoadContent failed: %v", err)
+	}
+	builder := NewHTMLBuilder()
+	if err := builder.AddChapter(content); err != nil {
+		t.Fatalf("AddChapter failed: %v", err)
+	}
+	html, err := builder.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	gen := NewTOCGenerator(nil, builder.GetChapterIDs())
+	// Fragments as parsed from NAV/NCX hrefs, e.g. "#%E7%AB%A0%201"
+	for _, fragment := range []string{"page_12", "章 1", "kobo.3.1"} {
+		pos, _ := gen.calculateFilePos([]byte(html), "text/chapter01.xhtml", fragment)
+		chapterPos, _ := gen.calculateFilePos([]byte(html), "text/chapter01.xhtml", "")
+		if pos == 0 || pos <= chapterPos {
+			t.Errorf("fragment %q not found in the built HTML: %s", fragment, html)
+		}
+	}
+}
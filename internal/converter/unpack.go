@@ -0,0 +1,711 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yuanying/epub2azw3/internal/epub"
+	"github.com/yuanying/epub2azw3/internal/mobi"
+)
+
+// Paths of the files written by Unpack.
+const (
+	unpackOPFPath   = "OEBPS/content.opf"
+	unpackNAVPath   = "OEBPS/nav.xhtml"
+	unpackNCXPath   = "OEBPS/toc.ncx"
+	unpackTextDir   = "OEBPS/text"
+	unpackStyleDir  = "OEBPS/styles"
+	unpackImageDir  = "OEBPS/images"
+	unpackFontDir   = "OEBPS/fonts"
+	unpackXMLHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+)
+
+var (
+	// unpackKindleRefRe matches kindle:flow, kindle:embed and kindle:pos references.
+	unpackKindleRefRe = regexp.MustCompile(`kindle:(?:flow:[0-9A-V]{4}(?:\?mime=[A-Za-z0-9.+/-]+)?|embed:[0-9A-Fa-f]{4}(?:\?mime=[A-Za-z0-9.+/-]+)?|pos:fid:[0-9A-V]{4}:off:[0-9A-V]{10})`)
+	// unpackAIDRe matches the aid attributes added to KF8 skeletons.
+	unpackAIDRe = regexp.MustCompile(`\said="[^"]*"`)
+	// unpackInternalHrefRe matches same-document links.
+	unpackInternalHrefRe = regexp.MustCompile(`href="#([^"]+)"`)
+	// unpackRecindexRe matches MOBI7 image references.
+	unpackRecindexRe = regexp.MustCompile(`recindex=["']?(\d+)["']?`)
+	// unpackFileposRe matches MOBI7 link targets.
+	unpackFileposRe = regexp.MustCompile(`filepos=["']?(\d+)["']?`)
+	// unpackPagebreakRe matches MOBI page breaks, which are not valid XHTML.
+	unpackPagebreakRe = regexp.MustCompile(`</?mbp:pagebreak[^>]*>`)
+	// unpackHeadingRe matches the first heading of a file, used as a TOC label.
+	unpackHeadingRe = regexp.MustCompile(`(?is)<h[1-6][^>]*>(.*?)</h[1-6]>`)
+	// unpackTagRe matches markup inside a heading.
+	unpackTagRe = regexp.MustCompile(`<[^>]*>`)
+)
+
+// UnpackOptions holds options for converting an AZW3/MOBI file back to EPUB.
+type UnpackOptions struct {
+	InputPath  string
+	OutputPath string
+	Logger     *slog.Logger
+}
+
+// unpacker holds the state of a single AZW3 to EPUB conversion.
+type unpacker struct {
+	reader  *mobi.Reader
+	section *mobi.Section
+	logger  *slog.Logger
+
+	files     []*mobi.HTMLFile
+	filePaths []string
+	layout    *mobi.KF8Layout
+	flows     [][]byte
+	idFiles   map[string]int // element id -> index of the file containing it
+
+	flowPaths  map[int]string // flow index -> EPUB path
+	flowTypes  map[int]string // flow index -> media type
+	imagePaths map[int]string // 1-based resource number -> EPUB path
+	imageTypes map[int]string
+	fonts      map[int][]byte // 1-based resource number -> decoded FONT record
+}
+
+// Unpack converts an AZW3/MOBI file into an EPUB. The text is split back into
+// XHTML files at the KF8 skeleton boundaries (or at the chapter divs when the
+// file has no skeleton index), kindle:embed resources are extracted, and the
+// OPF and navigation documents are rebuilt from the EXTH metadata and NCX index.
+func Unpack(opts UnpackOptions) error {
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(discardHandler{})
+	}
+
+	r, err := mobi.ReadFile(opts.InputPath)
+	if err != nil {
+		return err
+	}
+	s := r.KF8()
+	if s == nil {
+		s = r.MOBI7()
+	}
+	u := &unpacker{
+		reader:     r,
+		section:    s,
+		logger:     logger,
+		idFiles:    make(map[string]int),
+		flowPaths:  make(map[int]string),
+		flowTypes:  make(map[int]string),
+		imagePaths: make(map[int]string),
+		imageTypes: make(map[int]string),
+		fonts:      make(map[int][]byte),
+	}
+
+	u.logger.Info("start: split text", "stage", "unpack")
+	if err := u.splitText(); err != nil {
+		return err
+	}
+	u.logger.Info(fmt.Sprintf("done: split text into %d files", len(u.files)), "stage", "unpack")
+
+	metadata := u.metadata()
+	book := &epub.OPF{
+		Metadata: metadata,
+		Manifest: make(map[string]epub.ManifestItem),
+	}
+	addItem := func(item epub.ManifestItem) {
+		book.Manifest[item.ID] = item
+		book.ManifestOrder = append(book.ManifestOrder, item.ID)
+	}
+
+	contents := make(map[string][]byte)
+	for i, f := range u.files {
+		contents[u.filePaths[i]] = u.rewriteHTML(i, f.HTML, metadata.Title)
+		id := strings.TrimSuffix(path.Base(u.filePaths[i]), ".xhtml")
+		addItem(epub.ManifestItem{ID: id, Href: u.filePaths[i], MediaType: "application/xhtml+xml"})
+		book.Spine = append(book.Spine, epub.SpineItem{IDRef: id, Linear: true})
+	}
+
+	for i := 1; i < len(u.flows); i++ {
+		p, mediaType := u.flowPath(i)
+		data := u.flows[i]
+		if mediaType == "text/css" {
+			data = u.rewriteResourceRefs(dedupeCSSStatements(data), path.Dir(p))
+		}
+		contents[p] = data
+		addItem(epub.ManifestItem{ID: fmt.Sprintf("flow%04d", i), Href: p, MediaType: mediaType})
+	}
+
+	// The cover is extracted even when the text does not reference it.
+	if cover, ok := u.coverNumber(); ok {
+		if _, ok := u.imagePath(cover); ok {
+			book.Metadata.CoverID = fmt.Sprintf("image%04d", cover)
+		}
+	}
+	for _, n := range slices.Sorted(maps.Keys(u.imagePaths)) {
+		p := u.imagePaths[n]
+		data, err := r.Record(u.imageRecord(n))
+		if err != nil {
+			return err
+		}
+		if font, ok := u.fonts[n]; ok {
+			data = font
+		}
+		contents[p] = data
+		item := epub.ManifestItem{ID: strings.TrimSuffix(path.Base(p), path.Ext(p)), Href: p, MediaType: u.imageTypes[n]}
+		if item.ID == book.Metadata.CoverID {
+			item.Properties = []string{"cover-image"}
+		}
+		addItem(item)
+	}
+
+	toc := &epub.NCX{
+		UID:       metadata.Identifier,
+		DocTitle:  metadata.Title,
+		NavPoints: u.navPoints(),
+	}
+	navData, err := epub.MarshalNAV(toc, path.Dir(unpackNAVPath), metadata.Language)
+	if err != nil {
+		return fmt.Errorf("failed to build navigation document: %w", err)
+	}
+	ncxData, err := epub.MarshalNCX(toc, path.Dir(unpackNCXPath))
+	if err != nil {
+		return fmt.Errorf("failed to build NCX: %w", err)
+	}
+	contents[unpackNAVPath] = navData
+	contents[unpackNCXPath] = ncxData
+	addItem(epub.ManifestItem{ID: "nav", Href: unpackNAVPath, MediaType: "application/xhtml+xml", Properties: []string{"nav"}})
+	addItem(epub.ManifestItem{ID: "ncx", Href: unpackNCXPath, MediaType: "application/x-dtbncx+xml"})
+	book.NCXPath = unpackNCXPath
+
+	if s.EXTH != nil {
+		if ppd, ok := s.EXTH.StringValue(527); ok && (ppd == "rtl" || ppd == "ltr") {
+			book.PageProgressionDirection = ppd
+		}
+		book.Rendition = renditionFromEXTH(s.EXTH)
+	}
+	u.applyRESC(book)
+
+	opfData, err := epub.MarshalOPF(book, path.Dir(unpackOPFPath), mobi.PalmEpochTime(r.PDB.Header.ModificationDate))
+	if err != nil {
+		return fmt.Errorf("failed to build OPF: %w", err)
+	}
+	contents[unpackOPFPath] = opfData
+
+	return writeEPUB(opts.OutputPath, book, contents)
+}
+
+// renditionFromEXTH restores the rendition properties of a Kindle
+// fixed-layout book from EXTH 122 to 124 and the original resolution.
+func renditionFromEXTH(exth *mobi.EXTHHeader) epub.Rendition {
+	var r epub.Rendition
+	if fixed, ok := exth.StringValue(122); !ok || fixed != "true" {
+		return r
+	}
+	r.Layout = "pre-paginated"
+	r.BookType, _ = exth.StringValue(123)
+	switch orientation, _ := exth.StringValue(124); orientation {
+	case "portrait", "landscape":
+		r.Orientation = orientation
+	case "none":
+		r.Orientation = "auto"
+	}
+	for _, recordType := range []uint32{126, 307} {
+		if resolution, ok := exth.StringValue(recordType); ok {
+			r.OriginalResolution = resolution
+			break
+		}
+	}
+	return r
+}
+
+// applyRESC restores the page-progression-direction and the linear flags and
+// properties of the spine items from the RESC record. Files are split at the
+// skeleton boundaries, so the file index is the skeleton ID of the spine item.
+func (u *unpacker) applyRESC(book *epub.OPF) {
+	resc, err := u.reader.RESC(u.section)
+	if err != nil {
+		u.logger.Warn("failed to read RESC record, spine properties are not restored", "stage", "unpack", "error", err)
+		return
+	}
+	if resc == nil {
+		return
+	}
+	if resc.PageProgressionDirection == "rtl" || resc.PageProgressionDirection == "ltr" {
+		book.PageProgressionDirection = resc.PageProgressionDirection
+	}
+	for _, item := range resc.Spine {
+		if item.SkeletonID < 0 || item.SkeletonID >= len(book.Spine) {
+			continue
+		}
+		book.Spine[item.SkeletonID].Linear = item.Linear
+		book.Spine[item.SkeletonID].Properties = item.Properties
+	}
+}
+
+// writeEPUB writes the OPF followed by the manifest items in manifest order.
+func writeEPUB(outputPath string, book *epub.OPF, contents map[string][]byte) error {
+	f, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer f.Close()
+
+	w, err := epub.NewWriter(f, unpackOPFPath)
+	if err != nil {
+		return err
+	}
+	if err := w.AddFile(unpackOPFPath, contents[unpackOPFPath]); err != nil {
+		return err
+	}
+	for _, id := range book.ManifestOrder {
+		href := book.Manifest[id].Href
+		if err := w.AddFile(href, contents[href]); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to finish EPUB: %w", err)
+	}
+	return f.Close()
+}
+
+// splitText reconstructs the HTML files of the section and assigns their paths.
+func (u *unpacker) splitText() error {
+	r, s := u.reader, u.section
+	if s.IsKF8() {
+		flows, err := r.Flows(s)
+		if err != nil {
+			return fmt.Errorf("failed to read text: %w", err)
+		}
+		u.flows = flows
+		layout, err := r.Layout(s)
+		if err != nil {
+			return fmt.Errorf("failed to read KF8 layout: %w", err)
+		}
+		if layout != nil {
+			u.layout = layout
+			if u.files, err = layout.Files(); err != nil {
+				return fmt.Errorf("failed to reassemble KF8 files: %w", err)
+			}
+		} else {
+			u.files = mobi.SplitChapters(flows[0])
+		}
+	} else {
+		text, err := r.Text(s)
+		if err != nil {
+			return fmt.Errorf("failed to read text: %w", err)
+		}
+		u.flows = [][]byte{text}
+		u.files = mobi.SplitChapters(text)
+	}
+
+	if len(u.files) == 0 {
+		return fmt.Errorf("no text files found")
+	}
+
+	used := make(map[string]bool)
+	for i, f := range u.files {
+		name := f.ChapterID
+		if name == "" || used[name] {
+			name = fmt.Sprintf("part%04d", i)
+		}
+		used[name] = true
+		u.filePaths = append(u.filePaths, unpackTextDir+"/"+name+".xhtml")
+
+		for _, m := range elementIDRe.FindAllSubmatch(f.HTML, -1) {
+			if _, exists := u.idFiles[string(m[1])]; !exists {
+				u.idFiles[string(m[1])] = i
+			}
+		}
+	}
+	return nil
+}
+
+// dedupeCSSStatements removes repeated top-level statements (rules and
+// at-rules) from a stylesheet, keeping the last copy of each. The converter
+// adds the stylesheets of every chapter to the merged flow, so a stylesheet
+// linked from every chapter is repeated once per chapter. Keeping the last
+// copy preserves the cascade order of the remaining rules.
+func dedupeCSSStatements(css []byte) []byte {
+	var statements [][]byte
+	depth, start := 0, 0
+	inComment, inString, escapeNext := false, byte(0), false
+	for i := 0; i < len(css); i++ {
+		ch := css[i]
+		switch {
+		case inComment:
+			if ch == '*' && i+1 < len(css) && css[i+1] == '/' {
+				inComment = false
+				i++
+			}
+			continue
+		case inString != 0:
+			switch {
+			case escapeNext:
+				escapeNext = false
+			case ch == '\\':
+				escapeNext = true
+			case ch == inString:
+				inString = 0
+			}
+			continue
+		}
+		switch ch {
+		case '/':
+			if i+1 < len(css) && css[i+1] == '*' {
+				inComment = true
+				i++
+			}
+		case '"', '\'':
+			inString = ch
+		case '{':
+			depth++
+		case '}':
+			if depth > 0 {
+				depth--
+			}
+			if depth == 0 {
+				statements = append(statements, css[start:i+1])
+				start = i + 1
+			}
+		case ';':
+			if depth == 0 {
+				statements = append(statements, css[start:i+1])
+				start = i + 1
+			}
+		}
+	}
+	statements = append(statements, css[start:])
+
+	last := make(map[string]int)
+	for i, s := range statements {
+		last[string(bytes.TrimSpace(s))] = i
+	}
+	var out [][]byte
+	for i, s := range statements {
+		if s = bytes.TrimSpace(s); len(s) > 0 && last[string(s)] == i {
+			out = append(out, s)
+		}
+	}
+	return append(bytes.Join(out, []byte("\n")), '\n')
+}
+
+// elementIDRe matches id attributes.
+var elementIDRe = regexp.MustCompile(`\sid="([^"]+)"`)
+
+// rewriteHTML turns a reconstructed KF8/MOBI7 file into an XHTML content document.
+func (u *unpacker) rewriteHTML(index int, data []byte, title string) []byte {
+	dir := path.Dir(u.filePaths[index])
+
+	out := unpackKindleRefRe.ReplaceAllFunc(data, func(ref []byte) []byte {
+		if fid, off, ok := mobi.ParseKindlePos(string(ref)); ok {
+			if u.layout != nil {
+				if pos, ok := u.layout.Position(fid, off); ok {
+					if href, ok := u.positionHref(index, pos); ok {
+						return []byte(href)
+					}
+				}
+			}
+			u.logger.Warn(fmt.Sprintf("unresolved link %s in %s", ref, u.filePaths[index]), "stage", "unpack")
+			return ref
+		}
+		return u.rewriteResourceRefs(ref, dir)
+	})
+
+	out = unpackRecindexRe.ReplaceAllFunc(out, func(m []byte) []byte {
+		n, err := strconv.Atoi(string(unpackRecindexRe.FindSubmatch(m)[1]))
+		if err != nil {
+			return m
+		}
+		p, ok := u.imagePath(n)
+		if !ok {
+			return m
+		}
+		return []byte(`src="` + relativeTo(dir, p) + `"`)
+	})
+	out = unpackFileposRe.ReplaceAllFunc(out, func(m []byte) []byte {
+		pos, err := strconv.ParseUint(string(unpackFileposRe.FindSubmatch(m)[1]), 10, 32)
+		if err != nil {
+			return m
+		}
+		href, ok := u.positionHref(index, uint32(pos))
+		if !ok {
+			return m
+		}
+		return []byte(`href="` + href + `"`)
+	})
+
+	// Links into other files, e.g. after splitting a single HTML document
+	out = unpackInternalHrefRe.ReplaceAllFunc(out, func(m []byte) []byte {
+		id := string(unpackInternalHrefRe.FindSubmatch(m)[1])
+		target, ok := u.idFiles[id]
+		if !ok || target == index {
+			return m
+		}
+		return []byte(`href="` + path.Base(u.filePaths[target]) + "#" + id + `"`)
+	})
+
+	out = unpackAIDRe.ReplaceAll(out, nil)
+	out = unpackPagebreakRe.ReplaceAll(out, nil)
+	if !bytes.Contains(out, []byte("<title")) {
+		out = bytes.Replace(out, []byte("<head>"), []byte("<head><title>"+html.EscapeString(title)+"</title>"), 1)
+	}
+	if !bytes.HasPrefix(out, []byte("<?xml")) {
+		out = append([]byte(unpackXMLHeader), out...)
+	}
+	return out
+}
+
+// rewriteResourceRefs replaces kindle:flow and kindle:embed references with
+// paths relative to dir.
+func (u *unpacker) rewriteResourceRefs(data []byte, dir string) []byte {
+	return unpackKindleRefRe.ReplaceAllFunc(data, func(ref []byte) []byte {
+		if flow, _, ok := mobi.ParseKindleFlow(string(ref)); ok && flow > 0 && flow < len(u.flows) {
+			p, _ := u.flowPath(flow)
+			return []byte(relativeTo(dir, p))
+		}
+		if n, ok := mobi.ParseKindleEmbed(string(ref)); ok {
+			if p, ok := u.imagePath(n); ok {
+				return []byte(relativeTo(dir, p))
+			}
+		}
+		if !bytes.HasPrefix(ref, []byte("kindle:pos:")) {
+			u.logger.Warn(fmt.Sprintf("unresolved reference %s", ref), "stage", "unpack")
+		}
+		return ref
+	})
+}
+
+// positionHref returns the href, relative to file from, of the element at the
+// text flow position pos.
+func (u *unpacker) positionHref(from int, pos uint32) (string, bool) {
+	target, offset, ok := mobi.LocateFile(u.files, pos)
+	if !ok {
+		return "", false
+	}
+	href := path.Base(u.filePaths[target])
+	id := u.files[target].IDAt(offset)
+	if id == "" || id == u.files[target].ChapterID {
+		return href, true
+	}
+	if target == from {
+		return "#" + id, true
+	}
+	return href + "#" + id, true
+}
+
+// flowPath returns the EPUB path and media type of KF8 flow n (n >= 1). The
+// media type is taken from the kindle:flow references to the flow.
+func (u *unpacker) flowPath(n int) (string, string) {
+	if p, ok := u.flowPaths[n]; ok {
+		return p, u.flowTypes[n]
+	}
+	mediaType := "text/css"
+	for _, f := range u.files {
+		for _, ref := range unpackKindleRefRe.FindAll(f.HTML, -1) {
+			if flow, mime, ok := mobi.ParseKindleFlow(string(ref)); ok && flow == n && mime != "" {
+				mediaType = mime
+			}
+		}
+	}
+	var p string
+	switch mediaType {
+	case "image/svg+xml":
+		p = fmt.Sprintf("%s/flow%04d.svg", unpackImageDir, n)
+	default:
+		p = fmt.Sprintf("%s/flow%04d.css", unpackStyleDir, n)
+	}
+	u.flowPaths[n], u.flowTypes[n] = p, mediaType
+	return p, mediaType
+}
+
+// imageRecord returns the PDB record number of the 1-based resource number n.
+func (u *unpacker) imageRecord(n int) int {
+	h := u.section.Header
+	if h.FirstImageIndex == mobi.NullIndex {
+		return -1
+	}
+	return u.section.Record0 + int(h.FirstImageIndex) + n - 1
+}
+
+// imagePath returns the EPUB path of the image or font with the 1-based
+// resource number n, registering it for extraction. It fails when the resource
+// is neither an image nor a readable FONT record.
+func (u *unpacker) imagePath(n int) (string, bool) {
+	if p, ok := u.imagePaths[n]; ok {
+		return p, true
+	}
+	rec := u.imageRecord(n)
+	if rec < 0 {
+		return "", false
+	}
+	mediaType := u.reader.RecordType(rec)
+	var ext string
+	switch mediaType {
+	case "image/jpeg":
+		ext = ".jpg"
+	case "image/png":
+		ext = ".png"
+	case "image/gif":
+		ext = ".gif"
+	case "FONT":
+		return u.fontPath(n, rec)
+	default:
+		return "", false
+	}
+	p := fmt.Sprintf("%s/image%04d%s", unpackImageDir, n, ext)
+	u.imagePaths[n], u.imageTypes[n] = p, mediaType
+	return p, true
+}
+
+// fontPath decodes the FONT record rec with the 1-based resource number n and
+// returns the EPUB path of the font.
+func (u *unpacker) fontPath(n, rec int) (string, bool) {
+	data, err := u.reader.Record(rec)
+	if err != nil {
+		return "", false
+	}
+	font, err := mobi.DecodeFontRecord(data)
+	if err != nil {
+		u.logger.Warn(fmt.Sprintf("failed to decode font record %d: %v", rec, err), "stage", "unpack")
+		return "", false
+	}
+	mediaType, ext := "application/x-font-truetype", ".ttf"
+	if bytes.HasPrefix(font, []byte("OTTO")) {
+		mediaType, ext = "application/vnd.ms-opentype", ".otf"
+	}
+	p := fmt.Sprintf("%s/font%04d%s", unpackFontDir, n, ext)
+	u.imagePaths[n], u.imageTypes[n] = p, mediaType
+	u.fonts[n] = font
+	return p, true
+}
+
+// coverNumber returns the 1-based resource number of the cover image from
+// EXTH 131 or 201.
+func (u *unpacker) coverNumber() (int, bool) {
+	exth := u.section.EXTH
+	if exth == nil {
+		return 0, false
+	}
+	for _, t := range []uint32{131, 201} {
+		if v, ok := exth.Uint32Value(t); ok && v != mobi.NullIndex {
+			return int(v) + 1, true
+		}
+	}
+	return 0, false
+}
+
+// metadata rebuilds the OPF metadata from the EXTH records.
+func (u *unpacker) metadata() epub.Metadata {
+	s := u.section
+	md := epub.Metadata{Title: s.FullName}
+	if md.Title == "" {
+		md.Title = u.reader.PDB.Header.Title()
+	}
+
+	exth := s.EXTH
+	if exth == nil {
+		exth = &mobi.EXTHHeader{}
+	}
+	if v, ok := exth.StringValue(503); ok && v != "" {
+		md.Title = v
+	}
+	for _, rec := range exth.Records {
+		switch rec.Type {
+		case 100:
+			for _, name := range strings.Split(string(rec.Data), " & ") {
+				if name = strings.TrimSpace(name); name != "" {
+					md.Creators = append(md.Creators, epub.Creator{Name: name, Role: "aut"})
+				}
+			}
+		case 105:
+			for _, subject := range strings.Split(string(rec.Data), "; ") {
+				if subject = strings.TrimSpace(subject); subject != "" {
+					md.Subjects = append(md.Subjects, subject)
+				}
+			}
+		}
+	}
+	md.Publisher, _ = exth.StringValue(101)
+	md.Description, _ = exth.StringValue(103)
+	md.Date, _ = exth.StringValue(106)
+	md.Rights, _ = exth.StringValue(109)
+	md.Language, _ = exth.StringValue(524)
+
+	switch {
+	case lookupString(exth, 104) != "":
+		md.Identifier = "urn:isbn:" + lookupString(exth, 104)
+	case lookupString(exth, 113) != "":
+		md.Identifier = "urn:asin:" + lookupString(exth, 113)
+	case lookupString(exth, 504) != "":
+		md.Identifier = "urn:asin:" + lookupString(exth, 504)
+	default:
+		md.Identifier = fmt.Sprintf("urn:mobi:%d", s.Header.UniqueID)
+	}
+	return md
+}
+
+// lookupString returns the trimmed string value of an EXTH record, or "".
+func lookupString(exth *mobi.EXTHHeader, recordType uint32) string {
+	v, _ := exth.StringValue(recordType)
+	return strings.TrimSpace(v)
+}
+
+// navPoints converts the NCX index into navigation points. Without an NCX
+// index, every file gets an entry labelled by its first heading.
+func (u *unpacker) navPoints() []epub.NavPoint {
+	entries, err := u.reader.NCX(u.section)
+	if err != nil {
+		u.logger.Warn("failed to read NCX index, rebuilding the TOC from the files", "stage", "unpack", "error", err)
+		entries = nil
+	}
+
+	if len(entries) == 0 {
+		points := make([]epub.NavPoint, len(u.files))
+		for i, f := range u.files {
+			label := path.Base(u.filePaths[i])
+			if m := unpackHeadingRe.FindSubmatch(f.HTML); m != nil {
+				if text := strings.TrimSpace(html.UnescapeString(unpackTagRe.ReplaceAllString(string(m[1]), ""))); text != "" {
+					label = text
+				}
+			}
+			points[i] = epub.NavPoint{Label: label, ContentPath: u.filePaths[i]}
+		}
+		return points
+	}
+
+	var convert func(entries []mobi.NCXEntry) []epub.NavPoint
+	convert = func(entries []mobi.NCXEntry) []epub.NavPoint {
+		points := make([]epub.NavPoint, 0, len(entries))
+		for _, e := range entries {
+			np := epub.NavPoint{Label: e.Label, ContentPath: u.filePaths[0]}
+			if target, offset, ok := mobi.LocateFile(u.files, e.FilePos); ok {
+				np.ContentPath = u.filePaths[target]
+				if id := u.files[target].IDAt(offset); id != u.files[target].ChapterID {
+					np.Fragment = id
+				}
+			}
+			np.Children = convert(e.Children)
+			points = append(points, np)
+		}
+		return points
+	}
+	return convert(entries)
+}
+
+// relativeTo returns target (an absolute path within the EPUB) relative to dir.
+func relativeTo(dir, target string) string {
+	if dir == path.Dir(target) {
+		return path.Base(target)
+	}
+	dirParts := strings.Split(dir, "/")
+	targetParts := strings.Split(target, "/")
+	common := 0
+	for common < len(dirParts) && common < len(targetParts)-1 && dirParts[common] == targetParts[common] {
+		common++
+	}
+	return strings.Repeat("../", len(dirParts)-common) + strings.Join(targetParts[common:], "/")
+}
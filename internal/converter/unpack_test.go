@@ -0,0 +1,304 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yuanying/epub2azw3/internal/epub"
+	"github.com/yuanying/epub2azw3/internal/mobi"
+)
+
+// createUnpackTestEPUB creates an EPUB with metadata, a cover, a stylesheet
+// with an embedded font, an NCX, a right-to-left spine and a link between two
+// chapters.
+func createUnpackTestEPUB(t *testing.T, dir string) string {
+	t.Helper()
+	files := map[string]string{
+		"OEBPS/content.opf": `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Unpack Book</dc:title>
+    <dc:language>ja</dc:language>
+    <dc:identifier id="uid">urn:isbn:9784000000001</dc:identifier>
+    <dc:creator>Author One</dc:creator>
+    <dc:creator>Author Two</dc:creator>
+    <dc:publisher>Publisher</dc:publisher>
+    <dc:date>2024-05-06</dc:date>
+  </metadata>
+  <manifest>
+    <item id="ch1" href="text/chapter1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ch2" href="text/chapter2.xhtml" media-type="application/xhtml+xml"/>
+    <item id="css" href="style.css" media-type="text/css"/>
+    <item id="cover" href="images/cover.jpg" media-type="image/jpeg" properties="cover-image"/>
+    <item id="font" href="fonts/gaiji.ttf" media-type="application/x-font-truetype"/>
+    <item id="font-woff" href="fonts/gaiji.woff" media-type="font/woff"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+  </manifest>
+  <spine toc="ncx" page-progression-direction="rtl">
+    <itemref idref="ch1" properties="page-spread-right"/>
+    <itemref idref="ch2" linear="no"/>
+  </spine>
+</package>`,
+		"OEBPS/toc.ncx": `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head><meta name="dtb:uid" content="urn:isbn:9784000000001"/></head>
+  <docTitle><text>Unpack Book</text></docTitle>
+  <navMap>
+    <navPoint id="n1" playOrder="1"><navLabel><text>Chapter 1</text></navLabel><content src="text/chapter1.xhtml"/></navPoint>
+    <navPoint id="n2" playOrder="2"><navLabel><text>Chapter 2</text></navLabel><content src="text/chapter2.xhtml"/>
+      <navPoint id="n3" playOrder="3"><navLabel><text>Section 2.1</text></navLabel><content src="text/chapter2.xhtml#s1"/></navPoint>
+    </navPoint>
+  </navMap>
+</ncx>`,
+		"OEBPS/style.css": `@font-face { font-family: "Gaiji"; src: url("fonts/gaiji.ttf"); }
+p { text-indent: 1em; }`,
+		"OEBPS/fonts/gaiji.woff": "wOFF",
+		"OEBPS/text/chapter1.xhtml": `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>Chapter 1</title><link rel="stylesheet" type="text/css" href="../style.css"/></head>
+<body><h1>Chapter 1</h1><p>` + strings.Repeat("first chapter text ", 1000) + `</p>
+<p><img src="../images/cover.jpg" alt="cover"/></p>
+<p><a href="chapter2.xhtml#s1">to section</a></p></body>
+</html>`,
+		"OEBPS/text/chapter2.xhtml": `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>Chapter 2</title><link rel="stylesheet" type="text/css" href="../style.css"/></head>
+<body><h1>Chapter 2</h1><h2 id="s1">Section 2.1</h2><p>second chapter text</p></body>
+</html>`,
+	}
+
+	path := filepath.Join(dir, "unpack.epub")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := epub.NewWriter(f, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := w.AddFile(name, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.AddFile("OEBPS/images/cover.jpg", createJPEGImage(t, 200, 300)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddFile("OEBPS/fonts/gaiji.ttf", createFontData(4096)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUnpack_RoundTrip(t *testing.T) {
+	for _, format := range []string{FormatAZW3, FormatMOBI7KF8} {
+		t.Run(format, func(t *testing.T) {
+			dir := t.TempDir()
+			azw3Path := filepath.Join(dir, "book.azw3")
+			if err := NewPipeline(ConvertOptions{
+				InputPath:  createUnpackTestEPUB(t, dir),
+				OutputPath: azw3Path,
+				Format:     format,
+			}).Convert(); err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+
+			epubPath := filepath.Join(dir, "unpacked.epub")
+			if err := Unpack(UnpackOptions{InputPath: azw3Path, OutputPath: epubPath}); err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+
+			r, err := epub.Open(epubPath)
+			if err != nil {
+				t.Fatalf("epub.Open() error = %v", err)
+			}
+			defer r.Close()
+
+			opfData, err := r.ReadFile(r.OPFPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			opf, err := epub.ParseOPF(opfData, filepath.Dir(r.OPFPath()))
+			if err != nil {
+				t.Fatalf("ParseOPF() error = %v", err)
+			}
+
+			md := opf.Metadata
+			if md.Title != "Unpack Book" || md.Language != "ja" || md.Publisher != "Publisher" || md.Date != "2024-05-06" {
+				t.Errorf("Metadata = %+v", md)
+			}
+			if md.Identifier != "urn:isbn:9784000000001" {
+				t.Errorf("Identifier = %q", md.Identifier)
+			}
+			if len(md.Creators) != 2 || md.Creators[0].Name != "Author One" || md.Creators[1].Name != "Author Two" {
+				t.Errorf("Creators = %+v", md.Creators)
+			}
+
+			// Front matter (the generated TOC) and the two chapters
+			if len(opf.Spine) != 3 {
+				t.Fatalf("spine = %+v, want 3 items", opf.Spine)
+			}
+			if opf.PageProgressionDirection != "rtl" {
+				t.Errorf("PageProgressionDirection = %q, want rtl", opf.PageProgressionDirection)
+			}
+			var chapter1, chapter2 string
+			for _, item := range opf.Spine {
+				href := opf.Manifest[item.IDRef].Href
+				data, err := r.ReadFile(href)
+				if err != nil {
+					t.Fatalf("ReadFile(%s) error = %v", href, err)
+				}
+				content := string(data)
+				if strings.Contains(content, "kindle:") || strings.Contains(content, " aid=") {
+					t.Errorf("%s still contains KF8 references:\n%.500s", href, content)
+				}
+				if !strings.HasPrefix(content, "<?xml") {
+					t.Errorf("%s has no XML declaration", href)
+				}
+				if _, err := epub.LoadContent(item.IDRef, href, data); err != nil {
+					t.Errorf("LoadContent(%s) error = %v", href, err)
+				}
+				switch {
+				case strings.Contains(content, "first chapter text"):
+					chapter1 = content
+					if !item.Linear || len(item.Properties) != 1 || item.Properties[0] != "page-spread-right" {
+						t.Errorf("chapter 1 spine item = %+v, want page-spread-right", item)
+					}
+				case strings.Contains(content, "second chapter text"):
+					chapter2 = content
+					if item.Linear {
+						t.Errorf("chapter 2 spine item = %+v, want linear=no", item)
+					}
+				}
+			}
+			if chapter1 == "" || chapter2 == "" {
+				t.Fatal("chapter contents not found in the spine")
+			}
+			if strings.Count(chapter1, "first chapter text") != 1000 {
+				t.Error("chapter 1 text was not fully reassembled")
+			}
+			if !strings.Contains(chapter1, `href="ch02.xhtml#ch02-s1"`) {
+				t.Errorf("link to chapter 2 not restored:\n%.300s", chapter1[strings.Index(chapter1, "<a "):])
+			}
+			if !strings.Contains(chapter1, `href="../styles/flow0001.css"`) {
+				t.Error("stylesheet link not restored")
+			}
+
+			cover, ok := opf.Manifest[md.CoverID]
+			if !ok || cover.MediaType != "image/jpeg" || len(cover.Properties) != 1 || cover.Properties[0] != "cover-image" {
+				t.Fatalf("cover = %+v (CoverID %q)", cover, md.CoverID)
+			}
+			if !strings.Contains(chapter1, `src="../images/`+filepath.Base(cover.Href)+`"`) {
+				t.Error("image reference not restored")
+			}
+			if data, err := r.ReadFile(cover.Href); err != nil || len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+				t.Errorf("cover image = %d bytes, %v", len(data), err)
+			}
+			css, err := r.ReadFile("OEBPS/styles/flow0001.css")
+			if err != nil || !strings.Contains(string(css), "text-indent") {
+				t.Errorf("stylesheet = %q, %v", css, err)
+			}
+			if !strings.Contains(string(css), `url(../fonts/font0002.ttf)`) {
+				t.Errorf("font reference not restored: %q", css)
+			}
+			// Both chapters link style.css, which the converter merges twice.
+			if n := strings.Count(string(css), "text-indent"); n != 1 {
+				t.Errorf("stylesheet has %d copies of the chapter rules, want 1:\n%s", n, css)
+			}
+			font, ok := opf.Manifest["font0002"]
+			if !ok || font.Href != "OEBPS/fonts/font0002.ttf" || font.MediaType != "application/x-font-truetype" {
+				t.Fatalf("font = %+v", font)
+			}
+			if data, err := r.ReadFile(font.Href); err != nil || !bytes.Equal(data, createFontData(4096)) {
+				t.Errorf("font = %d bytes, %v; want the original font", len(data), err)
+			}
+
+			toc, err := epub.LoadNCX(r, opf)
+			if err != nil {
+				t.Fatalf("LoadNCX() error = %v", err)
+			}
+			if len(toc.NavPoints) != 2 || toc.NavPoints[1].Label != "Chapter 2" {
+				t.Fatalf("NavPoints = %+v", toc.NavPoints)
+			}
+			section := toc.NavPoints[1].Children
+			if len(section) != 1 || section[0].ContentPath != "OEBPS/text/ch02.xhtml" || section[0].Fragment != "ch02-s1" {
+				t.Errorf("section NavPoint = %+v", section)
+			}
+		})
+	}
+}
+
+func TestUnpack_NoTextFiles(t *testing.T) {
+	dir := t.TempDir()
+	azw3Path := filepath.Join(dir, "book.azw3")
+	if err := NewPipeline(ConvertOptions{
+		InputPath:  createUnpackTestEPUB(t, dir),
+		OutputPath: azw3Path,
+	}).Convert(); err != nil {
+		t.Fatalf("Convert() error = %v", err)
+	}
+
+	// An empty SKEL index leaves no files to split the text into, while the
+	// NCX index still has entries.
+	r, err := mobi.ReadFile(azw3Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := r.KF8()
+	data, err := os.ReadFile(azw3Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := r.PDB.Records[s.Record0+int(s.Header.SkeletonIndex)].Offset
+	binary.BigEndian.PutUint32(data[header+24:], 0) // entry record count
+	if err := os.WriteFile(azw3Path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Unpack(UnpackOptions{InputPath: azw3Path, OutputPath: filepath.Join(dir, "out.epub")}); err == nil {
+		t.Error("Unpack() error = nil for a file without text files")
+	}
+}
+
+func TestDedupeCSSStatements(t *testing.T) {
+	css := `@charset "UTF-8";
+p { text-indent: 1em; }
+/* a; b { */ h1 { content: "}"; }
+#ch01-note { color: red; }
+@media print { p { color: black; } }
+@charset "UTF-8";
+p { text-indent: 1em; }
+/* a; b { */ h1 { content: "}"; }
+#ch02-note { color: red; }
+@media print { p { color: black; } }
+`
+	want := `#ch01-note { color: red; }
+@charset "UTF-8";
+p { text-indent: 1em; }
+/* a; b { */ h1 { content: "}"; }
+#ch02-note { color: red; }
+@media print { p { color: black; } }
+`
+	if got := string(dedupeCSSStatements([]byte(css))); got != want {
+		t.Errorf("dedupeCSSStatements() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUnpack_InvalidInput(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "broken.azw3")
+	if err := os.WriteFile(input, []byte("not a mobi file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Unpack(UnpackOptions{InputPath: input, OutputPath: filepath.Join(dir, "out.epub")}); err == nil {
+		t.Error("Unpack() error = nil for an invalid file")
+	}
+}
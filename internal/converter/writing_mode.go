@@ -0,0 +1,218 @@
+package converter
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Writing modes written as EXTH 525 (primary writing mode).
+const (
+	WritingModeHorizontalLR = "horizontal-lr"
+	WritingModeHorizontalRL = "horizontal-rl"
+	WritingModeVerticalRL   = "vertical-rl"
+	WritingModeVerticalLR   = "vertical-lr"
+)
+
+// WritingModes lists the writing modes accepted by ConvertOptions.WritingMode.
+var WritingModes = []string{WritingModeHorizontalLR, WritingModeHorizontalRL, WritingModeVerticalRL, WritingModeVerticalLR}
+
+// cssCommentRe matches CSS comments.
+var cssCommentRe = regexp.MustCompile(`(?s)/\*.*?\*/`)
+
+// cssRuleRe matches an innermost CSS rule: a selector list and its declaration block.
+var cssRuleRe = regexp.MustCompile(`([^{}]*)\{([^{}]*)\}`)
+
+// cssWritingModeRe matches writing-mode declarations, including the
+// -epub- and -webkit- prefixed forms used by Japanese EPUBs.
+var cssWritingModeRe = regexp.MustCompile(`(?i)(?:^|[;\s])(?:-epub-|-webkit-)?writing-mode\s*:\s*([a-z-]+)`)
+
+// DetectWritingMode derives the primary writing mode of a book from the CSS
+// writing-mode applied to the chapter roots (html/body selectors, or classes
+// of the body and html elements), and from their dir attribute. Each chapter
+// votes for one mode and the most common one wins. When no chapter gives a
+// hint, a right-to-left page progression implies vertical-rl for CJK
+// languages (from the chapter lang attributes, else language) and
+// horizontal-rl otherwise. The default is horizontal-lr.
+func DetectWritingMode(ppd, css string, chapters []*ChapterContent, language string) string {
+	rules := parseWritingModeRules(css)
+
+	votes := make(map[string]int)
+	var order []string
+	chapterLang := ""
+	for _, chapter := range chapters {
+		if chapterLang == "" {
+			chapterLang = chapterLanguage(chapter)
+		}
+		mode := chapterWritingMode(chapter, rules)
+		if mode == "" {
+			continue
+		}
+		if votes[mode] == 0 {
+			order = append(order, mode)
+		}
+		votes[mode]++
+	}
+
+	best := ""
+	for _, mode := range order {
+		if best == "" || votes[mode] > votes[best] {
+			best = mode
+		}
+	}
+	if best != "" {
+		return best
+	}
+
+	if ppd == "rtl" {
+		if chapterLang != "" {
+			language = chapterLang
+		}
+		if isCJKLanguage(language) {
+			return WritingModeVerticalRL
+		}
+		return WritingModeHorizontalRL
+	}
+	return WritingModeHorizontalLR
+}
+
+// PageProgressionForWritingMode returns the page progression direction
+// implied by a writing mode: "rtl" for vertical-rl and horizontal-rl,
+// "ltr" otherwise.
+func PageProgressionForWritingMode(mode string) string {
+	if strings.HasSuffix(mode, "-rl") {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// writingModeRule is a CSS rule setting writing-mode.
+type writingModeRule struct {
+	selectors []string
+	mode      string // CSS value, normalized (e.g. "vertical-rl", "horizontal-tb")
+}
+
+// parseWritingModeRules returns the rules of css that set writing-mode, in
+// source order.
+func parseWritingModeRules(css string) []writingModeRule {
+	css = cssCommentRe.ReplaceAllString(css, "")
+	var rules []writingModeRule
+	for _, m := range cssRuleRe.FindAllStringSubmatch(css, -1) {
+		decls := cssWritingModeRe.FindAllStringSubmatch(m[2], -1)
+		if len(decls) == 0 {
+			continue
+		}
+		mode := normalizeCSSWritingMode(decls[len(decls)-1][1])
+		if mode == "" {
+			continue
+		}
+		var selectors []string
+		for _, sel := range strings.Split(m[1], ",") {
+			if sel = strings.TrimSpace(sel); sel != "" {
+				selectors = append(selectors, sel)
+			}
+		}
+		rules = append(rules, writingModeRule{selectors: selectors, mode: mode})
+	}
+	return rules
+}
+
+// normalizeCSSWritingMode maps CSS writing-mode values, including the
+// SVG 1.1 values (tb-rl, lr-tb, ...), to the CSS3 values.
+func normalizeCSSWritingMode(value string) string {
+	switch strings.ToLower(value) {
+	case "vertical-rl", "tb-rl", "tb":
+		return "vertical-rl"
+	case "vertical-lr", "tb-lr":
+		return "vertical-lr"
+	case "horizontal-tb", "lr-tb", "lr", "rl-tb", "rl":
+		return "horizontal-tb"
+	}
+	return ""
+}
+
+// chapterWritingMode returns the writing mode of a chapter, or "" when the
+// chapter gives no hint.
+func chapterWritingMode(chapter *ChapterContent, rules []writingModeRule) string {
+	classes := make(map[string]bool)
+	for _, class := range strings.Fields(chapter.BodyAttrs["class"]) {
+		classes[class] = true
+	}
+
+	cssMode := ""
+	for _, rule := range rules {
+		for _, sel := range rule.selectors {
+			if selectsChapterRoot(sel, classes) {
+				cssMode = rule.mode
+				break
+			}
+		}
+	}
+
+	rtl := strings.EqualFold(strings.TrimSpace(chapter.BodyAttrs["dir"]), "rtl")
+	switch cssMode {
+	case "vertical-rl":
+		return WritingModeVerticalRL
+	case "vertical-lr":
+		return WritingModeVerticalLR
+	case "horizontal-tb":
+		if rtl {
+			return WritingModeHorizontalRL
+		}
+		return WritingModeHorizontalLR
+	}
+	if rtl {
+		return WritingModeHorizontalRL
+	}
+	return ""
+}
+
+// selectsChapterRoot reports whether a CSS selector targets the html or body
+// element of a chapter, either by element name or by the classes in classes.
+// Only the last compound selector is considered; selectors with IDs,
+// attributes or pseudo-classes are not matched.
+func selectsChapterRoot(selector string, classes map[string]bool) bool {
+	fields := strings.FieldsFunc(selector, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '>' || r == '+' || r == '~'
+	})
+	if len(fields) == 0 {
+		return false
+	}
+	compound := fields[len(fields)-1]
+	if strings.ContainsAny(compound, "#[:") {
+		return false
+	}
+
+	parts := strings.Split(compound, ".")
+	element := strings.ToLower(parts[0])
+	if element != "" && element != "html" && element != "body" {
+		return false
+	}
+	if element == "" && len(parts) == 1 {
+		return false
+	}
+	for _, class := range parts[1:] {
+		if !classes[class] {
+			return false
+		}
+	}
+	return true
+}
+
+// chapterLanguage returns the lang or xml:lang attribute of a chapter.
+func chapterLanguage(chapter *ChapterContent) string {
+	if lang := strings.TrimSpace(chapter.BodyAttrs["xml:lang"]); lang != "" {
+		return lang
+	}
+	return strings.TrimSpace(chapter.BodyAttrs["lang"])
+}
+
+// isCJKLanguage reports whether a BCP 47 language tag is Chinese, Japanese
+// or Korean.
+func isCJKLanguage(tag string) bool {
+	primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	switch primary {
+	case "ja", "zh", "ko":
+		return true
+	}
+	return false
+}
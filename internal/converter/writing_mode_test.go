@@ -0,0 +1,96 @@
+package converter
+
+import "testing"
+
+func TestDetectWritingMode(t *testing.T) {
+	chapter := func(attrs map[string]string) *ChapterContent {
+		return &ChapterContent{BodyAttrs: attrs}
+	}
+	tests := []struct {
+		name     string
+		ppd      string
+		css      string
+		chapters []*ChapterContent
+		language string
+		want     string
+	}{
+		{
+			name:     "no hints",
+			chapters: []*ChapterContent{chapter(nil)},
+			language: "en",
+			want:     WritingModeHorizontalLR,
+		},
+		{
+			name:     "AozoraEpub3 vertical class",
+			ppd:      "rtl",
+			css:      `.vrtl { -epub-writing-mode: vertical-rl; -webkit-writing-mode: vertical-rl; } .hltr { -epub-writing-mode: horizontal-tb; }`,
+			chapters: []*ChapterContent{chapter(map[string]string{"class": "vrtl"}), chapter(map[string]string{"class": "vrtl"}), chapter(map[string]string{"class": "hltr"})},
+			language: "ja",
+			want:     WritingModeVerticalRL,
+		},
+		{
+			name:     "html selector",
+			css:      `/* vertical */ html { writing-mode: tb-rl; }`,
+			chapters: []*ChapterContent{chapter(nil)},
+			want:     WritingModeVerticalRL,
+		},
+		{
+			name:     "descendant selector is not a root",
+			css:      `body p.note { writing-mode: vertical-rl; }`,
+			chapters: []*ChapterContent{chapter(nil)},
+			want:     WritingModeHorizontalLR,
+		},
+		{
+			name:     "class not on the body",
+			css:      `.vrtl { writing-mode: vertical-rl; }`,
+			chapters: []*ChapterContent{chapter(map[string]string{"class": "main"})},
+			want:     WritingModeHorizontalLR,
+		},
+		{
+			name:     "later rule wins",
+			css:      `body { writing-mode: vertical-rl; } body.main { writing-mode: horizontal-tb; }`,
+			chapters: []*ChapterContent{chapter(map[string]string{"class": "main"})},
+			want:     WritingModeHorizontalLR,
+		},
+		{
+			name:     "dir rtl",
+			chapters: []*ChapterContent{chapter(map[string]string{"dir": "rtl", "lang": "ar"})},
+			want:     WritingModeHorizontalRL,
+		},
+		{
+			name:     "rtl spine with Japanese language",
+			ppd:      "rtl",
+			chapters: []*ChapterContent{chapter(nil)},
+			language: "ja",
+			want:     WritingModeVerticalRL,
+		},
+		{
+			name:     "rtl spine with body lang",
+			ppd:      "rtl",
+			chapters: []*ChapterContent{chapter(map[string]string{"xml:lang": "he"})},
+			language: "ja",
+			want:     WritingModeHorizontalRL,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectWritingMode(tt.ppd, tt.css, tt.chapters, tt.language); got != tt.want {
+				t.Errorf("DetectWritingMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPageProgressionForWritingMode(t *testing.T) {
+	tests := map[string]string{
+		WritingModeHorizontalLR: "ltr",
+		WritingModeHorizontalRL: "rtl",
+		WritingModeVerticalRL:   "rtl",
+		WritingModeVerticalLR:   "ltr",
+	}
+	for mode, want := range tests {
+		if got := PageProgressionForWritingMode(mode); got != want {
+			t.Errorf("PageProgressionForWritingMode(%q) = %q, want %q", mode, got, want)
+		}
+	}
+}
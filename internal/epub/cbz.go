@@ -0,0 +1,297 @@
+package epub
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/xml"
+	"fmt"
+	"image"
+	_ "image/gif"  // register GIF for image.DecodeConfig
+	_ "image/jpeg" // register JPEG for image.DecodeConfig
+	_ "image/png"  // register PNG for image.DecodeConfig
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cbzOPFPath is the path of the OPF synthesized for a CBZ archive.
+const cbzOPFPath = "content.opf"
+
+// cbzMediaTypes maps the extensions of the page images of a CBZ archive to
+// their media types.
+var cbzMediaTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+}
+
+// comicInfo is the ComicInfo.xml metadata of a CBZ archive (the ComicRack
+// schema). Only the fields used for the OPF are read.
+type comicInfo struct {
+	Title       string `xml:"Title"`
+	Series      string `xml:"Series"`
+	Number      string `xml:"Number"`
+	Summary     string `xml:"Summary"`
+	Year        int    `xml:"Year"`
+	Month       int    `xml:"Month"`
+	Day         int    `xml:"Day"`
+	Writer      string `xml:"Writer"`
+	Publisher   string `xml:"Publisher"`
+	Genre       string `xml:"Genre"`
+	LanguageISO string `xml:"LanguageISO"`
+	Manga       string `xml:"Manga"` // "Yes", "No", "YesAndRightToLeft" or "Unknown"
+}
+
+// OpenCBZ opens a CBZ archive (a ZIP of page images) as a fixed-layout comic
+// EPUB. The images, in natural order of their paths, become the pages: each
+// one gets an XHTML page with the image size as its viewport, and the first
+// one is the cover. The OPF is synthesized from ComicInfo.xml when the
+// archive has one, or else from the file name. Files of the archive are
+// renamed to images/imgNNNN.<ext>, so that names in any encoding can be
+// referenced from the OPF.
+func OpenCBZ(filename string) (*EPUBReader, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CBZ: %w", err)
+	}
+
+	reader := &EPUBReader{
+		zipReader: zr,
+		files:     make(map[string]*zip.File),
+		opfPath:   cbzOPFPath,
+	}
+
+	var pages []*zip.File
+	var info *comicInfo
+	for _, f := range zr.File {
+		name := normalizePath(f.Name)
+		reader.files[name] = f
+		base := path.Base(name)
+		if f.FileInfo().IsDir() || strings.HasPrefix(base, ".") || strings.HasPrefix(name, "__MACOSX/") {
+			continue
+		}
+		if strings.EqualFold(base, "ComicInfo.xml") {
+			if info, err = readComicInfo(f); err != nil {
+				zr.Close()
+				return nil, err
+			}
+			continue
+		}
+		if _, ok := cbzMediaTypes[strings.ToLower(path.Ext(name))]; ok {
+			pages = append(pages, f)
+		}
+	}
+	if len(pages) == 0 {
+		zr.Close()
+		return nil, fmt.Errorf("no page images found in CBZ")
+	}
+	slices.SortFunc(pages, func(a, b *zip.File) int { return naturalCompare(a.Name, b.Name) })
+
+	opf := &OPF{
+		Metadata:  cbzMetadata(info, filename, pages),
+		Manifest:  make(map[string]ManifestItem),
+		Rendition: Rendition{Layout: "pre-paginated", BookType: "comic"},
+	}
+	if info != nil && strings.EqualFold(strings.TrimSpace(info.Manga), "YesAndRightToLeft") {
+		opf.PageProgressionDirection = "rtl"
+	}
+
+	for i, f := range pages {
+		ext := strings.ToLower(path.Ext(f.Name))
+		imageItem := ManifestItem{
+			ID:        fmt.Sprintf("img%04d", i+1),
+			Href:      fmt.Sprintf("images/img%04d%s", i+1, ext),
+			MediaType: cbzMediaTypes[ext],
+		}
+		pageItem := ManifestItem{
+			ID:        fmt.Sprintf("page%04d", i+1),
+			Href:      fmt.Sprintf("pages/page%04d.xhtml", i+1),
+			MediaType: "application/xhtml+xml",
+		}
+		if i == 0 {
+			imageItem.Properties = []string{"cover-image"}
+			opf.Metadata.CoverID = imageItem.ID
+		}
+		size, err := imageSize(f)
+		if err != nil {
+			zr.Close()
+			return nil, fmt.Errorf("failed to read page image %s: %w", f.Name, err)
+		}
+
+		reader.files[imageItem.Href] = f
+		reader.AddFile(pageItem.Href, cbzPage(i+1, relativePath(path.Dir(pageItem.Href), imageItem.Href), size))
+		for _, item := range []ManifestItem{pageItem, imageItem} {
+			opf.Manifest[item.ID] = item
+			opf.ManifestOrder = append(opf.ManifestOrder, item.ID)
+		}
+		opf.Spine = append(opf.Spine, SpineItem{IDRef: pageItem.ID, Linear: true})
+	}
+
+	var modified time.Time
+	for _, f := range pages {
+		if f.Modified.After(modified) {
+			modified = f.Modified
+		}
+	}
+	data, err := MarshalOPF(opf, "", modified)
+	if err != nil {
+		zr.Close()
+		return nil, fmt.Errorf("failed to synthesize OPF: %w", err)
+	}
+	reader.AddFile(cbzOPFPath, data)
+	return reader, nil
+}
+
+// readComicInfo parses a ComicInfo.xml entry.
+func readComicInfo(f *zip.File) (*comicInfo, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ComicInfo.xml: %w", err)
+	}
+	defer rc.Close()
+
+	var info comicInfo
+	if err := xml.NewDecoder(rc).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to parse ComicInfo.xml: %w", err)
+	}
+	return &info, nil
+}
+
+// cbzMetadata builds the metadata of a CBZ archive. The title is
+// "<series> <number>: <title>" from ComicInfo.xml, with the parts that are
+// missing left out, or else the file name. The identifier is derived from the
+// names and checksums of the pages, so converting the same archive twice
+// gives the same identifier.
+func cbzMetadata(info *comicInfo, filename string, pages []*zip.File) Metadata {
+	if info == nil {
+		info = &comicInfo{}
+	}
+	md := Metadata{
+		Title:       strings.TrimSpace(info.Title),
+		Language:    strings.TrimSpace(info.LanguageISO),
+		Publisher:   strings.TrimSpace(info.Publisher),
+		Description: strings.TrimSpace(info.Summary),
+	}
+
+	series := strings.TrimSpace(info.Series)
+	if number := strings.TrimSpace(info.Number); series != "" && number != "" {
+		series += " " + number
+	}
+	switch {
+	case series != "" && md.Title != "":
+		md.Title = series + ": " + md.Title
+	case series != "":
+		md.Title = series
+	case md.Title == "":
+		base := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+		md.Title = strings.TrimSuffix(base, path.Ext(base))
+	}
+	if md.Language == "" {
+		md.Language = "und"
+	}
+
+	for _, name := range strings.Split(info.Writer, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			md.Creators = append(md.Creators, Creator{Name: name, Role: "aut"})
+		}
+	}
+	for _, genre := range strings.Split(info.Genre, ",") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			md.Subjects = append(md.Subjects, genre)
+		}
+	}
+	if info.Year > 0 {
+		md.Date = strconv.Itoa(info.Year)
+		if info.Month >= 1 && info.Month <= 12 {
+			md.Date += fmt.Sprintf("-%02d", info.Month)
+			if info.Day >= 1 && info.Day <= 31 {
+				md.Date += fmt.Sprintf("-%02d", info.Day)
+			}
+		}
+	}
+
+	h := sha1.New()
+	for _, f := range pages {
+		fmt.Fprintf(h, "%s\x00%08x\x00", f.Name, f.CRC32)
+	}
+	sum := h.Sum(nil)
+	sum[6] = sum[6]&0x0f | 0x50 // version 5
+	sum[8] = sum[8]&0x3f | 0x80 // RFC 4122 variant
+	md.Identifier = fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+	return md
+}
+
+// imageSize returns the pixel size of an image entry, decoding only its header.
+func imageSize(f *zip.File) (image.Point, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return image.Point{}, err
+	}
+	defer rc.Close()
+
+	cfg, _, err := image.DecodeConfig(rc)
+	if err != nil {
+		return image.Point{}, err
+	}
+	return image.Pt(cfg.Width, cfg.Height), nil
+}
+
+// cbzPage returns the XHTML page of a page image: the image fills a page of
+// its own size.
+func cbzPage(n int, src string, size image.Point) []byte {
+	return fmt.Appendf(nil, `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>%d</title><meta name="viewport" content="width=%d, height=%d"/></head>
+<body><div style="position:absolute;left:0;top:0;width:100%%;height:100%%;"><img src="%s" alt="" style="width:100%%;height:100%%;"/></div></body>
+</html>
+`, n, size.X, size.Y, escapeXML(src))
+}
+
+// naturalCompare compares two paths in natural order: runs of digits compare
+// by their numeric value, so "page2" sorts before "page10". Letters compare
+// case-insensitively.
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, nb := leadingDigits(a), leadingDigits(b)
+			ta, tb := strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(ta) != len(tb) {
+				return len(ta) - len(tb)
+			}
+			if c := strings.Compare(ta, tb); c != 0 {
+				return c
+			}
+			a, b = a[len(na):], b[len(nb):]
+			continue
+		}
+		ca, cb := toLowerASCII(a[0]), toLowerASCII(b[0])
+		if ca != cb {
+			return int(ca) - int(cb)
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) - len(b)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// leadingDigits returns the run of digits at the start of s.
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i]
+}
+
+func toLowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
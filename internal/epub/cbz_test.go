@@ -0,0 +1,167 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// createTestCBZ writes a CBZ archive with the given files. Files named *.png
+// with empty data get a PNG page of 300x400 pixels.
+func createTestCBZ(t *testing.T, dir, name string, files [][2]string) string {
+	t.Helper()
+	var page bytes.Buffer
+	if err := png.Encode(&page, image.NewGray(image.Rect(0, 0, 300, 400))); err != nil {
+		t.Fatal(err)
+	}
+
+	cbzPath := filepath.Join(dir, name)
+	f, err := os.Create(cbzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, file := range files {
+		w, err := zw.Create(file[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := []byte(file[1])
+		if len(data) == 0 && strings.HasSuffix(file[0], ".png") {
+			data = page.Bytes()
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return cbzPath
+}
+
+func TestOpenCBZ(t *testing.T) {
+	cbzPath := createTestCBZ(t, t.TempDir(), "volume.cbz", [][2]string{
+		{"vol/page10.png", ""},
+		{"vol/Page2.png", ""},
+		{"vol/page1.png", ""},
+		{"vol/notes.txt", "not a page"},
+		{"__MACOSX/vol/._page1.png", "resource fork"},
+		{"ComicInfo.xml", `<?xml version="1.0"?>
+<ComicInfo xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <Title>The Beginning</Title>
+  <Series>Space &amp; Time</Series>
+  <Number>3</Number>
+  <Writer>Alice, Bob</Writer>
+  <Genre>SF, Adventure</Genre>
+  <Year>2024</Year>
+  <Month>5</Month>
+  <LanguageISO>ja</LanguageISO>
+  <Manga>YesAndRightToLeft</Manga>
+</ComicInfo>`},
+	})
+
+	reader, err := OpenCBZ(cbzPath)
+	if err != nil {
+		t.Fatalf("OpenCBZ() error = %v", err)
+	}
+	defer reader.Close()
+
+	opfData, err := reader.ReadFile(reader.OPFPath())
+	if err != nil {
+		t.Fatalf("ReadFile(OPF) error = %v", err)
+	}
+	opf, err := ParseOPF(opfData, filepath.Dir(reader.OPFPath()))
+	if err != nil {
+		t.Fatalf("ParseOPF() error = %v", err)
+	}
+
+	md := opf.Metadata
+	if md.Title != "Space & Time 3: The Beginning" {
+		t.Errorf("Title = %q", md.Title)
+	}
+	if len(md.Creators) != 2 || md.Creators[0].Name != "Alice" || md.Creators[1].Name != "Bob" {
+		t.Errorf("Creators = %+v, want Alice and Bob", md.Creators)
+	}
+	if md.Language != "ja" || md.Date != "2024-05" || !reflect.DeepEqual(md.Subjects, []string{"SF", "Adventure"}) {
+		t.Errorf("Language, Date, Subjects = %q, %q, %q", md.Language, md.Date, md.Subjects)
+	}
+	if !strings.HasPrefix(md.Identifier, "urn:uuid:") {
+		t.Errorf("Identifier = %q, want a urn:uuid", md.Identifier)
+	}
+	if opf.PageProgressionDirection != "rtl" || !opf.FixedLayout() || opf.Rendition.BookType != "comic" {
+		t.Errorf("PageProgressionDirection, Rendition = %q, %+v", opf.PageProgressionDirection, opf.Rendition)
+	}
+	if cover, ok := opf.FindCoverImage(); !ok || cover != "images/img0001.png" {
+		t.Errorf("FindCoverImage() = %q, %v", cover, ok)
+	}
+
+	if len(opf.Spine) != 3 {
+		t.Fatalf("spine has %d items, want 3", len(opf.Spine))
+	}
+	// Natural order: page1, Page2, page10.
+	for i, want := range []string{"vol/page1.png", "vol/Page2.png", "vol/page10.png"} {
+		page := opf.Manifest[opf.Spine[i].IDRef]
+		xhtml, err := reader.ReadFile(page.Href)
+		if err != nil {
+			t.Fatalf("ReadFile(%q) error = %v", page.Href, err)
+		}
+		if !bytes.Contains(xhtml, []byte(`<meta name="viewport" content="width=300, height=400"/>`)) {
+			t.Errorf("%s has no viewport: %s", page.Href, xhtml)
+		}
+		content, err := LoadContent(page.ID, page.Href, xhtml)
+		if err != nil {
+			t.Fatalf("LoadContent(%q) error = %v", page.Href, err)
+		}
+		src := content.ImageRefs[0]
+		if reader.files[src] != reader.files[want] {
+			t.Errorf("page %d shows %s, want %s", i+1, src, want)
+		}
+	}
+}
+
+func TestOpenCBZ_WithoutComicInfo(t *testing.T) {
+	cbzPath := createTestCBZ(t, t.TempDir(), "My Comic.cbz", [][2]string{{"001.png", ""}})
+
+	reader, err := OpenCBZ(cbzPath)
+	if err != nil {
+		t.Fatalf("OpenCBZ() error = %v", err)
+	}
+	defer reader.Close()
+	opfData, err := reader.ReadFile(reader.OPFPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opf, err := ParseOPF(opfData, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opf.Metadata.Title != "My Comic" || opf.Metadata.Language != "und" || opf.PageProgressionDirection != "" {
+		t.Errorf("Title, Language, PageProgressionDirection = %q, %q, %q", opf.Metadata.Title, opf.Metadata.Language, opf.PageProgressionDirection)
+	}
+}
+
+func TestOpenCBZ_NoImages(t *testing.T) {
+	cbzPath := createTestCBZ(t, t.TempDir(), "empty.cbz", [][2]string{{"readme.txt", "no pages"}})
+	if _, err := OpenCBZ(cbzPath); err == nil {
+		t.Fatal("OpenCBZ() should fail without page images")
+	}
+}
+
+func TestNaturalCompare(t *testing.T) {
+	names := []string{"p10.jpg", "P2.jpg", "p1.jpg", "p01b.jpg", "a/p3.jpg", "p001.jpg"}
+	sorted := slices.Clone(names)
+	slices.SortStableFunc(sorted, naturalCompare)
+	want := []string{"a/p3.jpg", "p1.jpg", "p001.jpg", "p01b.jpg", "P2.jpg", "p10.jpg"}
+	if !reflect.DeepEqual(sorted, want) {
+		t.Errorf("natural order = %q, want %q", sorted, want)
+	}
+}
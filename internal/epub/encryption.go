@@ -0,0 +1,218 @@
+package epub
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Font obfuscation algorithms listed in META-INF/encryption.xml.
+const (
+	// AlgorithmIDPFFont is the IDPF font obfuscation: the first 1040 bytes are
+	// XORed with the SHA-1 of the unique identifier.
+	AlgorithmIDPFFont = "http://www.idpf.org/2008/embedding"
+	// AlgorithmAdobeFont is the Adobe font obfuscation: the first 1024 bytes
+	// are XORed with the 16 bytes of the book's UUID.
+	AlgorithmAdobeFont = "http://ns.adobe.com/pdf/enc#RC"
+)
+
+const (
+	idpfObfuscatedLength  = 1040
+	adobeObfuscatedLength = 1024
+)
+
+// encryptionPath is the location of the encryption document in the container.
+const encryptionPath = "META-INF/encryption.xml"
+
+// encryptionDocument represents META-INF/encryption.xml
+type encryptionDocument struct {
+	EncryptedData []struct {
+		EncryptionMethod struct {
+			Algorithm string `xml:"Algorithm,attr"`
+		} `xml:"EncryptionMethod"`
+		CipherData struct {
+			CipherReference struct {
+				URI string `xml:"URI,attr"`
+			} `xml:"CipherReference"`
+		} `xml:"CipherData"`
+	} `xml:"EncryptedData"`
+}
+
+// parseEncryption reads META-INF/encryption.xml, if present, and records which
+// resources are obfuscated fonts and which are encrypted. The key of an
+// obfuscated font is derived from the book identifier, so the OPF is read when
+// there is at least one.
+func (r *EPUBReader) parseEncryption() error {
+	if _, ok := r.files[encryptionPath]; !ok {
+		return nil
+	}
+	content, err := r.ReadFile(encryptionPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", encryptionPath, err)
+	}
+
+	var doc encryptionDocument
+	if err := xml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", encryptionPath, err)
+	}
+
+	r.obfuscated = make(map[string]string)
+	r.encrypted = make(map[string]string)
+	for _, data := range doc.EncryptedData {
+		uri := data.CipherData.CipherReference.URI
+		if uri == "" {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(uri); err == nil {
+			uri = unescaped
+		}
+		path := normalizePath(strings.TrimPrefix(uri, "/"))
+		switch algorithm := strings.TrimSpace(data.EncryptionMethod.Algorithm); algorithm {
+		case AlgorithmIDPFFont, AlgorithmAdobeFont:
+			r.obfuscated[path] = algorithm
+		default:
+			r.encrypted[path] = algorithm
+		}
+	}
+
+	if len(r.obfuscated) == 0 {
+		return nil
+	}
+	opfData, err := r.ReadFile(r.opfPath)
+	if err != nil {
+		return fmt.Errorf("failed to read OPF for font deobfuscation: %w", err)
+	}
+	r.identifiers, err = obfuscationIdentifiers(opfData)
+	if err != nil {
+		return fmt.Errorf("failed to parse OPF for font deobfuscation: %w", err)
+	}
+	return nil
+}
+
+// EncryptedFiles returns the paths of the resources that encryption.xml lists
+// as encrypted with an algorithm other than font obfuscation, i.e. DRM.
+// ReadFile fails with ErrEncrypted for these resources.
+func (r *EPUBReader) EncryptedFiles() []string {
+	paths := make([]string, 0, len(r.encrypted))
+	for path := range r.encrypted {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// obfuscationIdentifiers returns the identifiers that may have been used as
+// the obfuscation key, in order of preference: Metadata.Identifier, the
+// package's unique identifier, then the other dc:identifier values. The
+// specifications use the unique identifier, but Metadata.Identifier prefers
+// an ISBN, which is what some tools use instead.
+func obfuscationIdentifiers(opfData []byte) ([]string, error) {
+	opf, err := ParseOPF(opfData, "")
+	if err != nil {
+		return nil, err
+	}
+	var pkg opfPackage
+	if err := xml.Unmarshal(opfData, &pkg); err != nil {
+		return nil, err
+	}
+
+	ids := []string{opf.Metadata.Identifier}
+	for _, id := range pkg.Metadata.Identifier {
+		if strings.TrimSpace(id.ID) == strings.TrimSpace(pkg.UniqueID) {
+			ids = append(ids, id.Value)
+		}
+	}
+	for _, id := range pkg.Metadata.Identifier {
+		ids = append(ids, id.Value)
+	}
+
+	var out []string
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id != "" && !slices.Contains(out, id) {
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+// deobfuscate undoes the font obfuscation algorithm of data. The key is
+// derived from the first identifier that yields a font signature, falling back
+// to the first identifier.
+func (r *EPUBReader) deobfuscate(data []byte, algorithm string) []byte {
+	var first []byte
+	for _, id := range r.identifiers {
+		var out []byte
+		switch algorithm {
+		case AlgorithmIDPFFont:
+			out = xorPrefix(data, idpfKey(id), idpfObfuscatedLength)
+		case AlgorithmAdobeFont:
+			key, ok := adobeKey(id)
+			if !ok {
+				continue
+			}
+			out = xorPrefix(data, key, adobeObfuscatedLength)
+		}
+		if hasFontSignature(out) {
+			return out
+		}
+		if first == nil {
+			first = out
+		}
+	}
+	if first == nil {
+		return data
+	}
+	return first
+}
+
+// idpfKey returns the IDPF obfuscation key: the SHA-1 of the identifier with
+// all whitespace removed.
+func idpfKey(identifier string) []byte {
+	stripped := strings.Map(func(c rune) rune {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return c
+	}, identifier)
+	sum := sha1.Sum([]byte(stripped))
+	return sum[:]
+}
+
+// adobeKey returns the Adobe obfuscation key: the 16 bytes of a UUID
+// identifier such as "urn:uuid:xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx".
+func adobeKey(identifier string) ([]byte, bool) {
+	s := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(identifier)), "urn:uuid:")
+	s = strings.NewReplacer("-", "", ":", "").Replace(s)
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != 16 {
+		return nil, false
+	}
+	return key, true
+}
+
+// xorPrefix returns a copy of data with its first n bytes XORed with key.
+func xorPrefix(data, key []byte, n int) []byte {
+	out := bytes.Clone(data)
+	for i := 0; i < n && i < len(out); i++ {
+		out[i] ^= key[i%len(key)]
+	}
+	return out
+}
+
+// hasFontSignature reports whether data starts with a TrueType, OpenType,
+// font collection or WOFF signature.
+func hasFontSignature(data []byte) bool {
+	for _, sig := range [][]byte{{0x00, 0x01, 0x00, 0x00}, []byte("OTTO"), []byte("true"), []byte("ttcf"), []byte("wOFF"), []byte("wOF2")} {
+		if bytes.HasPrefix(data, sig) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package epub
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const encryptionTestOPF = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Obfuscated</dc:title>
+    <dc:language>en</dc:language>
+    <dc:identifier id="uid">urn:uuid:12345678-9abc-def0-1234-56789abcdef0</dc:identifier>
+    <dc:identifier id="isbn">9784000000002</dc:identifier>
+  </metadata>
+  <manifest>
+    <item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="ch1"/></spine>
+</package>`
+
+// testFont returns a fake TrueType font of size bytes.
+func testFont(size int) []byte {
+	font := make([]byte, size)
+	for i := range font {
+		font[i] = byte(i*7 + i/256)
+	}
+	copy(font, []byte{0x00, 0x01, 0x00, 0x00})
+	return font
+}
+
+// createEncryptionTestEPUB writes an EPUB with the given encryption.xml and
+// additional files.
+func createEncryptionTestEPUB(t *testing.T, encryption string, files map[string][]byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "encrypted.epub")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := NewWriter(f, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files["OEBPS/content.opf"] = []byte(encryptionTestOPF)
+	files["META-INF/encryption.xml"] = []byte(encryption)
+	for name, data := range files {
+		if err := w.AddFile(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEPUBReader_ReadFile_DeobfuscatesFonts(t *testing.T) {
+	font := testFont(4096)
+	uuidKey, _ := adobeKey("urn:uuid:12345678-9abc-def0-1234-56789abcdef0")
+	encryption := `<?xml version="1.0" encoding="UTF-8"?>
+<encryption xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:enc="http://www.w3.org/2001/04/xmlenc#">
+  <enc:EncryptedData>
+    <enc:EncryptionMethod Algorithm="http://www.idpf.org/2008/embedding"/>
+    <enc:CipherData><enc:CipherReference URI="OEBPS/fonts/idpf.ttf"/></enc:CipherData>
+  </enc:EncryptedData>
+  <enc:EncryptedData>
+    <enc:EncryptionMethod Algorithm="http://www.idpf.org/2008/embedding"/>
+    <enc:CipherData><enc:CipherReference URI="OEBPS/fonts/isbn%20key.ttf"/></enc:CipherData>
+  </enc:EncryptedData>
+  <enc:EncryptedData>
+    <enc:EncryptionMethod Algorithm="http://ns.adobe.com/pdf/enc#RC"/>
+    <enc:CipherData><enc:CipherReference URI="OEBPS/fonts/adobe.otf"/></enc:CipherData>
+  </enc:EncryptedData>
+</encryption>`
+
+	path := createEncryptionTestEPUB(t, encryption, map[string][]byte{
+		// The specification derives the key from the unique identifier...
+		"OEBPS/fonts/idpf.ttf": xorPrefix(font, idpfKey(" urn:uuid:12345678-9abc-def0-1234-56789abcdef0\n"), idpfObfuscatedLength),
+		// ...while some tools use the ISBN chosen as Metadata.Identifier.
+		"OEBPS/fonts/isbn key.ttf": xorPrefix(font, idpfKey("9784000000002"), idpfObfuscatedLength),
+		"OEBPS/fonts/adobe.otf":    xorPrefix(font, uuidKey, adobeObfuscatedLength),
+		"OEBPS/fonts/plain.ttf":    font,
+	})
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer r.Close()
+
+	for _, name := range []string{"OEBPS/fonts/idpf.ttf", "OEBPS/fonts/isbn key.ttf", "OEBPS/fonts/adobe.otf", "OEBPS/fonts/plain.ttf"} {
+		data, err := r.ReadFile(name)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", name, err)
+		}
+		if !bytes.Equal(data, font) {
+			t.Errorf("ReadFile(%s) did not return the deobfuscated font", name)
+		}
+	}
+	if files := r.EncryptedFiles(); len(files) != 0 {
+		t.Errorf("EncryptedFiles() = %v, want none", files)
+	}
+}
+
+func TestEPUBReader_ReadFile_Encrypted(t *testing.T) {
+	encryption := `<?xml version="1.0" encoding="UTF-8"?>
+<encryption xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:enc="http://www.w3.org/2001/04/xmlenc#">
+  <enc:EncryptedData>
+    <enc:EncryptionMethod Algorithm="http://www.w3.org/2001/04/xmlenc#aes128-cbc"/>
+    <enc:CipherData><enc:CipherReference URI="OEBPS/ch1.xhtml"/></enc:CipherData>
+  </enc:EncryptedData>
+</encryption>`
+	path := createEncryptionTestEPUB(t, encryption, map[string][]byte{
+		"OEBPS/ch1.xhtml": {0x12, 0x34},
+	})
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer r.Close()
+
+	if got := r.EncryptedFiles(); !reflect.DeepEqual(got, []string{"OEBPS/ch1.xhtml"}) {
+		t.Errorf("EncryptedFiles() = %v", got)
+	}
+	if _, err := r.ReadFile("OEBPS/ch1.xhtml"); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("ReadFile() error = %v, want ErrEncrypted", err)
+	}
+}
+
+func TestOpen_InvalidEncryptionXML(t *testing.T) {
+	path := createEncryptionTestEPUB(t, "<encryption", map[string][]byte{})
+	if r, err := Open(path); err == nil {
+		r.Close()
+		t.Error("Open() error = nil, want error for malformed encryption.xml")
+	}
+}
+
+func TestAdobeKey(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"urn:uuid:12345678-9abc-def0-1234-56789abcdef0", true},
+		{"12345678-9ABC-DEF0-1234-56789ABCDEF0", true},
+		{"9784000000002", false},
+		{"urn:uuid:1234", false},
+	}
+	for _, tt := range tests {
+		if _, ok := adobeKey(tt.id); ok != tt.want {
+			t.Errorf("adobeKey(%q) ok = %v, want %v", tt.id, ok, tt.want)
+		}
+	}
+}
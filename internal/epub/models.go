@@ -1,5 +1,7 @@
 package epub
 
+import "slices"
+
 // OPF represents the parsed Open Package Format document
 type OPF struct {
 	Metadata                 Metadata
@@ -9,6 +11,35 @@ type OPF struct {
 	Spine                    []SpineItem
 	NCXPath                  string
 	PageProgressionDirection string // "rtl", "ltr", or "" (not specified)
+	Rendition                Rendition
+}
+
+// Rendition holds the EPUB 3 rendition properties of the package and the
+// equivalent Kindle meta elements (fixed-layout, orientation-lock,
+// original-resolution, book-type).
+type Rendition struct {
+	Layout             string // "pre-paginated", "reflowable", or "" (not specified)
+	Spread             string // "none", "landscape", "both", "auto", or ""
+	Orientation        string // "portrait", "landscape", "auto", or ""
+	OriginalResolution string // Kindle original-resolution, e.g. "1072x1448"
+	BookType           string // Kindle book-type: "comic", "children", or ""
+}
+
+// FixedLayout reports whether the book is pre-paginated: either the package
+// declares rendition:layout pre-paginated, or every spine item does.
+func (o *OPF) FixedLayout() bool {
+	if o.Rendition.Layout != "" {
+		return o.Rendition.Layout == "pre-paginated"
+	}
+	if len(o.Spine) == 0 {
+		return false
+	}
+	for _, item := range o.Spine {
+		if !slices.Contains(item.Properties, "rendition:layout-pre-paginated") {
+			return false
+		}
+	}
+	return true
 }
 
 // Metadata represents the metadata section of the OPF
@@ -42,8 +73,9 @@ type ManifestItem struct {
 
 // SpineItem represents an item reference in the spine
 type SpineItem struct {
-	IDRef  string
-	Linear bool
+	IDRef      string
+	Linear     bool
+	Properties []string // e.g. "page-spread-left"
 }
 
 // GuideReference represents an OPF guide reference.
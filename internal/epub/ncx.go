@@ -5,6 +5,7 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -18,6 +19,8 @@ type NCX struct {
 	Depth     int
 	DocTitle  string
 	NavPoints []NavPoint
+	PageList  []PageTarget // print page boundaries, in reading order
+	Landmarks []Landmark   // from the landmarks nav of the NAV document
 }
 
 // NavPoint represents a single navigation point in the table of contents.
@@ -30,17 +33,38 @@ type NavPoint struct {
 	Children    []NavPoint
 }
 
+// PageTarget represents the start of a print page, from the pageList of an NCX
+// or the page-list nav of a NAV document.
+type PageTarget struct {
+	Label       string // page number as printed, e.g. "12" or "xiv"
+	ContentPath string // fragment-free, absolute path within EPUB
+	Fragment    string // fragment identifier (without #)
+}
+
+// Landmark represents a structural part of the book, from the landmarks nav
+// of a NAV document.
+type Landmark struct {
+	Type        string // epub:type of the link, e.g. "bodymatter", "toc" or "cover"
+	Label       string
+	ContentPath string // fragment-free, absolute path within EPUB
+	Fragment    string // fragment identifier (without #)
+}
+
 // LoadNCX loads and parses the table of contents from an EPUB.
 // It prioritizes NCX over NAV. Returns nil, nil if neither exists.
+// When both exist, the landmarks, and the page list if the NCX has none,
+// are taken from the NAV.
 func LoadNCX(reader *EPUBReader, opf *OPF) (*NCX, error) {
 	// Try NCX first
+	var ncx *NCX
 	if opf.NCXPath != "" {
 		data, err := reader.ReadFile(opf.NCXPath)
 		if err == nil {
 			ncxDir := filepath.ToSlash(filepath.Dir(opf.NCXPath))
-			return parseNCX(data, ncxDir)
-		}
-		if !errors.Is(err, ErrFileNotFound) {
+			if ncx, err = parseNCX(data, ncxDir); err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, ErrFileNotFound) {
 			return nil, fmt.Errorf("failed to read NCX file %s: %w", opf.NCXPath, err)
 		}
 	}
@@ -48,16 +72,29 @@ func LoadNCX(reader *EPUBReader, opf *OPF) (*NCX, error) {
 	// Fallback to NAV
 	navPath, ok := findNAVPath(opf)
 	if !ok {
-		return nil, nil
+		return ncx, nil
 	}
 
 	data, err := reader.ReadFile(navPath)
 	if err != nil {
+		if ncx != nil {
+			return ncx, nil
+		}
 		return nil, fmt.Errorf("failed to read NAV file %s: %w", navPath, err)
 	}
 
 	navDir := filepath.ToSlash(filepath.Dir(navPath))
-	return parseNAV(data, navDir)
+	nav, err := parseNAV(data, navDir)
+	if ncx == nil {
+		return nav, err
+	}
+	if err == nil {
+		if len(ncx.PageList) == 0 {
+			ncx.PageList = nav.PageList
+		}
+		ncx.Landmarks = nav.Landmarks
+	}
+	return ncx, nil
 }
 
 // XML structures for NCX parsing.
@@ -66,6 +103,7 @@ type ncxXML struct {
 	Head     ncxHead     `xml:"head"`
 	DocTitle ncxDocTitle `xml:"docTitle"`
 	NavMap   ncxNavMap   `xml:"navMap"`
+	PageList ncxPageList `xml:"pageList"`
 }
 
 type ncxHead struct {
@@ -93,6 +131,16 @@ type ncxNavPoint struct {
 	Children  []ncxNavPoint `xml:"navPoint"`
 }
 
+type ncxPageList struct {
+	PageTargets []ncxPageTarget `xml:"pageTarget"`
+}
+
+type ncxPageTarget struct {
+	Value    string      `xml:"value,attr"`
+	NavLabel ncxNavLabel `xml:"navLabel"`
+	Content  ncxContent  `xml:"content"`
+}
+
 type ncxNavLabel struct {
 	Text string `xml:"text"`
 }
@@ -113,6 +161,14 @@ func parseNCX(data []byte, ncxDir string) (*NCX, error) {
 		NavPoints: convertNCXNavPoints(raw.NavMap.NavPoints, ncxDir),
 	}
 
+	for _, pt := range raw.PageList.PageTargets {
+		label := strings.TrimSpace(pt.NavLabel.Text)
+		if label == "" {
+			label = strings.TrimSpace(pt.Value)
+		}
+		ncx.PageList = append(ncx.PageList, newPageTarget(label, pt.Content.Src, ncxDir))
+	}
+
 	for _, m := range raw.Head.Metas {
 		switch m.Name {
 		case "dtb:uid":
@@ -169,10 +225,35 @@ func findNAVPath(opf *OPF) (string, bool) {
 	return "", false
 }
 
+// resolveHref splits an href relative to baseDir into the absolute content
+// path and the fragment identifier.
+func resolveHref(baseDir, href string) (contentPath, fragment string) {
+	path, fragment := splitFragment(href)
+	if path != "" {
+		contentPath = resolvePath(baseDir, path)
+	}
+	return contentPath, fragment
+}
+
+// newPageTarget builds a PageTarget from a page label and the href of the page.
+func newPageTarget(label, href, baseDir string) PageTarget {
+	contentPath, fragment := resolveHref(baseDir, href)
+	return PageTarget{
+		Label:       label,
+		ContentPath: contentPath,
+		Fragment:    fragment,
+	}
+}
+
 // hasEpubTypeTOC checks if the epub:type attribute value contains "toc" token.
 func hasEpubTypeTOC(value string) bool {
-	for _, token := range strings.Fields(value) {
-		if token == "toc" {
+	return hasEpubType(value, "toc")
+}
+
+// hasEpubType checks if the epub:type attribute value contains the given token.
+func hasEpubType(value, token string) bool {
+	for _, t := range strings.Fields(value) {
+		if t == token {
 			return true
 		}
 	}
@@ -188,22 +269,39 @@ func parseNAV(data []byte, navDir string) (*NCX, error) {
 
 	ncx := &NCX{}
 
-	// Find first nav element with epub:type containing "toc"
-	doc.Find("nav").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+	// Use the first nav element with epub:type containing "toc", the
+	// first one containing "page-list" and the first one containing "landmarks"
+	foundTOC, foundPageList, foundLandmarks := false, false, false
+	doc.Find("nav").Each(func(_ int, s *goquery.Selection) {
 		epubType, _ := s.Attr("epub:type")
-		if !hasEpubTypeTOC(epubType) {
-			return true // continue
+		switch {
+		case !foundTOC && hasEpubTypeTOC(epubType):
+			foundTOC = true
+			counter := 0
+			ol := s.Find("ol").First()
+			ncx.NavPoints = parseNAVList(ol, navDir, &counter)
+		case !foundPageList && hasEpubType(epubType, "page-list"):
+			foundPageList = true
+			ncx.PageList = parseNAVPageList(s, navDir)
+		case !foundLandmarks && hasEpubType(epubType, "landmarks"):
+			foundLandmarks = true
+			ncx.Landmarks = parseNAVLandmarks(s, navDir)
 		}
-
-		counter := 0
-		ol := s.Find("ol").First()
-		ncx.NavPoints = parseNAVList(ol, navDir, &counter)
-		return false // break after first toc
 	})
 
 	return ncx, nil
 }
 
+// parseNAVPageList parses the links of a page-list nav into PageTargets.
+func parseNAVPageList(nav *goquery.Selection, navDir string) []PageTarget {
+	var targets []PageTarget
+	nav.Find("li > a").Each(func(_ int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		targets = append(targets, newPageTarget(strings.TrimSpace(a.Text()), href, navDir))
+	})
+	return targets
+}
+
 // parseNAVList recursively parses an ol/li/a structure into NavPoints.
 func parseNAVList(ol *goquery.Selection, navDir string, counter *int) []NavPoint {
 	var points []NavPoint
@@ -263,6 +361,27 @@ func parseNAVList(ol *goquery.Selection, navDir string, counter *int) []NavPoint
 	return points
 }
 
+// parseNAVLandmarks parses the links of a landmarks nav into Landmarks.
+// Links without an epub:type are skipped.
+func parseNAVLandmarks(nav *goquery.Selection, navDir string) []Landmark {
+	var landmarks []Landmark
+	nav.Find("li > a").Each(func(_ int, a *goquery.Selection) {
+		epubType := strings.TrimSpace(a.AttrOr("epub:type", ""))
+		if epubType == "" {
+			return
+		}
+		href, _ := a.Attr("href")
+		contentPath, fragment := resolveHref(navDir, href)
+		landmarks = append(landmarks, Landmark{
+			Type:        epubType,
+			Label:       strings.TrimSpace(a.Text()),
+			ContentPath: contentPath,
+			Fragment:    fragment,
+		})
+	})
+	return landmarks
+}
+
 // cloneWithoutOL creates a clone of the selection with nested ol elements removed.
 func cloneWithoutOL(li *goquery.Selection) *goquery.Selection {
 	clone := li.Clone()
@@ -271,6 +390,7 @@ func cloneWithoutOL(li *goquery.Selection) *goquery.Selection {
 }
 
 // splitFragment splits a source path into the path and fragment identifier.
+// The fragment is percent-decoded, so that it matches the id it refers to.
 func splitFragment(src string) (path, fragment string) {
 	if src == "" {
 		return "", ""
@@ -279,6 +399,9 @@ func splitFragment(src string) (path, fragment string) {
 	path = parts[0]
 	if len(parts) == 2 {
 		fragment = parts[1]
+		if decoded, err := url.PathUnescape(fragment); err == nil {
+			fragment = decoded
+		}
 	}
 	return path, fragment
 }
@@ -53,6 +53,18 @@ func TestSplitFragment(t *testing.T) {
 			wantPath:     "text/chapter1.xhtml",
 			wantFragment: "anchor",
 		},
+		{
+			name:         "percent-encoded fragment",
+			src:          "chapter1.xhtml#%E7%AB%A0%201",
+			wantPath:     "chapter1.xhtml",
+			wantFragment: "章 1",
+		},
+		{
+			name:         "invalid percent encoding",
+			src:          "chapter1.xhtml#100%",
+			wantPath:     "chapter1.xhtml",
+			wantFragment: "100%",
+		},
 	}
 
 	for _, tt := range tests {
@@ -324,6 +336,43 @@ func TestParseNCX_Empty(t *testing.T) {
 	}
 }
 
+func TestParseNCX_PageList(t *testing.T) {
+	ncxXML := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <docTitle><text>Paged Book</text></docTitle>
+  <navMap>
+    <navPoint id="np1" playOrder="1">
+      <navLabel><text>Chapter 1</text></navLabel>
+      <content src="text/chapter1.xhtml"/>
+    </navPoint>
+  </navMap>
+  <pageList>
+    <navLabel><text>Pages</text></navLabel>
+    <pageTarget id="p1" type="front" value="1" playOrder="2">
+      <navLabel><text>i</text></navLabel>
+      <content src="text/chapter1.xhtml"/>
+    </pageTarget>
+    <pageTarget id="p2" type="normal" value="2" playOrder="3">
+      <navLabel><text></text></navLabel>
+      <content src="text/chapter1.xhtml#page2"/>
+    </pageTarget>
+  </pageList>
+</ncx>`)
+
+	ncx, err := parseNCX(ncxXML, "OEBPS")
+	if err != nil {
+		t.Fatalf("parseNCX() error = %v", err)
+	}
+
+	want := []PageTarget{
+		{Label: "i", ContentPath: "OEBPS/text/chapter1.xhtml"},
+		{Label: "2", ContentPath: "OEBPS/text/chapter1.xhtml", Fragment: "page2"},
+	}
+	if !reflect.DeepEqual(ncx.PageList, want) {
+		t.Errorf("PageList = %+v, want %+v", ncx.PageList, want)
+	}
+}
+
 func TestFindNAVPath(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -429,6 +478,75 @@ func TestParseNAV_Basic(t *testing.T) {
 	}
 }
 
+func TestParseNAV_PageList(t *testing.T) {
+	navHTML := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<body>
+<nav epub:type="landmarks">
+  <ol><li><a epub:type="bodymatter" href="text/chapter1.xhtml">Start</a></li></ol>
+</nav>
+<nav epub:type="page-list" hidden="">
+  <ol>
+    <li><a href="text/chapter1.xhtml#pg1">1</a></li>
+    <li><a href="text/chapter2.xhtml#pg2"> 2 </a></li>
+  </ol>
+</nav>
+<nav epub:type="toc">
+  <ol><li><a href="text/chapter1.xhtml">Chapter 1</a></li></ol>
+</nav>
+</body>
+</html>`)
+
+	ncx, err := parseNAV(navHTML, "OEBPS")
+	if err != nil {
+		t.Fatalf("parseNAV() error = %v", err)
+	}
+
+	if len(ncx.NavPoints) != 1 || ncx.NavPoints[0].Label != "Chapter 1" {
+		t.Errorf("NavPoints = %+v, want the toc nav", ncx.NavPoints)
+	}
+	want := []PageTarget{
+		{Label: "1", ContentPath: "OEBPS/text/chapter1.xhtml", Fragment: "pg1"},
+		{Label: "2", ContentPath: "OEBPS/text/chapter2.xhtml", Fragment: "pg2"},
+	}
+	if !reflect.DeepEqual(ncx.PageList, want) {
+		t.Errorf("PageList = %+v, want %+v", ncx.PageList, want)
+	}
+}
+
+func TestParseNAV_Landmarks(t *testing.T) {
+	navHTML := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<body>
+<nav epub:type="toc">
+  <ol><li><a href="text/chapter1.xhtml">Chapter 1</a></li></ol>
+</nav>
+<nav epub:type="landmarks">
+  <ol>
+    <li><a epub:type="cover" href="text/cover.xhtml">Cover</a></li>
+    <li><a epub:type="toc" href="nav.xhtml#toc">Contents</a></li>
+    <li><a href="text/notes.xhtml">Untyped</a></li>
+    <li><a epub:type="bodymatter" href="text/chapter1.xhtml#start">Start Reading</a></li>
+  </ol>
+</nav>
+</body>
+</html>`)
+
+	ncx, err := parseNAV(navHTML, "OEBPS")
+	if err != nil {
+		t.Fatalf("parseNAV() error = %v", err)
+	}
+
+	want := []Landmark{
+		{Type: "cover", Label: "Cover", ContentPath: "OEBPS/text/cover.xhtml"},
+		{Type: "toc", Label: "Contents", ContentPath: "OEBPS/nav.xhtml", Fragment: "toc"},
+		{Type: "bodymatter", Label: "Start Reading", ContentPath: "OEBPS/text/chapter1.xhtml", Fragment: "start"},
+	}
+	if !reflect.DeepEqual(ncx.Landmarks, want) {
+		t.Errorf("Landmarks = %+v, want %+v", ncx.Landmarks, want)
+	}
+}
+
 func TestParseNAV_Nested(t *testing.T) {
 	navHTML := []byte(`<?xml version="1.0" encoding="UTF-8"?>
 <html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
@@ -635,6 +753,69 @@ func TestLoadNCX_NCXPriority(t *testing.T) {
 	}
 }
 
+func TestLoadNCX_NCXWithNAVPageListAndLandmarks(t *testing.T) {
+	ncxContent := `<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <navMap>
+    <navPoint id="np1" playOrder="1">
+      <navLabel><text>NCX Chapter 1</text></navLabel>
+      <content src="chapter1.xhtml"/>
+    </navPoint>
+  </navMap>
+</ncx>`
+
+	navContent := `<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<body>
+<nav epub:type="toc">
+  <ol><li><a href="chapter1.xhtml">NAV Chapter 1</a></li></ol>
+</nav>
+<nav epub:type="page-list">
+  <ol><li><a href="chapter1.xhtml#p1">1</a></li></ol>
+</nav>
+<nav epub:type="landmarks">
+  <ol><li><a epub:type="bodymatter" href="chapter1.xhtml">Start</a></li></ol>
+</nav>
+</body>
+</html>`
+
+	epubPath := createNCXTestEPUB(t, map[string]string{
+		"OEBPS/toc.ncx":   ncxContent,
+		"OEBPS/nav.xhtml": navContent,
+	})
+
+	reader, err := Open(epubPath)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reader.Close()
+
+	opf := &OPF{
+		NCXPath: "OEBPS/toc.ncx",
+		Manifest: map[string]ManifestItem{
+			"ncx": {ID: "ncx", Href: "OEBPS/toc.ncx", MediaType: "application/x-dtbncx+xml"},
+			"nav": {ID: "nav", Href: "OEBPS/nav.xhtml", MediaType: "application/xhtml+xml", Properties: []string{"nav"}},
+		},
+	}
+
+	ncx, err := LoadNCX(reader, opf)
+	if err != nil {
+		t.Fatalf("LoadNCX() error = %v", err)
+	}
+
+	if len(ncx.NavPoints) != 1 || ncx.NavPoints[0].Label != "NCX Chapter 1" {
+		t.Errorf("NavPoints = %+v, want the NCX navMap", ncx.NavPoints)
+	}
+	wantPages := []PageTarget{{Label: "1", ContentPath: "OEBPS/chapter1.xhtml", Fragment: "p1"}}
+	if !reflect.DeepEqual(ncx.PageList, wantPages) {
+		t.Errorf("PageList = %+v, want %+v", ncx.PageList, wantPages)
+	}
+	wantLandmarks := []Landmark{{Type: "bodymatter", Label: "Start", ContentPath: "OEBPS/chapter1.xhtml"}}
+	if !reflect.DeepEqual(ncx.Landmarks, wantLandmarks) {
+		t.Errorf("Landmarks = %+v, want %+v", ncx.Landmarks, wantLandmarks)
+	}
+}
+
 func TestLoadNCX_NAVFallback(t *testing.T) {
 	navContent := `<?xml version="1.0" encoding="UTF-8"?>
 <html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
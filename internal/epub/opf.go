@@ -83,8 +83,9 @@ type opfSpine struct {
 
 // opfItemRef represents an itemref in the spine
 type opfItemRef struct {
-	IDRef  string `xml:"idref,attr"`
-	Linear string `xml:"linear,attr"`
+	IDRef      string `xml:"idref,attr"`
+	Linear     string `xml:"linear,attr"`
+	Properties string `xml:"properties,attr"`
 }
 
 // opfGuide represents the guide section (EPUB 2.0).
@@ -138,15 +139,21 @@ func ParseOPF(content []byte, opfDir string) (*OPF, error) {
 			linear = false
 		}
 
-		opf.Spine = append(opf.Spine, SpineItem{
+		spineItem := SpineItem{
 			IDRef:  itemRef.IDRef,
 			Linear: linear,
-		})
+		}
+		if itemRef.Properties != "" {
+			spineItem.Properties = strings.Fields(itemRef.Properties)
+		}
+		opf.Spine = append(opf.Spine, spineItem)
 	}
 
 	// Parse page-progression-direction
 	opf.PageProgressionDirection = pkg.Spine.PageProgressionDirection
 
+	opf.Rendition = parseRendition(pkg.Metadata.Meta)
+
 	// Resolve NCX path from toc attribute
 	if pkg.Spine.Toc != "" {
 		if ncxItem, ok := opf.Manifest[pkg.Spine.Toc]; ok {
@@ -231,6 +238,55 @@ func parseMetadata(meta *opfMetadata, uniqueID string) Metadata {
 	return md
 }
 
+// parseRendition parses the package-level EPUB 3 rendition properties and the
+// Kindle fixed-layout meta elements. The EPUB 3 properties take precedence.
+func parseRendition(metas []opfMeta) Rendition {
+	var r Rendition
+	for _, m := range metas {
+		if m.Property == "" || m.Refines != "" {
+			continue
+		}
+		value := strings.TrimSpace(m.Value)
+		switch m.Property {
+		case "rendition:layout":
+			r.Layout = value
+		case "rendition:spread":
+			r.Spread = value
+		case "rendition:orientation":
+			r.Orientation = value
+		}
+	}
+
+	for _, m := range metas {
+		value := strings.TrimSpace(m.Content)
+		if m.Name == "" || value == "" {
+			continue
+		}
+		switch m.Name {
+		case "fixed-layout":
+			if r.Layout == "" {
+				if strings.EqualFold(value, "true") {
+					r.Layout = "pre-paginated"
+				} else {
+					r.Layout = "reflowable"
+				}
+			}
+		case "orientation-lock":
+			if r.Orientation == "" {
+				if value == "none" {
+					value = "auto"
+				}
+				r.Orientation = value
+			}
+		case "original-resolution":
+			r.OriginalResolution = value
+		case "book-type":
+			r.BookType = value
+		}
+	}
+	return r
+}
+
 // processCreatorRoles processes EPUB 3.0 meta elements to refine creator roles
 func processCreatorRoles(md *Metadata, meta *opfMetadata) {
 	// Build a map of creator IDs to indices
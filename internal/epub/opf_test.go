@@ -322,6 +322,80 @@ func TestParseOPF_PageProgressionDirection(t *testing.T) {
 	}
 }
 
+func TestParseOPF_Rendition(t *testing.T) {
+	tests := []struct {
+		name      string
+		meta      string
+		itemProps string
+		want      Rendition
+		fixed     bool
+	}{
+		{
+			name: "EPUB 3 properties",
+			meta: `<meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:spread">landscape</meta>
+    <meta property="rendition:orientation">portrait</meta>
+    <meta refines="#chapter" property="rendition:layout">reflowable</meta>`,
+			want:  Rendition{Layout: "pre-paginated", Spread: "landscape", Orientation: "portrait"},
+			fixed: true,
+		},
+		{
+			name: "Kindle meta elements",
+			meta: `<meta name="fixed-layout" content="true"/>
+    <meta name="orientation-lock" content="none"/>
+    <meta name="original-resolution" content="1072x1448"/>
+    <meta name="book-type" content="comic"/>`,
+			want:  Rendition{Layout: "pre-paginated", Orientation: "auto", OriginalResolution: "1072x1448", BookType: "comic"},
+			fixed: true,
+		},
+		{
+			name: "EPUB 3 property wins over Kindle meta",
+			meta: `<meta property="rendition:layout">reflowable</meta>
+    <meta name="fixed-layout" content="true"/>`,
+			want: Rendition{Layout: "reflowable"},
+		},
+		{
+			name:      "every spine item pre-paginated",
+			itemProps: ` properties="rendition:layout-pre-paginated page-spread-right"`,
+			fixed:     true,
+		},
+		{
+			name: "reflowable",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opfContent := `<?xml version="1.0" encoding="UTF-8"?>
+<package version="3.0" xmlns="http://www.idpf.org/2007/opf" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Fixed Layout</dc:title>
+    <dc:language>en</dc:language>
+    <dc:identifier id="uid">urn:uuid:12345</dc:identifier>
+    ` + tt.meta + `
+  </metadata>
+  <manifest>
+    <item id="chapter" href="chapter.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="chapter"` + tt.itemProps + `/>
+  </spine>
+</package>`
+
+			opf, err := ParseOPF([]byte(opfContent), "")
+			if err != nil {
+				t.Fatalf("ParseOPF failed: %v", err)
+			}
+			if opf.Rendition != tt.want {
+				t.Errorf("Rendition = %+v, want %+v", opf.Rendition, tt.want)
+			}
+			if got := opf.FixedLayout(); got != tt.fixed {
+				t.Errorf("FixedLayout() = %v, want %v", got, tt.fixed)
+			}
+		})
+	}
+}
+
 func TestParseOPF_IdentifierPrefersSchemeISBN(t *testing.T) {
 	opfContent := `<?xml version="1.0" encoding="UTF-8"?>
 <package version="2.0" xmlns="http://www.idpf.org/2007/opf" unique-identifier="uid">
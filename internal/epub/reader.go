@@ -14,6 +14,11 @@ type EPUBReader struct {
 	zipReader *zip.ReadCloser
 	files     map[string]*zip.File
 	opfPath   string
+
+	obfuscated  map[string]string // path -> font obfuscation algorithm
+	encrypted   map[string]string // path -> encryption algorithm (DRM)
+	identifiers []string          // candidate obfuscation key sources
+	added       map[string][]byte // path -> file added by AddFile
 }
 
 // container.xml structure
@@ -33,9 +38,12 @@ var (
 	ErrContainerNotFound  = errors.New("META-INF/container.xml not found")
 	ErrOPFPathNotFound    = errors.New("OPF path not found in container.xml")
 	ErrFileNotFound       = errors.New("file not found")
+	ErrEncrypted          = errors.New("resource is encrypted (DRM-protected)")
 )
 
-// Open opens an EPUB file and validates its structure
+// Open opens an EPUB file and validates its structure.
+// Fonts obfuscated as listed in META-INF/encryption.xml are deobfuscated by
+// ReadFile; resources encrypted with any other algorithm cannot be read.
 func Open(path string) (*EPUBReader, error) {
 	zr, err := zip.OpenReader(path)
 	if err != nil {
@@ -65,6 +73,11 @@ func Open(path string) (*EPUBReader, error) {
 		return nil, err
 	}
 
+	if err := reader.parseEncryption(); err != nil {
+		zr.Close()
+		return nil, err
+	}
+
 	return reader, nil
 }
 
@@ -83,13 +96,31 @@ func (r *EPUBReader) Files() map[string]*zip.File {
 	return r.files
 }
 
-// ReadFile reads the contents of a file from the EPUB
+// AddFile adds a file in memory, replacing the file of the EPUB with the same
+// path if there is one. ReadFile returns it as is. It lets the converter
+// substitute generated pages and images without rewriting the archive.
+func (r *EPUBReader) AddFile(path string, data []byte) {
+	if r.added == nil {
+		r.added = make(map[string][]byte)
+	}
+	r.added[normalizePath(path)] = data
+}
+
+// ReadFile reads the contents of a file from the EPUB, or a file added by
+// AddFile. Obfuscated fonts are returned deobfuscated. Encrypted resources
+// fail with ErrEncrypted.
 func (r *EPUBReader) ReadFile(path string) ([]byte, error) {
 	path = normalizePath(path)
+	if data, ok := r.added[path]; ok {
+		return data, nil
+	}
 	f, ok := r.files[path]
 	if !ok {
 		return nil, fmt.Errorf("%w: %s", ErrFileNotFound, path)
 	}
+	if algorithm, ok := r.encrypted[path]; ok {
+		return nil, fmt.Errorf("%w: %s (%s)", ErrEncrypted, path, algorithm)
+	}
 
 	rc, err := f.Open()
 	if err != nil {
@@ -97,7 +128,14 @@ func (r *EPUBReader) ReadFile(path string) ([]byte, error) {
 	}
 	defer rc.Close()
 
-	return io.ReadAll(rc)
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm, ok := r.obfuscated[path]; ok {
+		data = r.deobfuscate(data, algorithm)
+	}
+	return data, nil
 }
 
 // validateMimetype checks that the mimetype file exists and is valid
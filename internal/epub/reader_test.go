@@ -282,6 +282,30 @@ func TestEPUBReader_ReadFile_NotFound(t *testing.T) {
 	}
 }
 
+func TestEPUBReader_AddFile(t *testing.T) {
+	dir := t.TempDir()
+	epubPath := createTestEPUB(t, dir)
+
+	reader, err := Open(epubPath)
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer reader.Close()
+
+	reader.AddFile("mimetype", []byte("replaced"))
+	reader.AddFile("./OEBPS/new.xhtml", []byte("added"))
+
+	for path, want := range map[string]string{"mimetype": "replaced", "OEBPS/new.xhtml": "added"} {
+		got, err := reader.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile(%q) failed: %v", path, err)
+		}
+		if string(got) != want {
+			t.Errorf("ReadFile(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
 // Test path normalization (handling of ./ prefix)
 func TestOpen_PathNormalization(t *testing.T) {
 	dir := t.TempDir()
@@ -0,0 +1,299 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Writer creates an EPUB container. The mimetype entry is stored uncompressed
+// as the first entry, followed by META-INF/container.xml.
+type Writer struct {
+	zw *zip.Writer
+}
+
+// NewWriter starts an EPUB container whose package document is at opfPath.
+func NewWriter(w io.Writer, opfPath string) (*Writer, error) {
+	zw := zip.NewWriter(w)
+
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mimetype entry: %w", err)
+	}
+	if _, err := mw.Write([]byte("application/epub+zip")); err != nil {
+		return nil, fmt.Errorf("failed to write mimetype: %w", err)
+	}
+
+	ew := &Writer{zw: zw}
+	var container bytes.Buffer
+	container.WriteString(xml.Header)
+	container.WriteString(`<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">` + "\n")
+	container.WriteString("  <rootfiles>\n")
+	fmt.Fprintf(&container, "    <rootfile full-path=\"%s\" media-type=\"application/oebps-package+xml\"/>\n", escapeXML(opfPath))
+	container.WriteString("  </rootfiles>\n</container>\n")
+	if err := ew.AddFile("META-INF/container.xml", container.Bytes()); err != nil {
+		return nil, err
+	}
+	return ew, nil
+}
+
+// AddFile adds a compressed entry to the container.
+func (w *Writer) AddFile(name string, data []byte) error {
+	fw, err := w.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	if _, err := fw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close finishes the container. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	return w.zw.Close()
+}
+
+// MarshalOPF serializes an OPF as an EPUB 3 package document located in opfDir.
+// Manifest and guide hrefs are absolute paths within the EPUB, as returned by
+// ParseOPF, and are written relative to opfDir. The identifier is the package's
+// unique identifier; modified becomes the dcterms:modified property.
+func MarshalOPF(opf *OPF, opfDir string, modified time.Time) ([]byte, error) {
+	if opf.Metadata.Identifier == "" {
+		return nil, fmt.Errorf("identifier is required")
+	}
+	md := opf.Metadata
+
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="bookid">` + "\n")
+	b.WriteString(`  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:opf="http://www.idpf.org/2007/opf">` + "\n")
+	fmt.Fprintf(&b, "    <dc:identifier id=\"bookid\">%s</dc:identifier>\n", escapeXML(md.Identifier))
+	fmt.Fprintf(&b, "    <dc:title>%s</dc:title>\n", escapeXML(md.Title))
+	language := md.Language
+	if language == "" {
+		language = "und"
+	}
+	fmt.Fprintf(&b, "    <dc:language>%s</dc:language>\n", escapeXML(language))
+	for i, c := range md.Creators {
+		id := "creator" + strconv.Itoa(i+1)
+		if c.Lang != "" {
+			fmt.Fprintf(&b, "    <dc:creator id=\"%s\" xml:lang=\"%s\">%s</dc:creator>\n", id, escapeXML(c.Lang), escapeXML(c.Name))
+		} else {
+			fmt.Fprintf(&b, "    <dc:creator id=\"%s\">%s</dc:creator>\n", id, escapeXML(c.Name))
+		}
+		if c.Role != "" {
+			fmt.Fprintf(&b, "    <meta refines=\"#%s\" property=\"role\" scheme=\"marc:relators\">%s</meta>\n", id, escapeXML(c.Role))
+		}
+	}
+	writeOptional := func(element, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "    <dc:%s>%s</dc:%s>\n", element, escapeXML(value), element)
+		}
+	}
+	writeOptional("publisher", md.Publisher)
+	writeOptional("date", md.Date)
+	writeOptional("description", md.Description)
+	for _, s := range md.Subjects {
+		writeOptional("subject", s)
+	}
+	writeOptional("rights", md.Rights)
+	fmt.Fprintf(&b, "    <meta property=\"dcterms:modified\">%s</meta>\n", modified.UTC().Format("2006-01-02T15:04:05Z"))
+	if md.CoverID != "" {
+		fmt.Fprintf(&b, "    <meta name=\"cover\" content=\"%s\"/>\n", escapeXML(md.CoverID))
+	}
+	writeProperty := func(property, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "    <meta property=\"%s\">%s</meta>\n", property, escapeXML(value))
+		}
+	}
+	writeProperty("rendition:layout", opf.Rendition.Layout)
+	writeProperty("rendition:spread", opf.Rendition.Spread)
+	writeProperty("rendition:orientation", opf.Rendition.Orientation)
+	writeName := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "    <meta name=\"%s\" content=\"%s\"/>\n", name, escapeXML(value))
+		}
+	}
+	writeName("original-resolution", opf.Rendition.OriginalResolution)
+	writeName("book-type", opf.Rendition.BookType)
+	b.WriteString("  </metadata>\n")
+
+	var ncxID string
+	b.WriteString("  <manifest>\n")
+	for _, id := range opf.ManifestOrder {
+		item, ok := opf.Manifest[id]
+		if !ok {
+			return nil, fmt.Errorf("manifest item %q not found", id)
+		}
+		if item.Href == opf.NCXPath && opf.NCXPath != "" {
+			ncxID = item.ID
+		}
+		fmt.Fprintf(&b, "    <item id=\"%s\" href=\"%s\" media-type=\"%s\"", escapeXML(item.ID), escapeXML(relativePath(opfDir, item.Href)), escapeXML(item.MediaType))
+		if len(item.Properties) > 0 {
+			fmt.Fprintf(&b, " properties=\"%s\"", escapeXML(strings.Join(item.Properties, " ")))
+		}
+		b.WriteString("/>\n")
+	}
+	b.WriteString("  </manifest>\n")
+
+	b.WriteString("  <spine")
+	if ncxID != "" {
+		fmt.Fprintf(&b, " toc=\"%s\"", escapeXML(ncxID))
+	}
+	if opf.PageProgressionDirection != "" {
+		fmt.Fprintf(&b, " page-progression-direction=\"%s\"", escapeXML(opf.PageProgressionDirection))
+	}
+	b.WriteString(">\n")
+	for _, item := range opf.Spine {
+		if _, ok := opf.Manifest[item.IDRef]; !ok {
+			return nil, fmt.Errorf("spine item %q not found in manifest", item.IDRef)
+		}
+		fmt.Fprintf(&b, "    <itemref idref=\"%s\"", escapeXML(item.IDRef))
+		if !item.Linear {
+			b.WriteString(" linear=\"no\"")
+		}
+		if len(item.Properties) > 0 {
+			fmt.Fprintf(&b, " properties=\"%s\"", escapeXML(strings.Join(item.Properties, " ")))
+		}
+		b.WriteString("/>\n")
+	}
+	b.WriteString("  </spine>\n")
+
+	if len(opf.Guide) > 0 {
+		b.WriteString("  <guide>\n")
+		for _, ref := range opf.Guide {
+			fmt.Fprintf(&b, "    <reference type=\"%s\" title=\"%s\" href=\"%s\"/>\n", escapeXML(ref.Type), escapeXML(ref.Title), escapeXML(relativePath(opfDir, ref.Href)))
+		}
+		b.WriteString("  </guide>\n")
+	}
+	b.WriteString("</package>\n")
+	return b.Bytes(), nil
+}
+
+// MarshalNCX serializes a table of contents as an NCX document located in ncxDir.
+// Content paths are absolute paths within the EPUB and are written relative to ncxDir.
+func MarshalNCX(ncx *NCX, ncxDir string) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString(`<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">` + "\n")
+	b.WriteString("  <head>\n")
+	fmt.Fprintf(&b, "    <meta name=\"dtb:uid\" content=\"%s\"/>\n", escapeXML(ncx.UID))
+	fmt.Fprintf(&b, "    <meta name=\"dtb:depth\" content=\"%d\"/>\n", max(navDepth(ncx.NavPoints), 1))
+	b.WriteString("    <meta name=\"dtb:totalPageCount\" content=\"0\"/>\n")
+	b.WriteString("    <meta name=\"dtb:maxPageNumber\" content=\"0\"/>\n")
+	b.WriteString("  </head>\n")
+	fmt.Fprintf(&b, "  <docTitle><text>%s</text></docTitle>\n", escapeXML(ncx.DocTitle))
+	b.WriteString("  <navMap>\n")
+
+	playOrder := 0
+	var write func(points []NavPoint, indent string)
+	write = func(points []NavPoint, indent string) {
+		for _, np := range points {
+			playOrder++
+			id := np.ID
+			if id == "" {
+				id = "navPoint-" + strconv.Itoa(playOrder)
+			}
+			fmt.Fprintf(&b, "%s<navPoint id=\"%s\" playOrder=\"%d\">\n", indent, escapeXML(id), playOrder)
+			fmt.Fprintf(&b, "%s  <navLabel><text>%s</text></navLabel>\n", indent, escapeXML(np.Label))
+			fmt.Fprintf(&b, "%s  <content src=\"%s\"/>\n", indent, escapeXML(navHref(ncxDir, np)))
+			write(np.Children, indent+"  ")
+			fmt.Fprintf(&b, "%s</navPoint>\n", indent)
+		}
+	}
+	write(ncx.NavPoints, "    ")
+
+	b.WriteString("  </navMap>\n</ncx>\n")
+	return b.Bytes(), nil
+}
+
+// MarshalNAV serializes a table of contents as an EPUB 3 navigation document
+// located in navDir.
+func MarshalNAV(ncx *NCX, navDir, language string) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(xml.Header)
+	b.WriteString("<!DOCTYPE html>\n")
+	b.WriteString(`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"`)
+	if language != "" {
+		fmt.Fprintf(&b, ` xml:lang="%s" lang="%s"`, escapeXML(language), escapeXML(language))
+	}
+	b.WriteString(">\n")
+	fmt.Fprintf(&b, "<head>\n  <title>%s</title>\n</head>\n<body>\n", escapeXML(ncx.DocTitle))
+	b.WriteString("  <nav epub:type=\"toc\" id=\"toc\">\n")
+
+	var write func(points []NavPoint, indent string)
+	write = func(points []NavPoint, indent string) {
+		fmt.Fprintf(&b, "%s<ol>\n", indent)
+		for _, np := range points {
+			fmt.Fprintf(&b, "%s  <li><a href=\"%s\">%s</a>", indent, escapeXML(navHref(navDir, np)), escapeXML(np.Label))
+			if len(np.Children) > 0 {
+				b.WriteString("\n")
+				write(np.Children, indent+"    ")
+				fmt.Fprintf(&b, "%s  ", indent)
+			}
+			b.WriteString("</li>\n")
+		}
+		fmt.Fprintf(&b, "%s</ol>\n", indent)
+	}
+	if len(ncx.NavPoints) > 0 {
+		write(ncx.NavPoints, "    ")
+	}
+
+	b.WriteString("  </nav>\n</body>\n</html>\n")
+	return b.Bytes(), nil
+}
+
+// navHref returns the href of a navigation point relative to dir.
+func navHref(dir string, np NavPoint) string {
+	href := relativePath(dir, np.ContentPath)
+	if np.Fragment != "" {
+		href += "#" + np.Fragment
+	}
+	return href
+}
+
+// navDepth returns the depth of the navigation point tree.
+func navDepth(points []NavPoint) int {
+	depth := 0
+	for _, np := range points {
+		depth = max(depth, 1+navDepth(np.Children))
+	}
+	return depth
+}
+
+// relativePath returns target (an absolute path within the EPUB) relative to dir.
+func relativePath(dir, target string) string {
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	if dir == "" {
+		return target
+	}
+	dirParts := strings.Split(dir, "/")
+	targetParts := strings.Split(path.Clean("/" + target)[1:], "/")
+
+	common := 0
+	for common < len(dirParts) && common < len(targetParts)-1 && dirParts[common] == targetParts[common] {
+		common++
+	}
+	parts := make([]string, 0, len(dirParts)-common+len(targetParts)-common)
+	for range dirParts[common:] {
+		parts = append(parts, "..")
+	}
+	parts = append(parts, targetParts[common:]...)
+	return strings.Join(parts, "/")
+}
+
+// escapeXML escapes text for use in XML character data and attribute values.
+func escapeXML(s string) string {
+	var b strings.Builder
+	if err := xml.EscapeText(&b, []byte(s)); err != nil {
+		return s
+	}
+	return b.String()
+}
@@ -0,0 +1,196 @@
+package epub
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter_RoundTrip(t *testing.T) {
+	opf := &OPF{
+		Metadata: Metadata{
+			Title:      "Round & Trip",
+			Language:   "ja",
+			Identifier: "urn:isbn:9784000000000",
+			Publisher:  "Publisher",
+			Date:       "2024-01-02",
+			Creators:   []Creator{{Name: "Author One", Role: "aut"}, {Name: "Editor", Role: "edt"}},
+			Subjects:   []string{"Fiction"},
+			CoverID:    "cover",
+		},
+		Manifest: map[string]ManifestItem{
+			"ch01":  {ID: "ch01", Href: "OEBPS/text/ch01.xhtml", MediaType: "application/xhtml+xml"},
+			"nav":   {ID: "nav", Href: "OEBPS/nav.xhtml", MediaType: "application/xhtml+xml", Properties: []string{"nav"}},
+			"ncx":   {ID: "ncx", Href: "OEBPS/toc.ncx", MediaType: "application/x-dtbncx+xml"},
+			"cover": {ID: "cover", Href: "OEBPS/images/cover.jpg", MediaType: "image/jpeg", Properties: []string{"cover-image"}},
+		},
+		ManifestOrder:            []string{"ch01", "nav", "ncx", "cover"},
+		Spine:                    []SpineItem{{IDRef: "ch01", Linear: true, Properties: []string{"page-spread-right"}}, {IDRef: "nav", Linear: false}},
+		NCXPath:                  "OEBPS/toc.ncx",
+		PageProgressionDirection: "rtl",
+		Rendition:                Rendition{Layout: "pre-paginated", Spread: "landscape", OriginalResolution: "1072x1448", BookType: "comic"},
+		Guide:                    []GuideReference{{Type: "text", Title: "Start", Href: "OEBPS/text/ch01.xhtml#start"}},
+	}
+	ncx := &NCX{
+		UID:      opf.Metadata.Identifier,
+		DocTitle: opf.Metadata.Title,
+		NavPoints: []NavPoint{
+			{Label: "Chapter <1>", ContentPath: "OEBPS/text/ch01.xhtml", Children: []NavPoint{
+				{Label: "Section", ContentPath: "OEBPS/text/ch01.xhtml", Fragment: "s1"},
+			}},
+		},
+	}
+
+	opfData, err := MarshalOPF(opf, "OEBPS", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("MarshalOPF() error = %v", err)
+	}
+	ncxData, err := MarshalNCX(ncx, "OEBPS")
+	if err != nil {
+		t.Fatalf("MarshalNCX() error = %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.epub")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWriter(f, "OEBPS/content.opf")
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	for name, data := range map[string][]byte{
+		"OEBPS/content.opf":      opfData,
+		"OEBPS/toc.ncx":          ncxData,
+		"OEBPS/text/ch01.xhtml":  []byte(`<html xmlns="http://www.w3.org/1999/xhtml"><body><p id="s1">text</p></body></html>`),
+		"OEBPS/images/cover.jpg": {0xFF, 0xD8},
+	} {
+		if err := w.AddFile(name, data); err != nil {
+			t.Fatalf("AddFile(%s) error = %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	f.Close()
+
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zr.File[0].Name != "mimetype" || zr.File[0].Method != zip.Store {
+		t.Errorf("first entry = %s (method %d), want stored mimetype", zr.File[0].Name, zr.File[0].Method)
+	}
+	zr.Close()
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer r.Close()
+	if r.OPFPath() != "OEBPS/content.opf" {
+		t.Errorf("OPFPath() = %q", r.OPFPath())
+	}
+
+	content, err := r.ReadFile(r.OPFPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseOPF(content, "OEBPS")
+	if err != nil {
+		t.Fatalf("ParseOPF() error = %v", err)
+	}
+	if !reflect.DeepEqual(parsed.Metadata, opf.Metadata) {
+		t.Errorf("Metadata = %+v, want %+v", parsed.Metadata, opf.Metadata)
+	}
+	if !reflect.DeepEqual(parsed.Manifest, opf.Manifest) || !reflect.DeepEqual(parsed.ManifestOrder, opf.ManifestOrder) {
+		t.Errorf("Manifest = %+v, want %+v", parsed.Manifest, opf.Manifest)
+	}
+	if !reflect.DeepEqual(parsed.Spine, opf.Spine) {
+		t.Errorf("Spine = %+v, want %+v", parsed.Spine, opf.Spine)
+	}
+	if parsed.NCXPath != opf.NCXPath || parsed.PageProgressionDirection != "rtl" {
+		t.Errorf("NCXPath = %q, PageProgressionDirection = %q", parsed.NCXPath, parsed.PageProgressionDirection)
+	}
+	if parsed.Rendition != opf.Rendition {
+		t.Errorf("Rendition = %+v, want %+v", parsed.Rendition, opf.Rendition)
+	}
+	if !reflect.DeepEqual(parsed.Guide, opf.Guide) {
+		t.Errorf("Guide = %+v, want %+v", parsed.Guide, opf.Guide)
+	}
+
+	loaded, err := LoadNCX(r, parsed)
+	if err != nil {
+		t.Fatalf("LoadNCX() error = %v", err)
+	}
+	if loaded.UID != ncx.UID || loaded.DocTitle != ncx.DocTitle || loaded.Depth != 2 {
+		t.Errorf("NCX head = %+v", loaded)
+	}
+	if len(loaded.NavPoints) != 1 || loaded.NavPoints[0].Label != "Chapter <1>" {
+		t.Fatalf("NavPoints = %+v", loaded.NavPoints)
+	}
+	child := loaded.NavPoints[0].Children
+	if len(child) != 1 || child[0].ContentPath != "OEBPS/text/ch01.xhtml" || child[0].Fragment != "s1" {
+		t.Errorf("child NavPoints = %+v", child)
+	}
+}
+
+func TestMarshalNAV(t *testing.T) {
+	ncx := &NCX{
+		DocTitle: "Book",
+		NavPoints: []NavPoint{
+			{Label: "One", ContentPath: "OEBPS/text/ch01.xhtml", Children: []NavPoint{
+				{Label: "One.One", ContentPath: "OEBPS/text/ch01.xhtml", Fragment: "a"},
+			}},
+			{Label: "Two", ContentPath: "OEBPS/text/ch02.xhtml"},
+		},
+	}
+	data, err := MarshalNAV(ncx, "OEBPS", "en")
+	if err != nil {
+		t.Fatalf("MarshalNAV() error = %v", err)
+	}
+
+	parsed, err := parseNAV(data, "OEBPS")
+	if err != nil {
+		t.Fatalf("parseNAV() error = %v\n%s", err, data)
+	}
+	if len(parsed.NavPoints) != 2 {
+		t.Fatalf("NavPoints = %+v", parsed.NavPoints)
+	}
+	if got := parsed.NavPoints[0].Children; len(got) != 1 || got[0].Label != "One.One" || got[0].Fragment != "a" {
+		t.Errorf("children = %+v", got)
+	}
+	if parsed.NavPoints[1].ContentPath != "OEBPS/text/ch02.xhtml" {
+		t.Errorf("ContentPath = %q", parsed.NavPoints[1].ContentPath)
+	}
+	if !strings.Contains(string(data), `epub:type="toc"`) {
+		t.Error("nav element does not have epub:type=\"toc\"")
+	}
+}
+
+func TestMarshalOPF_RequiresIdentifier(t *testing.T) {
+	if _, err := MarshalOPF(&OPF{}, "", time.Now()); err == nil {
+		t.Error("MarshalOPF() error = nil, want error for a missing identifier")
+	}
+}
+
+func TestRelativePath(t *testing.T) {
+	tests := []struct {
+		dir, target, want string
+	}{
+		{"", "text/ch01.xhtml", "text/ch01.xhtml"},
+		{"OEBPS", "OEBPS/text/ch01.xhtml", "text/ch01.xhtml"},
+		{"OEBPS/text", "OEBPS/images/a.jpg", "../images/a.jpg"},
+		{"OEBPS/text", "OEBPS/text/ch01.xhtml#x", "ch01.xhtml#x"},
+		{"a/b", "c.css", "../../c.css"},
+	}
+	for _, tt := range tests {
+		if got := relativePath(tt.dir, tt.target); got != tt.want {
+			t.Errorf("relativePath(%q, %q) = %q, want %q", tt.dir, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// apnxVersion is the version of the APNX format (1.1).
+const apnxVersion uint32 = 0x00010001
+
+// apnxPageHeaderVersion and apnxPageOffsetSize are the version of the page
+// header and the size in bits of a page offset.
+const (
+	apnxPageHeaderVersion uint16 = 1
+	apnxPageOffsetSize    uint16 = 32
+)
+
+// APNX is an Amazon page number index: the sidecar file that Kindle reads to
+// show real page numbers for a book. Each page is the offset in the text flow
+// where the page starts.
+type APNX struct {
+	ContentGUID string // identifies the book; any short hexadecimal string
+	ASIN        string
+	CDEType     string // e.g. "EBOK"
+	Title       string // the book title; stored as the PDB database name
+	Format      string // "MOBI_8" (default) or "MOBI_7"
+	PageMap     string // page labels (see APNXPageMap); "" means arabic from 1
+	Pages       []uint32
+}
+
+// apnxContentHeader is the JSON header describing the book.
+type apnxContentHeader struct {
+	ContentGUID    string `json:"contentGuid"`
+	ASIN           string `json:"asin"`
+	CDEType        string `json:"cdeType"`
+	Format         string `json:"format"`
+	FileRevisionID string `json:"fileRevisionId"`
+	ACR            string `json:"acr"`
+}
+
+// apnxPageHeader is the JSON header describing the page labels.
+type apnxPageHeader struct {
+	ASIN    string `json:"asin"`
+	PageMap string `json:"pageMap"`
+}
+
+// Bytes serializes the APNX file.
+// Layout:
+//  1. Version (uint32)
+//  2. Offset of the page header (uint32)
+//  3. Content header length (uint32) and JSON content header
+//  4. Page header version, page header length, page count and the size in
+//     bits of a page offset (uint16 each), and the JSON page header
+//  5. Page offsets (uint32 each)
+func (a *APNX) Bytes() ([]byte, error) {
+	if len(a.Pages) > math.MaxUint16 {
+		return nil, fmt.Errorf("too many pages for APNX: %d", len(a.Pages))
+	}
+	for i := 1; i < len(a.Pages); i++ {
+		if a.Pages[i] < a.Pages[i-1] {
+			return nil, fmt.Errorf("APNX page %d starts before page %d", i+1, i)
+		}
+	}
+
+	format := a.Format
+	if format == "" {
+		format = "MOBI_8"
+	}
+	name := truncateDatabaseName(a.Title)
+	contentHeader, err := json.Marshal(apnxContentHeader{
+		ContentGUID:    a.ContentGUID,
+		ASIN:           a.ASIN,
+		CDEType:        a.CDEType,
+		Format:         format,
+		FileRevisionID: "1",
+		ACR:            string(bytes.TrimRight(name[:], "\x00")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode APNX content header: %w", err)
+	}
+	pageMap := a.PageMap
+	if pageMap == "" {
+		pageMap = "(1,a,1)"
+	}
+	pageHeader, err := json.Marshal(apnxPageHeader{ASIN: a.ASIN, PageMap: pageMap})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode APNX page header: %w", err)
+	}
+	if len(pageHeader) > math.MaxUint16 {
+		return nil, fmt.Errorf("APNX page header too long: %d bytes", len(pageHeader))
+	}
+
+	buf := new(bytes.Buffer)
+	fields := []any{
+		apnxVersion,
+		uint32(12 + len(contentHeader)),
+		uint32(len(contentHeader)),
+		contentHeader,
+		apnxPageHeaderVersion,
+		uint16(len(pageHeader)),
+		uint16(len(a.Pages)),
+		apnxPageOffsetSize,
+		pageHeader,
+		a.Pages,
+	}
+	for _, field := range fields {
+		if err := binary.Write(buf, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("failed to write APNX: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// pageMapEscaper drops the characters that delimit groups and labels of a
+// page map from custom page labels.
+var pageMapEscaper = strings.NewReplacer("(", "", ")", "", ",", "", "|", "")
+
+// APNXPageMap builds the page map of an APNX page header from the printed
+// labels of the pages. Runs of consecutive arabic or lower-case roman numbers
+// become "(page,a,first)" and "(page,r,first)" groups; other labels are
+// listed as "(page,c,label|label...)". Pages are numbered from 1.
+func APNXPageMap(labels []string) string {
+	var groups []string
+	var kind, custom string
+	next := 0
+	for i, label := range labels {
+		label = strings.TrimSpace(label)
+		n, k := parsePageLabel(label)
+		if k == "c" {
+			label = pageMapEscaper.Replace(label)
+		}
+		switch {
+		case k == "c" && kind == "c":
+			custom += "|" + label
+			continue
+		case k != "c" && k == kind && n == next:
+			next++
+			continue
+		}
+		if kind == "c" {
+			groups[len(groups)-1] += custom + ")"
+		}
+		kind = k
+		if k == "c" {
+			groups = append(groups, fmt.Sprintf("(%d,c,", i+1))
+			custom = label
+		} else {
+			groups = append(groups, fmt.Sprintf("(%d,%s,%d)", i+1, k, n))
+			next = n + 1
+		}
+	}
+	if kind == "c" {
+		groups[len(groups)-1] += custom + ")"
+	}
+	return strings.Join(groups, ",")
+}
+
+// parsePageLabel classifies a page label as arabic ("a"), lower-case roman
+// ("r") or custom ("c"), and returns its number for arabic and roman labels.
+func parsePageLabel(label string) (int, string) {
+	if n, err := strconv.Atoi(label); err == nil && n > 0 && label[0] != '+' {
+		return n, "a"
+	}
+	values := map[byte]int{'i': 1, 'v': 5, 'x': 10, 'l': 50, 'c': 100, 'd': 500, 'm': 1000}
+	n := 0
+	for i := 0; i < len(label); i++ {
+		v, ok := values[label[i]]
+		if !ok {
+			return 0, "c"
+		}
+		if i+1 < len(label) && values[label[i+1]] > v {
+			n -= v
+		} else {
+			n += v
+		}
+	}
+	if n <= 0 {
+		return 0, "c"
+	}
+	return n, "r"
+}
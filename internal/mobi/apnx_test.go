@@ -0,0 +1,109 @@
+package mobi
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAPNXBytes(t *testing.T) {
+	apnx := &APNX{
+		ContentGUID: "0badf00d",
+		CDEType:     "EBOK",
+		Title:       "A \"Quoted\" Title",
+		Pages:       []uint32{0, 1800, 3600},
+	}
+	data, err := apnx.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+
+	if v := binary.BigEndian.Uint32(data[0:4]); v != 0x00010001 {
+		t.Errorf("version = %#x, want 0x00010001", v)
+	}
+	pageHeaderStart := binary.BigEndian.Uint32(data[4:8])
+	contentLen := binary.BigEndian.Uint32(data[8:12])
+	if pageHeaderStart != 12+contentLen {
+		t.Fatalf("page header offset = %d, want %d", pageHeaderStart, 12+contentLen)
+	}
+	var content map[string]string
+	if err := json.Unmarshal(data[12:12+contentLen], &content); err != nil {
+		t.Fatalf("content header is not JSON: %v", err)
+	}
+	want := map[string]string{
+		"contentGuid":    "0badf00d",
+		"asin":           "",
+		"cdeType":        "EBOK",
+		"format":         "MOBI_8",
+		"fileRevisionId": "1",
+		"acr":            `A "Quoted" Title`,
+	}
+	if !reflect.DeepEqual(content, want) {
+		t.Errorf("content header = %v, want %v", content, want)
+	}
+
+	p := data[pageHeaderStart:]
+	if v := binary.BigEndian.Uint16(p[0:2]); v != 1 {
+		t.Errorf("page header version = %d, want 1", v)
+	}
+	headerLen := int(binary.BigEndian.Uint16(p[2:4]))
+	if n := binary.BigEndian.Uint16(p[4:6]); n != 3 {
+		t.Errorf("page count = %d, want 3", n)
+	}
+	if bits := binary.BigEndian.Uint16(p[6:8]); bits != 32 {
+		t.Errorf("offset size = %d, want 32", bits)
+	}
+	if got := string(p[8 : 8+headerLen]); got != `{"asin":"","pageMap":"(1,a,1)"}` {
+		t.Errorf("page header = %s", got)
+	}
+	offsets := p[8+headerLen:]
+	if len(offsets) != 12 {
+		t.Fatalf("page offsets = %d bytes, want 12", len(offsets))
+	}
+	for i, want := range apnx.Pages {
+		if got := binary.BigEndian.Uint32(offsets[i*4:]); got != want {
+			t.Errorf("page %d offset = %d, want %d", i+1, got, want)
+		}
+	}
+}
+
+func TestAPNXBytes_TruncatesTitle(t *testing.T) {
+	apnx := &APNX{Title: strings.Repeat("x", 40)}
+	data, err := apnx.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	if !strings.Contains(string(data), `"acr":"`+strings.Repeat("x", 31)+`"`) {
+		t.Errorf("acr is not the 31-byte database name: %s", data)
+	}
+}
+
+func TestAPNXBytes_UnorderedPages(t *testing.T) {
+	apnx := &APNX{Pages: []uint32{0, 500, 400}}
+	if _, err := apnx.Bytes(); err == nil {
+		t.Fatal("Bytes() should fail for pages out of order")
+	}
+}
+
+func TestAPNXPageMap(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels []string
+		want   string
+	}{
+		{"arabic", []string{"1", "2", "3"}, "(1,a,1)"},
+		{"roman then arabic", []string{"i", "ii", "iii", "iv", "1", "2"}, "(1,r,1),(5,a,1)"},
+		{"gap in numbering", []string{"1", "2", "5", "6"}, "(1,a,1),(3,a,5)"},
+		{"custom labels", []string{"Cover", "A|1", "1", "2"}, "(1,c,Cover|A1),(3,a,1)"},
+		{"custom in between", []string{"1", "Plate", "2"}, "(1,a,1),(2,c,Plate),(3,a,2)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := APNXPageMap(tt.labels); got != tt.want {
+				t.Errorf("APNXPageMap(%q) = %q, want %q", tt.labels, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,11 +3,14 @@ package mobi
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"math"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/yuanying/epub2azw3/internal/epub"
 )
@@ -135,6 +138,185 @@ func (h *EXTHHeader) recordsDataSize() int {
 	return size
 }
 
+// ParseEXTH decodes an EXTH header, including its padding, from the start of data.
+// Records are returned in file order.
+func ParseEXTH(data []byte) (*EXTHHeader, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("EXTH data too short: got %d bytes, need at least 12", len(data))
+	}
+	if string(data[0:4]) != "EXTH" {
+		return nil, fmt.Errorf("invalid EXTH magic: got %q, want %q", string(data[0:4]), "EXTH")
+	}
+	length := binary.BigEndian.Uint32(data[4:8])
+	if length < 12 || int64(length) > int64(len(data)) {
+		return nil, fmt.Errorf("EXTH length %d out of range (%d bytes available)", length, len(data))
+	}
+	data = data[:length]
+
+	count := binary.BigEndian.Uint32(data[8:12])
+	h := &EXTHHeader{}
+	pos := 12
+	for i := uint32(0); i < count; i++ {
+		if pos+8 > len(data) {
+			return nil, fmt.Errorf("EXTH record %d truncated", i)
+		}
+		recType := binary.BigEndian.Uint32(data[pos : pos+4])
+		recLen := int(binary.BigEndian.Uint32(data[pos+4 : pos+8]))
+		if recLen < 8 || pos+recLen > len(data) {
+			return nil, fmt.Errorf("EXTH record %d (type %d) has invalid length %d", i, recType, recLen)
+		}
+		h.Records = append(h.Records, EXTHRecord{
+			Type: recType,
+			Data: data[pos+8 : pos+recLen],
+		})
+		pos += recLen
+	}
+	return h, nil
+}
+
+// Lookup returns the data of the first record of the given type.
+func (h *EXTHHeader) Lookup(recordType uint32) ([]byte, bool) {
+	for _, rec := range h.Records {
+		if rec.Type == recordType {
+			return rec.Data, true
+		}
+	}
+	return nil, false
+}
+
+// StringValue returns the first record of the given type as a string.
+func (h *EXTHHeader) StringValue(recordType uint32) (string, bool) {
+	data, ok := h.Lookup(recordType)
+	return string(data), ok
+}
+
+// Uint32Value returns the first record of the given type as a 4-byte big-endian integer.
+func (h *EXTHHeader) Uint32Value(recordType uint32) (uint32, bool) {
+	data, ok := h.Lookup(recordType)
+	if !ok || len(data) != 4 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint32(data), true
+}
+
+// exthTypeInfo describes a known EXTH record type.
+type exthTypeInfo struct {
+	name    string
+	numeric bool // data is a big-endian integer
+}
+
+// exthTypes lists the EXTH record types known to Kindle readers.
+var exthTypes = map[uint32]exthTypeInfo{
+	100: {name: "Author"},
+	101: {name: "Publisher"},
+	102: {name: "Imprint"},
+	103: {name: "Description"},
+	104: {name: "ISBN"},
+	105: {name: "Subject"},
+	106: {name: "Publishing date"},
+	107: {name: "Review"},
+	108: {name: "Contributor"},
+	109: {name: "Rights"},
+	110: {name: "Subject code"},
+	111: {name: "Type"},
+	112: {name: "Source"},
+	113: {name: "ASIN"},
+	114: {name: "Version number", numeric: true},
+	115: {name: "Sample", numeric: true},
+	116: {name: "Start reading", numeric: true},
+	117: {name: "Adult"},
+	118: {name: "Retail price"},
+	119: {name: "Retail price currency"},
+	121: {name: "KF8 boundary offset", numeric: true},
+	122: {name: "Fixed layout"},
+	123: {name: "Book type"},
+	124: {name: "Orientation lock"},
+	125: {name: "Resource count", numeric: true},
+	126: {name: "Original resolution"},
+	129: {name: "KF8 cover URI"},
+	131: {name: "Cover offset", numeric: true},
+	132: {name: "Region magnification"},
+	201: {name: "Cover offset", numeric: true},
+	202: {name: "Thumbnail offset", numeric: true},
+	203: {name: "Has fake cover", numeric: true},
+	204: {name: "Creator software", numeric: true},
+	205: {name: "Creator major version", numeric: true},
+	206: {name: "Creator minor version", numeric: true},
+	207: {name: "Creator build number", numeric: true},
+	208: {name: "Watermark"},
+	209: {name: "Tamper proof keys"},
+	300: {name: "Font signature"},
+	307: {name: "Original resolution"},
+	401: {name: "Clipping limit", numeric: true},
+	402: {name: "Publisher limit", numeric: true},
+	404: {name: "Text-to-speech disabled", numeric: true},
+	406: {name: "Rental expiration", numeric: true},
+	501: {name: "Document type"},
+	502: {name: "Last update time"},
+	503: {name: "Updated title"},
+	504: {name: "ASIN"},
+	524: {name: "Language"},
+	525: {name: "Primary writing mode"},
+	527: {name: "Page progression direction"},
+	528: {name: "Override Kindle fonts"},
+	534: {name: "Input source type"},
+	535: {name: "Creator build revision"},
+}
+
+// EXTHTypeName returns a human-readable name for an EXTH record type,
+// or "Unknown" for types not listed in exthTypes.
+func EXTHTypeName(recordType uint32) string {
+	if info, ok := exthTypes[recordType]; ok {
+		return info.name
+	}
+	return "Unknown"
+}
+
+// FormatEXTHValue decodes the record data by its type: integers for numeric
+// types, text for valid UTF-8, and hex for anything else.
+func FormatEXTHValue(rec EXTHRecord) string {
+	if exthTypes[rec.Type].numeric && len(rec.Data) > 0 && len(rec.Data) <= 4 {
+		var v uint32
+		for _, b := range rec.Data {
+			v = v<<8 | uint32(b)
+		}
+		return strconv.FormatUint(uint64(v), 10)
+	}
+	if utf8.Valid(rec.Data) {
+		return string(rec.Data)
+	}
+	return hex.EncodeToString(rec.Data)
+}
+
+// FixedLayout describes a Kindle fixed-layout book.
+type FixedLayout struct {
+	OriginalResolution string // page size as "<width>x<height>", e.g. "1072x1448"
+	BookType           string // "comic" or "children"; empty for other books
+	OrientationLock    string // "portrait", "landscape", or "none"; empty when not locked
+	// RegionMagnification marks a book with Panel View (app-amzn-magnify) regions.
+	RegionMagnification bool
+}
+
+// addEXTHRecords appends the fixed-layout records: 122 (fixed-layout), 123
+// (book type), 124 (orientation lock), the original resolution, which is
+// written as both 126 and 307, and 132 (region magnification).
+func (fl *FixedLayout) addEXTHRecords(h *EXTHHeader) {
+	h.AddStringRecord(122, "true")
+	if fl.BookType != "" {
+		h.AddStringRecord(123, fl.BookType)
+	}
+	if fl.OrientationLock != "" {
+		h.AddStringRecord(124, fl.OrientationLock)
+	}
+	if fl.OriginalResolution != "" {
+		h.AddStringRecord(126, fl.OriginalResolution)
+		h.AddStringRecord(307, fl.OriginalResolution)
+	}
+	if fl.RegionMagnification {
+		h.AddStringRecord(132, "true")
+	}
+}
+
 // EXTHFromMetadata creates an EXTHHeader populated from EPUB metadata.
 // Empty fields are skipped.
 func EXTHFromMetadata(meta epub.Metadata, boundaryOffset, recordCount uint32) *EXTHHeader {
@@ -771,3 +771,98 @@ func parseEXTHRecords(t *testing.T, data []byte) map[uint32][]string {
 
 	return result
 }
+
+func TestParseEXTH_RoundTrip(t *testing.T) {
+	h := NewEXTHHeader(7, 42)
+	h.AddStringRecord(100, "著者")
+	h.AddStringRecord(503, "Title")
+	h.AddUint32Record(131, 3)
+	data, err := h.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+
+	got, err := ParseEXTH(append(data, "trailing full name"...))
+	if err != nil {
+		t.Fatalf("ParseEXTH() error = %v", err)
+	}
+	if len(got.Records) != len(h.Records) {
+		t.Fatalf("record count = %d, want %d", len(got.Records), len(h.Records))
+	}
+	for i, rec := range got.Records {
+		if rec.Type != h.Records[i].Type || string(rec.Data) != string(h.Records[i].Data) {
+			t.Errorf("record %d = %+v, want %+v", i, rec, h.Records[i])
+		}
+	}
+
+	if v, ok := got.Uint32Value(121); !ok || v != 7 {
+		t.Errorf("Uint32Value(121) = %d, %v; want 7", v, ok)
+	}
+	if v, ok := got.StringValue(100); !ok || v != "著者" {
+		t.Errorf("StringValue(100) = %q, %v", v, ok)
+	}
+	if _, ok := got.Lookup(999); ok {
+		t.Error("Lookup(999) found a missing record")
+	}
+	if _, ok := got.Uint32Value(503); ok {
+		t.Error("Uint32Value(503) accepted a non 4-byte record")
+	}
+}
+
+func TestParseEXTH_Errors(t *testing.T) {
+	h := NewEXTHHeader(0, 0)
+	valid, _ := h.Bytes()
+
+	badLength := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint32(badLength[4:], 1000)
+
+	badRecord := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint32(badRecord[16:], 4)
+
+	tests := map[string][]byte{
+		"short":      valid[:8],
+		"bad magic":  append([]byte("HTXE"), valid[4:]...),
+		"bad length": badLength,
+		"bad record": badRecord,
+	}
+	for name, data := range tests {
+		if _, err := ParseEXTH(data); err == nil {
+			t.Errorf("%s: ParseEXTH() error = nil, want error", name)
+		}
+	}
+}
+
+func TestEXTHTypeName(t *testing.T) {
+	tests := map[uint32]string{
+		100:  "Author",
+		121:  "KF8 boundary offset",
+		524:  "Language",
+		9999: "Unknown",
+	}
+	for recordType, want := range tests {
+		if got := EXTHTypeName(recordType); got != want {
+			t.Errorf("EXTHTypeName(%d) = %q, want %q", recordType, got, want)
+		}
+	}
+}
+
+func TestFormatEXTHValue(t *testing.T) {
+	tests := []struct {
+		name string
+		rec  EXTHRecord
+		want string
+	}{
+		{"numeric", makeUint32Record(125, 42), "42"},
+		{"numeric single byte", EXTHRecord{Type: 401, Data: []byte{10}}, "10"},
+		{"string", EXTHRecord{Type: 100, Data: []byte("著者")}, "著者"},
+		{"unknown text", EXTHRecord{Type: 9999, Data: []byte("abc")}, "abc"},
+		{"binary", EXTHRecord{Type: 9999, Data: []byte{0xFF, 0x00}}, "ff00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatEXTHValue(tt.rec); got != tt.want {
+				t.Errorf("FormatEXTHValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
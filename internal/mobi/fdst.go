@@ -26,6 +26,24 @@ func NewFDSTSingleFlow(textLength uint32) *FDSTRecord {
 	}
 }
 
+// NewFDST creates an FDSTRecord for consecutive flows with the given lengths.
+// Flow 0 is the text flow; the remaining flows follow it in order.
+func NewFDST(flowLengths []uint32) *FDSTRecord {
+	entries := make([][2]uint32, len(flowLengths))
+	var start uint32
+	for i, length := range flowLengths {
+		entries[i] = [2]uint32{start, start + length}
+		start += length
+	}
+	return &FDSTRecord{Entries: entries}
+}
+
+// KindleFlowRef returns the kindle:flow reference for the flow with the given
+// index (1 is the first flow after the text flow).
+func KindleFlowRef(flowIndex int, mimeType string) string {
+	return fmt.Sprintf("kindle:flow:%s?mime=%s", toBase32(uint32(flowIndex), 4), mimeType)
+}
+
 // Bytes serializes the FDSTRecord into its binary representation.
 // Layout:
 //  1. "FDST" identifier (4 bytes)
@@ -68,3 +86,29 @@ func (f *FDSTRecord) Size() int {
 func (f *FDSTRecord) FlowCount() uint32 {
 	return uint32(len(f.Entries))
 }
+
+// ParseFDST decodes a serialized FDST record.
+func ParseFDST(data []byte) (*FDSTRecord, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("FDST record too short: got %d bytes, need at least 12", len(data))
+	}
+	if !bytes.Equal(data[0:4], fdstIdentifier[:]) {
+		return nil, fmt.Errorf("invalid FDST identifier: got %q, want %q", data[0:4], "FDST")
+	}
+
+	count := int(binary.BigEndian.Uint32(data[4:8]))
+	start := int(binary.BigEndian.Uint32(data[8:12]))
+	if start < 12 || start > len(data) || count > (len(data)-start)/8 {
+		return nil, fmt.Errorf("FDST entry table out of range: %d entries at offset %d in %d bytes", count, start, len(data))
+	}
+
+	entries := make([][2]uint32, count)
+	for i := range entries {
+		p := start + i*8
+		entries[i] = [2]uint32{
+			binary.BigEndian.Uint32(data[p : p+4]),
+			binary.BigEndian.Uint32(data[p+4 : p+8]),
+		}
+	}
+	return &FDSTRecord{Entries: entries}, nil
+}
@@ -162,3 +162,72 @@ func TestFDSTBytes_MultipleFlows(t *testing.T) {
 		t.Fatalf("data length = %d, want %d", len(data), 12+3*8)
 	}
 }
+
+func TestNewFDST(t *testing.T) {
+	fdst := NewFDST([]uint32{100, 20, 5})
+
+	want := [][2]uint32{{0, 100}, {100, 120}, {120, 125}}
+	if len(fdst.Entries) != len(want) {
+		t.Fatalf("entry count = %d, want %d", len(fdst.Entries), len(want))
+	}
+	for i, w := range want {
+		if fdst.Entries[i] != w {
+			t.Errorf("entry %d = %v, want %v", i, fdst.Entries[i], w)
+		}
+	}
+}
+
+func TestKindleFlowRef(t *testing.T) {
+	tests := []struct {
+		index int
+		mime  string
+		want  string
+	}{
+		{1, "text/css", "kindle:flow:0001?mime=text/css"},
+		{33, "image/svg+xml", "kindle:flow:0011?mime=image/svg+xml"},
+	}
+	for _, tt := range tests {
+		if got := KindleFlowRef(tt.index, tt.mime); got != tt.want {
+			t.Errorf("KindleFlowRef(%d, %q) = %q, want %q", tt.index, tt.mime, got, tt.want)
+		}
+	}
+}
+
+func TestParseFDST_RoundTrip(t *testing.T) {
+	fdst := NewFDST([]uint32{100, 20, 5})
+	data, err := fdst.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+
+	got, err := ParseFDST(data)
+	if err != nil {
+		t.Fatalf("ParseFDST() error = %v", err)
+	}
+	if len(got.Entries) != 3 {
+		t.Fatalf("entry count = %d, want 3", len(got.Entries))
+	}
+	for i, e := range got.Entries {
+		if e != fdst.Entries[i] {
+			t.Errorf("entry %d = %v, want %v", i, e, fdst.Entries[i])
+		}
+	}
+}
+
+func TestParseFDST_Errors(t *testing.T) {
+	valid, _ := NewFDSTSingleFlow(10).Bytes()
+
+	tooMany := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint32(tooMany[4:], 2)
+
+	tests := map[string][]byte{
+		"short":           valid[:8],
+		"bad identifier":  append([]byte("TSDF"), valid[4:]...),
+		"truncated table": tooMany,
+	}
+	for name, data := range tests {
+		if _, err := ParseFDST(data); err == nil {
+			t.Errorf("%s: ParseFDST() error = nil, want error", name)
+		}
+	}
+}
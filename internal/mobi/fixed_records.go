@@ -61,3 +61,9 @@ func EOFRecord() []byte {
 	binary.BigEndian.PutUint32(buf, 0xE98E0D0A)
 	return buf
 }
+
+// BoundaryRecord generates the 8-byte "BOUNDARY" record that separates the
+// MOBI7 section from the KF8 section in a joint MOBI7+KF8 file.
+func BoundaryRecord() []byte {
+	return []byte("BOUNDARY")
+}
@@ -212,3 +212,9 @@ func TestFCISRecord_MaxTextLength(t *testing.T) {
 		t.Fatalf("textLength = 0x%08X, want 0xFFFFFFFF", got)
 	}
 }
+
+func TestBoundaryRecord(t *testing.T) {
+	if got := string(BoundaryRecord()); got != "BOUNDARY" {
+		t.Errorf("BoundaryRecord() = %q, want %q", got, "BOUNDARY")
+	}
+}
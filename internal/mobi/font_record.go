@@ -0,0 +1,111 @@
+package mobi
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// FONT record flags.
+const (
+	FontFlagCompressed uint32 = 0x1 // font data is zlib-compressed
+	FontFlagObfuscated uint32 = 0x2 // the start of the stored data is XORed with a key
+)
+
+const (
+	// fontRecordHeaderSize is the size of the FONT record header:
+	// magic, decompressed size, flags, data offset, key length, key offset.
+	fontRecordHeaderSize = 24
+	// fontObfuscatedLength is the number of leading data bytes XORed with the key.
+	fontObfuscatedLength = 1040
+)
+
+// NewFontRecord builds a KF8 FONT record holding a TrueType/OpenType font.
+// The font is zlib-compressed. When obfuscate is true and the compressed data
+// is long enough, its first 1040 bytes are XORed with a 20-byte key stored in
+// the record header. The key is the SHA-1 of the font, so output is reproducible.
+func NewFontRecord(font []byte, obfuscate bool) ([]byte, error) {
+	var compressed bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create zlib writer: %w", err)
+	}
+	if _, err := zw.Write(font); err != nil {
+		return nil, fmt.Errorf("failed to compress font: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress font: %w", err)
+	}
+	data := compressed.Bytes()
+
+	flags := FontFlagCompressed
+	var key []byte
+	if obfuscate && len(data) >= fontObfuscatedLength {
+		flags |= FontFlagObfuscated
+		sum := sha1.Sum(font)
+		key = sum[:]
+		xorFontData(data, key)
+	}
+
+	rec := make([]byte, fontRecordHeaderSize, fontRecordHeaderSize+len(key)+len(data))
+	copy(rec[0:4], "FONT")
+	binary.BigEndian.PutUint32(rec[4:8], uint32(len(font)))
+	binary.BigEndian.PutUint32(rec[8:12], flags)
+	binary.BigEndian.PutUint32(rec[12:16], uint32(fontRecordHeaderSize+len(key)))
+	binary.BigEndian.PutUint32(rec[16:20], uint32(len(key)))
+	binary.BigEndian.PutUint32(rec[20:24], fontRecordHeaderSize)
+	rec = append(rec, key...)
+	rec = append(rec, data...)
+	return rec, nil
+}
+
+// DecodeFontRecord returns the font stored in a FONT record, undoing the
+// obfuscation and compression indicated by its flags.
+func DecodeFontRecord(rec []byte) ([]byte, error) {
+	if len(rec) < fontRecordHeaderSize || string(rec[0:4]) != "FONT" {
+		return nil, fmt.Errorf("not a FONT record")
+	}
+	size := binary.BigEndian.Uint32(rec[4:8])
+	flags := binary.BigEndian.Uint32(rec[8:12])
+	dataOffset := binary.BigEndian.Uint32(rec[12:16])
+	keyLength := binary.BigEndian.Uint32(rec[16:20])
+	keyOffset := binary.BigEndian.Uint32(rec[20:24])
+	if uint64(dataOffset) > uint64(len(rec)) {
+		return nil, fmt.Errorf("FONT data offset %d is beyond the record (%d bytes)", dataOffset, len(rec))
+	}
+	data := bytes.Clone(rec[dataOffset:])
+
+	if flags&FontFlagObfuscated != 0 {
+		if keyLength == 0 || uint64(keyOffset)+uint64(keyLength) > uint64(len(rec)) {
+			return nil, fmt.Errorf("FONT key [%d, %d) is outside the record (%d bytes)", keyOffset, uint64(keyOffset)+uint64(keyLength), len(rec))
+		}
+		xorFontData(data, rec[keyOffset:keyOffset+keyLength])
+	}
+
+	if flags&FontFlagCompressed != 0 {
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress font: %w", err)
+		}
+		defer zr.Close()
+		data, err = io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress font: %w", err)
+		}
+	}
+
+	if uint32(len(data)) != size {
+		return nil, fmt.Errorf("font is %d bytes, FONT header says %d", len(data), size)
+	}
+	return data, nil
+}
+
+// xorFontData XORs the first 1040 bytes of data with key in place.
+func xorFontData(data, key []byte) {
+	for i := 0; i < fontObfuscatedLength && i < len(data); i++ {
+		data[i] ^= key[i%len(key)]
+	}
+}
@@ -0,0 +1,108 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand/v2"
+	"testing"
+)
+
+// testFontData returns size bytes of incompressible data starting with the
+// TrueType signature.
+func testFontData(size int) []byte {
+	data := make([]byte, size)
+	rand.NewChaCha8([32]byte{1}).Read(data)
+	copy(data, []byte{0x00, 0x01, 0x00, 0x00})
+	return data
+}
+
+func TestNewFontRecord_Header(t *testing.T) {
+	font := testFontData(4096)
+	rec, err := NewFontRecord(font, true)
+	if err != nil {
+		t.Fatalf("NewFontRecord() error = %v", err)
+	}
+
+	if string(rec[0:4]) != "FONT" {
+		t.Errorf("magic = %q, want FONT", rec[0:4])
+	}
+	if size := binary.BigEndian.Uint32(rec[4:8]); size != 4096 {
+		t.Errorf("decompressed size = %d, want 4096", size)
+	}
+	if flags := binary.BigEndian.Uint32(rec[8:12]); flags != FontFlagCompressed|FontFlagObfuscated {
+		t.Errorf("flags = %#x, want %#x", flags, FontFlagCompressed|FontFlagObfuscated)
+	}
+	if off := binary.BigEndian.Uint32(rec[12:16]); off != 24+20 {
+		t.Errorf("data offset = %d, want 44", off)
+	}
+	if keyLen, keyOff := binary.BigEndian.Uint32(rec[16:20]), binary.BigEndian.Uint32(rec[20:24]); keyLen != 20 || keyOff != 24 {
+		t.Errorf("key = %d bytes at %d, want 20 bytes at 24", keyLen, keyOff)
+	}
+	if bytes.Contains(rec, font[:64]) {
+		t.Error("FONT record contains the font data in the clear")
+	}
+
+	again, err := NewFontRecord(font, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rec, again) {
+		t.Error("NewFontRecord() is not deterministic")
+	}
+}
+
+func TestFontRecord_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		font      []byte
+		obfuscate bool
+		wantFlags uint32
+	}{
+		{"obfuscated", testFontData(4096), true, FontFlagCompressed | FontFlagObfuscated},
+		{"compressed only", testFontData(4096), false, FontFlagCompressed},
+		{"too short to obfuscate", testFontData(100), true, FontFlagCompressed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, err := NewFontRecord(tt.font, tt.obfuscate)
+			if err != nil {
+				t.Fatalf("NewFontRecord() error = %v", err)
+			}
+			if flags := binary.BigEndian.Uint32(rec[8:12]); flags != tt.wantFlags {
+				t.Errorf("flags = %#x, want %#x", flags, tt.wantFlags)
+			}
+			got, err := DecodeFontRecord(rec)
+			if err != nil {
+				t.Fatalf("DecodeFontRecord() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.font) {
+				t.Error("decoded font does not match the original")
+			}
+		})
+	}
+}
+
+func TestDecodeFontRecord_Errors(t *testing.T) {
+	valid, err := NewFontRecord(testFontData(4096), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		modify func([]byte) []byte
+	}{
+		{"not a FONT record", func(b []byte) []byte { return []byte("INDX0000000000000000000000") }},
+		{"truncated header", func(b []byte) []byte { return b[:10] }},
+		{"data offset beyond record", func(b []byte) []byte { binary.BigEndian.PutUint32(b[12:16], 1<<20); return b }},
+		{"key beyond record", func(b []byte) []byte { binary.BigEndian.PutUint32(b[20:24], 1<<20); return b }},
+		{"wrong size", func(b []byte) []byte { binary.BigEndian.PutUint32(b[4:8], 1); return b }},
+		{"corrupt data", func(b []byte) []byte { return b[:60] }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeFontRecord(tt.modify(bytes.Clone(valid))); err == nil {
+				t.Error("DecodeFontRecord() error = nil, want error")
+			}
+		})
+	}
+}
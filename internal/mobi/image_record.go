@@ -41,6 +41,21 @@ func (m *ImageMapper) AddImage(path string, data []byte, mediaType string) {
 	})
 }
 
+// AddFont adds a TrueType/OpenType font to the mapper as an obfuscated FONT
+// record (see NewFontRecord). Fonts share the resource numbering of images.
+// Duplicate paths are skipped.
+func (m *ImageMapper) AddFont(path string, font []byte, mediaType string) error {
+	if _, exists := m.PathToIndex[path]; exists {
+		return nil
+	}
+	rec, err := NewFontRecord(font, true)
+	if err != nil {
+		return fmt.Errorf("failed to build FONT record for %s: %w", path, err)
+	}
+	m.AddImage(path, rec, mediaType)
+	return nil
+}
+
 // KindleEmbedRef returns the kindle:embed:XXXX reference for a given image path.
 // The XXXX is the 1-based index as a 4-digit zero-padded hexadecimal number.
 func (m *ImageMapper) KindleEmbedRef(path string) (string, bool) {
@@ -48,8 +63,14 @@ func (m *ImageMapper) KindleEmbedRef(path string) (string, bool) {
 	if !ok {
 		return "", false
 	}
+	return KindleEmbedIndexRef(idx), true
+}
+
+// KindleEmbedIndexRef returns the kindle:embed:XXXX reference for the image
+// record with the given 0-based index.
+func KindleEmbedIndexRef(idx int) string {
 	// kindle:embed uses 1-based indexing
-	return fmt.Sprintf("kindle:embed:%04X", idx+1), true
+	return fmt.Sprintf("kindle:embed:%04X", idx+1)
 }
 
 // ImageRecordData returns the raw image data for each image record,
@@ -68,6 +89,33 @@ func (m *ImageMapper) ImageRecordData() [][]byte {
 // imgSrcRe matches <img src="..."> attributes in HTML.
 var imgSrcRe = regexp.MustCompile(`(<img\s[^>]*?)src="([^"]*)"`)
 
+// CSSURLRe matches url(...) values in CSS, with or without quotes. The URL is
+// in submatch 1 (double quotes), 2 (single quotes) or 3 (unquoted).
+var CSSURLRe = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)`)
+
+// TransformCSSReferences replaces url(...) values in CSS, such as @font-face
+// src URLs, with kindle:embed:XXXX?mime=type references using the provided
+// ImageMapper. URLs must already be resolved to EPUB paths.
+func TransformCSSReferences(css string, mapper *ImageMapper) string {
+	if mapper == nil || len(mapper.Images) == 0 {
+		return css
+	}
+
+	return CSSURLRe.ReplaceAllStringFunc(css, func(match string) string {
+		submatch := CSSURLRe.FindStringSubmatch(match)
+		path := submatch[1] + submatch[2] + submatch[3]
+
+		ref, ok := mapper.KindleEmbedRef(path)
+		if !ok {
+			return match
+		}
+		if mediaType := mapper.Images[mapper.PathToIndex[path]].MediaType; mediaType != "" {
+			ref += "?mime=" + mediaType
+		}
+		return "url(" + ref + ")"
+	})
+}
+
 // TransformImageReferences replaces img src attributes in HTML with
 // kindle:embed:XXXX references using the provided ImageMapper.
 func TransformImageReferences(html string, mapper *ImageMapper) string {
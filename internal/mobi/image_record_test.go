@@ -208,3 +208,57 @@ func TestImageMapper_DuplicatePath(t *testing.T) {
 		t.Fatalf("expected 1 image (duplicate skipped), got %d", len(m.Images))
 	}
 }
+
+func TestImageMapper_AddFont(t *testing.T) {
+	m := NewImageMapper()
+	m.AddImage("images/cover.jpg", []byte("data"), "image/jpeg")
+	font := testFontData(2048)
+	if err := m.AddFont("fonts/gaiji.ttf", font, "application/x-font-truetype"); err != nil {
+		t.Fatalf("AddFont() error = %v", err)
+	}
+	if err := m.AddFont("fonts/gaiji.ttf", []byte("other"), "application/x-font-truetype"); err != nil {
+		t.Fatalf("AddFont() duplicate error = %v", err)
+	}
+
+	if len(m.Images) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(m.Images))
+	}
+	ref, ok := m.KindleEmbedRef("fonts/gaiji.ttf")
+	if !ok || ref != "kindle:embed:0002" {
+		t.Fatalf("KindleEmbedRef() = %q, %v, want kindle:embed:0002", ref, ok)
+	}
+	decoded, err := DecodeFontRecord(m.ImageRecordData()[1])
+	if err != nil {
+		t.Fatalf("DecodeFontRecord() error = %v", err)
+	}
+	if string(decoded) != string(font) {
+		t.Fatal("font record does not hold the added font")
+	}
+}
+
+func TestTransformCSSReferences(t *testing.T) {
+	m := NewImageMapper()
+	m.AddImage("OEBPS/images/bg.png", []byte("data"), "image/png")
+	if err := m.AddFont("OEBPS/fonts/gaiji.ttf", testFontData(100), "application/x-font-truetype"); err != nil {
+		t.Fatal(err)
+	}
+
+	css := `@font-face { font-family: "Gaiji"; src: url("OEBPS/fonts/gaiji.ttf") format("truetype"); }
+@font-face { font-family: "Other"; src: url(OEBPS/fonts/missing.otf); }
+body { background: url( 'OEBPS/images/bg.png' ); }`
+	result := TransformCSSReferences(css, m)
+
+	for _, want := range []string{
+		`src: url(kindle:embed:0002?mime=application/x-font-truetype) format("truetype")`,
+		`src: url(OEBPS/fonts/missing.otf)`,
+		`background: url(kindle:embed:0001?mime=image/png)`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in result:\n%s", want, result)
+		}
+	}
+
+	if got := TransformCSSReferences(css, nil); got != css {
+		t.Error("nil mapper should return unchanged CSS")
+	}
+}
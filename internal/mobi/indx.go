@@ -0,0 +1,530 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	// NullIndex marks an absent record index in MOBI header index fields.
+	NullIndex uint32 = 0xFFFFFFFF
+
+	// indxHeaderLength is the fixed length of every INDX record header.
+	indxHeaderLength = 192
+
+	// indxRecordLimit is the maximum size of a single INDX entry record.
+	// KindleGen keeps a 1048-byte margin below the 64 KiB PDB record limit.
+	indxRecordLimit = 0x10000 - indxHeaderLength - 1048
+
+	// cncxRecordLimit is the maximum size of a single CNCX string record.
+	cncxRecordLimit = 0x10000 - 1024
+
+	// cncxMaxStringLength is the maximum number of bytes stored for one CNCX string.
+	cncxMaxStringLength = 500
+)
+
+// IndexTag describes a single TAGX table entry of an INDX index.
+// An entry with EndFlag set to 1 terminates a control byte group.
+type IndexTag struct {
+	Number         uint8
+	ValuesPerEntry uint8
+	Mask           uint8
+	EndFlag        uint8
+}
+
+// indexEndTag terminates a control byte group in the TAGX table.
+var indexEndTag = IndexTag{EndFlag: 1}
+
+// IndexEntry is a single labelled entry of an INDX index.
+// Values maps a tag number to the values written for that tag.
+type IndexEntry struct {
+	Label  string
+	Values map[uint8][]uint32
+}
+
+// IndexDefinition describes the layout of an INDX index.
+type IndexDefinition struct {
+	Tags             []IndexTag
+	ControlByteCount int
+}
+
+// CNCXBuilder collects the strings referenced by an index and assigns
+// each one an offset in the CNCX records.
+type CNCXBuilder struct {
+	records [][]byte
+	current bytes.Buffer
+	offsets map[string]uint32
+}
+
+// NewCNCXBuilder creates an empty CNCXBuilder.
+func NewCNCXBuilder() *CNCXBuilder {
+	return &CNCXBuilder{
+		offsets: make(map[string]uint32),
+	}
+}
+
+// Add stores s (once) and returns its CNCX offset.
+// The offset encodes the CNCX record number in the high 16 bits and
+// the position within that record in the low 16 bits.
+func (c *CNCXBuilder) Add(s string) uint32 {
+	if off, ok := c.offsets[s]; ok {
+		return off
+	}
+
+	data := []byte(s)
+	if len(data) > cncxMaxStringLength {
+		data = truncateUTF8(data, cncxMaxStringLength)
+	}
+	raw := append(EncodeVarint(uint32(len(data))), data...)
+
+	if c.current.Len()+len(raw) > cncxRecordLimit {
+		c.records = append(c.records, alignBlock(c.current.Bytes()))
+		c.current.Reset()
+	}
+
+	off := uint32(len(c.records))*0x10000 + uint32(c.current.Len())
+	c.current.Write(raw)
+	c.offsets[s] = off
+	return off
+}
+
+// Records returns the serialized CNCX records, each padded to 4 bytes.
+func (c *CNCXBuilder) Records() [][]byte {
+	records := make([][]byte, 0, len(c.records)+1)
+	records = append(records, c.records...)
+	if c.current.Len() > 0 {
+		records = append(records, alignBlock(c.current.Bytes()))
+	}
+	return records
+}
+
+// EncodeVarint encodes v as a forward variable-width integer:
+// big-endian groups of 7 bits, with the high bit set on the last byte.
+func EncodeVarint(v uint32) []byte {
+	var groups []byte
+	for {
+		groups = append(groups, byte(v&0x7F))
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	groups[0] |= 0x80
+
+	out := make([]byte, len(groups))
+	for i, b := range groups {
+		out[len(groups)-1-i] = b
+	}
+	return out
+}
+
+// DecodeVarint decodes a forward variable-width integer from the start of data.
+// It returns the value and the number of bytes consumed.
+func DecodeVarint(data []byte) (uint32, int, error) {
+	var v uint32
+	for i, b := range data {
+		if i >= 5 {
+			break
+		}
+		v = v<<7 | uint32(b&0x7F)
+		if b&0x80 != 0 {
+			return v, i + 1, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("unterminated variable-width integer")
+}
+
+// BuildIndexRecords serializes entries into an INDX header record followed by
+// one or more INDX entry records. cncxCount is the number of CNCX records that
+// the caller places directly after the returned records.
+func BuildIndexRecords(def IndexDefinition, entries []IndexEntry, cncxCount int) ([][]byte, error) {
+	type block struct {
+		entries   bytes.Buffer
+		idxt      bytes.Buffer
+		count     int
+		lastLabel string
+	}
+
+	blocks := []*block{{}}
+	for i, entry := range entries {
+		raw, err := encodeIndexEntry(def, entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode index entry %d: %w", i, err)
+		}
+
+		cur := blocks[len(blocks)-1]
+		if cur.count > 0 && cur.entries.Len()+cur.idxt.Len()+len(raw)+2 > indxRecordLimit {
+			cur = &block{}
+			blocks = append(blocks, cur)
+		}
+
+		if err := binary.Write(&cur.idxt, binary.BigEndian, uint16(indxHeaderLength+cur.entries.Len())); err != nil {
+			return nil, fmt.Errorf("failed to write IDXT entry: %w", err)
+		}
+		cur.entries.Write(raw)
+		cur.count++
+		cur.lastLabel = entry.Label
+	}
+
+	records := make([][]byte, 0, len(blocks)+1)
+	records = append(records, nil) // header record, filled in below
+
+	for _, b := range blocks {
+		entryBlock := alignBlock(b.entries.Bytes())
+		idxtBlock := alignBlock(append([]byte("IDXT"), b.idxt.Bytes()...))
+
+		buf := &bytes.Buffer{}
+		buf.WriteString("INDX")
+		fields := []any{
+			uint32(indxHeaderLength), // 4: header length
+			uint32(0),                // 8: unknown
+			uint32(1),                // 12: header type (1 = entry record)
+			uint32(0),                // 16: unknown
+			uint32(indxHeaderLength + len(entryBlock)), // 20: IDXT offset
+			uint32(b.count),    // 24: entry count
+			uint32(0xFFFFFFFF), // 28: unknown
+			uint32(0xFFFFFFFF), // 32: unknown
+		}
+		for _, f := range fields {
+			if err := binary.Write(buf, binary.BigEndian, f); err != nil {
+				return nil, fmt.Errorf("failed to write INDX record header: %w", err)
+			}
+		}
+		buf.Write(make([]byte, indxHeaderLength-buf.Len()))
+		buf.Write(entryBlock)
+		buf.Write(idxtBlock)
+
+		if buf.Len() > 0x10000 {
+			return nil, fmt.Errorf("INDX record too large: %d bytes", buf.Len())
+		}
+		records = append(records, buf.Bytes())
+	}
+
+	header, err := buildIndexHeaderRecord(def, len(entries), len(blocks), cncxCount, func(geo *bytes.Buffer, idxt *bytes.Buffer, base int) error {
+		for _, b := range blocks {
+			if err := binary.Write(idxt, binary.BigEndian, uint16(base+geo.Len())); err != nil {
+				return err
+			}
+			geo.WriteByte(byte(len(b.lastLabel)))
+			geo.WriteString(b.lastLabel)
+			if err := binary.Write(geo, binary.BigEndian, uint16(b.count)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	records[0] = header
+
+	return records, nil
+}
+
+// buildIndexHeaderRecord builds the INDX header record: the fixed header,
+// the TAGX table, the per-record geometry entries and their IDXT.
+func buildIndexHeaderRecord(def IndexDefinition, entryCount, recordCount, cncxCount int, writeGeometry func(geo, idxt *bytes.Buffer, base int) error) ([]byte, error) {
+	tagx := buildTAGX(def)
+
+	geo := &bytes.Buffer{}
+	idxt := &bytes.Buffer{}
+	idxt.WriteString("IDXT")
+	if err := writeGeometry(geo, idxt, indxHeaderLength+len(tagx)); err != nil {
+		return nil, fmt.Errorf("failed to write index geometry: %w", err)
+	}
+	geoBlock := alignBlock(geo.Bytes())
+	idxtBlock := alignBlock(idxt.Bytes())
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("INDX")
+	fields := []any{
+		uint32(indxHeaderLength), // 4: header length
+		uint32(0),                // 8: unknown
+		uint32(0),                // 12: unknown
+		uint32(2),                // 16: index type
+		uint32(indxHeaderLength + len(tagx) + len(geoBlock)), // 20: IDXT offset
+		uint32(recordCount), // 24: number of index records
+		EncodingUTF8,        // 28: index encoding
+		uint32(0xFFFFFFFF),  // 32: unknown
+		uint32(entryCount),  // 36: number of index entries
+		uint32(0),           // 40: ORDT offset
+		uint32(0),           // 44: LIGT offset
+		uint32(0),           // 48: number of ORDT/LIGT entries
+		uint32(cncxCount),   // 52: number of CNCX records
+	}
+	for _, f := range fields {
+		if err := binary.Write(buf, binary.BigEndian, f); err != nil {
+			return nil, fmt.Errorf("failed to write INDX header: %w", err)
+		}
+	}
+	// Offsets 56-179: unknown
+	buf.Write(make([]byte, 180-buf.Len()))
+	// Offset 180: TAGX offset
+	if err := binary.Write(buf, binary.BigEndian, uint32(indxHeaderLength)); err != nil {
+		return nil, fmt.Errorf("failed to write TAGX offset: %w", err)
+	}
+	buf.Write(make([]byte, indxHeaderLength-buf.Len()))
+
+	buf.Write(tagx)
+	buf.Write(geoBlock)
+	buf.Write(idxtBlock)
+	return buf.Bytes(), nil
+}
+
+// buildTAGX serializes the TAGX table for the index definition.
+func buildTAGX(def IndexDefinition) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString("TAGX")
+	_ = binary.Write(buf, binary.BigEndian, uint32(12+4*len(def.Tags)))
+	_ = binary.Write(buf, binary.BigEndian, uint32(def.ControlByteCount))
+	for _, t := range def.Tags {
+		buf.Write([]byte{t.Number, t.ValuesPerEntry, t.Mask, t.EndFlag})
+	}
+	return buf.Bytes()
+}
+
+// encodeIndexEntry serializes a single entry:
+// label length + label + control bytes + tag values.
+func encodeIndexEntry(def IndexDefinition, entry IndexEntry) ([]byte, error) {
+	if len(entry.Label) > 0xFF {
+		return nil, fmt.Errorf("label too long: %d bytes", len(entry.Label))
+	}
+
+	controlBytes := make([]byte, 0, def.ControlByteCount)
+	var cb byte
+	for _, t := range def.Tags {
+		if t.EndFlag == 1 {
+			controlBytes = append(controlBytes, cb)
+			cb = 0
+			continue
+		}
+		values := entry.Values[t.Number]
+		if len(values) == 0 {
+			continue
+		}
+		if len(values)%int(t.ValuesPerEntry) != 0 {
+			return nil, fmt.Errorf("tag %d: %d values is not a multiple of %d", t.Number, len(values), t.ValuesPerEntry)
+		}
+		n := len(values) / int(t.ValuesPerEntry)
+		shift := bits.TrailingZeros8(t.Mask)
+		if (n<<shift)&^int(t.Mask) != 0 {
+			return nil, fmt.Errorf("tag %d: %d value groups do not fit mask 0x%02X", t.Number, n, t.Mask)
+		}
+		cb |= byte(n<<shift) & t.Mask
+	}
+	if len(controlBytes) != def.ControlByteCount {
+		return nil, fmt.Errorf("got %d control bytes, want %d", len(controlBytes), def.ControlByteCount)
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteByte(byte(len(entry.Label)))
+	buf.WriteString(entry.Label)
+	buf.Write(controlBytes)
+	for _, t := range def.Tags {
+		if t.EndFlag == 1 {
+			continue
+		}
+		for _, v := range entry.Values[t.Number] {
+			buf.Write(EncodeVarint(v))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Index is a decoded INDX index: its TAGX definition, its entries in index
+// order and the CNCX records holding the strings the entries refer to.
+type Index struct {
+	Definition IndexDefinition
+	Entries    []IndexEntry
+	CNCX       [][]byte
+}
+
+// IndexRecordCounts returns the number of entry records and CNCX records that
+// follow an INDX header record.
+func IndexRecordCounts(header []byte) (entryRecords, cncxRecords int, err error) {
+	if len(header) < indxHeaderLength || string(header[0:4]) != "INDX" {
+		return 0, 0, fmt.Errorf("invalid INDX header record")
+	}
+	return int(binary.BigEndian.Uint32(header[24:28])), int(binary.BigEndian.Uint32(header[52:56])), nil
+}
+
+// ParseIndex decodes an index from its header record followed by its entry
+// records and CNCX records, in the order BuildIndexRecords and the CNCX
+// builder lay them out.
+func ParseIndex(records [][]byte) (*Index, error) {
+	if len(records) == 0 {
+		return nil, fmt.Errorf("missing INDX header record")
+	}
+	header := records[0]
+	entryCount, cncxCount, err := IndexRecordCounts(header)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) < 1+entryCount+cncxCount {
+		return nil, fmt.Errorf("index needs %d records, got %d", 1+entryCount+cncxCount, len(records))
+	}
+
+	def, err := parseTAGX(header)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &Index{
+		Definition: def,
+		CNCX:       records[1+entryCount : 1+entryCount+cncxCount],
+	}
+	for i, record := range records[1 : 1+entryCount] {
+		entries, err := parseIndexEntries(def, record)
+		if err != nil {
+			return nil, fmt.Errorf("INDX record %d: %w", i, err)
+		}
+		idx.Entries = append(idx.Entries, entries...)
+	}
+	return idx, nil
+}
+
+// CNCXString returns the string stored at a CNCX offset (see CNCXBuilder.Add).
+func (idx *Index) CNCXString(offset uint32) (string, error) {
+	rec := int(offset / 0x10000)
+	pos := int(offset % 0x10000)
+	if rec >= len(idx.CNCX) || pos >= len(idx.CNCX[rec]) {
+		return "", fmt.Errorf("CNCX offset 0x%X out of range", offset)
+	}
+	data := idx.CNCX[rec][pos:]
+	n, size, err := DecodeVarint(data)
+	if err != nil {
+		return "", fmt.Errorf("CNCX offset 0x%X: %w", offset, err)
+	}
+	if size+int(n) > len(data) {
+		return "", fmt.Errorf("CNCX offset 0x%X: string length %d exceeds record", offset, n)
+	}
+	return string(data[size : size+int(n)]), nil
+}
+
+// parseTAGX decodes the TAGX table referenced by an INDX header record.
+func parseTAGX(header []byte) (IndexDefinition, error) {
+	start := int(binary.BigEndian.Uint32(header[180:184]))
+	if start+12 > len(header) || string(header[start:start+4]) != "TAGX" {
+		return IndexDefinition{}, fmt.Errorf("TAGX table not found at offset %d", start)
+	}
+	length := int(binary.BigEndian.Uint32(header[start+4 : start+8]))
+	if length < 12 || start+length > len(header) {
+		return IndexDefinition{}, fmt.Errorf("TAGX length %d out of range", length)
+	}
+
+	def := IndexDefinition{ControlByteCount: int(binary.BigEndian.Uint32(header[start+8 : start+12]))}
+	for p := start + 12; p+4 <= start+length; p += 4 {
+		def.Tags = append(def.Tags, IndexTag{
+			Number:         header[p],
+			ValuesPerEntry: header[p+1],
+			Mask:           header[p+2],
+			EndFlag:        header[p+3],
+		})
+	}
+	return def, nil
+}
+
+// parseIndexEntries decodes the entries of a single INDX entry record via its IDXT.
+func parseIndexEntries(def IndexDefinition, record []byte) ([]IndexEntry, error) {
+	if len(record) < indxHeaderLength || string(record[0:4]) != "INDX" {
+		return nil, fmt.Errorf("invalid INDX entry record")
+	}
+	idxt := int(binary.BigEndian.Uint32(record[20:24]))
+	count := int(binary.BigEndian.Uint32(record[24:28]))
+	if idxt+4+2*count > len(record) || string(record[idxt:idxt+4]) != "IDXT" {
+		return nil, fmt.Errorf("IDXT not found at offset %d", idxt)
+	}
+
+	entries := make([]IndexEntry, 0, count)
+	for i := 0; i < count; i++ {
+		start := int(binary.BigEndian.Uint16(record[idxt+4+2*i:]))
+		end := idxt
+		if i+1 < count {
+			end = int(binary.BigEndian.Uint16(record[idxt+4+2*(i+1):]))
+		}
+		if start >= end || end > len(record) {
+			return nil, fmt.Errorf("entry %d out of range", i)
+		}
+		entry, err := decodeIndexEntry(def, record[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// decodeIndexEntry decodes a single entry: label length + label + control bytes
+// + tag values. A multi-bit mask that is completely set means the value count
+// is stored as a varint before the values.
+func decodeIndexEntry(def IndexDefinition, data []byte) (IndexEntry, error) {
+	labelLen := int(data[0])
+	if 1+labelLen+def.ControlByteCount > len(data) {
+		return IndexEntry{}, fmt.Errorf("entry header truncated")
+	}
+	entry := IndexEntry{
+		Label:  string(data[1 : 1+labelLen]),
+		Values: make(map[uint8][]uint32),
+	}
+	controlBytes := data[1+labelLen : 1+labelLen+def.ControlByteCount]
+	pos := 1 + labelLen + def.ControlByteCount
+
+	group := 0
+	for _, t := range def.Tags {
+		if t.EndFlag == 1 {
+			group++
+			continue
+		}
+		if group >= len(controlBytes) || t.Mask == 0 {
+			continue
+		}
+		masked := controlBytes[group] & t.Mask
+		if masked == 0 {
+			continue
+		}
+
+		var valueCount int
+		if masked == t.Mask && bits.OnesCount8(t.Mask) > 1 {
+			n, size, err := DecodeVarint(data[pos:])
+			if err != nil {
+				return IndexEntry{}, fmt.Errorf("tag %d: %w", t.Number, err)
+			}
+			pos += size
+			valueCount = int(n)
+		} else {
+			valueCount = int(masked>>bits.TrailingZeros8(t.Mask)) * int(t.ValuesPerEntry)
+		}
+
+		for j := 0; j < valueCount; j++ {
+			v, size, err := DecodeVarint(data[pos:])
+			if err != nil {
+				return IndexEntry{}, fmt.Errorf("tag %d: %w", t.Number, err)
+			}
+			entry.Values[t.Number] = append(entry.Values[t.Number], v)
+			pos += size
+		}
+	}
+	return entry, nil
+}
+
+// alignBlock pads data with zero bytes to a 4-byte boundary.
+func alignBlock(data []byte) []byte {
+	pad := (4 - len(data)%4) % 4
+	out := make([]byte, len(data), len(data)+pad)
+	copy(out, data)
+	return append(out, make([]byte, pad)...)
+}
+
+// truncateUTF8 truncates data to at most n bytes without splitting a UTF-8 sequence.
+func truncateUTF8(data []byte, n int) []byte {
+	if len(data) <= n {
+		return data
+	}
+	end := n
+	for end > 0 && data[end]&0xC0 == 0x80 {
+		end--
+	}
+	return data[:end]
+}
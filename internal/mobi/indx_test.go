@@ -0,0 +1,331 @@
+package mobi
+
+import (
+	"bytes"
+	"fmt"
+	"math/bits"
+	"strings"
+	"testing"
+)
+
+func TestEncodeVarint(t *testing.T) {
+	tests := []struct {
+		value uint32
+		want  []byte
+	}{
+		{0, []byte{0x80}},
+		{0x7F, []byte{0xFF}},
+		{0x80, []byte{0x01, 0x80}},
+		{0x3FFF, []byte{0x7F, 0xFF}},
+		{0x4000, []byte{0x01, 0x00, 0x80}},
+	}
+
+	for _, tt := range tests {
+		got := EncodeVarint(tt.value)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("EncodeVarint(%d) = %X, want %X", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeVarint_RoundTrip(t *testing.T) {
+	for _, v := range []uint32{0, 1, 127, 128, 300, 16383, 16384, 1 << 21, 0xFFFFFFFF} {
+		encoded := EncodeVarint(v)
+		got, n, err := DecodeVarint(append(encoded, 0xAA))
+		if err != nil {
+			t.Fatalf("DecodeVarint(%X) error = %v", encoded, err)
+		}
+		if got != v || n != len(encoded) {
+			t.Errorf("DecodeVarint(%X) = (%d, %d), want (%d, %d)", encoded, got, n, v, len(encoded))
+		}
+	}
+}
+
+func TestDecodeVarint_Unterminated(t *testing.T) {
+	if _, _, err := DecodeVarint([]byte{0x01, 0x02}); err == nil {
+		t.Error("DecodeVarint should fail for unterminated input")
+	}
+}
+
+func TestCNCXBuilder(t *testing.T) {
+	c := NewCNCXBuilder()
+	off1 := c.Add("first")
+	off2 := c.Add("second")
+	off3 := c.Add("first")
+
+	if off1 != 0 {
+		t.Errorf("first offset = %d, want 0", off1)
+	}
+	if off2 != 6 {
+		t.Errorf("second offset = %d, want 6", off2)
+	}
+	if off3 != off1 {
+		t.Errorf("duplicate string offset = %d, want %d", off3, off1)
+	}
+
+	records := c.Records()
+	if len(records) != 1 {
+		t.Fatalf("record count = %d, want 1", len(records))
+	}
+	if len(records[0])%4 != 0 {
+		t.Errorf("CNCX record length %d is not 4-byte aligned", len(records[0]))
+	}
+	if got := string(records[0][1:6]); got != "first" {
+		t.Errorf("first string = %q, want %q", got, "first")
+	}
+}
+
+func TestCNCXBuilder_Empty(t *testing.T) {
+	if records := NewCNCXBuilder().Records(); len(records) != 0 {
+		t.Errorf("record count = %d, want 0", len(records))
+	}
+}
+
+func TestBuildIndexRecords(t *testing.T) {
+	def := IndexDefinition{
+		Tags: []IndexTag{
+			{Number: 1, ValuesPerEntry: 1, Mask: 0x01},
+			{Number: 2, ValuesPerEntry: 2, Mask: 0x02},
+			indexEndTag,
+		},
+		ControlByteCount: 1,
+	}
+	entries := []IndexEntry{
+		{Label: "a", Values: map[uint8][]uint32{1: {5}, 2: {1, 2}}},
+		{Label: "b", Values: map[uint8][]uint32{1: {6}}},
+	}
+
+	records, err := BuildIndexRecords(def, entries, 1)
+	if err != nil {
+		t.Fatalf("BuildIndexRecords() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("record count = %d, want 2", len(records))
+	}
+
+	header := records[0]
+	if string(header[:4]) != "INDX" {
+		t.Fatalf("header magic = %q, want INDX", string(header[:4]))
+	}
+	if got := readUint32BE(header, 16); got != 2 {
+		t.Errorf("index type = %d, want 2", got)
+	}
+	if got := readUint32BE(header, 24); got != 1 {
+		t.Errorf("index record count = %d, want 1", got)
+	}
+	if got := readUint32BE(header, 28); got != EncodingUTF8 {
+		t.Errorf("encoding = %d, want %d", got, EncodingUTF8)
+	}
+	if got := readUint32BE(header, 36); got != 2 {
+		t.Errorf("entry count = %d, want 2", got)
+	}
+	if got := readUint32BE(header, 52); got != 1 {
+		t.Errorf("CNCX count = %d, want 1", got)
+	}
+	if got := readUint32BE(header, 180); got != indxHeaderLength {
+		t.Errorf("TAGX offset = %d, want %d", got, indxHeaderLength)
+	}
+	if got := string(header[indxHeaderLength : indxHeaderLength+4]); got != "TAGX" {
+		t.Errorf("TAGX magic = %q", got)
+	}
+	idxt := readUint32BE(header, 20)
+	if got := string(header[idxt : idxt+4]); got != "IDXT" {
+		t.Errorf("header IDXT magic = %q", got)
+	}
+
+	rec := records[1]
+	if got := readUint32BE(rec, 12); got != 1 {
+		t.Errorf("entry record type = %d, want 1", got)
+	}
+	if got := readUint32BE(rec, 24); got != 2 {
+		t.Errorf("entry record count = %d, want 2", got)
+	}
+	idxt = readUint32BE(rec, 20)
+	if got := string(rec[idxt : idxt+4]); got != "IDXT" {
+		t.Fatalf("entry IDXT magic = %q", got)
+	}
+
+	// First entry: label "a", control byte 0x03 (tag 1 once, tag 2 once), 5, 1, 2
+	first := readUint16BE(rec, int(idxt)+4)
+	want := []byte{1, 'a', 0x03, 0x85, 0x81, 0x82}
+	if got := rec[first : int(first)+len(want)]; !bytes.Equal(got, want) {
+		t.Errorf("first entry = %X, want %X", got, want)
+	}
+
+	// Second entry: label "b", control byte 0x01, 6
+	second := readUint16BE(rec, int(idxt)+6)
+	want = []byte{1, 'b', 0x01, 0x86}
+	if got := rec[second : int(second)+len(want)]; !bytes.Equal(got, want) {
+		t.Errorf("second entry = %X, want %X", got, want)
+	}
+}
+
+func TestBuildIndexRecords_InvalidValueCount(t *testing.T) {
+	def := IndexDefinition{
+		Tags: []IndexTag{
+			{Number: 6, ValuesPerEntry: 2, Mask: 0x01},
+			indexEndTag,
+		},
+		ControlByteCount: 1,
+	}
+	entries := []IndexEntry{{Label: "x", Values: map[uint8][]uint32{6: {1}}}}
+
+	if _, err := BuildIndexRecords(def, entries, 0); err == nil {
+		t.Error("BuildIndexRecords should fail when values do not match ValuesPerEntry")
+	}
+}
+
+// decodeIndexEntries parses the entries of an INDX entry record using the
+// TAGX table of its header record.
+func decodeIndexEntries(t *testing.T, header, record []byte) []IndexEntry {
+	t.Helper()
+
+	tagxStart := int(readUint32BE(header, 180))
+	if string(header[tagxStart:tagxStart+4]) != "TAGX" {
+		t.Fatalf("TAGX not found at %d", tagxStart)
+	}
+	tagxLen := int(readUint32BE(header, tagxStart+4))
+	controlByteCount := int(readUint32BE(header, tagxStart+8))
+	var tags []IndexTag
+	for p := tagxStart + 12; p < tagxStart+tagxLen; p += 4 {
+		tags = append(tags, IndexTag{Number: header[p], ValuesPerEntry: header[p+1], Mask: header[p+2], EndFlag: header[p+3]})
+	}
+
+	idxt := int(readUint32BE(record, 20))
+	count := int(readUint32BE(record, 24))
+	entries := make([]IndexEntry, 0, count)
+	for i := 0; i < count; i++ {
+		pos := int(readUint16BE(record, idxt+4+2*i))
+		labelLen := int(record[pos])
+		entry := IndexEntry{Label: string(record[pos+1 : pos+1+labelLen]), Values: map[uint8][]uint32{}}
+		pos += 1 + labelLen
+		controlBytes := record[pos : pos+controlByteCount]
+		pos += controlByteCount
+
+		group := 0
+		for _, tag := range tags {
+			if tag.EndFlag == 1 {
+				group++
+				continue
+			}
+			n := int(controlBytes[group]&tag.Mask) >> bits.TrailingZeros8(tag.Mask)
+			for j := 0; j < n*int(tag.ValuesPerEntry); j++ {
+				v, size, err := DecodeVarint(record[pos:])
+				if err != nil {
+					t.Fatalf("entry %d tag %d: %v", i, tag.Number, err)
+				}
+				entry.Values[tag.Number] = append(entry.Values[tag.Number], v)
+				pos += size
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestParseIndex_RoundTrip(t *testing.T) {
+	def := IndexDefinition{
+		Tags: []IndexTag{
+			{Number: 1, ValuesPerEntry: 1, Mask: 0x01},
+			{Number: 6, ValuesPerEntry: 2, Mask: 0x02},
+			indexEndTag,
+		},
+		ControlByteCount: 1,
+	}
+	cncx := NewCNCXBuilder()
+	entries := []IndexEntry{
+		{Label: "a", Values: map[uint8][]uint32{1: {cncx.Add("first")}, 6: {0, 10}}},
+		{Label: "b", Values: map[uint8][]uint32{1: {cncx.Add("二番目")}}},
+		{Label: "c", Values: map[uint8][]uint32{6: {3, 0x12345}}},
+	}
+	cncxRecords := cncx.Records()
+	records, err := BuildIndexRecords(def, entries, len(cncxRecords))
+	if err != nil {
+		t.Fatalf("BuildIndexRecords() error = %v", err)
+	}
+	records = append(records, cncxRecords...)
+
+	idx, err := ParseIndex(records)
+	if err != nil {
+		t.Fatalf("ParseIndex() error = %v", err)
+	}
+	if len(idx.Definition.Tags) != len(def.Tags) || idx.Definition.ControlByteCount != 1 {
+		t.Errorf("definition = %+v, want %+v", idx.Definition, def)
+	}
+	if len(idx.Entries) != len(entries) {
+		t.Fatalf("entry count = %d, want %d", len(idx.Entries), len(entries))
+	}
+	for i, e := range idx.Entries {
+		if e.Label != entries[i].Label {
+			t.Errorf("entry %d label = %q, want %q", i, e.Label, entries[i].Label)
+		}
+		for tag, want := range entries[i].Values {
+			if !equalUint32s(e.Values[tag], want) {
+				t.Errorf("entry %d tag %d = %v, want %v", i, tag, e.Values[tag], want)
+			}
+		}
+	}
+
+	for off, want := range map[uint32]string{entries[0].Values[1][0]: "first", entries[1].Values[1][0]: "二番目"} {
+		got, err := idx.CNCXString(off)
+		if err != nil || got != want {
+			t.Errorf("CNCXString(0x%X) = %q, %v; want %q", off, got, err, want)
+		}
+	}
+	if _, err := idx.CNCXString(0x10000); err == nil {
+		t.Error("CNCXString() error = nil for an offset in a missing record")
+	}
+}
+
+func TestParseIndex_MultipleRecords(t *testing.T) {
+	def := IndexDefinition{
+		Tags:             []IndexTag{{Number: 1, ValuesPerEntry: 1, Mask: 0x01}, indexEndTag},
+		ControlByteCount: 1,
+	}
+	label := strings.Repeat("x", 200)
+	entries := make([]IndexEntry, 400)
+	for i := range entries {
+		entries[i] = IndexEntry{Label: fmt.Sprintf("%s%04d", label, i), Values: map[uint8][]uint32{1: {uint32(i)}}}
+	}
+	records, err := BuildIndexRecords(def, entries, 0)
+	if err != nil {
+		t.Fatalf("BuildIndexRecords() error = %v", err)
+	}
+	if len(records) < 3 {
+		t.Fatalf("record count = %d, want more than one entry record", len(records))
+	}
+
+	idx, err := ParseIndex(records)
+	if err != nil {
+		t.Fatalf("ParseIndex() error = %v", err)
+	}
+	if len(idx.Entries) != len(entries) {
+		t.Fatalf("entry count = %d, want %d", len(idx.Entries), len(entries))
+	}
+	for i, e := range idx.Entries {
+		if e.Label != entries[i].Label || e.Values[1][0] != uint32(i) {
+			t.Fatalf("entry %d = %q %v", i, e.Label, e.Values)
+		}
+	}
+}
+
+func TestParseIndex_Errors(t *testing.T) {
+	def := IndexDefinition{
+		Tags:             []IndexTag{{Number: 1, ValuesPerEntry: 1, Mask: 0x01}, indexEndTag},
+		ControlByteCount: 1,
+	}
+	records, err := BuildIndexRecords(def, []IndexEntry{{Label: "a", Values: map[uint8][]uint32{1: {1}}}}, 1)
+	if err != nil {
+		t.Fatalf("BuildIndexRecords() error = %v", err)
+	}
+
+	if _, err := ParseIndex(nil); err == nil {
+		t.Error("ParseIndex(nil) error = nil")
+	}
+	if _, err := ParseIndex(records); err == nil {
+		t.Error("ParseIndex() error = nil when the CNCX record is missing")
+	}
+	if _, err := ParseIndex([][]byte{[]byte("not an index")}); err == nil {
+		t.Error("ParseIndex() error = nil for an invalid header")
+	}
+}
@@ -0,0 +1,71 @@
+package mobi
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// fileposPlaceholder is a fixed-width MOBI7 filepos attribute that is filled in
+// once the final byte positions are known.
+const fileposPlaceholder = "filepos=0000000000"
+
+// mobi7StyleRe matches <style> elements, which MOBI7 readers do not support.
+var mobi7StyleRe = regexp.MustCompile(`(?is)<style[^>]*>.*?</style>`)
+
+// mobi7LinkRe matches <link> elements such as the kindle:flow stylesheet link.
+var mobi7LinkRe = regexp.MustCompile(`(?i)<link\s[^>]*>`)
+
+// mobi7EmbedRe matches img src attributes pointing at kindle:embed resources.
+var mobi7EmbedRe = regexp.MustCompile(`src="kindle:embed:([0-9A-Fa-f]{4})[^"]*"`)
+
+// BuildMOBI7HTML derives the simplified HTML of a MOBI7 section from the
+// integrated KF8 HTML (after TransformImageReferences):
+//   - stylesheets (<style>, <link>) are dropped
+//   - img src="kindle:embed:XXXX" becomes recindex="NNNNN"
+//   - internal href="#id" links become filepos byte offsets into the result
+func BuildMOBI7HTML(html []byte) ([]byte, error) {
+	out := mobi7StyleRe.ReplaceAll(html, nil)
+	out = mobi7LinkRe.ReplaceAll(out, nil)
+
+	var convErr error
+	out = mobi7EmbedRe.ReplaceAllFunc(out, func(match []byte) []byte {
+		sub := mobi7EmbedRe.FindSubmatch(match)
+		index, err := strconv.ParseUint(string(sub[1]), 16, 32)
+		if err != nil {
+			convErr = fmt.Errorf("invalid kindle:embed reference %q: %w", match, err)
+			return match
+		}
+		return fmt.Appendf(nil, `recindex="%05d"`, index)
+	})
+	if convErr != nil {
+		return nil, convErr
+	}
+
+	// Replace internal links with fixed-width placeholders first, so that the
+	// positions of their targets no longer change.
+	ids := elementIDPositions(out)
+	var buf bytes.Buffer
+	targets := make(map[int]string)
+	last := 0
+	for _, m := range internalHrefRe.FindAllSubmatchIndex(out, -1) {
+		id := string(out[m[2]:m[3]])
+		if _, ok := ids[id]; !ok {
+			continue
+		}
+		buf.Write(out[last:m[0]])
+		targets[buf.Len()] = id
+		buf.WriteString(fileposPlaceholder)
+		last = m[1]
+	}
+	buf.Write(out[last:])
+	out = buf.Bytes()
+
+	ids = elementIDPositions(out)
+	for pos, id := range targets {
+		ref := fmt.Sprintf("filepos=%010d", ids[id])
+		copy(out[pos:], ref)
+	}
+	return out, nil
+}
@@ -0,0 +1,61 @@
+package mobi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBuildMOBI7HTML_StripsStylesheets(t *testing.T) {
+	html := []byte(`<html><head><title>T</title><link rel="stylesheet" type="text/css" href="kindle:flow:0001?mime=text/css"/><style>p{margin:0}</style></head><body><p>x</p></body></html>`)
+
+	got, err := BuildMOBI7HTML(html)
+	if err != nil {
+		t.Fatalf("BuildMOBI7HTML() error = %v", err)
+	}
+	want := `<html><head><title>T</title></head><body><p>x</p></body></html>`
+	if string(got) != want {
+		t.Errorf("BuildMOBI7HTML() = %s, want %s", got, want)
+	}
+}
+
+func TestBuildMOBI7HTML_ImageRecindex(t *testing.T) {
+	html := []byte(`<html><body><img src="kindle:embed:000A" alt="a"/><img src="images/missing.png"/></body></html>`)
+
+	got, err := BuildMOBI7HTML(html)
+	if err != nil {
+		t.Fatalf("BuildMOBI7HTML() error = %v", err)
+	}
+	if !bytes.Contains(got, []byte(`<img recindex="00010" alt="a"/>`)) {
+		t.Errorf("kindle:embed reference not converted to recindex: %s", got)
+	}
+	if !bytes.Contains(got, []byte(`src="images/missing.png"`)) {
+		t.Errorf("unmapped image source should be left unchanged: %s", got)
+	}
+}
+
+func TestBuildMOBI7HTML_Filepos(t *testing.T) {
+	html := []byte(`<html><head><style>p{}</style></head><body>` +
+		`<div id="toc"><a href="#ch02">Two</a><a href="#nowhere">x</a></div>` +
+		`<div id="ch01"><p>One</p></div>` +
+		`<div id="ch02"><p>Two</p></div>` +
+		`</body></html>`)
+
+	got, err := BuildMOBI7HTML(html)
+	if err != nil {
+		t.Fatalf("BuildMOBI7HTML() error = %v", err)
+	}
+
+	target := bytes.Index(got, []byte(`<div id="ch02">`))
+	want := fmt.Sprintf(`<a filepos=%010d>Two</a>`, target)
+	if !bytes.Contains(got, []byte(want)) {
+		t.Errorf("expected %s in %s", want, got)
+	}
+	if !bytes.Contains(got, []byte(`href="#nowhere"`)) {
+		t.Error("link without target should be left unchanged")
+	}
+	if strings.Contains(string(got), fileposPlaceholder) {
+		t.Error("unresolved filepos placeholder remains")
+	}
+}
@@ -61,9 +61,15 @@ const (
 	// MOBITypeKF8 is the MOBI type for KF8 format.
 	MOBITypeKF8 uint32 = 248
 
+	// MOBITypeBook is the MOBI type for a MOBI7 book section.
+	MOBITypeBook uint32 = 2
+
 	// FileVersionKF8 is the file version for KF8 format.
 	FileVersionKF8 uint32 = 8
 
+	// FileVersionMOBI7 is the file version for the MOBI7 section of a joint file.
+	FileVersionMOBI7 uint32 = 6
+
 	// EXTHFlagPresent indicates that EXTH records are present.
 	EXTHFlagPresent uint32 = 0x40
 )
@@ -107,6 +113,13 @@ type MOBIHeaderConfig struct {
 	ExtraRecordDataFlags uint32
 	FDSTFlowCount        uint32
 	FDSTOffset           uint32
+	NCXIndex             uint32 // 0 means no NCX index
+	FragmentIndex        uint32 // 0 means no FRAG index
+	SkeletonIndex        uint32 // 0 means no SKEL index
+	GuideIndex           uint32 // 0 means no guide index
+	RESCIndex            uint32 // 0 means no RESC record
+	MOBIType             uint32 // 0 means MOBITypeKF8
+	FileVersion          uint32 // 0 means FileVersionKF8
 }
 
 // MOBIHeader represents the internal state of a MOBI header for Record 0.
@@ -124,6 +137,13 @@ type MOBIHeader struct {
 	ExtraRecordDataFlags uint32
 	FDSTFlowCount        uint32
 	FDSTOffset           uint32
+	NCXIndex             uint32
+	FragmentIndex        uint32
+	SkeletonIndex        uint32
+	GuideIndex           uint32
+	RESCIndex            uint32
+	MOBIType             uint32
+	FileVersion          uint32
 }
 
 // NewMOBIHeader creates a MOBIHeader from the given configuration.
@@ -136,6 +156,15 @@ func NewMOBIHeader(cfg MOBIHeaderConfig) (*MOBIHeader, error) {
 		return nil, fmt.Errorf("invalid content record range: first=%d > last=%d", cfg.FirstContentRecord, cfg.LastContentRecord)
 	}
 
+	mobiType := cfg.MOBIType
+	if mobiType == 0 {
+		mobiType = MOBITypeKF8
+	}
+	fileVersion := cfg.FileVersion
+	if fileVersion == 0 {
+		fileVersion = FileVersionKF8
+	}
+
 	var uid uint32
 	if cfg.UniqueID != nil {
 		uid = *cfg.UniqueID
@@ -161,6 +190,13 @@ func NewMOBIHeader(cfg MOBIHeaderConfig) (*MOBIHeader, error) {
 		ExtraRecordDataFlags: cfg.ExtraRecordDataFlags,
 		FDSTFlowCount:        cfg.FDSTFlowCount,
 		FDSTOffset:           cfg.FDSTOffset,
+		NCXIndex:             indexOrNull(cfg.NCXIndex),
+		FragmentIndex:        indexOrNull(cfg.FragmentIndex),
+		SkeletonIndex:        indexOrNull(cfg.SkeletonIndex),
+		GuideIndex:           indexOrNull(cfg.GuideIndex),
+		RESCIndex:            indexOrNull(cfg.RESCIndex),
+		MOBIType:             mobiType,
+		FileVersion:          fileVersion,
 	}, nil
 }
 
@@ -210,7 +246,7 @@ func (h *MOBIHeader) MOBIHeaderBytes(fullNameOffset, fullNameLength, exthFlags u
 	}
 
 	// Offset 8: MOBI type
-	if err := writeU32(MOBITypeKF8); err != nil {
+	if err := writeU32(h.MOBIType); err != nil {
 		return nil, fmt.Errorf("failed to write MOBI type: %w", err)
 	}
 
@@ -225,7 +261,7 @@ func (h *MOBIHeader) MOBIHeaderBytes(fullNameOffset, fullNameLength, exthFlags u
 	}
 
 	// Offset 20: file version
-	if err := writeU32(FileVersionKF8); err != nil {
+	if err := writeU32(h.FileVersion); err != nil {
 		return nil, fmt.Errorf("failed to write file version: %w", err)
 	}
 
@@ -381,18 +417,36 @@ func (h *MOBIHeader) MOBIHeaderBytes(fullNameOffset, fullNameLength, exthFlags u
 		return nil, fmt.Errorf("failed to write extra record data flags: %w", err)
 	}
 
-	// Offset 212: INDX record offset (0xFFFFFFFF)
-	if err := writeU32(0xFFFFFFFF); err != nil {
+	// Offset 212: INDX record offset (NCX index)
+	if err := writeU32(h.NCXIndex); err != nil {
 		return nil, fmt.Errorf("failed to write INDX record offset: %w", err)
 	}
 
 	// KF8 additional fields (offsets 216-247)
 
-	// Offsets 216-232: unused (5 * 0xFFFFFFFF)
-	for i := 0; i < 5; i++ {
-		if err := writeU32(0xFFFFFFFF); err != nil {
-			return nil, fmt.Errorf("failed to write KF8 unused field: %w", err)
-		}
+	// Offset 216: FRAG index record number
+	if err := writeU32(h.FragmentIndex); err != nil {
+		return nil, fmt.Errorf("failed to write FRAG index: %w", err)
+	}
+
+	// Offset 220: SKEL index record number
+	if err := writeU32(h.SkeletonIndex); err != nil {
+		return nil, fmt.Errorf("failed to write SKEL index: %w", err)
+	}
+
+	// Offset 224: unused (0xFFFFFFFF)
+	if err := writeU32(0xFFFFFFFF); err != nil {
+		return nil, fmt.Errorf("failed to write KF8 unused field: %w", err)
+	}
+
+	// Offset 228: guide index record number
+	if err := writeU32(h.GuideIndex); err != nil {
+		return nil, fmt.Errorf("failed to write guide index: %w", err)
+	}
+
+	// Offset 232: RESC record number
+	if err := writeU32(h.RESCIndex); err != nil {
+		return nil, fmt.Errorf("failed to write RESC index: %w", err)
 	}
 
 	// Offset 236: FDST flow count
@@ -486,6 +540,59 @@ func (h *MOBIHeader) Record0Bytes(exthData []byte, fullName string) ([]byte, err
 	return buf.Bytes(), nil
 }
 
+// ParseMOBIHeader decodes the PalmDOC header and the MOBI header of a Record 0.
+// Files written by other tools may have a shorter MOBI header: fields beyond
+// its length are returned as NullIndex (index fields) or zero.
+func ParseMOBIHeader(record0 []byte) (*MOBIHeader, error) {
+	if len(record0) < PalmDOCHeaderSize+8 {
+		return nil, fmt.Errorf("Record 0 too short: got %d bytes", len(record0))
+	}
+	mobi := record0[PalmDOCHeaderSize:]
+	if string(mobi[0:4]) != "MOBI" {
+		return nil, fmt.Errorf("invalid MOBI identifier: got %q, want %q", string(mobi[0:4]), "MOBI")
+	}
+	headerLen := int(binary.BigEndian.Uint32(mobi[4:8]))
+	if headerLen > len(mobi) {
+		return nil, fmt.Errorf("MOBI header length %d exceeds Record 0 size %d", headerLen, len(record0))
+	}
+
+	u32 := func(offset int, absent uint32) uint32 {
+		if offset+4 > headerLen {
+			return absent
+		}
+		return binary.BigEndian.Uint32(mobi[offset : offset+4])
+	}
+	u16 := func(offset int) uint16 {
+		if offset+2 > headerLen {
+			return 0
+		}
+		return binary.BigEndian.Uint16(mobi[offset : offset+2])
+	}
+
+	return &MOBIHeader{
+		Compression:          binary.BigEndian.Uint16(record0[0:2]),
+		TextLength:           binary.BigEndian.Uint32(record0[4:8]),
+		TextRecordCount:      binary.BigEndian.Uint16(record0[8:10]),
+		MOBIType:             u32(8, 0),
+		UniqueID:             u32(16, 0),
+		FileVersion:          u32(20, 0),
+		LanguageCode:         u32(76, 0),
+		FirstImageIndex:      u32(80, NullIndex),
+		FirstContentRecord:   u16(160),
+		LastContentRecord:    u16(162),
+		FCISRecordNumber:     u32(168, NullIndex),
+		FLISRecordNumber:     u32(176, NullIndex),
+		ExtraRecordDataFlags: u32(208, 0),
+		NCXIndex:             u32(212, NullIndex),
+		FragmentIndex:        u32(216, NullIndex),
+		SkeletonIndex:        u32(220, NullIndex),
+		GuideIndex:           u32(228, NullIndex),
+		RESCIndex:            u32(232, NullIndex),
+		FDSTFlowCount:        u32(236, 0),
+		FDSTOffset:           u32(240, NullIndex),
+	}, nil
+}
+
 // validateEXTH validates EXTH data integrity.
 // Returns nil if exthData is nil or empty (no EXTH present).
 func validateEXTH(exthData []byte) error {
@@ -508,6 +615,15 @@ func validateEXTH(exthData []byte) error {
 	return nil
 }
 
+// indexOrNull returns NullIndex for a zero record number.
+// Record 0 always holds the headers, so it is never a valid index record.
+func indexOrNull(index uint32) uint32 {
+	if index == 0 {
+		return NullIndex
+	}
+	return index
+}
+
 // generateUniqueID generates a random uint32 using crypto/rand.
 func generateUniqueID() (uint32, error) {
 	var b [4]byte
@@ -316,6 +316,50 @@ func TestMOBIHeaderBytes(t *testing.T) {
 	}
 }
 
+func TestMOBIHeaderBytes_KF8Indexes(t *testing.T) {
+	cfg := MOBIHeaderConfig{
+		Compression:        CompressionNone,
+		TextLength:         1000,
+		TextRecordCount:    1,
+		FirstContentRecord: 1,
+		LastContentRecord:  1,
+		NCXIndex:           2,
+		FragmentIndex:      3,
+		SkeletonIndex:      5,
+		GuideIndex:         7,
+		RESCIndex:          9,
+	}
+
+	h, err := NewMOBIHeader(cfg)
+	if err != nil {
+		t.Fatalf("NewMOBIHeader() error = %v", err)
+	}
+
+	data, err := h.MOBIHeaderBytes(0, 0, 0)
+	if err != nil {
+		t.Fatalf("MOBIHeaderBytes() error = %v", err)
+	}
+
+	if got := binary.BigEndian.Uint32(data[212:216]); got != 2 {
+		t.Errorf("NCX index = %d, want 2", got)
+	}
+	if got := binary.BigEndian.Uint32(data[216:220]); got != 3 {
+		t.Errorf("FRAG index = %d, want 3", got)
+	}
+	if got := binary.BigEndian.Uint32(data[220:224]); got != 5 {
+		t.Errorf("SKEL index = %d, want 5", got)
+	}
+	if got := binary.BigEndian.Uint32(data[228:232]); got != 7 {
+		t.Errorf("guide index = %d, want 7", got)
+	}
+	if got := binary.BigEndian.Uint32(data[232:236]); got != 9 {
+		t.Errorf("RESC index = %d, want 9", got)
+	}
+	if val := binary.BigEndian.Uint32(data[224:228]); val != 0xFFFFFFFF {
+		t.Errorf("KF8 offset 224 = 0x%08X, want 0xFFFFFFFF", val)
+	}
+}
+
 func TestMOBIHeaderBytes_EXTHFlags(t *testing.T) {
 	cfg := MOBIHeaderConfig{
 		Compression:        CompressionPalmDoc,
@@ -762,3 +806,90 @@ func TestRecord0Bytes_MultibyteName(t *testing.T) {
 		t.Errorf("Record0 length %d is not 4-byte aligned", len(data))
 	}
 }
+
+func TestParseMOBIHeader_RoundTrip(t *testing.T) {
+	uid := uint32(0xDEADBEEF)
+	h, err := NewMOBIHeader(MOBIHeaderConfig{
+		Compression:          CompressionPalmDoc,
+		TextLength:           12345,
+		TextRecordCount:      4,
+		Language:             "ja",
+		UniqueID:             &uid,
+		FirstImageIndex:      5,
+		FirstContentRecord:   1,
+		LastContentRecord:    4,
+		FCISRecordNumber:     12,
+		FLISRecordNumber:     11,
+		ExtraRecordDataFlags: ExtraDataMultibyte,
+		FDSTFlowCount:        2,
+		FDSTOffset:           NullIndex,
+		NCXIndex:             6,
+		FragmentIndex:        8,
+		GuideIndex:           9,
+		RESCIndex:            10,
+	})
+	if err != nil {
+		t.Fatalf("NewMOBIHeader() error = %v", err)
+	}
+	record0, err := h.Record0Bytes(buildValidEXTH(12), "Title")
+	if err != nil {
+		t.Fatalf("Record0Bytes() error = %v", err)
+	}
+
+	got, err := ParseMOBIHeader(record0)
+	if err != nil {
+		t.Fatalf("ParseMOBIHeader() error = %v", err)
+	}
+	if *got != *h {
+		t.Errorf("ParseMOBIHeader() = %+v, want %+v", got, h)
+	}
+	if got.SkeletonIndex != NullIndex {
+		t.Errorf("SkeletonIndex = %d, want NullIndex", got.SkeletonIndex)
+	}
+}
+
+func TestParseMOBIHeader_ShortHeader(t *testing.T) {
+	h, err := NewMOBIHeader(MOBIHeaderConfig{Compression: CompressionNone, FirstContentRecord: 1, LastContentRecord: 1})
+	if err != nil {
+		t.Fatalf("NewMOBIHeader() error = %v", err)
+	}
+	record0, err := h.Record0Bytes(nil, "")
+	if err != nil {
+		t.Fatalf("Record0Bytes() error = %v", err)
+	}
+	// Pretend the MOBI header ends before the KF8 fields, as in older MOBI files.
+	binary.BigEndian.PutUint32(record0[PalmDOCHeaderSize+4:], 0xE4)
+
+	got, err := ParseMOBIHeader(record0)
+	if err != nil {
+		t.Fatalf("ParseMOBIHeader() error = %v", err)
+	}
+	if got.FragmentIndex != NullIndex || got.FDSTFlowCount != 0 {
+		t.Errorf("KF8 fields = %d, %d; want NullIndex, 0", got.FragmentIndex, got.FDSTFlowCount)
+	}
+	if got.NCXIndex != NullIndex {
+		t.Errorf("NCXIndex = %d, want NullIndex", got.NCXIndex)
+	}
+}
+
+func TestParseMOBIHeader_Errors(t *testing.T) {
+	h, _ := NewMOBIHeader(MOBIHeaderConfig{Compression: CompressionNone})
+	valid, _ := h.Record0Bytes(nil, "")
+
+	badMagic := append([]byte(nil), valid...)
+	copy(badMagic[PalmDOCHeaderSize:], "IBOM")
+
+	badLength := append([]byte(nil), valid...)
+	binary.BigEndian.PutUint32(badLength[PalmDOCHeaderSize+4:], 0x10000)
+
+	tests := map[string][]byte{
+		"short":      valid[:20],
+		"bad magic":  badMagic,
+		"bad length": badLength,
+	}
+	for name, data := range tests {
+		if _, err := ParseMOBIHeader(data); err == nil {
+			t.Errorf("%s: ParseMOBIHeader() error = nil, want error", name)
+		}
+	}
+}
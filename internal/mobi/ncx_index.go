@@ -0,0 +1,177 @@
+package mobi
+
+import (
+	"fmt"
+	"sort"
+)
+
+// NCXEntry represents a single TOC entry with a label, file position, and optional children.
+type NCXEntry struct {
+	Label    string
+	FilePos  uint32
+	Children []NCXEntry
+}
+
+// GuideReference represents a guide reference written to the guide index.
+type GuideReference struct {
+	Type    string
+	Title   string
+	FilePos uint32
+}
+
+// ncxIndexDefinition is the TAGX layout of the KF8 NCX index.
+var ncxIndexDefinition = IndexDefinition{
+	Tags: []IndexTag{
+		{Number: 1, ValuesPerEntry: 1, Mask: 0x01},  // offset
+		{Number: 2, ValuesPerEntry: 1, Mask: 0x02},  // length
+		{Number: 3, ValuesPerEntry: 1, Mask: 0x04},  // label (CNCX offset)
+		{Number: 4, ValuesPerEntry: 1, Mask: 0x08},  // depth
+		{Number: 21, ValuesPerEntry: 1, Mask: 0x10}, // parent
+		{Number: 22, ValuesPerEntry: 1, Mask: 0x20}, // first child
+		{Number: 23, ValuesPerEntry: 1, Mask: 0x40}, // last child
+		{Number: 6, ValuesPerEntry: 2, Mask: 0x80},  // pos_fid (fragment, offset)
+		indexEndTag,
+		{Number: 69, ValuesPerEntry: 1, Mask: 0x01}, // image
+		{Number: 70, ValuesPerEntry: 1, Mask: 0x02}, // description
+		{Number: 71, ValuesPerEntry: 1, Mask: 0x04}, // author
+		{Number: 72, ValuesPerEntry: 1, Mask: 0x08}, // caption
+		{Number: 73, ValuesPerEntry: 1, Mask: 0x10}, // attribution
+		indexEndTag,
+	},
+	ControlByteCount: 2,
+}
+
+// guideIndexDefinition is the TAGX layout of the KF8 guide index.
+var guideIndexDefinition = IndexDefinition{
+	Tags: []IndexTag{
+		{Number: 1, ValuesPerEntry: 1, Mask: 0x01}, // title (CNCX offset)
+		{Number: 6, ValuesPerEntry: 2, Mask: 0x02}, // pos_fid (fragment, offset)
+		indexEndTag,
+	},
+	ControlByteCount: 1,
+}
+
+// flatNCXEntry is an NCXEntry flattened out of the TOC tree.
+type flatNCXEntry struct {
+	entry    NCXEntry
+	depth    int
+	docOrder int
+	parent   int // docOrder of the parent, -1 for top-level entries
+	children []int
+	index    int // position in the NCX index
+}
+
+// NCXIndexRecords builds the NCX INDX records followed by their CNCX records.
+// Entries are written breadth-first (all top-level entries, then their children)
+// and linked with parent/child tags. Each entry spans up to the next entry of the
+// same or a shallower depth, or up to textLength.
+// When layout is non-nil, every entry also gets a pos_fid fragment reference.
+func NCXIndexRecords(entries []NCXEntry, textLength uint32, layout *KF8Layout) ([][]byte, error) {
+	var flat []*flatNCXEntry
+	var walk func(list []NCXEntry, depth, parent int)
+	walk = func(list []NCXEntry, depth, parent int) {
+		for _, e := range list {
+			fe := &flatNCXEntry{entry: e, depth: depth, docOrder: len(flat), parent: parent}
+			flat = append(flat, fe)
+			if parent >= 0 {
+				flat[parent].children = append(flat[parent].children, fe.docOrder)
+			}
+			walk(e.Children, depth+1, fe.docOrder)
+		}
+	}
+	walk(entries, 0, -1)
+
+	ordered := make([]*flatNCXEntry, len(flat))
+	copy(ordered, flat)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].depth < ordered[j].depth
+	})
+	for i, fe := range ordered {
+		fe.index = i
+	}
+
+	cncx := NewCNCXBuilder()
+	indexEntries := make([]IndexEntry, len(ordered))
+	for i, fe := range ordered {
+		end := textLength
+		for _, next := range flat[fe.docOrder+1:] {
+			if next.depth <= fe.depth {
+				end = next.entry.FilePos
+				break
+			}
+		}
+		var length uint32
+		if end > fe.entry.FilePos {
+			length = end - fe.entry.FilePos
+		}
+
+		values := map[uint8][]uint32{
+			1: {fe.entry.FilePos},
+			2: {length},
+			3: {cncx.Add(fe.entry.Label)},
+			4: {uint32(fe.depth)},
+		}
+		if fe.parent >= 0 {
+			values[21] = []uint32{uint32(flat[fe.parent].index)}
+		}
+		if len(fe.children) > 0 {
+			values[22] = []uint32{uint32(flat[fe.children[0]].index)}
+			values[23] = []uint32{uint32(flat[fe.children[len(fe.children)-1]].index)}
+		}
+		if layout != nil {
+			if fid, off, ok := layout.fragmentPosition(fe.entry.FilePos); ok {
+				values[6] = []uint32{uint32(fid), off}
+			}
+		}
+
+		indexEntries[i] = IndexEntry{
+			Label:  fmt.Sprintf("%04d", i),
+			Values: values,
+		}
+	}
+
+	cncxRecords := cncx.Records()
+	records, err := BuildIndexRecords(ncxIndexDefinition, indexEntries, len(cncxRecords))
+	if err != nil {
+		return nil, err
+	}
+	return append(records, cncxRecords...), nil
+}
+
+// GuideIndexRecords builds the guide INDX records followed by their CNCX records.
+// Guide references are labelled by their type and point at the fragment that
+// contains their file position. Entries are sorted by type, since readers look
+// labels up by binary search.
+func GuideIndexRecords(refs []GuideReference, layout *KF8Layout) ([][]byte, error) {
+	if layout == nil {
+		return nil, fmt.Errorf("guide index requires a KF8 layout")
+	}
+	refs = append([]GuideReference(nil), refs...)
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].Type < refs[j].Type })
+
+	cncx := NewCNCXBuilder()
+	entries := make([]IndexEntry, 0, len(refs))
+	for _, ref := range refs {
+		fid, off, ok := layout.fragmentPosition(ref.FilePos)
+		if !ok {
+			continue
+		}
+		entries = append(entries, IndexEntry{
+			Label: ref.Type,
+			Values: map[uint8][]uint32{
+				1: {cncx.Add(ref.Title)},
+				6: {uint32(fid), off},
+			},
+		})
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	cncxRecords := cncx.Records()
+	records, err := BuildIndexRecords(guideIndexDefinition, entries, len(cncxRecords))
+	if err != nil {
+		return nil, err
+	}
+	return append(records, cncxRecords...), nil
+}
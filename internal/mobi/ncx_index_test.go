@@ -0,0 +1,203 @@
+package mobi
+
+import (
+	"reflect"
+	"testing"
+)
+
+// cncxString reads the string at a CNCX offset from the given CNCX records.
+func cncxString(t *testing.T, records [][]byte, offset uint32) string {
+	t.Helper()
+	rec := records[offset>>16]
+	pos := int(offset & 0xFFFF)
+	n, size, err := DecodeVarint(rec[pos:])
+	if err != nil {
+		t.Fatalf("invalid CNCX string at 0x%X: %v", offset, err)
+	}
+	return string(rec[pos+size : pos+size+int(n)])
+}
+
+func TestNCXIndexRecords_Hierarchy(t *testing.T) {
+	entries := []NCXEntry{
+		{Label: "Chapter 1", FilePos: 100, Children: []NCXEntry{
+			{Label: "Section 1.1", FilePos: 150},
+			{Label: "Section 1.2", FilePos: 200},
+		}},
+		{Label: "第2章", FilePos: 300},
+	}
+
+	records, err := NCXIndexRecords(entries, 1000, nil)
+	if err != nil {
+		t.Fatalf("NCXIndexRecords() error = %v", err)
+	}
+	// header + entry record + CNCX
+	if len(records) != 3 {
+		t.Fatalf("record count = %d, want 3", len(records))
+	}
+	if got := readUint32BE(records[0], 36); got != 4 {
+		t.Errorf("entry count = %d, want 4", got)
+	}
+	if got := readUint32BE(records[0], 52); got != 1 {
+		t.Errorf("CNCX count = %d, want 1", got)
+	}
+
+	decoded := decodeIndexEntries(t, records[0], records[1])
+	if len(decoded) != 4 {
+		t.Fatalf("decoded %d entries, want 4", len(decoded))
+	}
+
+	// Breadth-first: Chapter 1, 第2章, Section 1.1, Section 1.2
+	want := []struct {
+		label  string
+		offset uint32
+		length uint32
+		depth  uint32
+		parent []uint32
+		first  []uint32
+		last   []uint32
+	}{
+		{"Chapter 1", 100, 200, 0, nil, []uint32{2}, []uint32{3}},
+		{"第2章", 300, 700, 0, nil, nil, nil},
+		{"Section 1.1", 150, 50, 1, []uint32{0}, nil, nil},
+		{"Section 1.2", 200, 100, 1, []uint32{0}, nil, nil},
+	}
+
+	for i, w := range want {
+		e := decoded[i]
+		if label := cncxString(t, records[2:], e.Values[3][0]); label != w.label {
+			t.Errorf("entry %d label = %q, want %q", i, label, w.label)
+		}
+		if e.Values[1][0] != w.offset {
+			t.Errorf("entry %d offset = %d, want %d", i, e.Values[1][0], w.offset)
+		}
+		if e.Values[2][0] != w.length {
+			t.Errorf("entry %d length = %d, want %d", i, e.Values[2][0], w.length)
+		}
+		if e.Values[4][0] != w.depth {
+			t.Errorf("entry %d depth = %d, want %d", i, e.Values[4][0], w.depth)
+		}
+		if !equalUint32s(e.Values[21], w.parent) {
+			t.Errorf("entry %d parent = %v, want %v", i, e.Values[21], w.parent)
+		}
+		if !equalUint32s(e.Values[22], w.first) {
+			t.Errorf("entry %d first child = %v, want %v", i, e.Values[22], w.first)
+		}
+		if !equalUint32s(e.Values[23], w.last) {
+			t.Errorf("entry %d last child = %v, want %v", i, e.Values[23], w.last)
+		}
+		if _, ok := e.Values[6]; ok {
+			t.Errorf("entry %d has pos_fid without a layout", i)
+		}
+	}
+}
+
+func TestNCXIndexRecords_PosFid(t *testing.T) {
+	html := []byte(`<html><head></head><body>` +
+		`<div id="ch01"><h1>One</h1></div>` +
+		`<div id="ch02"><h1>Two</h1></div>` +
+		`</body></html>`)
+	layout, err := BuildKF8Layout(html, []string{"ch01", "ch02"})
+	if err != nil {
+		t.Fatalf("BuildKF8Layout() error = %v", err)
+	}
+
+	second := layout.Fragments[1]
+	entries := []NCXEntry{
+		{Label: "One", FilePos: layout.Fragments[0].RawStart},
+		{Label: "Two", FilePos: second.RawStart + 4},
+	}
+	records, err := NCXIndexRecords(entries, uint32(len(layout.Text)), layout)
+	if err != nil {
+		t.Fatalf("NCXIndexRecords() error = %v", err)
+	}
+
+	decoded := decodeIndexEntries(t, records[0], records[1])
+	if got := decoded[0].Values[6]; !equalUint32s(got, []uint32{0, 0}) {
+		t.Errorf("entry 0 pos_fid = %v, want [0 0]", got)
+	}
+	if got := decoded[1].Values[6]; !equalUint32s(got, []uint32{1, 4}) {
+		t.Errorf("entry 1 pos_fid = %v, want [1 4]", got)
+	}
+}
+
+func TestGuideIndexRecords(t *testing.T) {
+	html := []byte(`<html><head></head><body><div id="toc">TOC</div><div id="ch01"><p>One</p></div></body></html>`)
+	layout, err := BuildKF8Layout(html, []string{"ch01"})
+	if err != nil {
+		t.Fatalf("BuildKF8Layout() error = %v", err)
+	}
+
+	refs := []GuideReference{{Type: "toc", Title: "Table of Contents", FilePos: layout.Fragments[0].RawStart}}
+	records, err := GuideIndexRecords(refs, layout)
+	if err != nil {
+		t.Fatalf("GuideIndexRecords() error = %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("record count = %d, want 3", len(records))
+	}
+
+	decoded := decodeIndexEntries(t, records[0], records[1])
+	if len(decoded) != 1 {
+		t.Fatalf("decoded %d entries, want 1", len(decoded))
+	}
+	if decoded[0].Label != "toc" {
+		t.Errorf("label = %q, want %q", decoded[0].Label, "toc")
+	}
+	if title := cncxString(t, records[2:], decoded[0].Values[1][0]); title != "Table of Contents" {
+		t.Errorf("title = %q", title)
+	}
+	if got := decoded[0].Values[6]; !equalUint32s(got, []uint32{0, 0}) {
+		t.Errorf("pos_fid = %v, want [0 0]", got)
+	}
+}
+
+func TestGuideIndexRecords_SortedByType(t *testing.T) {
+	html := []byte(`<html><head></head><body><div id="ch01"><p>One</p></div><div id="ch02"><p>Two</p></div></body></html>`)
+	layout, err := BuildKF8Layout(html, []string{"ch01", "ch02"})
+	if err != nil {
+		t.Fatalf("BuildKF8Layout() error = %v", err)
+	}
+
+	refs := []GuideReference{
+		{Type: "toc", Title: "Contents", FilePos: layout.Fragments[0].RawStart},
+		{Type: "text", Title: "Start", FilePos: layout.Fragments[1].RawStart},
+		{Type: "cover", Title: "Cover", FilePos: layout.Fragments[0].RawStart},
+	}
+	records, err := GuideIndexRecords(refs, layout)
+	if err != nil {
+		t.Fatalf("GuideIndexRecords() error = %v", err)
+	}
+
+	decoded := decodeIndexEntries(t, records[0], records[1])
+	var labels []string
+	for _, e := range decoded {
+		labels = append(labels, e.Label)
+	}
+	if want := []string{"cover", "text", "toc"}; !reflect.DeepEqual(labels, want) {
+		t.Errorf("labels = %q, want %q", labels, want)
+	}
+	if got := decoded[1].Values[6]; !equalUint32s(got, []uint32{1, 0}) {
+		t.Errorf("text pos_fid = %v, want [1 0]", got)
+	}
+	if refs[0].Type != "toc" {
+		t.Error("GuideIndexRecords reordered the caller's references")
+	}
+}
+
+func TestGuideIndexRecords_RequiresLayout(t *testing.T) {
+	if _, err := GuideIndexRecords([]GuideReference{{Type: "toc"}}, nil); err == nil {
+		t.Error("GuideIndexRecords should fail without a layout")
+	}
+}
+
+func equalUint32s(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -95,6 +95,16 @@ func PalmEpochSeconds(t time.Time) uint32 {
 	return uint32(t.Unix()) + PalmEpochOffset
 }
 
+// PalmEpochTime converts PDB header seconds to a time.Time.
+// Files written by some tools store Unix seconds instead of Palm epoch seconds;
+// as with other readers, values with the high bit clear are treated as Unix time.
+func PalmEpochTime(seconds uint32) time.Time {
+	if seconds&0x80000000 == 0 {
+		return time.Unix(int64(seconds), 0).UTC()
+	}
+	return time.Unix(int64(seconds)-PalmEpochOffset, 0).UTC()
+}
+
 // HeaderBytes encodes the PDB header into its 78-byte binary representation.
 func (p *PDB) HeaderBytes() ([]byte, error) {
 	buf := &bytes.Buffer{}
@@ -199,3 +209,47 @@ func encodeUniqueID(id uint32) [3]byte {
 		byte(id),
 	}
 }
+
+// ParsePDB decodes the PDB header and record list at the start of data.
+func ParsePDB(data []byte) (*PDB, error) {
+	if len(data) < 78 {
+		return nil, fmt.Errorf("PDB header too short: got %d bytes, need 78", len(data))
+	}
+
+	var header PDBHeader
+	if err := binary.Read(bytes.NewReader(data[:78]), binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("failed to decode PDB header: %w", err)
+	}
+
+	count := int(header.NumRecords)
+	if len(data) < 78+count*8 {
+		return nil, fmt.Errorf("record list truncated: %d records need %d bytes, got %d", count, 78+count*8, len(data))
+	}
+
+	records := make([]RecordEntry, count)
+	for i := range records {
+		entry := data[78+i*8:]
+		records[i] = RecordEntry{
+			Offset:     binary.BigEndian.Uint32(entry[0:4]),
+			Attributes: entry[4],
+			UniqueID:   [3]byte{entry[5], entry[6], entry[7]},
+		}
+		if int64(records[i].Offset) > int64(len(data)) {
+			return nil, fmt.Errorf("record %d offset %d exceeds file size %d", i, records[i].Offset, len(data))
+		}
+		if i > 0 && records[i].Offset < records[i-1].Offset {
+			return nil, fmt.Errorf("record %d offset %d precedes record %d offset %d", i, records[i].Offset, i-1, records[i-1].Offset)
+		}
+	}
+
+	return &PDB{Header: header, Records: records}, nil
+}
+
+// Title returns the database name without its NULL padding.
+func (h PDBHeader) Title() string {
+	name := h.Name[:]
+	if i := bytes.IndexByte(name, 0); i >= 0 {
+		name = name[:i]
+	}
+	return string(name)
+}
@@ -214,3 +214,67 @@ func TestNewPDB_ZeroTimeDefaults(t *testing.T) {
 		t.Fatalf("creation date %d not within expected range [%d, %d]", creationUnix, start.Unix(), end.Unix())
 	}
 }
+
+func TestParsePDB_RoundTrip(t *testing.T) {
+	creation := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pdb, err := NewPDB("Round Trip", []int{10, 20, 30}, creation, creation)
+	if err != nil {
+		t.Fatalf("NewPDB() error = %v", err)
+	}
+	header, _ := pdb.HeaderBytes()
+	list, _ := pdb.RecordListBytes()
+	data := append(append(header, list...), make([]byte, 60)...)
+
+	got, err := ParsePDB(data)
+	if err != nil {
+		t.Fatalf("ParsePDB() error = %v", err)
+	}
+	if got.Header != pdb.Header {
+		t.Errorf("header = %+v, want %+v", got.Header, pdb.Header)
+	}
+	if len(got.Records) != 3 {
+		t.Fatalf("record count = %d, want 3", len(got.Records))
+	}
+	for i := range got.Records {
+		if got.Records[i] != pdb.Records[i] {
+			t.Errorf("record %d = %+v, want %+v", i, got.Records[i], pdb.Records[i])
+		}
+	}
+	if got.Header.Title() != "Round Trip" {
+		t.Errorf("Title() = %q, want %q", got.Header.Title(), "Round Trip")
+	}
+}
+
+func TestParsePDB_Errors(t *testing.T) {
+	pdb, err := NewPDB("Bad", []int{10, 20}, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("NewPDB() error = %v", err)
+	}
+	header, _ := pdb.HeaderBytes()
+	list, _ := pdb.RecordListBytes()
+	valid := append(append(header, list...), make([]byte, 30)...)
+
+	beyondEOF := bytes.Clone(valid)
+	binary.BigEndian.PutUint32(beyondEOF[78+8:], 0xFFFF)
+
+	tests := map[string][]byte{
+		"short header":      valid[:40],
+		"truncated list":    valid[:80],
+		"offset beyond EOF": beyondEOF,
+	}
+	for name, data := range tests {
+		if _, err := ParsePDB(data); err == nil {
+			t.Errorf("%s: ParsePDB() error = nil, want error", name)
+		}
+	}
+}
+
+func TestPalmEpochTime(t *testing.T) {
+	want := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if got := PalmEpochTime(PalmEpochSeconds(want)); !got.Equal(want) {
+		t.Errorf("PalmEpochTime(Palm seconds) = %v, want %v", got, want)
+	}
+	if got := PalmEpochTime(uint32(want.Unix())); !got.Equal(want) {
+		t.Errorf("PalmEpochTime(Unix seconds) = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,523 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Section is a single MOBI section of a file, described by its Record 0.
+// Plain MOBI7 and AZW3 files have one section; joint MOBI7+KF8 files have a
+// MOBI7 section followed by a KF8 section after the BOUNDARY record.
+type Section struct {
+	// Record0 is the PDB record number of the section's Record 0.
+	// Record numbers in Header are relative to it.
+	Record0    int
+	Header     *MOBIHeader
+	EXTH       *EXTHHeader // nil when the section has no EXTH header
+	FullName   string
+	Encryption uint16 // PalmDOC encryption type, 0 means none
+	Encoding   uint32 // text encoding, EncodingUTF8 for files written by this package
+}
+
+// IsKF8 reports whether the section is a KF8 section.
+func (s *Section) IsKF8() bool {
+	return s.Header.FileVersion >= FileVersionKF8
+}
+
+// Reader parses AZW3/MOBI files into the same types used to write them.
+type Reader struct {
+	PDB *PDB
+	// Sections holds the sections in file order.
+	Sections []*Section
+
+	data []byte
+}
+
+// ReadFile reads and parses the AZW3/MOBI file at path.
+func ReadFile(path string) (*Reader, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return NewReader(data)
+}
+
+// NewReader parses the PDB header, the record list and the Record 0 of every
+// section of an AZW3/MOBI file.
+func NewReader(data []byte) (*Reader, error) {
+	pdb, err := ParsePDB(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse PDB: %w", err)
+	}
+	if pdb.Header.Type != [4]byte{'B', 'O', 'O', 'K'} || pdb.Header.Creator != [4]byte{'M', 'O', 'B', 'I'} {
+		return nil, fmt.Errorf("not a MOBI file: type %q, creator %q", pdb.Header.Type[:], pdb.Header.Creator[:])
+	}
+	if len(pdb.Records) == 0 {
+		return nil, fmt.Errorf("file has no records")
+	}
+
+	r := &Reader{PDB: pdb, data: data}
+
+	first, err := r.parseSection(0)
+	if err != nil {
+		return nil, err
+	}
+	r.Sections = append(r.Sections, first)
+
+	// A MOBI7 section points at the KF8 Record 0 of a joint file with EXTH 121.
+	if !first.IsKF8() && first.EXTH != nil {
+		if boundary, ok := first.EXTH.Uint32Value(121); ok && boundary != NullIndex && boundary > 1 && int(boundary) < len(pdb.Records) {
+			rec, err := r.Record(int(boundary) - 1)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Equal(rec, BoundaryRecord()) {
+				kf8, err := r.parseSection(int(boundary))
+				if err != nil {
+					return nil, err
+				}
+				r.Sections = append(r.Sections, kf8)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// NumRecords returns the number of PDB records.
+func (r *Reader) NumRecords() int {
+	return len(r.PDB.Records)
+}
+
+// Record returns the raw data of PDB record n.
+func (r *Reader) Record(n int) ([]byte, error) {
+	if n < 0 || n >= len(r.PDB.Records) {
+		return nil, fmt.Errorf("record %d out of range (0-%d)", n, len(r.PDB.Records)-1)
+	}
+	start := r.PDB.Records[n].Offset
+	end := uint32(len(r.data))
+	if n+1 < len(r.PDB.Records) {
+		end = r.PDB.Records[n+1].Offset
+	}
+	return r.data[start:end], nil
+}
+
+// KF8 returns the KF8 section, or nil for a MOBI7-only file.
+func (r *Reader) KF8() *Section {
+	for _, s := range r.Sections {
+		if s.IsKF8() {
+			return s
+		}
+	}
+	return nil
+}
+
+// MOBI7 returns the MOBI7 section, or nil for a KF8-only file.
+func (r *Reader) MOBI7() *Section {
+	for _, s := range r.Sections {
+		if !s.IsKF8() {
+			return s
+		}
+	}
+	return nil
+}
+
+// Text returns the decompressed text of a section, with the trailing entries
+// of every text record removed. For KF8 sections this is all flows concatenated.
+func (r *Reader) Text(s *Section) ([]byte, error) {
+	if s.Encryption != 0 {
+		return nil, fmt.Errorf("text is encrypted (encryption type %d)", s.Encryption)
+	}
+	if s.Header.Compression != CompressionNone && s.Header.Compression != CompressionPalmDoc {
+		return nil, fmt.Errorf("unsupported compression type: %d", s.Header.Compression)
+	}
+
+	text := make([]byte, 0, s.Header.TextLength)
+	for i := 1; i <= int(s.Header.TextRecordCount); i++ {
+		rec, err := r.Record(s.Record0 + i)
+		if err != nil {
+			return nil, fmt.Errorf("text record %d: %w", i, err)
+		}
+		data, err := StripTrailingEntries(rec, s.Header.ExtraRecordDataFlags)
+		if err != nil {
+			return nil, fmt.Errorf("text record %d: %w", i, err)
+		}
+		if s.Header.Compression == CompressionPalmDoc {
+			data, err = PalmDocDecompress(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decompress text record %d: %w", i, err)
+			}
+		}
+		text = append(text, data...)
+	}
+
+	if uint32(len(text)) > s.Header.TextLength {
+		text = text[:s.Header.TextLength]
+	}
+	return text, nil
+}
+
+// FDST returns the FDST record of a KF8 section, or nil when it has none.
+// The record is located through the MOBI header FDST offset when set, and
+// otherwise by its identifier among the records following the text.
+func (r *Reader) FDST(s *Section) (*FDSTRecord, error) {
+	if !s.IsKF8() {
+		return nil, nil
+	}
+	if s.Header.FDSTOffset != NullIndex && s.Header.FDSTOffset != 0 {
+		rec, err := r.Record(s.Record0 + int(s.Header.FDSTOffset))
+		if err != nil {
+			return nil, fmt.Errorf("FDST: %w", err)
+		}
+		return ParseFDST(rec)
+	}
+
+	for n := s.Record0 + int(s.Header.TextRecordCount) + 1; n < r.sectionEnd(s); n++ {
+		rec, err := r.Record(n)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(rec, fdstIdentifier[:]) {
+			return ParseFDST(rec)
+		}
+	}
+	return nil, nil
+}
+
+// RESC returns the RESC record of a KF8 section, or nil when it has none.
+// The record is read from the RESC index of the MOBI header. Files written by
+// other tools leave the index unset; their RESC record is searched for among
+// the resources, from the first image index.
+func (r *Reader) RESC(s *Section) (*RESC, error) {
+	if !s.IsKF8() {
+		return nil, nil
+	}
+	if s.Header.RESCIndex != NullIndex {
+		rec, err := r.Record(s.Record0 + int(s.Header.RESCIndex))
+		if err != nil {
+			return nil, err
+		}
+		return ParseRESCRecord(rec)
+	}
+	if s.Header.FirstImageIndex == NullIndex {
+		return nil, nil
+	}
+	for n := s.Record0 + int(s.Header.FirstImageIndex); n < r.sectionEnd(s); n++ {
+		if r.RecordType(n) == "RESC" {
+			rec, err := r.Record(n)
+			if err != nil {
+				return nil, err
+			}
+			return ParseRESCRecord(rec)
+		}
+	}
+	return nil, nil
+}
+
+// Flows returns the text of a section split into its FDST flows.
+// Flow 0 is the text flow; sections without an FDST record have only flow 0.
+func (r *Reader) Flows(s *Section) ([][]byte, error) {
+	text, err := r.Text(s)
+	if err != nil {
+		return nil, err
+	}
+	fdst, err := r.FDST(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse FDST: %w", err)
+	}
+	if fdst == nil || len(fdst.Entries) == 0 {
+		return [][]byte{text}, nil
+	}
+
+	flows := make([][]byte, len(fdst.Entries))
+	for i, e := range fdst.Entries {
+		if e[0] > e[1] || int64(e[1]) > int64(len(text)) {
+			return nil, fmt.Errorf("flow %d [%d, %d) out of range (text length %d)", i, e[0], e[1], len(text))
+		}
+		flows[i] = text[e[0]:e[1]]
+	}
+	return flows, nil
+}
+
+// Index parses the INDX index whose header record is record number index
+// relative to the section's Record 0.
+func (r *Reader) Index(s *Section, index uint32) (*Index, error) {
+	start := s.Record0 + int(index)
+	header, err := r.Record(start)
+	if err != nil {
+		return nil, err
+	}
+	entryCount, cncxCount, err := IndexRecordCounts(header)
+	if err != nil {
+		return nil, err
+	}
+	if start+entryCount+cncxCount >= r.sectionEnd(s) {
+		return nil, fmt.Errorf("index at record %d needs %d records, past the end of the section", start, 1+entryCount+cncxCount)
+	}
+
+	records := make([][]byte, 0, 1+entryCount+cncxCount)
+	for n := start; n <= start+entryCount+cncxCount; n++ {
+		rec, err := r.Record(n)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	return ParseIndex(records)
+}
+
+// NCX returns the TOC stored in the binary NCX index of a section, or nil
+// when the section has no NCX index.
+func (r *Reader) NCX(s *Section) ([]NCXEntry, error) {
+	if s.Header.NCXIndex == NullIndex {
+		return nil, nil
+	}
+	idx, err := r.Index(s, s.Header.NCXIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NCX index: %w", err)
+	}
+
+	var build func(i int) (NCXEntry, error)
+	build = func(i int) (NCXEntry, error) {
+		values := idx.Entries[i].Values
+		var e NCXEntry
+		if v := values[1]; len(v) > 0 {
+			e.FilePos = v[0]
+		}
+		if v := values[3]; len(v) > 0 {
+			label, err := idx.CNCXString(v[0])
+			if err != nil {
+				return NCXEntry{}, fmt.Errorf("NCX entry %d: %w", i, err)
+			}
+			e.Label = label
+		}
+		first, last := values[22], values[23]
+		if len(first) == 0 || len(last) == 0 {
+			return e, nil
+		}
+		// Entries are stored breadth-first, so children always follow their parent.
+		if int(first[0]) <= i || first[0] > last[0] || int(last[0]) >= len(idx.Entries) {
+			return NCXEntry{}, fmt.Errorf("NCX entry %d has invalid children %d-%d", i, first[0], last[0])
+		}
+		for c := int(first[0]); c <= int(last[0]); c++ {
+			child, err := build(c)
+			if err != nil {
+				return NCXEntry{}, err
+			}
+			e.Children = append(e.Children, child)
+		}
+		return e, nil
+	}
+
+	var entries []NCXEntry
+	for i, entry := range idx.Entries {
+		if _, hasParent := entry.Values[21]; hasParent {
+			continue
+		}
+		e, err := build(i)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Layout returns the KF8 skeleton/fragment layout of a section, decoded from
+// its SKEL and FRAG indexes, or nil when the section has no SKEL index.
+// Layout.Text is flow 0.
+func (r *Reader) Layout(s *Section) (*KF8Layout, error) {
+	if !s.IsKF8() || s.Header.SkeletonIndex == NullIndex {
+		return nil, nil
+	}
+	if s.Header.FragmentIndex == NullIndex {
+		return nil, fmt.Errorf("SKEL index without FRAG index")
+	}
+	flows, err := r.Flows(s)
+	if err != nil {
+		return nil, err
+	}
+	skel, err := r.Index(s, s.Header.SkeletonIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SKEL index: %w", err)
+	}
+	frag, err := r.Index(s, s.Header.FragmentIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse FRAG index: %w", err)
+	}
+
+	l := &KF8Layout{Text: flows[0]}
+	for i, e := range skel.Entries {
+		count, geometry := e.Values[1], e.Values[6]
+		if len(count) == 0 || len(geometry) < 2 {
+			return nil, fmt.Errorf("SKEL entry %d is missing its fragment count or geometry", i)
+		}
+		l.Skeletons = append(l.Skeletons, SkeletonEntry{
+			FileNumber:    i,
+			StartPos:      geometry[0],
+			Length:        geometry[1],
+			FragmentCount: int(count[0]),
+			FirstFragment: len(l.Fragments),
+		})
+		sk := l.Skeletons[i]
+		if sk.FirstFragment+sk.FragmentCount > len(frag.Entries) {
+			return nil, fmt.Errorf("SKEL entry %d refers to fragments beyond the FRAG index", i)
+		}
+		for j := sk.FirstFragment; j < sk.FirstFragment+sk.FragmentCount; j++ {
+			fe := frag.Entries[j]
+			insertPos, err := strconv.ParseUint(fe.Label, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("FRAG entry %d has invalid insert position %q", j, fe.Label)
+			}
+			geometry := fe.Values[6]
+			if len(geometry) < 2 {
+				return nil, fmt.Errorf("FRAG entry %d is missing its geometry", j)
+			}
+			f := FragmentEntry{
+				InsertPos:      uint32(insertPos),
+				FileNumber:     i,
+				SequenceNumber: j,
+				StartPos:       geometry[0],
+				Length:         geometry[1],
+				// Fragments are stored right after their skeleton.
+				RawStart: sk.StartPos + sk.Length + geometry[0],
+			}
+			if v := fe.Values[2]; len(v) > 0 {
+				if selector, err := frag.CNCXString(v[0]); err == nil {
+					f.Selector = selector
+				}
+			}
+			l.Fragments = append(l.Fragments, f)
+		}
+	}
+	return l, nil
+}
+
+// RecordType guesses the kind of PDB record n from its position in a section
+// and its leading bytes.
+func (r *Reader) RecordType(n int) string {
+	for _, s := range r.Sections {
+		kind := "MOBI7"
+		if s.IsKF8() {
+			kind = "KF8"
+		}
+		if n == s.Record0 {
+			return kind + " Record 0"
+		}
+		if n > s.Record0 && n <= s.Record0+int(s.Header.TextRecordCount) {
+			return kind + " text"
+		}
+		for _, index := range []struct {
+			name   string
+			record uint32
+		}{
+			{"NCX", s.Header.NCXIndex},
+			{"FRAG", s.Header.FragmentIndex},
+			{"SKEL", s.Header.SkeletonIndex},
+			{"guide", s.Header.GuideIndex},
+		} {
+			if index.record == NullIndex {
+				continue
+			}
+			start := s.Record0 + int(index.record)
+			header, err := r.Record(start)
+			if err != nil {
+				continue
+			}
+			entryCount, cncxCount, err := IndexRecordCounts(header)
+			if err != nil {
+				continue
+			}
+			switch {
+			case n == start:
+				return index.name + " INDX header"
+			case n > start && n <= start+entryCount:
+				return index.name + " INDX"
+			case n > start+entryCount && n <= start+entryCount+cncxCount:
+				return index.name + " CNCX"
+			}
+		}
+	}
+
+	rec, err := r.Record(n)
+	if err != nil {
+		return "invalid"
+	}
+	switch {
+	case len(rec) == 0:
+		return "empty"
+	case bytes.Equal(rec, BoundaryRecord()):
+		return "BOUNDARY"
+	case bytes.Equal(rec, EOFRecord()):
+		return "EOF"
+	case bytes.HasPrefix(rec, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(rec, []byte("\x89PNG")):
+		return "image/png"
+	case bytes.HasPrefix(rec, []byte("GIF8")):
+		return "image/gif"
+	case bytes.HasPrefix(rec, []byte("<html")):
+		return "NCX (HTML)"
+	}
+	if len(rec) >= 4 {
+		switch magic := string(rec[:4]); magic {
+		case "INDX", "FDST", "FLIS", "FCIS", "FONT", "RESC", "DATP", "SRCS", "CMET", "CRES", "PAGE":
+			return magic
+		}
+	}
+	return "unknown"
+}
+
+// parseSection parses the Record 0 at PDB record number n.
+func (r *Reader) parseSection(n int) (*Section, error) {
+	record0, err := r.Record(n)
+	if err != nil {
+		return nil, err
+	}
+	header, err := ParseMOBIHeader(record0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse MOBI header of record %d: %w", n, err)
+	}
+
+	mobi := record0[PalmDOCHeaderSize:]
+	headerLen := int(binary.BigEndian.Uint32(mobi[4:8]))
+	s := &Section{
+		Record0:    n,
+		Header:     header,
+		Encryption: binary.BigEndian.Uint16(record0[12:14]),
+	}
+	if len(mobi) >= 16 {
+		s.Encoding = binary.BigEndian.Uint32(mobi[12:16])
+	}
+
+	if headerLen >= 104 && binary.BigEndian.Uint32(mobi[100:104])&EXTHFlagPresent != 0 {
+		s.EXTH, err = ParseEXTH(mobi[headerLen:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse EXTH of record %d: %w", n, err)
+		}
+	}
+
+	// The full name offset is relative to the MOBI header start.
+	if headerLen >= 76 {
+		offset := int64(binary.BigEndian.Uint32(mobi[68:72]))
+		length := int64(binary.BigEndian.Uint32(mobi[72:76]))
+		if offset+length > int64(len(mobi)) {
+			return nil, fmt.Errorf("full name of record %d out of range", n)
+		}
+		s.FullName = string(mobi[offset : offset+length])
+	}
+	return s, nil
+}
+
+// sectionEnd returns the PDB record number following the last record of s.
+func (r *Reader) sectionEnd(s *Section) int {
+	for _, other := range r.Sections {
+		if other.Record0 > s.Record0 {
+			return other.Record0 - 1 // BOUNDARY record
+		}
+	}
+	return len(r.PDB.Records)
+}
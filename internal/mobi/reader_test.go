@@ -0,0 +1,341 @@
+package mobi
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yuanying/epub2azw3/internal/epub"
+)
+
+func TestNewReader_KF8RoundTrip(t *testing.T) {
+	html := []byte(`<html><head></head><body>` +
+		`<div id="ch1"><h1>第一章</h1><p>` + strings.Repeat("吾輩は猫である。", 600) + `</p></div>` +
+		`<div id="ch2"><h1>Chapter 2</h1><p>` + strings.Repeat("text ", 200) + `</p></div>` +
+		`</body></html>`)
+	css := []byte("p { margin: 0; }")
+	uid := uint32(4242)
+	creation := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	meta := &epub.Metadata{
+		Title:    "読み取りテスト",
+		Language: "ja",
+		Creators: []epub.Creator{{Name: "著者"}},
+	}
+
+	w, err := NewAZW3Writer(AZW3WriterConfig{
+		Title:        meta.Title,
+		HTML:         html,
+		Metadata:     meta,
+		Compression:  CompressionPalmDoc,
+		CreationTime: creation,
+		UniqueID:     &uid,
+		ChapterIDs:   []string{"ch1", "ch2"},
+		NCXEntries: []NCXEntry{
+			{Label: "第一章", FilePos: 0, Children: []NCXEntry{{Label: "節", FilePos: 40}}},
+			{Label: "Chapter 2", FilePos: 100},
+		},
+		Flows:        [][]byte{css},
+		ImageRecords: [][]byte{[]byte("IMAGEDATA")},
+	})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	data := writeToBuffer(t, w)
+
+	r, err := NewReader(data)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	if got := r.PDB.Header.Title(); got != meta.Title {
+		t.Errorf("PDB title = %q, want %q", got, meta.Title)
+	}
+	if got := r.PDB.Header.CreationDate; got != PalmEpochSeconds(creation) {
+		t.Errorf("creation date = %d, want %d", got, PalmEpochSeconds(creation))
+	}
+	if len(r.Sections) != 1 {
+		t.Fatalf("section count = %d, want 1", len(r.Sections))
+	}
+	kf8 := r.KF8()
+	if kf8 == nil || r.MOBI7() != nil {
+		t.Fatal("expected a KF8-only file")
+	}
+	if kf8.FullName != meta.Title {
+		t.Errorf("full name = %q, want %q", kf8.FullName, meta.Title)
+	}
+	if kf8.Encoding != EncodingUTF8 {
+		t.Errorf("encoding = %d, want %d", kf8.Encoding, EncodingUTF8)
+	}
+	h := kf8.Header
+	if h.UniqueID != uid || h.Compression != CompressionPalmDoc || h.LanguageCode != 0x0411 {
+		t.Errorf("header = %+v", h)
+	}
+	if h.ExtraRecordDataFlags != ExtraDataMultibyte {
+		t.Errorf("extra record data flags = %d, want %d", h.ExtraRecordDataFlags, ExtraDataMultibyte)
+	}
+	if h.FDSTFlowCount != 2 {
+		t.Errorf("FDST flow count = %d, want 2", h.FDSTFlowCount)
+	}
+
+	if author, ok := kf8.EXTH.StringValue(100); !ok || author != "著者" {
+		t.Errorf("EXTH 100 = %q, %v", author, ok)
+	}
+	if count, ok := kf8.EXTH.Uint32Value(125); !ok || int(count) != r.NumRecords() {
+		t.Errorf("EXTH 125 = %d, want %d", count, r.NumRecords())
+	}
+
+	if img, err := r.Record(kf8.Record0 + int(h.FirstImageIndex)); err != nil || string(img) != "IMAGEDATA" {
+		t.Errorf("first image record = %q, %v", img, err)
+	}
+
+	flows, err := r.Flows(kf8)
+	if err != nil {
+		t.Fatalf("Flows() error = %v", err)
+	}
+	if len(flows) != 2 {
+		t.Fatalf("flow count = %d, want 2", len(flows))
+	}
+	if !bytes.Equal(flows[1], css) {
+		t.Errorf("flow 1 = %q, want %q", flows[1], css)
+	}
+	if !bytes.Contains(flows[0], []byte(strings.Repeat("吾輩は猫である。", 600))) {
+		t.Error("flow 0 does not contain the chapter text")
+	}
+
+	ncx, err := r.NCX(kf8)
+	if err != nil {
+		t.Fatalf("NCX() error = %v", err)
+	}
+	want := []NCXEntry{
+		{Label: "第一章", FilePos: 0, Children: []NCXEntry{{Label: "節", FilePos: 40}}},
+		{Label: "Chapter 2", FilePos: 100},
+	}
+	if !reflect.DeepEqual(ncx, want) {
+		t.Errorf("NCX() = %+v, want %+v", ncx, want)
+	}
+
+	frag, err := r.Index(kf8, h.FragmentIndex)
+	if err != nil {
+		t.Fatalf("Index(FRAG) error = %v", err)
+	}
+	if len(frag.Entries) == 0 {
+		t.Error("FRAG index has no entries")
+	}
+}
+
+func TestNewReader_JointFile(t *testing.T) {
+	html := generateTestHTML(100)
+	mobi7 := generateTestHTML(5000)
+	uid := uint32(1)
+
+	w, err := NewAZW3Writer(AZW3WriterConfig{
+		Title:        "Joint",
+		HTML:         html,
+		UniqueID:     &uid,
+		ImageRecords: [][]byte{[]byte("IMAGEDATA")},
+		MOBI7HTML:    mobi7,
+	})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	r, err := NewReader(writeToBuffer(t, w))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	if len(r.Sections) != 2 {
+		t.Fatalf("section count = %d, want 2", len(r.Sections))
+	}
+	m7, kf8 := r.MOBI7(), r.KF8()
+	if m7 == nil || kf8 == nil {
+		t.Fatal("expected MOBI7 and KF8 sections")
+	}
+	if m7.Record0 != 0 || kf8.Record0 != 4 {
+		t.Errorf("Record0 = %d, %d; want 0, 4", m7.Record0, kf8.Record0)
+	}
+	if m7.Header.FileVersion != FileVersionMOBI7 || m7.Header.MOBIType != MOBITypeBook {
+		t.Errorf("MOBI7 header = %+v", m7.Header)
+	}
+
+	text7, err := r.Text(m7)
+	if err != nil {
+		t.Fatalf("Text(MOBI7) error = %v", err)
+	}
+	if !bytes.Equal(text7, mobi7) {
+		t.Error("MOBI7 text does not match")
+	}
+	flows, err := r.Flows(kf8)
+	if err != nil {
+		t.Fatalf("Flows(KF8) error = %v", err)
+	}
+	if len(flows) != 1 || !bytes.Equal(flows[0], html) {
+		t.Errorf("KF8 flows = %q", flows)
+	}
+
+	// The MOBI7 first image index is absolute.
+	if img, err := r.Record(int(m7.Header.FirstImageIndex)); err != nil || string(img) != "IMAGEDATA" {
+		t.Errorf("MOBI7 first image record = %q, %v", img, err)
+	}
+	if fdst, err := r.FDST(m7); err != nil || fdst != nil {
+		t.Errorf("FDST(MOBI7) = %v, %v; want nil", fdst, err)
+	}
+}
+
+func TestNewReader_NoNCX(t *testing.T) {
+	w, err := NewAZW3Writer(AZW3WriterConfig{Title: "Plain", HTML: generateTestHTML(100)})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	r, err := NewReader(writeToBuffer(t, w))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	ncx, err := r.NCX(r.KF8())
+	if err != nil || ncx != nil {
+		t.Errorf("NCX() = %v, %v; want nil", ncx, err)
+	}
+}
+
+func TestNewReader_Errors(t *testing.T) {
+	w, err := NewAZW3Writer(AZW3WriterConfig{Title: "Plain", HTML: generateTestHTML(100)})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	valid := writeToBuffer(t, w)
+
+	notMOBI := bytes.Clone(valid)
+	copy(notMOBI[60:68], "TEXtREAd")
+
+	badRecord0 := bytes.Clone(valid)
+	copy(badRecord0[readUint32BE(valid, 78)+16:], "XXXX")
+
+	tests := map[string][]byte{
+		"empty":        nil,
+		"truncated":    valid[:80],
+		"not MOBI":     notMOBI,
+		"bad Record 0": badRecord0,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewReader(data); err == nil {
+				t.Error("NewReader() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestReader_IndexInflatedCount(t *testing.T) {
+	w, err := NewAZW3Writer(AZW3WriterConfig{
+		Title:      "Chapters",
+		HTML:       []byte(`<html><head></head><body><div id="ch1"><p>text</p></div></body></html>`),
+		ChapterIDs: []string{"ch1"},
+	})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	data := writeToBuffer(t, w)
+	r, err := NewReader(data)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	kf8 := r.KF8()
+	// Entry record count at offset 24 of the SKEL INDX header record
+	header := readUint32BE(data, 78+8*(kf8.Record0+int(kf8.Header.SkeletonIndex)))
+	copy(data[header+24:], []byte{0xFF, 0xFF, 0xFF, 0xF0})
+
+	if r, err = NewReader(data); err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if _, err := r.Index(r.KF8(), r.KF8().Header.SkeletonIndex); err == nil {
+		t.Error("Index() error = nil, want error for an inflated entry count")
+	}
+	if _, err := r.Layout(r.KF8()); err == nil {
+		t.Error("Layout() error = nil, want error for an inflated entry count")
+	}
+}
+
+func TestReader_TextEncrypted(t *testing.T) {
+	w, err := NewAZW3Writer(AZW3WriterConfig{Title: "Plain", HTML: generateTestHTML(100)})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	data := writeToBuffer(t, w)
+	// PalmDOC encryption type at offset 12 of Record 0
+	data[readUint32BE(data, 78)+13] = 2
+
+	r, err := NewReader(data)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if _, err := r.Text(r.Sections[0]); err == nil {
+		t.Error("Text() error = nil, want error for encrypted text")
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	w, err := NewAZW3Writer(AZW3WriterConfig{Title: "File", HTML: generateTestHTML(100)})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "book.azw3")
+	if err := os.WriteFile(path, writeToBuffer(t, w), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if r.KF8().FullName != "File" {
+		t.Errorf("full name = %q, want %q", r.KF8().FullName, "File")
+	}
+
+	if _, err := ReadFile(filepath.Join(t.TempDir(), "missing.azw3")); err == nil {
+		t.Error("ReadFile() error = nil for a missing file")
+	}
+}
+
+func TestReader_RecordType(t *testing.T) {
+	w, err := NewAZW3Writer(AZW3WriterConfig{
+		Title:        "Types",
+		HTML:         []byte(`<html><body><div id="c1"><p>one</p></div></body></html>`),
+		ChapterIDs:   []string{"c1"},
+		NCXEntries:   []NCXEntry{{Label: "One", FilePos: 0}},
+		ImageRecords: [][]byte{{0xFF, 0xD8, 0xFF, 0xE0}},
+		MOBI7HTML:    generateTestHTML(100),
+	})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	r, err := NewReader(writeToBuffer(t, w))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	// MOBI7: Record 0, text; BOUNDARY; KF8: Record 0, text, image,
+	// NCX (header, entries, CNCX), FRAG (header, entries, CNCX), SKEL (header, entries),
+	// FDST, FLIS, FCIS, EOF
+	want := []string{
+		"MOBI7 Record 0", "MOBI7 text", "BOUNDARY",
+		"KF8 Record 0", "KF8 text", "image/jpeg",
+		"NCX INDX header", "NCX INDX", "NCX CNCX",
+		"FRAG INDX header", "FRAG INDX", "FRAG CNCX",
+		"SKEL INDX header", "SKEL INDX",
+		"FDST", "FLIS", "FCIS", "EOF",
+	}
+	if r.NumRecords() != len(want) {
+		t.Fatalf("record count = %d, want %d", r.NumRecords(), len(want))
+	}
+	for i, w := range want {
+		if got := r.RecordType(i); got != w {
+			t.Errorf("RecordType(%d) = %q, want %q", i, got, w)
+		}
+	}
+	if got := r.RecordType(len(want)); got != "invalid" {
+		t.Errorf("RecordType(out of range) = %q, want %q", got, "invalid")
+	}
+}
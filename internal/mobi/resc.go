@@ -0,0 +1,124 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// rescHeaderSize is the size of the fixed RESC record header:
+// "RESC", version, type and a reserved field.
+const rescHeaderSize = 16
+
+// RESC is the resource container of a KF8 section: an OPF-like XML document
+// holding the spine and its page-progression-direction. Kindle reads the page
+// direction and the page-spread properties from it rather than from the EXTH.
+type RESC struct {
+	PageProgressionDirection string // "rtl", "ltr", or "" (not specified)
+	Spine                    []RESCSpineItem
+}
+
+// RESCSpineItem is a spine itemref of a RESC record.
+type RESCSpineItem struct {
+	IDRef string
+	// SkeletonID is the KF8 skeleton holding the item, or -1 when the item
+	// has no skeleton (e.g. it could not be loaded).
+	SkeletonID int
+	Linear     bool
+	Properties []string // e.g. "page-spread-left", "rendition:layout-pre-paginated"
+}
+
+// rescPackage is the XML document stored in a RESC record.
+type rescPackage struct {
+	Spine struct {
+		PageProgressionDirection string `xml:"page-progression-direction,attr"`
+		ItemRefs                 []struct {
+			IDRef      string `xml:"idref,attr"`
+			SkelID     string `xml:"skelid,attr"`
+			Linear     string `xml:"linear,attr"`
+			Properties string `xml:"properties,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+// NewRESCRecord serializes a RESC record. After the 16-byte header, the record
+// holds "size=<XML length in base 32>&version=&type=1" followed by the XML,
+// padded with NUL bytes to a multiple of four bytes.
+func NewRESCRecord(resc RESC) []byte {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>`)
+	b.WriteString(`<package version="2.0" xmlns="http://www.idpf.org/2007/opf" unique-identifier="uid">`)
+	b.WriteString(`<spine`)
+	if resc.PageProgressionDirection != "" {
+		fmt.Fprintf(&b, ` page-progression-direction="%s"`, html.EscapeString(resc.PageProgressionDirection))
+	}
+	b.WriteString(`>`)
+	for _, item := range resc.Spine {
+		fmt.Fprintf(&b, `<itemref idref="%s"`, html.EscapeString(item.IDRef))
+		if item.SkeletonID >= 0 {
+			fmt.Fprintf(&b, ` skelid="%d"`, item.SkeletonID)
+		}
+		if !item.Linear {
+			b.WriteString(` linear="no"`)
+		}
+		if len(item.Properties) > 0 {
+			fmt.Fprintf(&b, ` properties="%s"`, html.EscapeString(strings.Join(item.Properties, " ")))
+		}
+		b.WriteString(`/>`)
+	}
+	b.WriteString(`</spine></package>`)
+	doc := b.String()
+
+	rec := make([]byte, rescHeaderSize, rescHeaderSize+len(doc)+32)
+	copy(rec[0:4], "RESC")
+	binary.BigEndian.PutUint32(rec[4:8], 1)  // version
+	binary.BigEndian.PutUint32(rec[8:12], 1) // type
+	rec = fmt.Appendf(rec, "size=%s&version=&type=1", toBase32(uint32(len(doc)), 1))
+	rec = append(rec, doc...)
+	for len(rec)%4 != 0 {
+		rec = append(rec, 0)
+	}
+	return rec
+}
+
+// ParseRESCRecord parses a RESC record written by NewRESCRecord or KindleGen.
+func ParseRESCRecord(rec []byte) (*RESC, error) {
+	if len(rec) < rescHeaderSize || string(rec[0:4]) != "RESC" {
+		return nil, fmt.Errorf("not a RESC record")
+	}
+	data := rec[rescHeaderSize:]
+	start := bytes.IndexByte(data, '<')
+	if start < 0 {
+		return nil, fmt.Errorf("RESC record has no XML document")
+	}
+	data = data[start:]
+	if end := bytes.IndexByte(data, 0); end >= 0 {
+		data = data[:end]
+	}
+
+	var pkg rescPackage
+	if err := xml.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("failed to parse RESC XML: %w", err)
+	}
+
+	resc := &RESC{PageProgressionDirection: pkg.Spine.PageProgressionDirection}
+	for _, ref := range pkg.Spine.ItemRefs {
+		item := RESCSpineItem{
+			IDRef:      ref.IDRef,
+			SkeletonID: -1,
+			Linear:     ref.Linear != "no",
+		}
+		if ref.Properties != "" {
+			item.Properties = strings.Fields(ref.Properties)
+		}
+		if id, err := strconv.Atoi(ref.SkelID); err == nil {
+			item.SkeletonID = id
+		}
+		resc.Spine = append(resc.Spine, item)
+	}
+	return resc, nil
+}
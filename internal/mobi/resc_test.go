@@ -0,0 +1,85 @@
+package mobi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestRESCRecord_RoundTrip(t *testing.T) {
+	resc := RESC{
+		PageProgressionDirection: "rtl",
+		Spine: []RESCSpineItem{
+			{IDRef: "cover", SkeletonID: 0, Linear: false, Properties: []string{"page-spread-left"}},
+			{IDRef: "ch<1>", SkeletonID: 1, Linear: true},
+			{IDRef: "image", SkeletonID: -1, Linear: true, Properties: []string{"page-spread-right", "rendition:layout-pre-paginated"}},
+		},
+	}
+	rec := NewRESCRecord(resc)
+
+	if string(rec[0:4]) != "RESC" {
+		t.Errorf("magic = %q, want RESC", rec[0:4])
+	}
+	if version := binary.BigEndian.Uint32(rec[4:8]); version != 1 {
+		t.Errorf("version = %d, want 1", version)
+	}
+	if !bytes.HasPrefix(rec[16:], []byte("size=")) {
+		t.Errorf("RESC data = %q, want size= prefix", rec[16:32])
+	}
+	if len(rec)%4 != 0 {
+		t.Errorf("record length %d is not a multiple of 4", len(rec))
+	}
+	if !bytes.Contains(rec, []byte(`<spine page-progression-direction="rtl">`)) {
+		t.Errorf("spine element not found in %q", rec)
+	}
+
+	got, err := ParseRESCRecord(rec)
+	if err != nil {
+		t.Fatalf("ParseRESCRecord() error = %v", err)
+	}
+	if !reflect.DeepEqual(*got, resc) {
+		t.Errorf("ParseRESCRecord() = %+v, want %+v", *got, resc)
+	}
+}
+
+func TestParseRESCRecord_KindleGen(t *testing.T) {
+	data := []byte(`size=3&version=&type=1<?xml version="1.0" encoding="UTF-8"?>` +
+		`<package version="2.0" xmlns="http://www.idpf.org/2007/opf" unique-identifier="BookId">` +
+		`<metadata><meta name="cover" content="cover"/></metadata>` +
+		`<spine toc="ncx" page-progression-direction="ltr"><itemref idref="a" skelid="0"/></spine>` +
+		`</package>`)
+	rec := append([]byte("RESC\x00\x00\x00\x01\x00\x00\x00\x01\x00\x00\x00\x00"), data...)
+	rec = append(rec, 0, 0, 0)
+
+	got, err := ParseRESCRecord(rec)
+	if err != nil {
+		t.Fatalf("ParseRESCRecord() error = %v", err)
+	}
+	want := &RESC{
+		PageProgressionDirection: "ltr",
+		Spine:                    []RESCSpineItem{{IDRef: "a", SkeletonID: 0, Linear: true}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRESCRecord() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseRESCRecord_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		rec  []byte
+	}{
+		{"not a RESC record", []byte("FONT000000000000<package/>")},
+		{"truncated header", []byte("RESC")},
+		{"no XML", []byte("RESC000000000000size=0&version=&type=1")},
+		{"malformed XML", []byte("RESC000000000000size=0&version=&type=1<package><spine>")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseRESCRecord(tt.rec); err == nil {
+				t.Error("ParseRESCRecord() error = nil, want error")
+			}
+		})
+	}
+}
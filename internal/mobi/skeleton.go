@@ -0,0 +1,538 @@
+package mobi
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MaxFragmentSize is the preferred maximum size in bytes of a single KF8 fragment.
+// Fragments are only cut between top-level elements, so a single large element
+// may still produce a larger fragment.
+const MaxFragmentSize = 8192
+
+// kindlePosPlaceholder is a fixed-width internal link that is filled in once
+// the final fragment positions are known.
+const kindlePosPlaceholder = "kindle:pos:fid:0000:off:0000000000"
+
+// base32Digits are the digits used by kindle:pos and aid values.
+const base32Digits = "0123456789ABCDEFGHIJKLMNOPQRSTUV"
+
+// internalHrefRe matches href attributes that point at a fragment in the same document.
+var internalHrefRe = regexp.MustCompile(`href="#([^"]+)"`)
+
+// elementIDRe matches id attributes.
+var elementIDRe = regexp.MustCompile(`\sid="([^"]+)"`)
+
+// voidElements lists HTML elements that never have a closing tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// rawTextElements lists HTML elements whose content is not parsed as markup.
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true,
+}
+
+// SkeletonEntry describes one KF8 skeleton (one reconstructed HTML file).
+type SkeletonEntry struct {
+	FileNumber    int
+	StartPos      uint32 // skeleton start in the text flow
+	Length        uint32 // skeleton length (without fragments)
+	FragmentCount int
+	FirstFragment int // index into KF8Layout.Fragments
+}
+
+// FragmentEntry describes one KF8 fragment (a chunk inserted into a skeleton).
+type FragmentEntry struct {
+	InsertPos      uint32 // absolute insert position in the text flow
+	Selector       string // XPath-like selector of the insertion parent
+	FileNumber     int
+	SequenceNumber int
+	StartPos       uint32 // offset of the fragment among the file's fragments
+	Length         uint32
+	RawStart       uint32 // position of the fragment bytes in the text flow
+}
+
+// KF8Layout is the integrated HTML rearranged into KF8 skeletons and fragments.
+// Text is the resulting text flow: each skeleton followed by its fragments.
+type KF8Layout struct {
+	Text      []byte
+	Skeletons []SkeletonEntry
+	Fragments []FragmentEntry
+
+	chapterSkeletons map[string]int // chapter div id -> skeleton index
+}
+
+// ChapterSkeleton returns the index of the skeleton holding the chapter div
+// with the given id. It is only known for layouts built by BuildKF8Layout.
+func (l *KF8Layout) ChapterSkeleton(chapterID string) (int, bool) {
+	i, ok := l.chapterSkeletons[chapterID]
+	return i, ok
+}
+
+// layoutPiece maps a byte range of the source HTML to its copy in the text flow.
+type layoutPiece struct {
+	srcStart int
+	srcEnd   int
+	dstStart int
+}
+
+// BuildKF8Layout splits the integrated HTML into per-chapter skeletons and fragments.
+// Each chapter div (<div id="ch01">, ...) becomes its own skeleton; content in the
+// body before the first chapter (e.g. the inline TOC) becomes a separate skeleton.
+// Internal "#id" links are rewritten to kindle:pos:fid links so that they resolve
+// across skeletons. The layout is deterministic, so callers may compute byte
+// offsets on Text before handing the same HTML to the writer.
+func BuildKF8Layout(html []byte, chapterIDs []string) (*KF8Layout, error) {
+	return BuildKF8LayoutWithHeads(html, chapterIDs, nil)
+}
+
+// BuildKF8LayoutWithHeads is BuildKF8Layout with additional head markup per
+// chapter: heads[chapterID] is inserted at the end of the head element of the
+// chapter's skeleton, e.g. the viewport meta of a fixed-layout page.
+func BuildKF8LayoutWithHeads(html []byte, chapterIDs []string, heads map[string][]byte) (*KF8Layout, error) {
+	html, targets := insertLinkPlaceholders(html)
+
+	bodyOpenStart := indexTagStart(html, "<body", 0)
+	if bodyOpenStart < 0 {
+		return nil, fmt.Errorf("body element not found")
+	}
+	bodyOpenEnd := bytes.IndexByte(html[bodyOpenStart:], '>')
+	if bodyOpenEnd < 0 {
+		return nil, fmt.Errorf("unterminated body element")
+	}
+	bodyOpenEnd += bodyOpenStart + 1
+	bodyClose := bytes.LastIndex(html, []byte("</body>"))
+	if bodyClose < bodyOpenEnd {
+		return nil, fmt.Errorf("closing body tag not found")
+	}
+
+	head := html[:bodyOpenStart]
+	headClose := bytes.LastIndex(head, []byte("</head>"))
+	if headClose < 0 {
+		headClose = len(head)
+	}
+	bodyTag := html[bodyOpenStart:bodyOpenEnd]
+	tail := html[bodyClose:]
+
+	// Locate chapter div boundaries in document order.
+	var starts []int
+	var startIDs []string
+	searchFrom := bodyOpenEnd
+	for _, id := range chapterIDs {
+		pos := indexTagStart(html[:bodyClose], `<div id="`+id+`"`, searchFrom)
+		if pos < 0 {
+			continue
+		}
+		starts = append(starts, pos)
+		startIDs = append(startIDs, id)
+		searchFrom = pos + 1
+	}
+
+	l := &KF8Layout{chapterSkeletons: make(map[string]int)}
+	var pieces []layoutPiece
+	buf := &bytes.Buffer{}
+
+	addFile := func(chapterID string, wrapperStart, wrapperEnd, contentStart, contentEnd, closeStart, closeEnd int) {
+		fileNum := len(l.Skeletons)
+		aid := toBase32(uint32(fileNum), 1)
+		skelStart := buf.Len()
+
+		if extra := heads[chapterID]; len(extra) > 0 && chapterID != "" {
+			buf.Write(head[:headClose])
+			buf.Write(extra)
+			buf.Write(head[headClose:])
+		} else {
+			buf.Write(head)
+		}
+		var insertOffset int
+		if wrapperStart < 0 {
+			buf.Write(injectAID(bodyTag, aid))
+			insertOffset = buf.Len() - skelStart
+			buf.Write(tail)
+		} else {
+			buf.Write(bodyTag)
+			pieces = append(pieces, layoutPiece{srcStart: wrapperStart, srcEnd: wrapperEnd, dstStart: buf.Len()})
+			buf.Write(injectAID(html[wrapperStart:wrapperEnd], aid))
+			insertOffset = buf.Len() - skelStart
+			buf.Write(html[closeStart:closeEnd])
+			buf.Write(tail)
+		}
+
+		skel := SkeletonEntry{
+			FileNumber:    fileNum,
+			StartPos:      uint32(skelStart),
+			Length:        uint32(buf.Len() - skelStart),
+			FirstFragment: len(l.Fragments),
+		}
+
+		var cp uint32
+		for _, chunk := range splitFragments(html, contentStart, contentEnd) {
+			pieces = append(pieces, layoutPiece{srcStart: chunk[0], srcEnd: chunk[1], dstStart: buf.Len()})
+			frag := FragmentEntry{
+				InsertPos:      skel.StartPos + uint32(insertOffset) + cp,
+				Selector:       fmt.Sprintf("P-//*[@aid='%s']", aid),
+				FileNumber:     fileNum,
+				SequenceNumber: len(l.Fragments),
+				StartPos:       cp,
+				Length:         uint32(chunk[1] - chunk[0]),
+				RawStart:       uint32(buf.Len()),
+			}
+			buf.Write(html[chunk[0]:chunk[1]])
+			cp += frag.Length
+			l.Fragments = append(l.Fragments, frag)
+		}
+		skel.FragmentCount = len(l.Fragments) - skel.FirstFragment
+		l.Skeletons = append(l.Skeletons, skel)
+		if chapterID != "" {
+			l.chapterSkeletons[chapterID] = fileNum
+		}
+	}
+
+	// Front matter (or the whole body when no chapter divs were found).
+	frontEnd := bodyClose
+	if len(starts) > 0 {
+		frontEnd = starts[0]
+	}
+	if frontEnd > bodyOpenEnd || len(starts) == 0 {
+		addFile("", -1, -1, bodyOpenEnd, frontEnd, -1, -1)
+	}
+
+	for i, start := range starts {
+		end := bodyClose
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		openEnd := bytes.IndexByte(html[start:end], '>')
+		if openEnd < 0 {
+			return nil, fmt.Errorf("unterminated chapter div at offset %d", start)
+		}
+		openEnd += start + 1
+		closeStart := bytes.LastIndex(html[openEnd:end], []byte("</div>"))
+		if closeStart < 0 {
+			return nil, fmt.Errorf("closing tag for chapter div at offset %d not found", start)
+		}
+		closeStart += openEnd
+		addFile(startIDs[i], start, openEnd, openEnd, closeStart, closeStart, end)
+	}
+
+	l.Text = buf.Bytes()
+	if err := l.resolveLinkPlaceholders(html, pieces, targets); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// insertLinkPlaceholders replaces href="#id" attributes whose target exists in the
+// document with fixed-width kindle:pos placeholders. It returns the rewritten HTML
+// and, for every placeholder position, the target id.
+func insertLinkPlaceholders(html []byte) ([]byte, map[int]string) {
+	ids := elementIDPositions(html)
+	targets := make(map[int]string)
+	var out bytes.Buffer
+	last := 0
+	for _, m := range internalHrefRe.FindAllSubmatchIndex(html, -1) {
+		id := string(html[m[2]:m[3]])
+		if _, ok := ids[id]; !ok {
+			continue
+		}
+		out.Write(html[last:m[0]])
+		out.WriteString(`href="`)
+		targets[out.Len()] = id
+		out.WriteString(kindlePosPlaceholder)
+		out.WriteString(`"`)
+		last = m[1]
+	}
+	if last == 0 {
+		return html, targets
+	}
+	out.Write(html[last:])
+	return out.Bytes(), targets
+}
+
+// resolveLinkPlaceholders overwrites each placeholder in Text with the
+// kindle:pos:fid reference of its target.
+func (l *KF8Layout) resolveLinkPlaceholders(src []byte, pieces []layoutPiece, targets map[int]string) error {
+	ids := elementIDPositions(src)
+	for srcPos, id := range targets {
+		dst, ok := mapLayoutOffset(pieces, srcPos)
+		if !ok {
+			return fmt.Errorf("link placeholder at offset %d was not placed", srcPos)
+		}
+
+		tagStart, ok := ids[id]
+		if !ok {
+			continue
+		}
+		targetPos, ok := mapLayoutOffset(pieces, tagStart)
+		if !ok {
+			continue
+		}
+		fid, off, ok := l.fragmentPosition(uint32(targetPos))
+		if !ok {
+			continue
+		}
+		ref := fmt.Sprintf("kindle:pos:fid:%s:off:%s", toBase32(uint32(fid), 4), toBase32(off, 10))
+		copy(l.Text[dst:], ref)
+	}
+	return nil
+}
+
+// elementIDPositions maps each element id to the start of the first tag carrying it.
+func elementIDPositions(html []byte) map[string]int {
+	ids := make(map[string]int)
+	for _, m := range elementIDRe.FindAllSubmatchIndex(html, -1) {
+		id := string(html[m[2]:m[3]])
+		if _, exists := ids[id]; exists {
+			continue
+		}
+		ids[id] = bytes.LastIndexByte(html[:m[0]], '<')
+	}
+	return ids
+}
+
+// fragmentPosition returns the fragment sequence number and the offset within
+// that fragment for a position in the text flow. Positions inside a skeleton
+// resolve to the start of the skeleton's first fragment.
+func (l *KF8Layout) fragmentPosition(pos uint32) (int, uint32, bool) {
+	i := sort.Search(len(l.Fragments), func(i int) bool {
+		return l.Fragments[i].RawStart+l.Fragments[i].Length > pos
+	})
+	if i < len(l.Fragments) && pos >= l.Fragments[i].RawStart {
+		f := l.Fragments[i]
+		return f.SequenceNumber, pos - f.RawStart, true
+	}
+	for _, s := range l.Skeletons {
+		if pos >= s.StartPos && pos < s.StartPos+s.Length && s.FragmentCount > 0 {
+			return s.FirstFragment, 0, true
+		}
+	}
+	return 0, 0, false
+}
+
+// mapLayoutOffset maps a source HTML offset to its position in the text flow.
+func mapLayoutOffset(pieces []layoutPiece, srcPos int) (int, bool) {
+	for _, p := range pieces {
+		if srcPos >= p.srcStart && srcPos < p.srcEnd {
+			return p.dstStart + (srcPos - p.srcStart), true
+		}
+	}
+	return 0, false
+}
+
+// splitFragments splits html[start:end] into chunks of at most MaxFragmentSize
+// bytes, cutting only between top-level elements.
+func splitFragments(html []byte, start, end int) [][2]int {
+	if start >= end {
+		return nil
+	}
+
+	boundaries := topLevelBoundaries(html[start:end])
+	var chunks [][2]int
+	chunkStart := 0
+	prev := 0
+	for _, b := range boundaries {
+		if b-chunkStart > MaxFragmentSize && prev > chunkStart {
+			chunks = append(chunks, [2]int{start + chunkStart, start + prev})
+			chunkStart = prev
+		}
+		prev = b
+	}
+	if len(html[start:end])-chunkStart > MaxFragmentSize && prev > chunkStart {
+		chunks = append(chunks, [2]int{start + chunkStart, start + prev})
+		chunkStart = prev
+	}
+	chunks = append(chunks, [2]int{start + chunkStart, end})
+	return chunks
+}
+
+// topLevelBoundaries returns the offsets in content at which a top-level
+// element starts, i.e. where the content can be cut without splitting a tag.
+func topLevelBoundaries(content []byte) []int {
+	var boundaries []int
+	depth := 0
+	i := 0
+	for i < len(content) {
+		if content[i] != '<' {
+			i++
+			continue
+		}
+		switch {
+		case bytes.HasPrefix(content[i:], []byte("<!--")):
+			if depth == 0 && i > 0 {
+				boundaries = append(boundaries, i)
+			}
+			end := bytes.Index(content[i+4:], []byte("-->"))
+			if end < 0 {
+				return boundaries
+			}
+			i += 4 + end + 3
+		case bytes.HasPrefix(content[i:], []byte("</")):
+			depth--
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return boundaries
+			}
+			i += end + 1
+		case i+1 < len(content) && (content[i+1] == '!' || content[i+1] == '?'):
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return boundaries
+			}
+			i += end + 1
+		default:
+			if depth == 0 && i > 0 {
+				boundaries = append(boundaries, i)
+			}
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return boundaries
+			}
+			tag := content[i : i+end+1]
+			name := strings.ToLower(tagName(tag))
+			i += end + 1
+			if voidElements[name] || bytes.HasSuffix(tag, []byte("/>")) {
+				continue
+			}
+			if rawTextElements[name] {
+				closeIdx := bytes.Index(bytes.ToLower(content[i:]), []byte("</"+name))
+				if closeIdx < 0 {
+					return boundaries
+				}
+				i += closeIdx
+				depth++
+				continue
+			}
+			depth++
+		}
+	}
+	return boundaries
+}
+
+// tagName extracts the element name from an opening tag such as <div id="x">.
+func tagName(tag []byte) string {
+	name := tag[1:]
+	for i, c := range name {
+		if c == ' ' || c == '>' || c == '/' || c == '\t' || c == '\n' || c == '\r' {
+			return string(name[:i])
+		}
+	}
+	return string(name)
+}
+
+// indexTagStart finds the opening tag prefix (e.g. `<div id="ch01"`) at or after from,
+// requiring that the prefix is followed by whitespace, '/' or '>'.
+func indexTagStart(html []byte, prefix string, from int) int {
+	p := []byte(prefix)
+	for from < len(html) {
+		idx := bytes.Index(html[from:], p)
+		if idx < 0 {
+			return -1
+		}
+		pos := from + idx
+		next := pos + len(p)
+		if next < len(html) {
+			switch html[next] {
+			case ' ', '\t', '\n', '\r', '/', '>':
+				return pos
+			}
+		}
+		from = pos + 1
+	}
+	return -1
+}
+
+// injectAID adds an aid attribute to an opening tag.
+func injectAID(tag []byte, aid string) []byte {
+	end := len(tag) - 1
+	if end > 0 && tag[end-1] == '/' {
+		end--
+	}
+	out := make([]byte, 0, len(tag)+len(aid)+8)
+	out = append(out, tag[:end]...)
+	out = append(out, ` aid="`+aid+`"`...)
+	return append(out, tag[end:]...)
+}
+
+// toBase32 formats v in base 32 using at least minDigits digits.
+func toBase32(v uint32, minDigits int) string {
+	var digits []byte
+	for v > 0 {
+		digits = append(digits, base32Digits[v%32])
+		v /= 32
+	}
+	for len(digits) < minDigits {
+		digits = append(digits, '0')
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits)
+}
+
+// skeletonIndexDefinition is the TAGX layout of the SKEL index.
+var skeletonIndexDefinition = IndexDefinition{
+	Tags: []IndexTag{
+		{Number: 1, ValuesPerEntry: 1, Mask: 0x03}, // fragment count
+		{Number: 6, ValuesPerEntry: 2, Mask: 0x0C}, // geometry (start, length)
+		indexEndTag,
+	},
+	ControlByteCount: 1,
+}
+
+// fragmentIndexDefinition is the TAGX layout of the FRAG index.
+var fragmentIndexDefinition = IndexDefinition{
+	Tags: []IndexTag{
+		{Number: 2, ValuesPerEntry: 1, Mask: 0x01}, // selector (CNCX offset)
+		{Number: 3, ValuesPerEntry: 1, Mask: 0x02}, // file number
+		{Number: 4, ValuesPerEntry: 1, Mask: 0x04}, // sequence number
+		{Number: 6, ValuesPerEntry: 2, Mask: 0x08}, // geometry (start, length)
+		indexEndTag,
+	},
+	ControlByteCount: 1,
+}
+
+// SkeletonIndexRecords builds the SKEL INDX records for the layout.
+func (l *KF8Layout) SkeletonIndexRecords() ([][]byte, error) {
+	entries := make([]IndexEntry, len(l.Skeletons))
+	for i, s := range l.Skeletons {
+		count := uint32(s.FragmentCount)
+		entries[i] = IndexEntry{
+			Label: fmt.Sprintf("SKEL%010d", s.FileNumber),
+			Values: map[uint8][]uint32{
+				// KindleGen repeats both values twice.
+				1: {count, count},
+				6: {s.StartPos, s.Length, s.StartPos, s.Length},
+			},
+		}
+	}
+	return BuildIndexRecords(skeletonIndexDefinition, entries, 0)
+}
+
+// FragmentIndexRecords builds the FRAG INDX records followed by their CNCX records.
+func (l *KF8Layout) FragmentIndexRecords() ([][]byte, error) {
+	cncx := NewCNCXBuilder()
+	entries := make([]IndexEntry, len(l.Fragments))
+	for i, f := range l.Fragments {
+		entries[i] = IndexEntry{
+			Label: fmt.Sprintf("%010d", f.InsertPos),
+			Values: map[uint8][]uint32{
+				2: {cncx.Add(f.Selector)},
+				3: {uint32(f.FileNumber)},
+				4: {uint32(f.SequenceNumber)},
+				6: {f.StartPos, f.Length},
+			},
+		}
+	}
+	cncxRecords := cncx.Records()
+	records, err := BuildIndexRecords(fragmentIndexDefinition, entries, len(cncxRecords))
+	if err != nil {
+		return nil, err
+	}
+	return append(records, cncxRecords...), nil
+}
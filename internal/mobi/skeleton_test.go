@@ -0,0 +1,260 @@
+package mobi
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// reconstructFiles rebuilds each skeleton file by inserting its fragments,
+// the same way a KF8 reader does.
+func reconstructFiles(l *KF8Layout) []string {
+	files := make([]string, 0, len(l.Skeletons))
+	for _, s := range l.Skeletons {
+		file := string(l.Text[s.StartPos : s.StartPos+s.Length])
+		for _, f := range l.Fragments[s.FirstFragment : s.FirstFragment+s.FragmentCount] {
+			pos := int(f.InsertPos - s.StartPos)
+			frag := string(l.Text[f.RawStart : f.RawStart+f.Length])
+			file = file[:pos] + frag + file[pos:]
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+func TestBuildKF8Layout_Chapters(t *testing.T) {
+	html := []byte(`<html><head><title>T</title></head><body class="b">` +
+		`<div id="toc"><p>Contents</p></div>` +
+		`<div id="ch01"><h1>One</h1><p>First</p></div>` +
+		`<div id="ch02"><h1>Two</h1><p>Second</p></div>` +
+		`</body></html>`)
+
+	l, err := BuildKF8Layout(html, []string{"ch01", "ch02"})
+	if err != nil {
+		t.Fatalf("BuildKF8Layout() error = %v", err)
+	}
+
+	if len(l.Skeletons) != 3 {
+		t.Fatalf("skeleton count = %d, want 3", len(l.Skeletons))
+	}
+
+	want := []string{
+		`<html><head><title>T</title></head><body class="b" aid="0"><div id="toc"><p>Contents</p></div></body></html>`,
+		`<html><head><title>T</title></head><body class="b"><div id="ch01" aid="1"><h1>One</h1><p>First</p></div></body></html>`,
+		`<html><head><title>T</title></head><body class="b"><div id="ch02" aid="2"><h1>Two</h1><p>Second</p></div></body></html>`,
+	}
+	got := reconstructFiles(l)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("file %d =\n%s\nwant\n%s", i, got[i], want[i])
+		}
+	}
+
+	for i, s := range l.Skeletons {
+		if s.FileNumber != i {
+			t.Errorf("skeleton %d file number = %d", i, s.FileNumber)
+		}
+		if s.FragmentCount != 1 {
+			t.Errorf("skeleton %d fragment count = %d, want 1", i, s.FragmentCount)
+		}
+	}
+	if sel := l.Fragments[1].Selector; sel != "P-//*[@aid='1']" {
+		t.Errorf("fragment selector = %q", sel)
+	}
+}
+
+func TestBuildKF8LayoutWithHeads(t *testing.T) {
+	html := []byte(`<html><head><title>T</title></head><body>` +
+		`<div id="ch01"><p>First</p></div>` +
+		`<div id="ch02"><p>Second</p></div>` +
+		`</body></html>`)
+	heads := map[string][]byte{"ch02": []byte(`<meta name="viewport" content="width=800, height=1200"/>`)}
+
+	l, err := BuildKF8LayoutWithHeads(html, []string{"ch01", "ch02"}, heads)
+	if err != nil {
+		t.Fatalf("BuildKF8LayoutWithHeads() error = %v", err)
+	}
+	want := []string{
+		`<html><head><title>T</title></head><body><div id="ch01" aid="0"><p>First</p></div></body></html>`,
+		`<html><head><title>T</title><meta name="viewport" content="width=800, height=1200"/></head><body><div id="ch02" aid="1"><p>Second</p></div></body></html>`,
+	}
+	got := reconstructFiles(l)
+	if len(got) != len(want) {
+		t.Fatalf("file count = %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("file %d =\n%s\nwant\n%s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestBuildKF8Layout_TextContainsAllContent(t *testing.T) {
+	html := []byte(`<html><head></head><body>` +
+		`<div id="ch01"><p>Alpha</p></div>` +
+		`<div id="ch02"><p>Beta</p></div>` +
+		`</body></html>`)
+
+	l, err := BuildKF8Layout(html, []string{"ch01", "ch02"})
+	if err != nil {
+		t.Fatalf("BuildKF8Layout() error = %v", err)
+	}
+
+	var total uint32
+	for _, s := range l.Skeletons {
+		total += s.Length
+	}
+	for _, f := range l.Fragments {
+		total += f.Length
+	}
+	if int(total) != len(l.Text) {
+		t.Errorf("skeletons + fragments = %d bytes, text = %d bytes", total, len(l.Text))
+	}
+	for _, s := range []string{"Alpha", "Beta"} {
+		if !bytes.Contains(l.Text, []byte(s)) {
+			t.Errorf("text does not contain %q", s)
+		}
+	}
+}
+
+func TestBuildKF8Layout_NoChapters(t *testing.T) {
+	html := []byte(`<html><head></head><body><p>Only</p></body></html>`)
+
+	l, err := BuildKF8Layout(html, nil)
+	if err != nil {
+		t.Fatalf("BuildKF8Layout() error = %v", err)
+	}
+	if len(l.Skeletons) != 1 {
+		t.Fatalf("skeleton count = %d, want 1", len(l.Skeletons))
+	}
+	got := reconstructFiles(l)[0]
+	want := `<html><head></head><body aid="0"><p>Only</p></body></html>`
+	if got != want {
+		t.Errorf("file = %s, want %s", got, want)
+	}
+}
+
+func TestBuildKF8Layout_MissingBody(t *testing.T) {
+	if _, err := BuildKF8Layout([]byte(`<html></html>`), nil); err == nil {
+		t.Error("BuildKF8Layout should fail without a body element")
+	}
+}
+
+func TestBuildKF8Layout_InternalLinks(t *testing.T) {
+	html := []byte(`<html><head></head><body>` +
+		`<div id="ch01"><a href="#sec">jump</a><a href="#missing">x</a></div>` +
+		`<div id="ch02"><p>intro</p><h2 id="sec">Section</h2></div>` +
+		`</body></html>`)
+
+	l, err := BuildKF8Layout(html, []string{"ch01", "ch02"})
+	if err != nil {
+		t.Fatalf("BuildKF8Layout() error = %v", err)
+	}
+
+	if bytes.Contains(l.Text, []byte(kindlePosPlaceholder)) {
+		t.Error("unresolved kindle:pos placeholder remains in text")
+	}
+	if !bytes.Contains(l.Text, []byte(`href="#missing"`)) {
+		t.Error("link without target should be left unchanged")
+	}
+
+	m := regexp.MustCompile(`kindle:pos:fid:([0-9A-V]{4}):off:([0-9A-V]{10})`).FindSubmatch(l.Text)
+	if m == nil {
+		t.Fatalf("kindle:pos link not found in %s", l.Text)
+	}
+	if string(m[1]) != "0001" {
+		t.Errorf("fid = %s, want 0001", m[1])
+	}
+
+	frag := l.Fragments[1]
+	off := strings.Index(string(l.Text[frag.RawStart:frag.RawStart+frag.Length]), `<h2 id="sec">`)
+	if got := string(m[2]); got != toBase32(uint32(off), 10) {
+		t.Errorf("off = %s, want %s", got, toBase32(uint32(off), 10))
+	}
+}
+
+func TestBuildKF8Layout_SplitsLargeChapters(t *testing.T) {
+	para := "<p>" + strings.Repeat("x", 1000) + "</p>"
+	html := []byte(`<html><head></head><body><div id="ch01">` +
+		strings.Repeat(para, 20) + `</div></body></html>`)
+
+	l, err := BuildKF8Layout(html, []string{"ch01"})
+	if err != nil {
+		t.Fatalf("BuildKF8Layout() error = %v", err)
+	}
+
+	if l.Skeletons[0].FragmentCount < 3 {
+		t.Errorf("fragment count = %d, want at least 3", l.Skeletons[0].FragmentCount)
+	}
+	for i, f := range l.Fragments {
+		if f.Length > MaxFragmentSize {
+			t.Errorf("fragment %d length = %d, exceeds %d", i, f.Length, MaxFragmentSize)
+		}
+		frag := string(l.Text[f.RawStart : f.RawStart+f.Length])
+		if !strings.HasPrefix(frag, "<p>") || !strings.HasSuffix(frag, "</p>") {
+			t.Errorf("fragment %d is not cut at element boundaries", i)
+		}
+		if f.SequenceNumber != i {
+			t.Errorf("fragment %d sequence number = %d", i, f.SequenceNumber)
+		}
+	}
+
+	want := `<html><head></head><body><div id="ch01" aid="0">` + strings.Repeat(para, 20) + `</div></body></html>`
+	if got := reconstructFiles(l)[0]; got != want {
+		t.Error("reconstructed file does not match the original chapter")
+	}
+}
+
+func TestKF8Layout_IndexRecords(t *testing.T) {
+	html := []byte(`<html><head></head><body><div id="ch01"><p>One</p></div></body></html>`)
+	l, err := BuildKF8Layout(html, []string{"ch01"})
+	if err != nil {
+		t.Fatalf("BuildKF8Layout() error = %v", err)
+	}
+
+	skel, err := l.SkeletonIndexRecords()
+	if err != nil {
+		t.Fatalf("SkeletonIndexRecords() error = %v", err)
+	}
+	if len(skel) != 2 {
+		t.Fatalf("SKEL record count = %d, want 2", len(skel))
+	}
+	if !bytes.Contains(skel[1], []byte("SKEL0000000000")) {
+		t.Error("SKEL entry label not found")
+	}
+
+	frag, err := l.FragmentIndexRecords()
+	if err != nil {
+		t.Fatalf("FragmentIndexRecords() error = %v", err)
+	}
+	// header + entry record + CNCX
+	if len(frag) != 3 {
+		t.Fatalf("FRAG record count = %d, want 3", len(frag))
+	}
+	if got := readUint32BE(frag[0], 52); got != 1 {
+		t.Errorf("FRAG CNCX count = %d, want 1", got)
+	}
+	if !bytes.Contains(frag[2], []byte("P-//*[@aid='0']")) {
+		t.Error("selector not found in CNCX record")
+	}
+}
+
+func TestToBase32(t *testing.T) {
+	tests := []struct {
+		v    uint32
+		min  int
+		want string
+	}{
+		{0, 1, "0"},
+		{0, 4, "0000"},
+		{31, 1, "V"},
+		{32, 4, "0010"},
+		{1234, 10, "000000016I"},
+	}
+	for _, tt := range tests {
+		if got := toBase32(tt.v, tt.min); got != tt.want {
+			t.Errorf("toBase32(%d, %d) = %q, want %q", tt.v, tt.min, got, tt.want)
+		}
+	}
+}
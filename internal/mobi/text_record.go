@@ -1,8 +1,17 @@
 package mobi
 
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
 // RecordSize is the maximum size in bytes of a single text record.
 const RecordSize = 4096
 
+// ExtraDataMultibyte is the ExtraRecordDataFlags bit indicating that every text
+// record ends with a multibyte trailing entry.
+const ExtraDataMultibyte uint32 = 0x1
+
 // Compressor defines the interface for text record compression.
 type Compressor interface {
 	Compress(data []byte) ([]byte, error)
@@ -52,6 +61,103 @@ func SplitTextRecords(html []byte, compressor Compressor) ([][]byte, error) {
 	return records, nil
 }
 
+// SplitTextRecordsMultibyte splits the HTML like SplitTextRecords and appends a
+// multibyte trailing entry to every record: the bytes of the next record that
+// complete a UTF-8 character cut at the record boundary, followed by one byte
+// holding their count. Records written this way require ExtraDataMultibyte.
+func SplitTextRecordsMultibyte(html []byte, compressor Compressor) ([][]byte, error) {
+	records, err := SplitTextRecords(html, compressor)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range records {
+		end := min((i+1)*RecordSize, len(html))
+		overlap := multibyteOverlap(html, end)
+		record := make([]byte, 0, len(records[i])+len(overlap)+1)
+		record = append(record, records[i]...)
+		record = append(record, overlap...)
+		records[i] = append(record, byte(len(overlap)))
+	}
+	return records, nil
+}
+
+// multibyteOverlap returns the bytes at and after end that complete a UTF-8
+// character starting before end. It returns nil when end is a character boundary.
+func multibyteOverlap(text []byte, end int) []byte {
+	start := end - 1
+	for start >= 0 && end-start < utf8.UTFMax && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	if start < 0 || !utf8.RuneStart(text[start]) {
+		return nil
+	}
+
+	var size int
+	switch lead := text[start]; {
+	case lead&0xE0 == 0xC0:
+		size = 2
+	case lead&0xF0 == 0xE0:
+		size = 3
+	case lead&0xF8 == 0xF0:
+		size = 4
+	default:
+		return nil
+	}
+
+	need := start + size - end
+	if need <= 0 {
+		return nil
+	}
+	return text[end:min(end+need, len(text))]
+}
+
+// StripTrailingEntries removes the trailing entries described by flags
+// (ExtraRecordDataFlags) from a text record, returning the compressed text data.
+func StripTrailingEntries(record []byte, flags uint32) ([]byte, error) {
+	// Entries for bits 1-15 come last and each ends with its own backward size.
+	for bit := 15; bit > 0; bit-- {
+		if flags&(1<<bit) == 0 {
+			continue
+		}
+		size, err := backwardVarint(record)
+		if err != nil {
+			return nil, err
+		}
+		if size > len(record) {
+			return nil, fmt.Errorf("trailing entry size %d exceeds record length %d", size, len(record))
+		}
+		record = record[:len(record)-size]
+	}
+
+	if flags&ExtraDataMultibyte != 0 {
+		if len(record) == 0 {
+			return nil, fmt.Errorf("missing multibyte trailing entry")
+		}
+		size := int(record[len(record)-1]&0x3) + 1
+		if size > len(record) {
+			return nil, fmt.Errorf("multibyte trailing entry size %d exceeds record length %d", size, len(record))
+		}
+		record = record[:len(record)-size]
+	}
+	return record, nil
+}
+
+// backwardVarint decodes the size of a trailing entry stored as a variable-width
+// integer at the end of data: 7 bits per byte, the first byte has its high bit set.
+func backwardVarint(data []byte) (int, error) {
+	var v, shift int
+	for i := len(data) - 1; i >= 0 && len(data)-i <= 4; i-- {
+		b := data[i]
+		v |= int(b&0x7F) << shift
+		shift += 7
+		if b&0x80 != 0 {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid trailing entry size")
+}
+
 // TextLength returns the total byte length of the HTML content as uint32.
 func TextLength(html []byte) uint32 {
 	return uint32(len(html))
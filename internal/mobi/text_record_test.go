@@ -2,7 +2,9 @@ package mobi
 
 import (
 	"bytes"
+	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestNoCompression(t *testing.T) {
@@ -204,3 +206,144 @@ func TestTextRecordCount(t *testing.T) {
 		})
 	}
 }
+
+func TestMultibyteOverlap(t *testing.T) {
+	text := []byte("ab日本") // 日 = E6 97 A5, 本 = E6 9C AC
+	tests := []struct {
+		end  int
+		want []byte
+	}{
+		{2, nil},                // boundary before 日
+		{3, []byte{0x97, 0xA5}}, // after lead byte of 日
+		{4, []byte{0xA5}},       // inside 日
+		{5, nil},                // boundary before 本
+		{7, []byte{0xAC}},       // inside 本
+		{8, nil},                // end of text
+		{1, nil},                // ASCII
+	}
+	for _, tt := range tests {
+		got := multibyteOverlap(text, tt.end)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("multibyteOverlap(end=%d) = %X, want %X", tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestMultibyteOverlap_TruncatedText(t *testing.T) {
+	text := []byte{'a', 0xE6, 0x97}
+	if got := multibyteOverlap(text, 2); !bytes.Equal(got, []byte{0x97}) {
+		t.Errorf("multibyteOverlap() = %X, want 97", got)
+	}
+}
+
+func TestSplitTextRecordsMultibyte_TrailingEntry(t *testing.T) {
+	// 4095 ASCII bytes followed by a 3-byte character: the record boundary
+	// falls after its first byte.
+	html := append(bytes.Repeat([]byte("a"), RecordSize-1), "日本"...)
+
+	records, err := SplitTextRecordsMultibyte(html, nil)
+	if err != nil {
+		t.Fatalf("SplitTextRecordsMultibyte() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("record count = %d, want 2", len(records))
+	}
+
+	first := records[0]
+	if len(first) != RecordSize+3 {
+		t.Fatalf("first record length = %d, want %d", len(first), RecordSize+3)
+	}
+	if got := first[RecordSize:]; !bytes.Equal(got, []byte{0x97, 0xA5, 0x02}) {
+		t.Errorf("first trailing entry = %X, want 97A502", got)
+	}
+	if tail := first[len(first)-4 : len(first)-1]; !utf8.Valid(tail) {
+		t.Errorf("record end plus overlap %X is not valid UTF-8", tail)
+	}
+
+	last := records[1]
+	if last[len(last)-1] != 0x00 {
+		t.Errorf("last trailing entry size = %d, want 0", last[len(last)-1])
+	}
+}
+
+func TestSplitTextRecordsMultibyte_CJKRoundTrip(t *testing.T) {
+	compressors := map[string]Compressor{
+		"none":    &NoCompression{},
+		"palmdoc": &PalmDocCompressor{},
+	}
+	texts := map[string]string{
+		"japanese": strings.Repeat("吾輩は猫である。名前はまだ無い。", 700),
+		"chinese":  strings.Repeat("天地玄黄，宇宙洪荒。日月盈昃，辰宿列张。", 500),
+		"mixed":    strings.Repeat("abc漢字😀かな", 900),
+	}
+
+	for cname, c := range compressors {
+		for tname, text := range texts {
+			t.Run(cname+"/"+tname, func(t *testing.T) {
+				html := []byte("<html><body><p>" + text + "</p></body></html>")
+				records, err := SplitTextRecordsMultibyte(html, c)
+				if err != nil {
+					t.Fatalf("SplitTextRecordsMultibyte() error = %v", err)
+				}
+				if len(records) < 3 {
+					t.Fatalf("record count = %d, want at least 3", len(records))
+				}
+
+				var reassembled []byte
+				for i, rec := range records {
+					stripped, err := StripTrailingEntries(rec, ExtraDataMultibyte)
+					if err != nil {
+						t.Fatalf("record %d: StripTrailingEntries() error = %v", i, err)
+					}
+					chunk := stripped
+					if c.Type() == CompressionPalmDoc {
+						chunk, err = PalmDocDecompress(stripped)
+						if err != nil {
+							t.Fatalf("record %d: PalmDocDecompress() error = %v", i, err)
+						}
+					}
+
+					// The chunk plus its overlap must end on a character boundary.
+					n := int(rec[len(rec)-1] & 0x3)
+					overlap := rec[len(rec)-1-n : len(rec)-1]
+					withOverlap := append(append([]byte{}, chunk...), overlap...)
+					if r, _ := utf8.DecodeLastRune(withOverlap); r == utf8.RuneError {
+						t.Errorf("record %d does not end on a character boundary with its overlap", i)
+					}
+					reassembled = append(reassembled, chunk...)
+				}
+
+				if !bytes.Equal(reassembled, html) {
+					t.Fatal("reassembled text does not match the original")
+				}
+				if !utf8.Valid(reassembled) {
+					t.Fatal("reassembled text is not valid UTF-8")
+				}
+			})
+		}
+	}
+}
+
+func TestStripTrailingEntries_ExtraFlags(t *testing.T) {
+	// text + multibyte entry (1 byte overlap) + a 3-byte entry for bit 1
+	record := []byte{'t', 'e', 'x', 0xA5, 0x01, 0xAA, 0xBB, 0x83}
+
+	got, err := StripTrailingEntries(record, 0x3)
+	if err != nil {
+		t.Fatalf("StripTrailingEntries() error = %v", err)
+	}
+	if string(got) != "tex" {
+		t.Errorf("StripTrailingEntries() = %q, want %q", got, "tex")
+	}
+}
+
+func TestStripTrailingEntries_NoFlags(t *testing.T) {
+	record := []byte("plain")
+	got, err := StripTrailingEntries(record, 0)
+	if err != nil {
+		t.Fatalf("StripTrailingEntries() error = %v", err)
+	}
+	if !bytes.Equal(got, record) {
+		t.Errorf("StripTrailingEntries() = %q, want %q", got, record)
+	}
+}
@@ -0,0 +1,261 @@
+package mobi
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// chapterDivRe matches the opening tag of a chapter div (<div id="ch01">, ...).
+var chapterDivRe = regexp.MustCompile(`<div id="(ch\d+)"[\s/>]`)
+
+// kindlePosRe matches a kindle:pos fragment reference.
+var kindlePosRe = regexp.MustCompile(`^kindle:pos:fid:([0-9A-V]{4}):off:([0-9A-V]{10})$`)
+
+// kindleFlowRe matches a kindle:flow reference.
+var kindleFlowRe = regexp.MustCompile(`^kindle:flow:([0-9A-V]{4})(?:\?mime=(.+))?$`)
+
+// kindleEmbedRe matches a kindle:embed reference.
+var kindleEmbedRe = regexp.MustCompile(`^kindle:embed:([0-9A-Fa-f]{4})(?:\?mime=.+)?$`)
+
+// HTMLFile is one HTML file reconstructed from a text flow, either from a KF8
+// skeleton and its fragments or from a chapter of a single HTML document.
+type HTMLFile struct {
+	HTML []byte
+	// ChapterID is the id of the chapter div wrapping the file content, if any.
+	ChapterID string
+	pieces    []layoutPiece // text flow ranges and their offsets in HTML
+}
+
+// Offset maps a position in the text flow to an offset in HTML.
+func (f *HTMLFile) Offset(pos uint32) (int, bool) {
+	return mapLayoutOffset(f.pieces, int(pos))
+}
+
+// IDAt returns the id of the element whose tag starts at offset, or the id of
+// the next tag when offset is not at a tag start. It returns "" when that tag
+// has no id.
+func (f *HTMLFile) IDAt(offset int) string {
+	if offset < 0 || offset >= len(f.HTML) {
+		return ""
+	}
+	start := bytes.IndexByte(f.HTML[offset:], '<')
+	if start < 0 {
+		return ""
+	}
+	start += offset
+	end := bytes.IndexByte(f.HTML[start:], '>')
+	if end < 0 {
+		return ""
+	}
+	if m := elementIDRe.FindSubmatch(f.HTML[start : start+end]); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// Files reassembles the HTML files of the layout by inserting the fragments
+// of each skeleton at their insert positions.
+func (l *KF8Layout) Files() ([]*HTMLFile, error) {
+	files := make([]*HTMLFile, 0, len(l.Skeletons))
+	for _, s := range l.Skeletons {
+		end := uint64(s.StartPos) + uint64(s.Length)
+		if end > uint64(len(l.Text)) {
+			return nil, fmt.Errorf("skeleton %d [%d, %d) is beyond the text flow (%d bytes)", s.FileNumber, s.StartPos, end, len(l.Text))
+		}
+		html := bytes.Clone(l.Text[s.StartPos:end])
+		pieces := []layoutPiece{{srcStart: int(s.StartPos), srcEnd: int(end), dstStart: 0}}
+
+		for i := s.FirstFragment; i < s.FirstFragment+s.FragmentCount && i < len(l.Fragments); i++ {
+			f := l.Fragments[i]
+			fragEnd := uint64(f.RawStart) + uint64(f.Length)
+			if fragEnd > uint64(len(l.Text)) {
+				return nil, fmt.Errorf("fragment %d [%d, %d) is beyond the text flow (%d bytes)", i, f.RawStart, fragEnd, len(l.Text))
+			}
+			if f.InsertPos < s.StartPos || int(f.InsertPos-s.StartPos) > len(html) {
+				return nil, fmt.Errorf("fragment %d insert position %d is outside skeleton %d", i, f.InsertPos, s.FileNumber)
+			}
+			at := int(f.InsertPos - s.StartPos)
+			pieces = insertPiece(pieces, at, layoutPiece{srcStart: int(f.RawStart), srcEnd: int(fragEnd), dstStart: at})
+
+			grown := make([]byte, 0, len(html)+int(f.Length))
+			grown = append(grown, html[:at]...)
+			grown = append(grown, l.Text[f.RawStart:fragEnd]...)
+			html = append(grown, html[at:]...)
+		}
+
+		file := &HTMLFile{HTML: html, pieces: pieces}
+		if m := chapterDivRe.FindSubmatch(html); m != nil {
+			file.ChapterID = string(m[1])
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// insertPiece records that the bytes of p are inserted at offset at of the
+// file: the piece containing at is split and every following piece moves.
+func insertPiece(pieces []layoutPiece, at int, p layoutPiece) []layoutPiece {
+	length := p.srcEnd - p.srcStart
+	out := make([]layoutPiece, 0, len(pieces)+2)
+	for _, q := range pieces {
+		qLen := q.srcEnd - q.srcStart
+		switch {
+		case q.dstStart >= at:
+			q.dstStart += length
+			out = append(out, q)
+		case q.dstStart+qLen > at:
+			split := at - q.dstStart
+			out = append(out,
+				layoutPiece{srcStart: q.srcStart, srcEnd: q.srcStart + split, dstStart: q.dstStart},
+				layoutPiece{srcStart: q.srcStart + split, srcEnd: q.srcEnd, dstStart: at + length},
+			)
+		default:
+			out = append(out, q)
+		}
+	}
+	return append(out, p)
+}
+
+// Position returns the text flow position of a kindle:pos:fid reference.
+func (l *KF8Layout) Position(fid int, off uint32) (uint32, bool) {
+	if fid < 0 || fid >= len(l.Fragments) {
+		return 0, false
+	}
+	f := l.Fragments[fid]
+	if off > f.Length {
+		return 0, false
+	}
+	return f.RawStart + off, true
+}
+
+// ParseKindlePos parses a "kindle:pos:fid:XXXX:off:YYYYYYYYYY" reference into
+// its fragment sequence number and offset.
+func ParseKindlePos(ref string) (fid int, off uint32, ok bool) {
+	m := kindlePosRe.FindStringSubmatch(ref)
+	if m == nil {
+		return 0, 0, false
+	}
+	f, ok1 := fromBase32(m[1])
+	o, ok2 := fromBase32(m[2])
+	if !ok1 || !ok2 {
+		return 0, 0, false
+	}
+	return int(f), o, true
+}
+
+// ParseKindleFlow parses a "kindle:flow:XXXX?mime=type" reference into its
+// flow index and MIME type.
+func ParseKindleFlow(ref string) (flowIndex int, mimeType string, ok bool) {
+	m := kindleFlowRe.FindStringSubmatch(ref)
+	if m == nil {
+		return 0, "", false
+	}
+	v, ok := fromBase32(m[1])
+	if !ok {
+		return 0, "", false
+	}
+	return int(v), m[2], true
+}
+
+// ParseKindleEmbed parses a "kindle:embed:XXXX" reference into its 1-based
+// resource number.
+func ParseKindleEmbed(ref string) (int, bool) {
+	m := kindleEmbedRe.FindStringSubmatch(ref)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(m[1], 16, 16)
+	if err != nil || v == 0 {
+		return 0, false
+	}
+	return int(v), true
+}
+
+// fromBase32 parses a value written by toBase32.
+func fromBase32(s string) (uint32, bool) {
+	var v uint64
+	for _, c := range s {
+		d := strings.IndexRune(base32Digits, c)
+		if d < 0 {
+			return 0, false
+		}
+		v = v*32 + uint64(d)
+		if v > 0xFFFFFFFF {
+			return 0, false
+		}
+	}
+	return uint32(v), true
+}
+
+// SplitChapters splits a single HTML document into one file per chapter div
+// (<div id="ch01">, ...). Content in the body before the first chapter becomes
+// a separate file. Every file gets a copy of the document head and closing tags.
+// A document without a body or chapter divs is returned as a single file.
+func SplitChapters(html []byte) []*HTMLFile {
+	whole := []*HTMLFile{{HTML: bytes.Clone(html), pieces: []layoutPiece{{srcStart: 0, srcEnd: len(html), dstStart: 0}}}}
+
+	bodyOpenStart := indexTagStart(html, "<body", 0)
+	if bodyOpenStart < 0 {
+		return whole
+	}
+	bodyOpenEnd := bytes.IndexByte(html[bodyOpenStart:], '>')
+	if bodyOpenEnd < 0 {
+		return whole
+	}
+	bodyOpenEnd += bodyOpenStart + 1
+	bodyClose := bytes.LastIndex(html, []byte("</body>"))
+	if bodyClose < bodyOpenEnd {
+		return whole
+	}
+
+	var starts []int
+	var ids []string
+	for _, m := range chapterDivRe.FindAllSubmatchIndex(html[bodyOpenEnd:bodyClose], -1) {
+		starts = append(starts, bodyOpenEnd+m[0])
+		ids = append(ids, string(html[bodyOpenEnd+m[2]:bodyOpenEnd+m[3]]))
+	}
+	if len(starts) == 0 {
+		return whole
+	}
+	if len(bytes.TrimSpace(html[bodyOpenEnd:starts[0]])) > 0 {
+		starts = append([]int{bodyOpenEnd}, starts...)
+		ids = append([]string{""}, ids...)
+	}
+
+	head, tail := html[:bodyOpenEnd], html[bodyClose:]
+	files := make([]*HTMLFile, len(starts))
+	for i, start := range starts {
+		end := bodyClose
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		var buf bytes.Buffer
+		buf.Write(head)
+		buf.Write(html[start:end])
+		buf.Write(tail)
+		files[i] = &HTMLFile{
+			HTML:      buf.Bytes(),
+			ChapterID: ids[i],
+			pieces: []layoutPiece{
+				{srcStart: 0, srcEnd: len(head), dstStart: 0},
+				{srcStart: start, srcEnd: end, dstStart: len(head)},
+				{srcStart: bodyClose, srcEnd: len(html), dstStart: len(head) + end - start},
+			},
+		}
+	}
+	return files
+}
+
+// LocateFile returns the file containing the text flow position pos and the
+// corresponding offset in its HTML.
+func LocateFile(files []*HTMLFile, pos uint32) (int, int, bool) {
+	for i, f := range files {
+		if off, ok := f.Offset(pos); ok {
+			return i, off, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,161 @@
+package mobi
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func unpackTestHTML() []byte {
+	return []byte(`<html><head><title>T</title></head><body>` +
+		`<div id="toc"><a href="#ch02-s1">Section</a></div>` +
+		`<div id="ch01"><h1>One</h1><p>` + strings.Repeat("long text ", 2000) + `</p></div>` +
+		`<div id="ch02"><h1>Two</h1><p id="ch02-s1">target</p><a href="#ch01">back</a></div>` +
+		`</body></html>`)
+}
+
+func TestReader_LayoutRoundTrip(t *testing.T) {
+	html := unpackTestHTML()
+	chapterIDs := []string{"ch01", "ch02"}
+	want, err := BuildKF8Layout(html, chapterIDs)
+	if err != nil {
+		t.Fatalf("BuildKF8Layout() error = %v", err)
+	}
+
+	w, err := NewAZW3Writer(AZW3WriterConfig{Title: "Layout", HTML: html, ChapterIDs: chapterIDs, Compression: CompressionPalmDoc})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	r, err := NewReader(writeToBuffer(t, w))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	got, err := r.Layout(r.KF8())
+	if err != nil {
+		t.Fatalf("Layout() error = %v", err)
+	}
+	if !bytes.Equal(got.Text, want.Text) {
+		t.Error("layout text does not match")
+	}
+	if !reflect.DeepEqual(got.Skeletons, want.Skeletons) {
+		t.Errorf("Skeletons = %+v, want %+v", got.Skeletons, want.Skeletons)
+	}
+	if !reflect.DeepEqual(got.Fragments, want.Fragments) {
+		t.Errorf("Fragments = %+v, want %+v", got.Fragments, want.Fragments)
+	}
+}
+
+func TestReader_LayoutWithoutSkeletons(t *testing.T) {
+	w, err := NewAZW3Writer(AZW3WriterConfig{Title: "Plain", HTML: generateTestHTML(100)})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	r, err := NewReader(writeToBuffer(t, w))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if l, err := r.Layout(r.KF8()); err != nil || l != nil {
+		t.Errorf("Layout() = %v, %v; want nil", l, err)
+	}
+}
+
+func TestKF8Layout_Files(t *testing.T) {
+	html := unpackTestHTML()
+	l, err := BuildKF8Layout(html, []string{"ch01", "ch02"})
+	if err != nil {
+		t.Fatalf("BuildKF8Layout() error = %v", err)
+	}
+	files, err := l.Files()
+	if err != nil {
+		t.Fatalf("Files() error = %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("file count = %d, want 3", len(files))
+	}
+
+	wantIDs := []string{"", "ch01", "ch02"}
+	for i, f := range files {
+		if f.ChapterID != wantIDs[i] {
+			t.Errorf("file %d ChapterID = %q, want %q", i, f.ChapterID, wantIDs[i])
+		}
+		if !bytes.HasPrefix(f.HTML, []byte("<html><head><title>T</title></head><body")) || !bytes.HasSuffix(f.HTML, []byte("</body></html>")) {
+			t.Errorf("file %d is not a complete document: %.80q", i, f.HTML)
+		}
+	}
+	// The first chapter is split into several fragments; all of them must be reassembled.
+	if !bytes.Contains(files[1].HTML, []byte(`<h1>One</h1><p>`+strings.Repeat("long text ", 2000)+`</p></div></body>`)) {
+		t.Error("chapter 1 content was not reassembled")
+	}
+	if !bytes.Contains(files[2].HTML, []byte(`<p id="ch02-s1">target</p>`)) {
+		t.Error("chapter 2 content was not reassembled")
+	}
+
+	// The link in the TOC resolves to its target element.
+	ref := l.Text[bytes.Index(l.Text, []byte("kindle:pos:")):]
+	ref = ref[:bytes.IndexByte(ref, '"')]
+	fid, off, ok := ParseKindlePos(string(ref))
+	if !ok {
+		t.Fatalf("ParseKindlePos(%q) failed", ref)
+	}
+	pos, ok := l.Position(fid, off)
+	if !ok {
+		t.Fatalf("Position(%d, %d) failed", fid, off)
+	}
+	file, offset, ok := LocateFile(files, pos)
+	if !ok || file != 2 {
+		t.Fatalf("LocateFile(%d) = %d, %v; want file 2", pos, file, ok)
+	}
+	if id := files[file].IDAt(offset); id != "ch02-s1" {
+		t.Errorf("IDAt(%d) = %q, want %q", offset, id, "ch02-s1")
+	}
+}
+
+func TestSplitChapters(t *testing.T) {
+	html := []byte(`<html><head></head><body><p>front</p><div id="ch01"><p>one</p></div><div id="ch02"><p id="x">two</p></div></body></html>`)
+	files := SplitChapters(html)
+	want := []string{
+		`<html><head></head><body><p>front</p></body></html>`,
+		`<html><head></head><body><div id="ch01"><p>one</p></div></body></html>`,
+		`<html><head></head><body><div id="ch02"><p id="x">two</p></div></body></html>`,
+	}
+	if len(files) != len(want) {
+		t.Fatalf("file count = %d, want %d", len(files), len(want))
+	}
+	for i, f := range files {
+		if string(f.HTML) != want[i] {
+			t.Errorf("file %d = %q, want %q", i, f.HTML, want[i])
+		}
+	}
+	if files[2].ChapterID != "ch02" {
+		t.Errorf("ChapterID = %q, want %q", files[2].ChapterID, "ch02")
+	}
+
+	pos := uint32(bytes.Index(html, []byte(`<p id="x">`)))
+	file, offset, ok := LocateFile(files, pos)
+	if !ok || file != 2 || files[2].IDAt(offset) != "x" {
+		t.Errorf("LocateFile(%d) = %d, %d, %v", pos, file, offset, ok)
+	}
+
+	if got := SplitChapters([]byte("<p>no body</p>")); len(got) != 1 || string(got[0].HTML) != "<p>no body</p>" {
+		t.Errorf("SplitChapters(no body) = %+v", got)
+	}
+}
+
+func TestParseKindleReferences(t *testing.T) {
+	if fid, off, ok := ParseKindlePos("kindle:pos:fid:000A:off:0000000011"); !ok || fid != 10 || off != 33 {
+		t.Errorf("ParseKindlePos() = %d, %d, %v", fid, off, ok)
+	}
+	if _, _, ok := ParseKindlePos("kindle:pos:fid:000A"); ok {
+		t.Error("ParseKindlePos() accepted a truncated reference")
+	}
+	if flow, mime, ok := ParseKindleFlow(KindleFlowRef(1, "text/css")); !ok || flow != 1 || mime != "text/css" {
+		t.Errorf("ParseKindleFlow() = %d, %q, %v", flow, mime, ok)
+	}
+	if n, ok := ParseKindleEmbed("kindle:embed:001A?mime=image/jpeg"); !ok || n != 26 {
+		t.Errorf("ParseKindleEmbed() = %d, %v", n, ok)
+	}
+	if _, ok := ParseKindleEmbed("kindle:embed:0000"); ok {
+		t.Error("ParseKindleEmbed() accepted resource number 0")
+	}
+}
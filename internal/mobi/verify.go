@@ -0,0 +1,244 @@
+package mobi
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Verification checks performed by Verify.
+const (
+	CheckParse        = "parse"
+	CheckRecordOffset = "record-offsets"
+	CheckTextRecords  = "text-records"
+	CheckFirstImage   = "first-image"
+	CheckFDST         = "fdst"
+	CheckEXTHCount    = "exth-record-count"
+	CheckEmbedRefs    = "embed-references"
+	CheckNCX          = "ncx-offsets"
+	CheckLayout       = "skeleton-offsets"
+	CheckRESC         = "resc"
+)
+
+// VerifyIssue describes a structural invariant that a file violates.
+type VerifyIssue struct {
+	Check    string // one of the Check* constants
+	Location string // where the violation was found, e.g. "KF8 section" or "record 12"
+	Message  string
+}
+
+// String formats the issue as "check: location: message".
+func (i VerifyIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Check, i.Location, i.Message)
+}
+
+// verifyEmbedRe matches kindle:embed references in KF8 text.
+var verifyEmbedRe = regexp.MustCompile(`kindle:embed:([0-9A-Fa-f]{4})`)
+
+// verifyRecindexRe matches recindex attributes in MOBI7 text.
+var verifyRecindexRe = regexp.MustCompile(`recindex="(\d+)"`)
+
+// Verify re-reads a serialized AZW3/MOBI file and checks its structural
+// invariants. It returns every violation found; a file that cannot be parsed
+// at all yields a single CheckParse issue.
+func Verify(data []byte) []VerifyIssue {
+	r, err := NewReader(data)
+	if err != nil {
+		return []VerifyIssue{{Check: CheckParse, Location: "file", Message: err.Error()}}
+	}
+
+	issues := verifyRecordOffsets(r)
+	for _, s := range r.Sections {
+		issues = append(issues, verifySection(r, s)...)
+	}
+	return issues
+}
+
+// verifyRecordOffsets checks that record data starts after the record list,
+// and that offsets are monotonic and inside the file.
+func verifyRecordOffsets(r *Reader) []VerifyIssue {
+	var issues []VerifyIssue
+	headerEnd := uint32(78 + 8*len(r.PDB.Records) + 2)
+	for i, rec := range r.PDB.Records {
+		loc := fmt.Sprintf("record %d", i)
+		switch {
+		case rec.Offset < headerEnd:
+			issues = append(issues, VerifyIssue{Check: CheckRecordOffset, Location: loc, Message: fmt.Sprintf("offset %d overlaps the PDB header (ends at %d)", rec.Offset, headerEnd)})
+		case int64(rec.Offset) > int64(len(r.data)):
+			issues = append(issues, VerifyIssue{Check: CheckRecordOffset, Location: loc, Message: fmt.Sprintf("offset %d is beyond the end of the file (%d bytes)", rec.Offset, len(r.data))})
+		case i > 0 && rec.Offset < r.PDB.Records[i-1].Offset:
+			issues = append(issues, VerifyIssue{Check: CheckRecordOffset, Location: loc, Message: fmt.Sprintf("offset %d precedes the previous record offset %d", rec.Offset, r.PDB.Records[i-1].Offset)})
+		}
+	}
+	return issues
+}
+
+// verifySection checks the invariants of a single MOBI7 or KF8 section.
+func verifySection(r *Reader, s *Section) []VerifyIssue {
+	kind := "MOBI7"
+	if s.IsKF8() {
+		kind = "KF8"
+	}
+	loc := fmt.Sprintf("%s section (Record 0 = %d)", kind, s.Record0)
+	h := s.Header
+
+	var issues []VerifyIssue
+	add := func(check, location, format string, args ...any) {
+		issues = append(issues, VerifyIssue{Check: check, Location: location, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Text records
+	if h.FirstContentRecord != 1 {
+		add(CheckTextRecords, loc, "first content record is %d, want 1", h.FirstContentRecord)
+	}
+	if h.LastContentRecord != h.TextRecordCount {
+		add(CheckTextRecords, loc, "last content record %d does not match text record count %d", h.LastContentRecord, h.TextRecordCount)
+	}
+	if end := s.Record0 + int(h.TextRecordCount); end >= r.NumRecords() {
+		add(CheckTextRecords, loc, "text records end at record %d, beyond the last record %d", end, r.NumRecords()-1)
+		return issues
+	}
+	text, err := r.Text(s)
+	if err != nil {
+		add(CheckTextRecords, loc, "failed to read text: %v", err)
+		return issues
+	}
+	if uint32(len(text)) != h.TextLength {
+		add(CheckTextRecords, loc, "decompressed text is %d bytes, header text length is %d", len(text), h.TextLength)
+	}
+
+	// First image
+	var firstImage int
+	if h.FirstImageIndex != NullIndex {
+		firstImage = s.Record0 + int(h.FirstImageIndex)
+		if !isResourceRecordType(r.RecordType(firstImage)) {
+			add(CheckFirstImage, fmt.Sprintf("record %d", firstImage), "first image index does not point at an image or font record (found %s)", r.RecordType(firstImage))
+		}
+	}
+
+	// EXTH record count (EXTH 125 counts the records from the section's Record 0)
+	if s.EXTH != nil {
+		if count, ok := s.EXTH.Uint32Value(125); ok && int(count) != r.NumRecords()-s.Record0 {
+			add(CheckEXTHCount, loc, "EXTH 125 record count is %d, but %d records are present", count, r.NumRecords()-s.Record0)
+		}
+	}
+
+	// FDST
+	flowText := text
+	if s.IsKF8() {
+		fdst, err := r.FDST(s)
+		switch {
+		case err != nil:
+			add(CheckFDST, loc, "failed to parse FDST: %v", err)
+		case fdst == nil:
+			add(CheckFDST, loc, "FDST record not found")
+		default:
+			var sum uint64
+			for i, e := range fdst.Entries {
+				if e[0] > e[1] {
+					add(CheckFDST, fmt.Sprintf("%s flow %d", loc, i), "flow range [%d, %d) is reversed", e[0], e[1])
+					continue
+				}
+				if i > 0 && e[0] != fdst.Entries[i-1][1] {
+					add(CheckFDST, fmt.Sprintf("%s flow %d", loc, i), "flow starts at %d, previous flow ends at %d", e[0], fdst.Entries[i-1][1])
+				}
+				sum += uint64(e[1] - e[0])
+			}
+			if sum != uint64(h.TextLength) {
+				add(CheckFDST, loc, "flow ranges sum to %d, text length is %d", sum, h.TextLength)
+			}
+			if uint32(len(fdst.Entries)) != h.FDSTFlowCount {
+				add(CheckFDST, loc, "FDST has %d flows, MOBI header says %d", len(fdst.Entries), h.FDSTFlowCount)
+			}
+			if len(fdst.Entries) > 0 && fdst.Entries[0][0] <= fdst.Entries[0][1] && fdst.Entries[0][1] <= uint32(len(text)) {
+				flowText = text[fdst.Entries[0][0]:fdst.Entries[0][1]]
+			}
+		}
+	}
+
+	// RESC
+	if h.RESCIndex != NullIndex {
+		if n := s.Record0 + int(h.RESCIndex); r.RecordType(n) != "RESC" {
+			add(CheckRESC, fmt.Sprintf("record %d", n), "RESC index does not point at a RESC record (found %s)", r.RecordType(n))
+		}
+	}
+	if _, err := r.RESC(s); err != nil {
+		add(CheckRESC, loc, "failed to parse RESC record: %v", err)
+	}
+
+	// Image references
+	re, base := verifyRecindexRe, 10
+	if s.IsKF8() {
+		re, base = verifyEmbedRe, 16
+	}
+	seen := make(map[string]bool)
+	for _, m := range re.FindAllSubmatch(text, -1) {
+		ref := string(m[0])
+		if seen[ref] {
+			continue
+		}
+		seen[ref] = true
+		n, err := strconv.ParseUint(string(m[1]), base, 32)
+		if err != nil || n == 0 {
+			add(CheckEmbedRefs, loc, "%s is not a valid image reference", ref)
+			continue
+		}
+		if h.FirstImageIndex == NullIndex {
+			add(CheckEmbedRefs, loc, "%s refers to an image, but the file has no image records", ref)
+			continue
+		}
+		target := firstImage + int(n) - 1
+		if typ := r.RecordType(target); !isResourceRecordType(typ) {
+			add(CheckEmbedRefs, fmt.Sprintf("record %d", target), "%s does not resolve to an image or font record (found %s)", ref, typ)
+		}
+	}
+
+	// NCX offsets
+	ncx, err := r.NCX(s)
+	if err != nil {
+		add(CheckNCX, loc, "failed to parse NCX index: %v", err)
+	}
+	var walk func(entries []NCXEntry)
+	walk = func(entries []NCXEntry) {
+		for _, e := range entries {
+			if e.FilePos >= uint32(len(flowText)) {
+				add(CheckNCX, fmt.Sprintf("%s NCX entry %q", loc, e.Label), "offset %d is outside the text (%d bytes)", e.FilePos, len(flowText))
+			}
+			walk(e.Children)
+		}
+	}
+	walk(ncx)
+
+	// Skeleton and fragment offsets
+	if s.IsKF8() {
+		layout, err := r.Layout(s)
+		if err != nil {
+			add(CheckLayout, loc, "failed to parse SKEL/FRAG indexes: %v", err)
+		} else if layout != nil {
+			flowLen := uint64(len(layout.Text))
+			for _, sk := range layout.Skeletons {
+				if end := uint64(sk.StartPos) + uint64(sk.Length); end > flowLen {
+					add(CheckLayout, fmt.Sprintf("%s skeleton %d", loc, sk.FileNumber), "range [%d, %d) is outside flow 0 (%d bytes)", sk.StartPos, end, flowLen)
+				}
+			}
+			for _, f := range layout.Fragments {
+				fragLoc := fmt.Sprintf("%s fragment %d", loc, f.SequenceNumber)
+				if end := uint64(f.RawStart) + uint64(f.Length); end > flowLen {
+					add(CheckLayout, fragLoc, "range [%d, %d) is outside flow 0 (%d bytes)", f.RawStart, end, flowLen)
+				}
+				if uint64(f.InsertPos) > flowLen {
+					add(CheckLayout, fragLoc, "insert position %d is outside flow 0 (%d bytes)", f.InsertPos, flowLen)
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+// isResourceRecordType reports whether a RecordType result names a resource
+// that kindle:embed references can point at: an image or a FONT record.
+func isResourceRecordType(recordType string) bool {
+	return strings.HasPrefix(recordType, "image/") || recordType == "FONT"
+}
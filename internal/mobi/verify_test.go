@@ -0,0 +1,200 @@
+package mobi
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// verifyTestConfig returns a writer configuration exercising every verified
+// structure: text records, images, FDST flows and the NCX index.
+func verifyTestConfig() AZW3WriterConfig {
+	return AZW3WriterConfig{
+		Title: "Verify",
+		HTML: []byte(`<html><body>` +
+			`<div id="c1"><p>` + strings.Repeat("text ", 1000) + `<img src="kindle:embed:0001?mime=image/jpeg"/></p></div>` +
+			`<div id="c2"><p>two</p></div></body></html>`),
+		Compression:  CompressionPalmDoc,
+		ChapterIDs:   []string{"c1", "c2"},
+		NCXEntries:   []NCXEntry{{Label: "One", FilePos: 0}, {Label: "Two", FilePos: 100}},
+		Flows:        [][]byte{[]byte(`p { background: url(kindle:embed:0001?mime=image/jpeg); }`)},
+		ImageRecords: [][]byte{{0xFF, 0xD8, 0xFF, 0xE0, 0x00}},
+	}
+}
+
+func writeVerifyTestFile(t *testing.T, cfg AZW3WriterConfig) []byte {
+	t.Helper()
+	w, err := NewAZW3Writer(cfg)
+	if err != nil {
+		t.Fatalf("NewAZW3Writer() error = %v", err)
+	}
+	return writeToBuffer(t, w)
+}
+
+func TestVerify_Valid(t *testing.T) {
+	cfg := verifyTestConfig()
+	if issues := Verify(writeVerifyTestFile(t, cfg)); len(issues) != 0 {
+		t.Errorf("Verify() = %v, want no issues", issues)
+	}
+
+	mobi7, err := BuildMOBI7HTML(cfg.HTML)
+	if err != nil {
+		t.Fatalf("BuildMOBI7HTML() error = %v", err)
+	}
+	cfg.MOBI7HTML = mobi7
+	if issues := Verify(writeVerifyTestFile(t, cfg)); len(issues) != 0 {
+		t.Errorf("Verify(joint) = %v, want no issues", issues)
+	}
+}
+
+func TestVerify_FontRecords(t *testing.T) {
+	font, err := NewFontRecord(testFontData(2048), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := verifyTestConfig()
+	cfg.ImageRecords = append(cfg.ImageRecords, font)
+	cfg.Flows = [][]byte{[]byte(`@font-face { src: url(kindle:embed:0002?mime=application/x-font-truetype); }`)}
+	if issues := Verify(writeVerifyTestFile(t, cfg)); len(issues) != 0 {
+		t.Errorf("Verify() = %v, want no issues", issues)
+	}
+
+	// A book whose only resource is a font
+	cfg.ImageRecords = [][]byte{font}
+	cfg.HTML = []byte(strings.ReplaceAll(string(cfg.HTML), `<img src="kindle:embed:0001?mime=image/jpeg"/>`, ""))
+	cfg.Flows = [][]byte{[]byte(`@font-face { src: url(kindle:embed:0001?mime=application/x-font-truetype); }`)}
+	if issues := Verify(writeVerifyTestFile(t, cfg)); len(issues) != 0 {
+		t.Errorf("Verify(font only) = %v, want no issues", issues)
+	}
+}
+
+func TestVerify_Violations(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *AZW3WriterConfig)
+		modify func(data []byte)
+		check  string
+		where  string
+	}{
+		{
+			name:   "unresolved kindle:embed",
+			config: func(cfg *AZW3WriterConfig) { cfg.Flows = [][]byte{[]byte("url(kindle:embed:0002)")} },
+			check:  CheckEmbedRefs,
+			where:  "record",
+		},
+		{
+			name:   "first image is not an image",
+			config: func(cfg *AZW3WriterConfig) { cfg.ImageRecords = [][]byte{[]byte("NOTANIMAGE")} },
+			check:  CheckFirstImage,
+			where:  "record 3",
+		},
+		{
+			name:   "NCX offset outside the text",
+			config: func(cfg *AZW3WriterConfig) { cfg.NCXEntries = []NCXEntry{{Label: "Far", FilePos: 1 << 20}} },
+			check:  CheckNCX,
+			where:  `NCX entry "Far"`,
+		},
+		{
+			name: "last content record mismatch",
+			modify: func(data []byte) {
+				rec0 := binary.BigEndian.Uint32(data[78:])
+				binary.BigEndian.PutUint16(data[rec0+16+162:], 7)
+			},
+			check: CheckTextRecords,
+			where: "KF8 section",
+		},
+		{
+			name: "EXTH record count mismatch",
+			modify: func(data []byte) {
+				// EXTH 121 (12 bytes) is followed by EXTH 125
+				rec0 := binary.BigEndian.Uint32(data[78:])
+				binary.BigEndian.PutUint32(data[rec0+16+MOBIHeaderSize+12+12+8:], 99)
+			},
+			check: CheckEXTHCount,
+			where: "KF8 section",
+		},
+		{
+			name: "FDST ranges do not sum to the text length",
+			modify: func(data []byte) {
+				n := int(binary.BigEndian.Uint16(data[76:]))
+				fdst := binary.BigEndian.Uint32(data[78+(n-4)*8:])
+				end := binary.BigEndian.Uint32(data[fdst+12+8+4:])
+				binary.BigEndian.PutUint32(data[fdst+12+8+4:], end-1)
+			},
+			check: CheckFDST,
+			where: "KF8 section",
+		},
+		{
+			name: "SKEL index record count beyond the section",
+			modify: func(data []byte) {
+				rec0 := binary.BigEndian.Uint32(data[78:])
+				skel := binary.BigEndian.Uint32(data[rec0+16+220:])
+				header := binary.BigEndian.Uint32(data[78+8*skel:])
+				binary.BigEndian.PutUint32(data[header+24:], 0xFFFFFFF0)
+			},
+			check: CheckLayout,
+			where: "KF8 section",
+		},
+		{
+			name: "skeleton outside flow 0",
+			modify: func(data []byte) {
+				n := int(binary.BigEndian.Uint16(data[76:]))
+				fdst := binary.BigEndian.Uint32(data[78+(n-4)*8:])
+				binary.BigEndian.PutUint32(data[fdst+12+4:], 10)
+			},
+			check: CheckLayout,
+			where: "skeleton 0",
+		},
+		{
+			name:   "RESC index is not a RESC record",
+			config: func(cfg *AZW3WriterConfig) { cfg.RESC = &RESC{PageProgressionDirection: "rtl"} },
+			modify: func(data []byte) {
+				rec0 := binary.BigEndian.Uint32(data[78:])
+				binary.BigEndian.PutUint32(data[rec0+16+232:], 1)
+			},
+			check: CheckRESC,
+			where: "record 1",
+		},
+		{
+			name: "record offset beyond the file",
+			modify: func(data []byte) {
+				n := int(binary.BigEndian.Uint16(data[76:]))
+				binary.BigEndian.PutUint32(data[78+(n-1)*8:], uint32(len(data)+10))
+			},
+			check: CheckParse,
+			where: "file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := verifyTestConfig()
+			if tt.config != nil {
+				tt.config(&cfg)
+			}
+			data := writeVerifyTestFile(t, cfg)
+			if tt.modify != nil {
+				tt.modify(data)
+			}
+
+			issues := Verify(data)
+			var found bool
+			for _, issue := range issues {
+				if issue.Check == tt.check && strings.Contains(issue.Location, tt.where) {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Verify() = %v, want a %s issue at %q", issues, tt.check, tt.where)
+			}
+		})
+	}
+}
+
+func TestVerifyIssue_String(t *testing.T) {
+	issue := VerifyIssue{Check: CheckFDST, Location: "KF8 section (Record 0 = 0)", Message: "flow ranges sum to 1, text length is 2"}
+	want := "fdst: KF8 section (Record 0 = 0): flow ranges sum to 1, text length is 2"
+	if got := issue.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
@@ -15,11 +15,51 @@ type AZW3WriterConfig struct {
 	HTML         []byte
 	Metadata     *epub.Metadata
 	ImageRecords [][]byte
-	CoverOffset  *uint32
-	NCXRecord    []byte
+	// CoverOffset is the index of the cover among ImageRecords, written as
+	// EXTH 131 and 201, and as the KF8 cover URI (EXTH 129) in the KF8 section.
+	CoverOffset *uint32
+	// ThumbnailOffset is the index of the cover thumbnail among ImageRecords,
+	// written as EXTH 202. Kindle shows it in the library.
+	ThumbnailOffset *uint32
+	// ASIN identifies the book on the device, written as EXTH 113 and 504.
+	// Kindle names the library thumbnail of a sideloaded book after it.
+	ASIN string
+	// CDEType is the content type of the book (e.g. "EBOK" or "PDOC"),
+	// written as EXTH 501.
+	CDEType string
+	// StartReading is the text flow offset where the book opens, written as
+	// EXTH 116 in the KF8 section.
+	StartReading *uint32
 	Compression  uint16
 	CreationTime time.Time
 	UniqueID     *uint32
+	// WritingMode is written as EXTH 525 (e.g. "horizontal-lr", "vertical-rl").
+	WritingMode string
+	// PageProgressionDirection is written as EXTH 527 ("ltr" or "rtl").
+	PageProgressionDirection string
+	// FixedLayout marks the book as a Kindle fixed-layout book.
+	FixedLayout *FixedLayout
+	// ChapterIDs lists the chapter div ids of HTML in document order.
+	// When set, the text is split into KF8 skeletons and fragments and the
+	// SKEL/FRAG indexes are written. When empty, HTML is stored as a single file.
+	ChapterIDs []string
+	// ChapterHeads holds additional head markup per chapter id, written into
+	// the head of the chapter's skeleton (see BuildKF8LayoutWithHeads).
+	ChapterHeads map[string][]byte
+	// NCXEntries is the TOC written as a binary NCX index.
+	NCXEntries []NCXEntry
+	// Guide is written as a KF8 guide index. It requires ChapterIDs.
+	Guide []GuideReference
+	// RESC is written as a RESC record after the image records and referenced
+	// from the RESC index of the MOBI header.
+	RESC *RESC
+	// Flows are additional KF8 flows (CSS, SVG) stored after the text flow.
+	// Flows[0] is flow 1 and is referenced as KindleFlowRef(1, mime).
+	Flows [][]byte
+	// MOBI7HTML is the simplified HTML of a MOBI7 section (see BuildMOBI7HTML).
+	// When set, a joint MOBI7+KF8 file is written: the MOBI7 section, a BOUNDARY
+	// record, then the KF8 section. Image records are shared with the MOBI7 section.
+	MOBI7HTML []byte
 }
 
 // AZW3Writer assembles and writes a complete AZW3 file.
@@ -44,29 +84,166 @@ func NewAZW3Writer(cfg AZW3WriterConfig) (*AZW3Writer, error) {
 	return &AZW3Writer{cfg: cfg}, nil
 }
 
+// pdbRecord is a single PDB record with a label used in error messages.
+type pdbRecord struct {
+	data  []byte
+	label string
+}
+
+// kf8Section holds the records of the KF8 section, starting with its Record 0.
+// Record numbers inside the section are relative to its Record 0.
+type kf8Section struct {
+	records         []pdbRecord
+	firstImageIndex uint32
+}
+
 // WriteTo writes the complete AZW3 file to the given writer.
 func (w *AZW3Writer) WriteTo(out io.Writer) (int64, error) {
 	cfg := w.cfg
 
+	kf8, err := w.buildKF8Section()
+	if err != nil {
+		return 0, err
+	}
+
+	records := kf8.records
+	if len(cfg.MOBI7HTML) > 0 {
+		mobi7, err := w.buildMOBI7Section(kf8)
+		if err != nil {
+			return 0, err
+		}
+		records = make([]pdbRecord, 0, len(mobi7)+1+len(kf8.records))
+		records = append(records, mobi7...)
+		records = append(records, pdbRecord{data: BoundaryRecord(), label: "BOUNDARY"})
+		records = append(records, kf8.records...)
+	}
+
+	// --- Build PDB ---
+	recordSizes := make([]int, len(records))
+	for i, r := range records {
+		recordSizes[i] = len(r.data)
+	}
+
+	creation := cfg.CreationTime
+	if creation.IsZero() {
+		creation = time.Now().UTC()
+	}
+
+	pdb, err := NewPDB(cfg.Title, recordSizes, creation, creation)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create PDB: %w", err)
+	}
+
+	// --- Write phase ---
+	var written int64
+
+	writeAll := func(data []byte, label string) error {
+		n, err := io.Copy(out, bytes.NewReader(data))
+		written += n
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", label, err)
+		}
+		return nil
+	}
+
+	headerBytes, err := pdb.HeaderBytes()
+	if err != nil {
+		return written, fmt.Errorf("failed to serialize PDB header: %w", err)
+	}
+	if err := writeAll(headerBytes, "PDB header"); err != nil {
+		return written, err
+	}
+
+	recordListBytes, err := pdb.RecordListBytes()
+	if err != nil {
+		return written, fmt.Errorf("failed to serialize record list: %w", err)
+	}
+	if err := writeAll(recordListBytes, "record list"); err != nil {
+		return written, err
+	}
+
+	for _, r := range records {
+		if err := writeAll(r.data, r.label); err != nil {
+			return written, err
+		}
+	}
+
+	return written, nil
+}
+
+// compressor returns the text compressor for the configured compression type.
+func (w *AZW3Writer) compressor() Compressor {
+	if w.cfg.Compression == CompressionPalmDoc {
+		return &PalmDocCompressor{}
+	}
+	return &NoCompression{}
+}
+
+// buildKF8Section assembles the KF8 records: Record 0, text records, images,
+// indexes, FDST, FLIS, FCIS and EOF.
+func (w *AZW3Writer) buildKF8Section() (*kf8Section, error) {
+	cfg := w.cfg
+
 	// --- Pass 1: Determine record numbers ---
 
-	// Select compressor based on compression type
-	var compressor Compressor
-	if cfg.Compression == CompressionPalmDoc {
-		compressor = &PalmDocCompressor{}
-	} else {
-		compressor = &NoCompression{}
+	// Rearrange the HTML into skeletons and fragments
+	text := cfg.HTML
+	var layout *KF8Layout
+	var fragRecords, skelRecords, guideRecords [][]byte
+	if len(cfg.ChapterIDs) > 0 {
+		var err error
+		layout, err = BuildKF8LayoutWithHeads(cfg.HTML, cfg.ChapterIDs, cfg.ChapterHeads)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build KF8 layout: %w", err)
+		}
+		text = layout.Text
+
+		fragRecords, err = layout.FragmentIndexRecords()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build FRAG index: %w", err)
+		}
+		skelRecords, err = layout.SkeletonIndexRecords()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build SKEL index: %w", err)
+		}
+
+		if len(cfg.Guide) > 0 {
+			guideRecords, err = GuideIndexRecords(cfg.Guide, layout)
+			if err != nil {
+				return nil, fmt.Errorf("failed to build guide index: %w", err)
+			}
+		}
+	}
+
+	// Append the additional flows after the text flow
+	flowLengths := []uint32{TextLength(text)}
+	if len(cfg.Flows) > 0 {
+		combined := make([]byte, 0, len(text))
+		combined = append(combined, text...)
+		for _, flow := range cfg.Flows {
+			combined = append(combined, flow...)
+			flowLengths = append(flowLengths, TextLength(flow))
+		}
+		text = combined
 	}
 
 	// Split text into records
-	textRecords, err := SplitTextRecords(cfg.HTML, compressor)
+	textRecords, err := SplitTextRecordsMultibyte(text, w.compressor())
 	if err != nil {
-		return 0, fmt.Errorf("failed to split text records: %w", err)
+		return nil, fmt.Errorf("failed to split text records: %w", err)
 	}
 
-	textLen := TextLength(cfg.HTML)
+	textLen := TextLength(text)
 	textRecCount := len(textRecords)
 
+	var ncxRecords [][]byte
+	if len(cfg.NCXEntries) > 0 {
+		ncxRecords, err = NCXIndexRecords(cfg.NCXEntries, flowLengths[0], layout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build NCX index: %w", err)
+		}
+	}
+
 	// Record index calculation
 	firstContentRecord := uint16(1)
 	lastContentRecord := uint16(textRecCount)
@@ -78,13 +255,35 @@ func (w *AZW3Writer) WriteTo(out io.Writer) (int64, error) {
 	}
 	nextIndex += len(cfg.ImageRecords)
 
-	// NCX record (if present) goes after image records, before FDST
-	if len(cfg.NCXRecord) > 0 {
+	// The RESC record is the last resource, so kindle:embed numbers are unaffected
+	var rescData []byte
+	var rescIndex uint32
+	if cfg.RESC != nil {
+		rescData = NewRESCRecord(*cfg.RESC)
+		rescIndex = uint32(nextIndex)
 		nextIndex++
 	}
 
-	fdstIndex := nextIndex
-	_ = fdstIndex // used for record placement
+	// NCX, FRAG (each with their CNCX records), SKEL and guide indexes follow, before FDST
+	var ncxIndex, fragIndex, skelIndex, guideIndex uint32
+	if len(ncxRecords) > 0 {
+		ncxIndex = uint32(nextIndex)
+		nextIndex += len(ncxRecords)
+	}
+	if len(fragRecords) > 0 {
+		fragIndex = uint32(nextIndex)
+		nextIndex += len(fragRecords)
+	}
+	if len(skelRecords) > 0 {
+		skelIndex = uint32(nextIndex)
+		nextIndex += len(skelRecords)
+	}
+	if len(guideRecords) > 0 {
+		guideIndex = uint32(nextIndex)
+		nextIndex += len(guideRecords)
+	}
+
+	// FDST
 	nextIndex++
 
 	flisIndex := uint32(nextIndex)
@@ -99,159 +298,206 @@ func (w *AZW3Writer) WriteTo(out io.Writer) (int64, error) {
 	totalRecordCount := uint32(nextIndex)
 
 	// --- Build EXTH ---
-	var exth *EXTHHeader
-	if cfg.Metadata != nil {
-		exth = EXTHFromMetadata(*cfg.Metadata, 0, totalRecordCount)
-	} else {
-		exth = NewEXTHHeader(0, totalRecordCount)
-	}
-	if cfg.CoverOffset != nil {
-		exth.AddUint32Record(131, *cfg.CoverOffset)
-	}
-
-	exthData, err := exth.Bytes()
+	exthData, err := w.exthBytes(0, totalRecordCount, true)
 	if err != nil {
-		return 0, fmt.Errorf("failed to serialize EXTH: %w", err)
+		return nil, err
 	}
 
 	// --- Build fixed records ---
-	fdst := NewFDSTSingleFlow(textLen)
+	fdst := NewFDST(flowLengths)
 	fdstData, err := fdst.Bytes()
 	if err != nil {
-		return 0, fmt.Errorf("failed to serialize FDST: %w", err)
+		return nil, fmt.Errorf("failed to serialize FDST: %w", err)
 	}
 
 	flisData := FLISRecord()
 
 	fcisData, err := FCISRecord(textLen)
 	if err != nil {
-		return 0, fmt.Errorf("failed to serialize FCIS: %w", err)
+		return nil, fmt.Errorf("failed to serialize FCIS: %w", err)
 	}
 
 	eofData := EOFRecord()
 
 	// --- Pass 2: Build Record 0 ---
-	language := ""
-	if cfg.Metadata != nil {
-		language = cfg.Metadata.Language
-	}
-
 	mobiCfg := MOBIHeaderConfig{
 		Compression:          cfg.Compression,
 		TextLength:           textLen,
 		TextRecordCount:      uint16(textRecCount),
-		Language:             language,
+		Language:             w.language(),
 		UniqueID:             cfg.UniqueID,
 		FirstImageIndex:      firstImageIndex,
 		FirstContentRecord:   firstContentRecord,
 		LastContentRecord:    lastContentRecord,
 		FCISRecordNumber:     fcisIndex,
 		FLISRecordNumber:     flisIndex,
-		ExtraRecordDataFlags: 0,
+		ExtraRecordDataFlags: ExtraDataMultibyte,
 		FDSTFlowCount:        fdst.FlowCount(),
 		FDSTOffset:           0xFFFFFFFF, // FDST is a standalone record
+		NCXIndex:             ncxIndex,
+		FragmentIndex:        fragIndex,
+		SkeletonIndex:        skelIndex,
+		GuideIndex:           guideIndex,
+		RESCIndex:            rescIndex,
 	}
 
 	mobiHeader, err := NewMOBIHeader(mobiCfg)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create MOBI header: %w", err)
+		return nil, fmt.Errorf("failed to create MOBI header: %w", err)
 	}
 
 	record0, err := mobiHeader.Record0Bytes(exthData, cfg.Title)
 	if err != nil {
-		return 0, fmt.Errorf("failed to build Record 0: %w", err)
+		return nil, fmt.Errorf("failed to build Record 0: %w", err)
 	}
 
-	// --- Build record sizes slice ---
-	recordSizes := make([]int, 0, int(totalRecordCount))
-	recordSizes = append(recordSizes, len(record0))
-	for _, tr := range textRecords {
-		recordSizes = append(recordSizes, len(tr))
+	// --- Collect records in file order ---
+	records := make([]pdbRecord, 0, int(totalRecordCount))
+	records = append(records, pdbRecord{data: record0, label: "Record 0"})
+	for i, tr := range textRecords {
+		records = append(records, pdbRecord{data: tr, label: fmt.Sprintf("text record %d", i)})
 	}
-	for _, ir := range cfg.ImageRecords {
-		recordSizes = append(recordSizes, len(ir))
+	for i, ir := range cfg.ImageRecords {
+		records = append(records, pdbRecord{data: ir, label: fmt.Sprintf("image record %d", i)})
 	}
-	if len(cfg.NCXRecord) > 0 {
-		recordSizes = append(recordSizes, len(cfg.NCXRecord))
+	if rescData != nil {
+		records = append(records, pdbRecord{data: rescData, label: "RESC record"})
 	}
-	recordSizes = append(recordSizes, len(fdstData))
-	recordSizes = append(recordSizes, len(flisData))
-	recordSizes = append(recordSizes, len(fcisData))
-	recordSizes = append(recordSizes, len(eofData))
-
-	// --- Build PDB ---
-	creation := cfg.CreationTime
-	if creation.IsZero() {
-		creation = time.Now().UTC()
+	for i, r := range ncxRecords {
+		records = append(records, pdbRecord{data: r, label: fmt.Sprintf("NCX index record %d", i)})
+	}
+	for i, r := range fragRecords {
+		records = append(records, pdbRecord{data: r, label: fmt.Sprintf("FRAG index record %d", i)})
+	}
+	for i, r := range skelRecords {
+		records = append(records, pdbRecord{data: r, label: fmt.Sprintf("SKEL index record %d", i)})
+	}
+	for i, r := range guideRecords {
+		records = append(records, pdbRecord{data: r, label: fmt.Sprintf("guide index record %d", i)})
 	}
+	records = append(records,
+		pdbRecord{data: fdstData, label: "FDST"},
+		pdbRecord{data: flisData, label: "FLIS"},
+		pdbRecord{data: fcisData, label: "FCIS"},
+		pdbRecord{data: eofData, label: "EOF"},
+	)
 
-	pdb, err := NewPDB(cfg.Title, recordSizes, creation, creation)
+	return &kf8Section{records: records, firstImageIndex: firstImageIndex}, nil
+}
+
+// buildMOBI7Section assembles the MOBI7 records (Record 0 and text records)
+// written in front of the BOUNDARY record and the given KF8 section.
+func (w *AZW3Writer) buildMOBI7Section(kf8 *kf8Section) ([]pdbRecord, error) {
+	cfg := w.cfg
+
+	textRecords, err := SplitTextRecordsMultibyte(cfg.MOBI7HTML, w.compressor())
 	if err != nil {
-		return 0, fmt.Errorf("failed to create PDB: %w", err)
+		return nil, fmt.Errorf("failed to split MOBI7 text records: %w", err)
 	}
+	textRecCount := len(textRecords)
 
-	// --- Write phase ---
-	var written int64
+	// The KF8 Record 0 follows the MOBI7 records and the BOUNDARY record.
+	kf8Record0 := uint32(1 + textRecCount + 1)
+	totalRecordCount := kf8Record0 + uint32(len(kf8.records))
 
-	writeAll := func(data []byte, label string) error {
-		n, err := io.Copy(out, bytes.NewReader(data))
-		written += n
-		if err != nil {
-			return fmt.Errorf("failed to write %s: %w", label, err)
-		}
-		return nil
+	// Images live in the KF8 section; MOBI7 refers to them by absolute record number.
+	firstImageIndex := NullIndex
+	if kf8.firstImageIndex != NullIndex {
+		firstImageIndex = kf8Record0 + kf8.firstImageIndex
 	}
 
-	headerBytes, err := pdb.HeaderBytes()
+	exthData, err := w.exthBytes(kf8Record0, totalRecordCount, false)
 	if err != nil {
-		return written, fmt.Errorf("failed to serialize PDB header: %w", err)
-	}
-	if err := writeAll(headerBytes, "PDB header"); err != nil {
-		return written, err
+		return nil, err
 	}
 
-	recordListBytes, err := pdb.RecordListBytes()
+	mobiHeader, err := NewMOBIHeader(MOBIHeaderConfig{
+		Compression:          cfg.Compression,
+		TextLength:           TextLength(cfg.MOBI7HTML),
+		TextRecordCount:      uint16(textRecCount),
+		Language:             w.language(),
+		UniqueID:             cfg.UniqueID,
+		FirstImageIndex:      firstImageIndex,
+		FirstContentRecord:   1,
+		LastContentRecord:    uint16(textRecCount),
+		FCISRecordNumber:     NullIndex,
+		FLISRecordNumber:     NullIndex,
+		ExtraRecordDataFlags: ExtraDataMultibyte,
+		FDSTOffset:           NullIndex,
+		MOBIType:             MOBITypeBook,
+		FileVersion:          FileVersionMOBI7,
+	})
 	if err != nil {
-		return written, fmt.Errorf("failed to serialize record list: %w", err)
-	}
-	if err := writeAll(recordListBytes, "record list"); err != nil {
-		return written, err
+		return nil, fmt.Errorf("failed to create MOBI7 header: %w", err)
 	}
 
-	if err := writeAll(record0, "Record 0"); err != nil {
-		return written, err
+	record0, err := mobiHeader.Record0Bytes(exthData, cfg.Title)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build MOBI7 Record 0: %w", err)
 	}
 
+	records := make([]pdbRecord, 0, 1+textRecCount)
+	records = append(records, pdbRecord{data: record0, label: "MOBI7 Record 0"})
 	for i, tr := range textRecords {
-		if err := writeAll(tr, fmt.Sprintf("text record %d", i)); err != nil {
-			return written, err
-		}
+		records = append(records, pdbRecord{data: tr, label: fmt.Sprintf("MOBI7 text record %d", i)})
 	}
+	return records, nil
+}
 
-	for i, ir := range cfg.ImageRecords {
-		if err := writeAll(ir, fmt.Sprintf("image record %d", i)); err != nil {
-			return written, err
-		}
-	}
+// exthBytes serializes the EXTH header built from the configured metadata.
+// The start reading offset (EXTH 116) and the cover URI (EXTH 129) are only
+// written in the KF8 section: the offset is in the KF8 text flow, not in the
+// MOBI7 text, and the URI is a KF8 kindle:embed reference.
+func (w *AZW3Writer) exthBytes(boundaryOffset, recordCount uint32, kf8 bool) ([]byte, error) {
+	cfg := w.cfg
 
-	if len(cfg.NCXRecord) > 0 {
-		if err := writeAll(cfg.NCXRecord, "NCX record"); err != nil {
-			return written, err
+	var exth *EXTHHeader
+	if cfg.Metadata != nil {
+		exth = EXTHFromMetadata(*cfg.Metadata, boundaryOffset, recordCount)
+	} else {
+		exth = NewEXTHHeader(boundaryOffset, recordCount)
+	}
+	if cfg.CoverOffset != nil {
+		exth.AddUint32Record(131, *cfg.CoverOffset)
+		exth.AddUint32Record(201, *cfg.CoverOffset)
+		if kf8 {
+			exth.AddStringRecord(129, KindleEmbedIndexRef(int(*cfg.CoverOffset)))
 		}
 	}
-
-	if err := writeAll(fdstData, "FDST"); err != nil {
-		return written, err
+	if cfg.ThumbnailOffset != nil {
+		exth.AddUint32Record(202, *cfg.ThumbnailOffset)
 	}
-	if err := writeAll(flisData, "FLIS"); err != nil {
-		return written, err
+	if cfg.ASIN != "" {
+		exth.AddStringRecord(113, cfg.ASIN)
+		exth.AddStringRecord(504, cfg.ASIN)
 	}
-	if err := writeAll(fcisData, "FCIS"); err != nil {
-		return written, err
+	if cfg.CDEType != "" {
+		exth.AddStringRecord(501, cfg.CDEType)
 	}
-	if err := writeAll(eofData, "EOF"); err != nil {
-		return written, err
+	if kf8 && cfg.StartReading != nil {
+		exth.AddUint32Record(116, *cfg.StartReading)
+	}
+	if cfg.WritingMode != "" {
+		exth.AddStringRecord(525, cfg.WritingMode)
+	}
+	if cfg.PageProgressionDirection != "" {
+		exth.AddStringRecord(527, cfg.PageProgressionDirection)
+	}
+	if cfg.FixedLayout != nil {
+		cfg.FixedLayout.addEXTHRecords(exth)
 	}
 
-	return written, nil
+	exthData, err := exth.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize EXTH: %w", err)
+	}
+	return exthData, nil
+}
+
+// language returns the configured metadata language, if any.
+func (w *AZW3Writer) language() string {
+	if w.cfg.Metadata != nil {
+		return w.cfg.Metadata.Language
+	}
+	return ""
 }
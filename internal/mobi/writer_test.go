@@ -3,6 +3,7 @@ package mobi
 import (
 	"bytes"
 	"encoding/binary"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -64,6 +65,16 @@ func extractRecord(data []byte, index int) []byte {
 	return data[recOffset:nextOffset]
 }
 
+// extractTextRecord extracts the Nth record and strips its multibyte trailing entry.
+func extractTextRecord(t *testing.T, data []byte, index int) []byte {
+	t.Helper()
+	text, err := StripTrailingEntries(extractRecord(data, index), ExtraDataMultibyte)
+	if err != nil {
+		t.Fatalf("record %d: %v", index, err)
+	}
+	return text
+}
+
 // --- Step 1: Constructor and validation ---
 
 func TestNewAZW3Writer_MinimalConfig(t *testing.T) {
@@ -475,6 +486,175 @@ func TestWriteTo_EXTHCoverOffsetAbsent(t *testing.T) {
 	}
 }
 
+func TestWriteTo_EXTHStartReading(t *testing.T) {
+	startReading := uint32(1234)
+	for _, joint := range []bool{false, true} {
+		cfg := AZW3WriterConfig{
+			Title:        "Test Book",
+			HTML:         generateTestHTML(5000),
+			StartReading: &startReading,
+		}
+		kf8Record := 0
+		if joint {
+			cfg.MOBI7HTML = generateTestHTML(100)
+			kf8Record = 3 // MOBI7 Record 0, one text record, BOUNDARY
+		}
+		w, err := NewAZW3Writer(cfg)
+		if err != nil {
+			t.Fatalf("NewAZW3Writer failed: %v", err)
+		}
+		data := writeToBuffer(t, w)
+
+		rec0 := extractRecord(data, kf8Record)
+		records := parseEXTHRecords(t, rec0[16+MOBIHeaderSize:])
+		if want := []string{"\x00\x00\x04\xd2"}; !reflect.DeepEqual(records[116], want) {
+			t.Errorf("joint=%v: KF8 EXTH 116 = %q, want %q", joint, records[116], want)
+		}
+		if joint {
+			mobi7 := parseEXTHRecords(t, extractRecord(data, 0)[16+MOBIHeaderSize:])
+			if _, ok := mobi7[116]; ok {
+				t.Error("MOBI7 EXTH has 116, but the offset is in the KF8 text")
+			}
+		}
+	}
+}
+
+func TestWriteTo_EXTHCoverAndThumbnail(t *testing.T) {
+	coverOffset, thumbnailOffset := uint32(0), uint32(2)
+	for _, joint := range []bool{false, true} {
+		cfg := AZW3WriterConfig{
+			Title:           "Test Book",
+			HTML:            generateTestHTML(5000),
+			ImageRecords:    [][]byte{{0xFF, 0xD8}, {0xFF, 0xD8}, {0xFF, 0xD8}},
+			CoverOffset:     &coverOffset,
+			ThumbnailOffset: &thumbnailOffset,
+		}
+		kf8Record := 0
+		if joint {
+			cfg.MOBI7HTML = generateTestHTML(100)
+			kf8Record = 3 // MOBI7 Record 0, one text record, BOUNDARY
+		}
+		w, err := NewAZW3Writer(cfg)
+		if err != nil {
+			t.Fatalf("NewAZW3Writer failed: %v", err)
+		}
+		data := writeToBuffer(t, w)
+
+		records := parseEXTHRecords(t, extractRecord(data, kf8Record)[16+MOBIHeaderSize:])
+		want := map[uint32][]string{
+			129: {"kindle:embed:0001"},
+			131: {"\x00\x00\x00\x00"},
+			201: {"\x00\x00\x00\x00"},
+			202: {"\x00\x00\x00\x02"},
+		}
+		for typ, values := range want {
+			if !reflect.DeepEqual(records[typ], values) {
+				t.Errorf("joint=%v: KF8 EXTH %d = %q, want %q", joint, typ, records[typ], values)
+			}
+		}
+		if joint {
+			mobi7 := parseEXTHRecords(t, extractRecord(data, 0)[16+MOBIHeaderSize:])
+			if _, ok := mobi7[129]; ok {
+				t.Error("MOBI7 EXTH has 129, but the URI is a KF8 reference")
+			}
+			for _, typ := range []uint32{131, 201, 202} {
+				if !reflect.DeepEqual(mobi7[typ], want[typ]) {
+					t.Errorf("MOBI7 EXTH %d = %q, want %q", typ, mobi7[typ], want[typ])
+				}
+			}
+		}
+	}
+}
+
+func TestWriteTo_EXTHASINAndCDEType(t *testing.T) {
+	w, err := NewAZW3Writer(AZW3WriterConfig{
+		Title:   "Test Book",
+		HTML:    generateTestHTML(100),
+		ASIN:    "B0TEST1234",
+		CDEType: "PDOC",
+	})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer failed: %v", err)
+	}
+	data := writeToBuffer(t, w)
+
+	records := parseEXTHRecords(t, extractRecord(data, 0)[16+MOBIHeaderSize:])
+	want := map[uint32][]string{113: {"B0TEST1234"}, 504: {"B0TEST1234"}, 501: {"PDOC"}}
+	for typ, values := range want {
+		if !reflect.DeepEqual(records[typ], values) {
+			t.Errorf("EXTH %d = %q, want %q", typ, records[typ], values)
+		}
+	}
+}
+
+func TestWriteTo_EXTHWritingMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		writingMode string
+		ppd         string
+		want        map[uint32][]string
+	}{
+		{"vertical-rl", "vertical-rl", "rtl", map[uint32][]string{525: {"vertical-rl"}, 527: {"rtl"}}},
+		{"horizontal-lr", "horizontal-lr", "ltr", map[uint32][]string{525: {"horizontal-lr"}, 527: {"ltr"}}},
+		{"unset", "", "", map[uint32][]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := NewAZW3Writer(AZW3WriterConfig{
+				Title:                    "Test Book",
+				HTML:                     generateTestHTML(100),
+				WritingMode:              tt.writingMode,
+				PageProgressionDirection: tt.ppd,
+			})
+			if err != nil {
+				t.Fatalf("NewAZW3Writer failed: %v", err)
+			}
+			data := writeToBuffer(t, w)
+
+			rec0 := extractRecord(data, 0)
+			records := parseEXTHRecords(t, rec0[16+MOBIHeaderSize:])
+			for _, recType := range []uint32{525, 527} {
+				if got, want := records[recType], tt.want[recType]; !reflect.DeepEqual(got, want) {
+					t.Errorf("EXTH %d = %q, want %q", recType, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteTo_EXTHFixedLayout(t *testing.T) {
+	w, err := NewAZW3Writer(AZW3WriterConfig{
+		Title: "Test Book",
+		HTML:  generateTestHTML(100),
+		FixedLayout: &FixedLayout{
+			OriginalResolution:  "1072x1448",
+			BookType:            "comic",
+			OrientationLock:     "portrait",
+			RegionMagnification: true,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAZW3Writer failed: %v", err)
+	}
+	data := writeToBuffer(t, w)
+
+	rec0 := extractRecord(data, 0)
+	records := parseEXTHRecords(t, rec0[16+MOBIHeaderSize:])
+	want := map[uint32][]string{
+		122: {"true"},
+		123: {"comic"},
+		124: {"portrait"},
+		126: {"1072x1448"},
+		307: {"1072x1448"},
+		132: {"true"},
+	}
+	for recType, values := range want {
+		if !reflect.DeepEqual(records[recType], values) {
+			t.Errorf("EXTH %d = %q, want %q", recType, records[recType], values)
+		}
+	}
+}
+
 // --- Step 6: Record data content verification ---
 
 func TestWriteTo_TextRecordContent(t *testing.T) {
@@ -494,7 +674,7 @@ func TestWriteTo_TextRecordContent(t *testing.T) {
 	data := writeToBuffer(t, w)
 
 	// Record 1 = text record (only one for small HTML)
-	textRec := extractRecord(data, 1)
+	textRec := extractTextRecord(t, data, 1)
 	if !bytes.Equal(textRec, html) {
 		t.Errorf("text record does not match original HTML: got %d bytes, want %d", len(textRec), len(html))
 	}
@@ -749,11 +929,16 @@ func TestWriteTo_MultipleTextRecords(t *testing.T) {
 		t.Errorf("FCISRecordNumber: got %d, want 5", fcisNum)
 	}
 
+	// Every text record carries a multibyte trailing entry
+	if flags := readUint32BE(rec0, mobiStart+208); flags != ExtraDataMultibyte {
+		t.Errorf("ExtraRecordDataFlags: got 0x%X, want 0x%X", flags, ExtraDataMultibyte)
+	}
+
 	// Concatenate text records should equal original HTML
 	var textData []byte
 	textRecordCount := TextRecordCount(html)
 	for i := 1; i <= textRecordCount; i++ {
-		textData = append(textData, extractRecord(data, i)...)
+		textData = append(textData, extractTextRecord(t, data, i)...)
 	}
 	if !bytes.Equal(textData, html) {
 		t.Errorf("concatenated text records don't match original HTML: got %d bytes, want %d", len(textData), len(html))
@@ -834,21 +1019,19 @@ func TestWriteTo_WithImageRecords(t *testing.T) {
 	}
 }
 
-// --- Step 10: NCX record ---
-
-func TestWriteTo_WithNCXRecord(t *testing.T) {
+func TestWriteTo_ImageRecordsShiftRecordNumbers(t *testing.T) {
 	html := generateTestHTML(100)
 	uid := uint32(12345)
 	creation := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 
-	ncxData := []byte("<html><body><h1>TOC</h1></body></html>")
+	img1 := bytes.Repeat([]byte{0xFF}, 50)
 
 	cfg := AZW3WriterConfig{
 		Title:        "Test Book",
 		HTML:         html,
 		UniqueID:     &uid,
 		CreationTime: creation,
-		NCXRecord:    ncxData,
+		ImageRecords: [][]byte{img1},
 	}
 	w, err := NewAZW3Writer(cfg)
 	if err != nil {
@@ -856,54 +1039,58 @@ func TestWriteTo_WithNCXRecord(t *testing.T) {
 	}
 	data := writeToBuffer(t, w)
 
-	// Record count: Record0 + text×1 + NCX + FDST + FLIS + FCIS + EOF = 7
+	rec0 := extractRecord(data, 0)
+	mobiStart := 16
+
+	// With 1 image: Record0, text×1, image×1, FDST, FLIS, FCIS, EOF = 7 records
 	numRecords := readUint16BE(data, 76)
 	if numRecords != 7 {
 		t.Errorf("record count: got %d, want 7", numRecords)
 	}
 
-	// NCX record should be at index 2 (after text)
-	ncxRec := extractRecord(data, 2)
-	if !bytes.Equal(ncxRec, ncxData) {
-		t.Error("NCX record content mismatch")
-	}
-
-	// FDST should be at index 3
-	fdstRec := extractRecord(data, 3)
-	if string(fdstRec[:4]) != "FDST" {
-		t.Errorf("FDST at index 3: got %q, want FDST", string(fdstRec[:4]))
-	}
-
-	// FLIS at index 4
-	rec0 := extractRecord(data, 0)
-	mobiStart := 16
+	// FLIS should be at index 4 (0=Record0, 1=text, 2=image, 3=FDST, 4=FLIS)
 	flisNum := readUint32BE(rec0, mobiStart+176)
 	if flisNum != 4 {
 		t.Errorf("FLISRecordNumber: got %d, want 4", flisNum)
 	}
 
-	// FCIS at index 5
+	// FCIS should be at index 5
 	fcisNum := readUint32BE(rec0, mobiStart+168)
 	if fcisNum != 5 {
 		t.Errorf("FCISRecordNumber: got %d, want 5", fcisNum)
 	}
+
+	// EXTH 125 should be 7
+	exthStart := 16 + MOBIHeaderSize
+	exthRecordCount := readUint32BE(rec0, exthStart+8)
+	offset := exthStart + 12
+	for i := 0; i < int(exthRecordCount); i++ {
+		recType := readUint32BE(rec0, offset)
+		recLen := readUint32BE(rec0, offset+4)
+		if recType == 125 {
+			val := readUint32BE(rec0, offset+8)
+			if val != 7 {
+				t.Errorf("EXTH 125 (record count): got %d, want 7", val)
+			}
+		}
+		offset += int(recLen)
+	}
 }
 
-func TestWriteTo_WithNCXAndImageRecords(t *testing.T) {
-	html := generateTestHTML(100)
+func TestWriteTo_WithChapterIDs(t *testing.T) {
+	html := []byte(`<html><head><title>T</title></head><body>` +
+		`<div id="ch01"><p>One</p></div>` +
+		`<div id="ch02"><p>Two</p></div>` +
+		`</body></html>`)
 	uid := uint32(12345)
 	creation := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 
-	img1 := bytes.Repeat([]byte{0xFF}, 100)
-	ncxData := []byte("<html><body><h1>TOC</h1></body></html>")
-
 	cfg := AZW3WriterConfig{
 		Title:        "Test Book",
 		HTML:         html,
 		UniqueID:     &uid,
 		CreationTime: creation,
-		ImageRecords: [][]byte{img1},
-		NCXRecord:    ncxData,
+		ChapterIDs:   []string{"ch01", "ch02"},
 	}
 	w, err := NewAZW3Writer(cfg)
 	if err != nil {
@@ -911,74 +1098,121 @@ func TestWriteTo_WithNCXAndImageRecords(t *testing.T) {
 	}
 	data := writeToBuffer(t, w)
 
-	// Record count: Record0 + text×1 + image×1 + NCX + FDST + FLIS + FCIS + EOF = 8
+	// Record0, text×1, FRAG header, FRAG entries, CNCX, SKEL header, SKEL entries,
+	// FDST, FLIS, FCIS, EOF = 11 records
 	numRecords := readUint16BE(data, 76)
-	if numRecords != 8 {
-		t.Errorf("record count: got %d, want 8", numRecords)
+	if numRecords != 11 {
+		t.Fatalf("record count: got %d, want 11", numRecords)
 	}
 
-	// Image at index 2
-	imgRec := extractRecord(data, 2)
-	if !bytes.Equal(imgRec, img1) {
-		t.Error("image record content mismatch")
+	rec0 := extractRecord(data, 0)
+	mobiStart := 16
+
+	fragIndex := readUint32BE(rec0, mobiStart+216)
+	if fragIndex != 2 {
+		t.Errorf("FRAG index: got %d, want 2", fragIndex)
+	}
+	skelIndex := readUint32BE(rec0, mobiStart+220)
+	if skelIndex != 5 {
+		t.Errorf("SKEL index: got %d, want 5", skelIndex)
 	}
 
-	// NCX at index 3
-	ncxRec := extractRecord(data, 3)
-	if !bytes.Equal(ncxRec, ncxData) {
-		t.Error("NCX record content mismatch")
+	for _, idx := range []int{2, 3, 5, 6} {
+		if rec := extractRecord(data, idx); string(rec[:4]) != "INDX" {
+			t.Errorf("record %d: got %q, want INDX", idx, string(rec[:4]))
+		}
 	}
 
-	// FDST at index 4
-	fdstRec := extractRecord(data, 4)
+	fdstRec := extractRecord(data, 7)
 	if string(fdstRec[:4]) != "FDST" {
-		t.Errorf("FDST at index 4: got %q, want FDST", string(fdstRec[:4]))
+		t.Errorf("FDST at index 7: got %q, want FDST", string(fdstRec[:4]))
+	}
+	if flisNum := readUint32BE(rec0, mobiStart+176); flisNum != 8 {
+		t.Errorf("FLISRecordNumber: got %d, want 8", flisNum)
+	}
+
+	// Text length in the PalmDOC header covers the rearranged text flow
+	layout, err := BuildKF8Layout(html, cfg.ChapterIDs)
+	if err != nil {
+		t.Fatalf("BuildKF8Layout failed: %v", err)
+	}
+	if textLen := readUint32BE(rec0, 4); textLen != uint32(len(layout.Text)) {
+		t.Errorf("text length: got %d, want %d", textLen, len(layout.Text))
+	}
+	textRec := extractTextRecord(t, data, 1)
+	if !bytes.Equal(textRec, layout.Text) {
+		t.Error("text record does not match the KF8 layout text")
+	}
+}
+
+func TestWriteTo_WithNCXEntries(t *testing.T) {
+	html := []byte(`<html><head></head><body>` +
+		`<div id="toc"><p>Contents</p></div>` +
+		`<div id="ch01"><h1>One</h1></div>` +
+		`</body></html>`)
+	uid := uint32(12345)
+	creation := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cfg := AZW3WriterConfig{
+		Title:        "Test Book",
+		HTML:         html,
+		UniqueID:     &uid,
+		CreationTime: creation,
+		ChapterIDs:   []string{"ch01"},
+		NCXEntries:   []NCXEntry{{Label: "One", FilePos: 0}},
+		Guide:        []GuideReference{{Type: "toc", Title: "Table of Contents", FilePos: 0}},
+	}
+	w, err := NewAZW3Writer(cfg)
+	if err != nil {
+		t.Fatalf("NewAZW3Writer failed: %v", err)
+	}
+	data := writeToBuffer(t, w)
+
+	// Record0, text×1, NCX×3, FRAG×3, SKEL×2, guide×3, FDST, FLIS, FCIS, EOF = 17
+	numRecords := readUint16BE(data, 76)
+	if numRecords != 17 {
+		t.Fatalf("record count: got %d, want 17", numRecords)
 	}
 
-	// FLIS at index 5
 	rec0 := extractRecord(data, 0)
 	mobiStart := 16
-	flisNum := readUint32BE(rec0, mobiStart+176)
-	if flisNum != 5 {
-		t.Errorf("FLISRecordNumber: got %d, want 5", flisNum)
+	wantIndexes := map[int]uint32{212: 2, 216: 5, 220: 8, 228: 10}
+	for offset, want := range wantIndexes {
+		if got := readUint32BE(rec0, mobiStart+offset); got != want {
+			t.Errorf("MOBI header offset %d: got %d, want %d", offset, got, want)
+		}
 	}
 
-	// FCIS at index 6
-	fcisNum := readUint32BE(rec0, mobiStart+168)
-	if fcisNum != 6 {
-		t.Errorf("FCISRecordNumber: got %d, want 6", fcisNum)
+	ncxHeader := extractRecord(data, 2)
+	if string(ncxHeader[:4]) != "INDX" {
+		t.Fatalf("NCX index magic: got %q, want INDX", string(ncxHeader[:4]))
+	}
+	decoded := decodeIndexEntries(t, ncxHeader, extractRecord(data, 3))
+	if len(decoded) != 1 {
+		t.Fatalf("NCX entries: got %d, want 1", len(decoded))
+	}
+	if label := cncxString(t, [][]byte{extractRecord(data, 4)}, decoded[0].Values[3][0]); label != "One" {
+		t.Errorf("NCX label: got %q, want %q", label, "One")
 	}
 
-	// EXTH 125 should be 8
-	exthStart := 16 + MOBIHeaderSize
-	exthRecordCount := readUint32BE(rec0, exthStart+8)
-	offset := exthStart + 12
-	for i := 0; i < int(exthRecordCount); i++ {
-		recType := readUint32BE(rec0, offset)
-		recLen := readUint32BE(rec0, offset+4)
-		if recType == 125 {
-			val := readUint32BE(rec0, offset+8)
-			if val != 8 {
-				t.Errorf("EXTH 125 (record count): got %d, want 8", val)
-			}
-		}
-		offset += int(recLen)
+	if fdst := extractRecord(data, 13); string(fdst[:4]) != "FDST" {
+		t.Errorf("FDST at index 13: got %q, want FDST", string(fdst[:4]))
 	}
 }
 
-func TestWriteTo_ImageRecordsShiftRecordNumbers(t *testing.T) {
+func TestWriteTo_WithFlows(t *testing.T) {
 	html := generateTestHTML(100)
+	css := []byte("p { margin: 0; }")
+	svg := []byte("<svg></svg>")
 	uid := uint32(12345)
 	creation := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
 
-	img1 := bytes.Repeat([]byte{0xFF}, 50)
-
 	cfg := AZW3WriterConfig{
 		Title:        "Test Book",
 		HTML:         html,
 		UniqueID:     &uid,
 		CreationTime: creation,
-		ImageRecords: [][]byte{img1},
+		Flows:        [][]byte{css, svg},
 	}
 	w, err := NewAZW3Writer(cfg)
 	if err != nil {
@@ -987,39 +1221,199 @@ func TestWriteTo_ImageRecordsShiftRecordNumbers(t *testing.T) {
 	data := writeToBuffer(t, w)
 
 	rec0 := extractRecord(data, 0)
-	mobiStart := 16
+	totalLen := uint32(len(html) + len(css) + len(svg))
+	if textLen := readUint32BE(rec0, 4); textLen != totalLen {
+		t.Errorf("text length: got %d, want %d", textLen, totalLen)
+	}
+	if flowCount := readUint32BE(rec0, 16+236); flowCount != 3 {
+		t.Errorf("FDST flow count: got %d, want 3", flowCount)
+	}
 
-	// With 1 image: Record0, text×1, image×1, FDST, FLIS, FCIS, EOF = 7 records
-	numRecords := readUint16BE(data, 76)
-	if numRecords != 7 {
-		t.Errorf("record count: got %d, want 7", numRecords)
+	textRec := extractTextRecord(t, data, 1)
+	want := append(append(append([]byte{}, html...), css...), svg...)
+	if !bytes.Equal(textRec, want) {
+		t.Error("text record should contain the text flow followed by the extra flows")
 	}
 
-	// FLIS should be at index 4 (0=Record0, 1=text, 2=image, 3=FDST, 4=FLIS)
-	flisNum := readUint32BE(rec0, mobiStart+176)
-	if flisNum != 4 {
-		t.Errorf("FLISRecordNumber: got %d, want 4", flisNum)
+	fdstRec := extractRecord(data, 2)
+	if string(fdstRec[:4]) != "FDST" {
+		t.Fatalf("FDST at index 2: got %q, want FDST", string(fdstRec[:4]))
+	}
+	wantEntries := [][2]uint32{
+		{0, 100},
+		{100, 100 + uint32(len(css))},
+		{100 + uint32(len(css)), totalLen},
+	}
+	for i, e := range wantEntries {
+		start := readUint32BE(fdstRec, 12+i*8)
+		end := readUint32BE(fdstRec, 16+i*8)
+		if start != e[0] || end != e[1] {
+			t.Errorf("FDST entry %d: got [%d, %d], want %v", i, start, end, e)
+		}
 	}
+}
 
-	// FCIS should be at index 5
-	fcisNum := readUint32BE(rec0, mobiStart+168)
-	if fcisNum != 5 {
-		t.Errorf("FCISRecordNumber: got %d, want 5", fcisNum)
+func TestWriteTo_JointMOBI7AndKF8(t *testing.T) {
+	html := generateTestHTML(100)
+	mobi7 := generateTestHTML(5000)
+	uid := uint32(12345)
+	creation := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	coverOffset := uint32(0)
+
+	cfg := AZW3WriterConfig{
+		Title:        "Test Book",
+		HTML:         html,
+		UniqueID:     &uid,
+		CreationTime: creation,
+		ImageRecords: [][]byte{[]byte("IMAGEDATA")},
+		CoverOffset:  &coverOffset,
+		MOBI7HTML:    mobi7,
+	}
+	w, err := NewAZW3Writer(cfg)
+	if err != nil {
+		t.Fatalf("NewAZW3Writer failed: %v", err)
 	}
+	data := writeToBuffer(t, w)
 
-	// EXTH 125 should be 7
-	exthStart := 16 + MOBIHeaderSize
+	// MOBI7: Record0, text×2; BOUNDARY;
+	// KF8: Record0, text×1, image×1, FDST, FLIS, FCIS, EOF = 11 records
+	numRecords := readUint16BE(data, 76)
+	if numRecords != 11 {
+		t.Fatalf("record count: got %d, want 11", numRecords)
+	}
+
+	mobiStart := 16
+	rec0 := extractRecord(data, 0)
+	if got := readUint32BE(rec0, mobiStart+8); got != MOBITypeBook {
+		t.Errorf("MOBI7 type: got %d, want %d", got, MOBITypeBook)
+	}
+	if got := readUint32BE(rec0, mobiStart+20); got != FileVersionMOBI7 {
+		t.Errorf("MOBI7 file version: got %d, want %d", got, FileVersionMOBI7)
+	}
+	if got := readUint32BE(rec0, 4); got != uint32(len(mobi7)) {
+		t.Errorf("MOBI7 text length: got %d, want %d", got, len(mobi7))
+	}
+	if got := readUint16BE(rec0, mobiStart+162); got != 2 {
+		t.Errorf("MOBI7 last content record: got %d, want 2", got)
+	}
+	// The image record lives in the KF8 section at absolute record 6
+	if got := readUint32BE(rec0, mobiStart+80); got != 6 {
+		t.Errorf("MOBI7 first image index: got %d, want 6", got)
+	}
+
+	// EXTH 121 points at the KF8 Record 0; EXTH 125 counts all records
+	exthStart := mobiStart + MOBIHeaderSize
 	exthRecordCount := readUint32BE(rec0, exthStart+8)
 	offset := exthStart + 12
+	found := map[uint32]uint32{}
 	for i := 0; i < int(exthRecordCount); i++ {
 		recType := readUint32BE(rec0, offset)
 		recLen := readUint32BE(rec0, offset+4)
-		if recType == 125 {
-			val := readUint32BE(rec0, offset+8)
-			if val != 7 {
-				t.Errorf("EXTH 125 (record count): got %d, want 7", val)
-			}
+		if recLen == 12 {
+			found[recType] = readUint32BE(rec0, offset+8)
 		}
 		offset += int(recLen)
 	}
+	if found[121] != 4 {
+		t.Errorf("EXTH 121: got %d, want 4", found[121])
+	}
+	if found[125] != 11 {
+		t.Errorf("EXTH 125: got %d, want 11", found[125])
+	}
+
+	if boundary := extractRecord(data, 3); string(boundary) != "BOUNDARY" {
+		t.Errorf("record 3: got %q, want BOUNDARY", boundary)
+	}
+
+	kf8Rec0 := extractRecord(data, 4)
+	if got := readUint32BE(kf8Rec0, mobiStart+8); got != MOBITypeKF8 {
+		t.Errorf("KF8 type: got %d, want %d", got, MOBITypeKF8)
+	}
+	// KF8 record numbers are relative to the KF8 Record 0
+	if got := readUint32BE(kf8Rec0, mobiStart+80); got != 2 {
+		t.Errorf("KF8 first image index: got %d, want 2", got)
+	}
+	if got := extractTextRecord(t, data, 5); !bytes.Equal(got, html) {
+		t.Error("KF8 text record mismatch")
+	}
+	if got := extractRecord(data, 6); string(got) != "IMAGEDATA" {
+		t.Errorf("image record: got %q", got)
+	}
+	if eof := extractRecord(data, 10); !bytes.Equal(eof, EOFRecord()) {
+		t.Error("last record should be EOF")
+	}
+}
+
+func TestWriteTo_WithRESC(t *testing.T) {
+	uid := uint32(12345)
+	resc := &RESC{
+		PageProgressionDirection: "rtl",
+		Spine:                    []RESCSpineItem{{IDRef: "ch1", SkeletonID: 0, Linear: true, Properties: []string{"page-spread-right"}}},
+	}
+
+	t.Run("after the images", func(t *testing.T) {
+		img := bytes.Repeat([]byte{0xFF}, 100)
+		w, err := NewAZW3Writer(AZW3WriterConfig{
+			Title:        "Test Book",
+			HTML:         generateTestHTML(100),
+			UniqueID:     &uid,
+			ImageRecords: [][]byte{img},
+			RESC:         resc,
+		})
+		if err != nil {
+			t.Fatalf("NewAZW3Writer failed: %v", err)
+		}
+		data := writeToBuffer(t, w)
+
+		if got := readUint32BE(extractRecord(data, 0), 16+80); got != 2 {
+			t.Errorf("FirstImageIndex: got %d, want 2", got)
+		}
+		if !bytes.Equal(extractRecord(data, 2), img) {
+			t.Error("image record moved by the RESC record")
+		}
+		if rec := extractRecord(data, 3); string(rec[:4]) != "RESC" {
+			t.Errorf("record 3: got %q, want RESC", rec[:4])
+		}
+		if got := readUint32BE(extractRecord(data, 0), 16+232); got != 3 {
+			t.Errorf("RESCIndex: got %d, want 3", got)
+		}
+		if fdst := extractRecord(data, 4); string(fdst[:4]) != "FDST" {
+			t.Errorf("record 4: got %q, want FDST", fdst[:4])
+		}
+	})
+
+	t.Run("without images", func(t *testing.T) {
+		w, err := NewAZW3Writer(AZW3WriterConfig{
+			Title:    "Test Book",
+			HTML:     generateTestHTML(100),
+			UniqueID: &uid,
+			RESC:     resc,
+		})
+		if err != nil {
+			t.Fatalf("NewAZW3Writer failed: %v", err)
+		}
+		data := writeToBuffer(t, w)
+
+		if got := readUint32BE(extractRecord(data, 0), 16+80); got != NullIndex {
+			t.Errorf("FirstImageIndex: got %d, want NullIndex", got)
+		}
+		if got := readUint32BE(extractRecord(data, 0), 16+232); got != 2 {
+			t.Errorf("RESCIndex: got %d, want 2", got)
+		}
+
+		r, err := NewReader(data)
+		if err != nil {
+			t.Fatalf("NewReader() error = %v", err)
+		}
+		got, err := r.RESC(r.KF8())
+		if err != nil {
+			t.Fatalf("RESC() error = %v", err)
+		}
+		if got == nil || got.PageProgressionDirection != "rtl" || len(got.Spine) != 1 || got.Spine[0].Properties[0] != "page-spread-right" {
+			t.Errorf("RESC() = %+v", got)
+		}
+		if issues := Verify(data); len(issues) != 0 {
+			t.Errorf("Verify() = %v", issues)
+		}
+	})
 }